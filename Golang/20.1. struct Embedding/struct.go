@@ -5,15 +5,17 @@ import (
 	"time"
 )
 
+// phone is a string, not an int: an int would drop the leading "+" and
+// zeros. 29. Packages/customer has the validated version.
 type customer struct {
-	name        string
-	phoneNumber int
+	name  string
+	phone string
 }
 type order struct {
-	id        int
-	status    string
-	country   string
-	recivedAt time.Time
+	id         int
+	status     string
+	country    string
+	receivedAt time.Time
 	customer
 }
 
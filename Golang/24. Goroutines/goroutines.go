@@ -19,5 +19,8 @@ func main() {
 		}(i) // Use an anonymous function to capture the loop variable
 	}
 
+	// Sleeping only guesses how long the goroutines need. The taskgroup
+	// package in "29. Packages" waits for them properly; its Example shows
+	// this loop converted.
 	time.Sleep(time.Second * 2) // Wait for goroutines to finish
 }
@@ -18,6 +18,8 @@ func main() {
 		go task(i, &wg)
 	}
 
-	// Wait for all goroutines to finish
+	// Wait for all goroutines to finish. The taskgroup package in
+	// "29. Packages" does the Add/Done bookkeeping and collects errors;
+	// see ExampleWithLimit there for this program converted.
 	wg.Wait()
 }
@@ -0,0 +1,119 @@
+// Command orderd runs the order REST API backed by a file store.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/inventory"
+	"github.com/rajasur/programming-learning/GO/order"
+	"github.com/rajasur/programming-learning/GO/order/api"
+	"github.com/rajasur/programming-learning/GO/order/deadline"
+	"github.com/rajasur/programming-learning/GO/order/store"
+	"github.com/rajasur/programming-learning/GO/order/track"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "listen address")
+	data := flag.String("data", "orders.log", "order log file")
+	state := flag.String("state", "WB", "seller state for GST")
+	cancelAfter := flag.Duration("cancel-after", 30*time.Minute, "cancel orders still received after this long")
+	payWithin := flag.Duration("pay-within", 24*time.Hour, "fail orders not paid for within this long")
+	stock := flag.String("stock", "", `opening stock as JSON, e.g. {"pen": 10}; stock isn't tracked without it`)
+	location := flag.String("location", "main", "location the stock is held at")
+	holdFor := flag.Duration("hold-for", 15*time.Minute, "how long new orders hold their stock before it is released")
+	flag.Parse()
+
+	st, err := store.OpenFile(*data, store.FileOptions{CompactInterval: time.Hour})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer st.Close()
+
+	journal, err := deadline.OpenJournal(*data+".deadlines", false)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer journal.Close()
+	sched, err := deadline.New(journal)
+	if err != nil {
+		log.Fatal(err)
+	}
+	scheduleDeadlines, clearDeadlines := sched.Watch(deadline.Policy{CancelAfter: *cancelAfter, PayWithin: *payWithin})
+
+	gst := order.GST{Rate: 1800, SellerState: *state}
+	hub := track.NewHub()
+	opts := []api.Option{
+		api.WithTaxRuleFor(func(o *order.Order) order.TaxRule { return gst.ForBuyer(o.Customer) }),
+		api.OnStatusChange(hub.Publish),
+		api.OnCreate(scheduleDeadlines),
+		api.OnStatusChange(clearDeadlines),
+	}
+
+	var inv *inventory.Inventory
+	if *stock != "" {
+		inv = inventory.New(inventory.WithReservationTTL(*holdFor))
+		if err := loadStock(inv, *stock, *location); err != nil {
+			log.Fatal(err)
+		}
+		machine := order.NewStatusMachine(order.DefaultTransitions)
+		inv.Attach(machine, func(err error) { log.Println(err) })
+		opts = append(opts,
+			api.WithStatusMachine(machine),
+			api.BeforeCreate(func(o *order.Order) error {
+				_, err := inv.ReserveOrder(o, *location)
+				return err
+			}, func(o *order.Order) {
+				inv.Release(o.ID, "order not saved", "")
+			}),
+		)
+	}
+	srv := api.NewServer(st, opts...)
+	// deadlines change orders through the server so they take its lock
+	// and reach the hooks above
+	sched.HandleOrders(srv)
+	srv.Handle("GET /orders/{id}/events", hub.OrderEvents())
+	srv.Handle("GET /customers/{phone}/events", hub.CustomerEvents())
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		hub.Close()
+	}()
+	go sched.Run(ctx)
+	if inv != nil {
+		go inv.Run(ctx, time.Minute)
+	}
+
+	log.Println("listening on", *addr)
+	if err := api.ListenAndServe(ctx, *addr, srv, 10*time.Second); err != nil {
+		log.Println(err)
+	}
+}
+
+// loadStock adds the units in path, a JSON object of SKU to units on
+// hand, to inv at location.
+func loadStock(inv *inventory.Inventory, path, location string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var units map[string]int64
+	if err := json.Unmarshal(b, &units); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for sku, n := range units {
+		if _, err := inv.Adjust(inventory.Key{SKU: sku, Location: location}, n, "opening stock", "orderd"); err != nil {
+			return fmt.Errorf("%s: %s: %w", path, sku, err)
+		}
+	}
+	return nil
+}
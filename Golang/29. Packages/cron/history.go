@@ -0,0 +1,95 @@
+package cron
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/enum"
+)
+
+// Outcome is what happened to one activation of a job.
+type Outcome int
+
+const (
+	Succeeded Outcome = iota
+	Failed
+	Overlapped // not run, the previous run was still going
+	Missed     // not run, dropped by the missed-run policy
+)
+
+var outcomes = enum.New("Outcome", map[Outcome]string{
+	Succeeded:  "succeeded",
+	Failed:     "failed",
+	Overlapped: "overlapped",
+	Missed:     "missed",
+})
+
+func (o Outcome) String() string                { return outcomes.Name(o) }
+func (o Outcome) MarshalText() ([]byte, error)  { return outcomes.MarshalText(o) }
+func (o *Outcome) UnmarshalText(b []byte) error { return outcomes.UnmarshalText(b, o) }
+
+// Run records one activation. Started and Duration are zero when the job
+// did not run. A Missed run can stand for every activation from Scheduled
+// to Through.
+type Run struct {
+	Job       string        `json:"job"`
+	Scheduled time.Time     `json:"scheduled"`
+	Through   time.Time     `json:"through,omitzero"`
+	Started   time.Time     `json:"started,omitzero"`
+	Duration  time.Duration `json:"duration,omitempty"`
+	Outcome   Outcome       `json:"outcome"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// jobState is what the state file keeps per job: the last activation dealt
+// with, so missed ones can be found after a restart, and recent runs.
+// The running flag lives here rather than on the job so that a job removed
+// and added again under the same name while it runs still doesn't overlap.
+type jobState struct {
+	Last    time.Time `json:"last"`
+	History []Run     `json:"history,omitempty"`
+	running bool
+}
+
+func loadState(path string) (map[string]*jobState, error) {
+	state := make(map[string]*jobState)
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// saveState writes to a temporary file and renames it into place, so a
+// crash leaves either the old state or the new.
+func saveState(path string, state map[string]*jobState) error {
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,436 @@
+// Package cron runs jobs on cron schedules.
+//
+//	s, _ := cron.New(cron.WithStateFile("cron.json"), cron.WithLocation(invoice.IST))
+//	s.Add("renewals", "0 2 * * *", billRenewals, cron.WithMissed(cron.RunAll))
+//	s.Add("cleanup", "@every 15m", cleanup)
+//	go s.Run(ctx)
+//
+// A job never overlaps itself: an activation that comes due while the
+// previous run is still going is recorded as Overlapped and dropped.
+// Activations missed while the process was down or asleep are handled by
+// the job's MissedPolicy, using the last activation saved in the state
+// file.
+//
+// Everything time related goes through the clock given to WithClock, and
+// RunDue runs whatever is due at a given instant, so schedules can be
+// stepped through deterministically, daylight saving changes included.
+package cron
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/enum"
+)
+
+var (
+	ErrExists   = errors.New("cron: job already exists")
+	ErrNotFound = errors.New("cron: no such job")
+)
+
+// MissedPolicy decides what happens to activations that came due while
+// nothing was checking, such as during downtime.
+type MissedPolicy int
+
+const (
+	RunOnce MissedPolicy = iota // run once for all of them
+	Skip                        // run none of them
+	RunAll                      // run each one in turn, up to MaxCatchUp
+)
+
+var missedPolicies = enum.New("MissedPolicy", map[MissedPolicy]string{
+	RunOnce: "run_once",
+	Skip:    "skip",
+	RunAll:  "run_all",
+})
+
+func (p MissedPolicy) String() string                { return missedPolicies.Name(p) }
+func (p MissedPolicy) MarshalText() ([]byte, error)  { return missedPolicies.MarshalText(p) }
+func (p *MissedPolicy) UnmarshalText(b []byte) error { return missedPolicies.UnmarshalText(b, p) }
+
+// MaxCatchUp bounds how many missed activations RunAll runs; older ones are
+// recorded as Missed.
+const MaxCatchUp = 100
+
+// Func is a job. scheduled is the activation being run, which under RunAll
+// can be well in the past.
+type Func func(ctx context.Context, scheduled time.Time) error
+
+type job struct {
+	name     string
+	spec     string
+	schedule Schedule
+	fn       Func
+	missed   MissedPolicy
+	timeout  time.Duration
+	next     time.Time
+	state    *jobState
+}
+
+type Scheduler struct {
+	loc     *time.Location
+	now     func() time.Time
+	grace   time.Duration
+	history int
+	path    string
+	logf    func(format string, args ...any)
+
+	mu    sync.Mutex
+	jobs  map[string]*job
+	state map[string]*jobState
+	wake  chan struct{}
+	wg    sync.WaitGroup
+}
+
+type Option func(*Scheduler)
+
+// WithLocation sets the zone expressions are read in, time.Local by
+// default. A CRON_TZ prefix on an expression overrides it.
+func WithLocation(loc *time.Location) Option {
+	return func(s *Scheduler) { s.loc = loc }
+}
+
+// WithClock sets the clock. Run still sleeps in real time, so tests should
+// drive the scheduler with RunDue.
+func WithClock(now func() time.Time) Option {
+	return func(s *Scheduler) { s.now = now }
+}
+
+// WithGrace sets how late an activation can be and still count as on
+// time rather than missed, 1 minute by default.
+func WithGrace(d time.Duration) Option {
+	return func(s *Scheduler) { s.grace = d }
+}
+
+// WithHistory keeps the last n runs of each job, 50 by default.
+func WithHistory(n int) Option {
+	return func(s *Scheduler) { s.history = n }
+}
+
+// WithStateFile keeps each job's last activation and history in path, so
+// missed activations are caught up after a restart.
+func WithStateFile(path string) Option {
+	return func(s *Scheduler) { s.path = path }
+}
+
+// WithLogger sets where failed runs and state file errors are reported.
+func WithLogger(logf func(format string, args ...any)) Option {
+	return func(s *Scheduler) { s.logf = logf }
+}
+
+func New(opts ...Option) (*Scheduler, error) {
+	s := &Scheduler{
+		loc:     time.Local,
+		now:     time.Now,
+		grace:   time.Minute,
+		history: 50,
+		logf:    log.Printf,
+		jobs:    make(map[string]*job),
+		state:   make(map[string]*jobState),
+		wake:    make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.path != "" {
+		state, err := loadState(s.path)
+		if err != nil {
+			return nil, fmt.Errorf("cron: loading %s: %w", s.path, err)
+		}
+		s.state = state
+	}
+	return s, nil
+}
+
+type JobOption func(*job)
+
+// WithMissed sets the job's missed-run policy, RunOnce by default.
+func WithMissed(p MissedPolicy) JobOption {
+	return func(j *job) { j.missed = p }
+}
+
+// WithTimeout cancels the context of each run after d.
+func WithTimeout(d time.Duration) JobOption {
+	return func(j *job) { j.timeout = d }
+}
+
+// Add schedules fn under name. If the state file knows the job, its next
+// activation follows the last one recorded, so any missed while the
+// process was down are due straight away.
+func (s *Scheduler) Add(name, spec string, fn Func, opts ...JobOption) error {
+	sched, err := Parse(spec, s.loc)
+	if err != nil {
+		return err
+	}
+	return s.AddSchedule(name, sched, fn, opts...)
+}
+
+// AddSchedule is Add with a schedule other than a cron expression.
+func (s *Scheduler) AddSchedule(name string, sched Schedule, fn Func, opts ...JobOption) error {
+	j := &job{name: name, schedule: sched, fn: fn}
+	for _, opt := range opts {
+		opt(j)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[name]; ok {
+		return fmt.Errorf("%w: %s", ErrExists, name)
+	}
+	j.state = s.state[name]
+	if j.state == nil {
+		j.state = &jobState{Last: s.now()}
+		s.state[name] = j.state
+	}
+	j.next = sched.Next(j.state.Last)
+	s.jobs[name] = j
+	s.poke()
+	return nil
+}
+
+// Remove unschedules a job. A run in progress finishes.
+func (s *Scheduler) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	delete(s.jobs, name)
+	s.poke()
+	return nil
+}
+
+func (s *Scheduler) poke() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Next returns a job's next activation.
+func (s *Scheduler) Next(name string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[name]
+	if !ok {
+		return time.Time{}, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return j.next, nil
+}
+
+// History returns a job's recent runs, oldest first.
+func (s *Scheduler) History(name string) []Run {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if st := s.state[name]; st != nil {
+		return slices.Clone(st.History)
+	}
+	return nil
+}
+
+// Run runs jobs as they come due until ctx is done, then waits for runs in
+// progress, whose contexts are cancelled too.
+func (s *Scheduler) Run(ctx context.Context) error {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			s.Wait()
+			return ctx.Err()
+		case <-timer.C:
+		case <-s.wake:
+		}
+		now := s.now()
+		s.RunDue(ctx, now)
+
+		wait := time.Hour
+		s.mu.Lock()
+		for _, j := range s.jobs {
+			if !j.next.IsZero() {
+				wait = min(wait, j.next.Sub(now))
+			}
+		}
+		s.mu.Unlock()
+		timer.Reset(max(wait, 0))
+	}
+}
+
+// Wait waits for the runs in progress.
+func (s *Scheduler) Wait() { s.wg.Wait() }
+
+// RunDue starts every activation due at now, each job's runs on its own
+// goroutine, and returns the number of runs started. Run calls it; tests
+// can call it directly with a fake time and then Wait.
+func (s *Scheduler) RunDue(ctx context.Context, now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	started := 0
+	for _, name := range slices.Sorted(maps.Keys(s.jobs)) {
+		j := s.jobs[name]
+		if j.next.IsZero() || j.next.After(now) {
+			continue
+		}
+		runs := s.applyPolicy(j, now)
+		j.next = j.schedule.Next(j.state.Last)
+		if len(runs) == 0 {
+			s.save()
+			continue
+		}
+		if j.state.running {
+			for _, at := range runs {
+				s.record(j, Run{Scheduled: at, Outcome: Overlapped})
+			}
+			s.save()
+			continue
+		}
+		j.state.running = true
+		started += len(runs)
+		s.wg.Add(1)
+		go s.execute(ctx, j, runs)
+	}
+	return started
+}
+
+// applyPolicy returns the activations from j.next up to now that the
+// policy runs, and records the ones it drops as a single Missed run. The
+// newest activation is on time if it is within the grace period. Only the
+// activations that run are stepped through, so a job that has been down
+// for months costs no more than one that missed a minute.
+func (s *Scheduler) applyPolicy(j *job, now time.Time) []time.Time {
+	first := j.next
+	last := lastActivation(j.schedule, first, now)
+	j.state.Last = last
+	onTime := now.Sub(last) <= s.grace
+
+	var runs []time.Time
+	switch {
+	case first.Equal(last) && onTime:
+		return []time.Time{last}
+	case j.missed == RunAll:
+		runs = []time.Time{last}
+		for len(runs) < MaxCatchUp && runs[0].After(first) {
+			runs = slices.Insert(runs, 0, lastActivation(j.schedule, first, runs[0].Add(-time.Nanosecond)))
+		}
+	case j.missed == RunOnce || onTime:
+		runs = []time.Time{last}
+	}
+
+	// everything from first up to the earliest run was dropped
+	if len(runs) == 0 {
+		s.recordMissed(j, first, last)
+	} else if runs[0].After(first) {
+		s.recordMissed(j, first, lastActivation(j.schedule, first, runs[0].Add(-time.Nanosecond)))
+	}
+	return runs
+}
+
+func (s *Scheduler) recordMissed(j *job, first, last time.Time) {
+	r := Run{Scheduled: first, Outcome: Missed}
+	if last.After(first) {
+		r.Through = last
+	}
+	s.record(j, r)
+}
+
+// lastActivation returns the last activation of sched at or before t,
+// given that from, at or before t, is one. An Every schedule is counted
+// directly; anything else is found by a binary search on Next, which never
+// goes backwards, so the cost grows with the log of the gap.
+func lastActivation(sched Schedule, from, t time.Time) time.Time {
+	due := func(at time.Time) bool {
+		next := sched.Next(at)
+		return !next.IsZero() && !next.After(t)
+	}
+	if !due(from) {
+		return from
+	}
+	if e, ok := sched.(Every); ok {
+		d := time.Duration(e)
+		return from.Add(t.Sub(from) / d * d)
+	}
+
+	// lo has an activation after it by t and hi has none; widen the
+	// window back from t until it holds one, then narrow it to a second,
+	// which holds at most one activation
+	lo, hi := from, t
+	for d := time.Minute; ; d *= 2 {
+		at := t.Add(-d)
+		if !at.After(from) {
+			break
+		}
+		if due(at) {
+			lo = at
+			break
+		}
+		hi = at
+	}
+	for hi.Sub(lo) > time.Second {
+		mid := lo.Add(hi.Sub(lo) / 2)
+		if due(mid) {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return sched.Next(lo)
+}
+
+func (s *Scheduler) execute(ctx context.Context, j *job, runs []time.Time) {
+	defer s.wg.Done()
+	for _, at := range runs {
+		started := s.now()
+		err := s.call(ctx, j, at)
+		r := Run{Scheduled: at, Started: started, Duration: s.now().Sub(started)}
+		if err != nil {
+			r.Outcome, r.Error = Failed, err.Error()
+			s.logf("cron: %s run for %s failed: %v", j.name, at.Format(time.RFC3339), err)
+		}
+		s.mu.Lock()
+		s.record(j, r)
+		s.save()
+		s.mu.Unlock()
+	}
+	s.mu.Lock()
+	j.state.running = false
+	s.mu.Unlock()
+}
+
+func (s *Scheduler) call(ctx context.Context, j *job, at time.Time) (err error) {
+	if j.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, j.timeout)
+		defer cancel()
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return j.fn(ctx, at)
+}
+
+func (s *Scheduler) record(j *job, r Run) {
+	r.Job = j.name
+	st := j.state
+	st.History = append(st.History, r)
+	if over := len(st.History) - s.history; over > 0 {
+		st.History = slices.Delete(st.History, 0, over)
+	}
+}
+
+func (s *Scheduler) save() {
+	if s.path == "" {
+		return
+	}
+	if err := saveState(s.path, s.state); err != nil {
+		s.logf("cron: saving %s: %v", s.path, err)
+	}
+}
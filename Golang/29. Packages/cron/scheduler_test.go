@@ -0,0 +1,463 @@
+package cron
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+// clock is a fake time source for WithClock.
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Set(t time.Time) {
+	c.mu.Lock()
+	c.now = t
+	c.mu.Unlock()
+}
+
+func newYork(t *testing.T) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func newScheduler(t *testing.T, c *clock, opts ...Option) *Scheduler {
+	t.Helper()
+	s, err := New(append([]Option{WithClock(c.Now), WithLogger(func(string, ...any) {})}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// recorder is a job that notes the activations it ran for.
+type recorder struct {
+	mu  sync.Mutex
+	ran []time.Time
+}
+
+func (r *recorder) run(_ context.Context, at time.Time) error {
+	r.mu.Lock()
+	r.ran = append(r.ran, at)
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *recorder) times() []time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.ran)
+}
+
+func TestNextDST(t *testing.T) {
+	ny := newYork(t)
+	tests := []struct {
+		name string
+		spec string
+		from time.Time
+		want []string // RFC 3339 in New York
+	}{
+		{
+			// 02:00 jumps to 03:00 on 8 March 2026
+			name: "spring forward runs skipped times at the change",
+			spec: "30 2 * * *",
+			from: time.Date(2026, time.March, 6, 12, 0, 0, 0, ny),
+			want: []string{"2026-03-07T02:30:00-05:00", "2026-03-08T03:00:00-04:00", "2026-03-09T02:30:00-04:00"},
+		},
+		{
+			// 02:00 falls back to 01:00 on 1 November 2026
+			name: "fall back runs a repeated time once",
+			spec: "30 1 * * *",
+			from: time.Date(2026, time.October, 31, 12, 0, 0, 0, ny),
+			want: []string{"2026-11-01T01:30:00-04:00", "2026-11-02T01:30:00-05:00"},
+		},
+		{
+			name: "hourly is an hour apart in real time across fall back",
+			spec: "0 * * * *",
+			from: time.Date(2026, time.November, 1, 0, 30, 0, 0, ny),
+			want: []string{"2026-11-01T01:00:00-04:00", "2026-11-01T02:00:00-05:00", "2026-11-01T03:00:00-05:00"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sched := MustParse(tt.spec, ny)
+			at := tt.from
+			var got []string
+			for range tt.want {
+				at = sched.Next(at)
+				got = append(got, at.In(ny).Format(time.RFC3339))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Stepping the fake clock through the spring-forward night runs a job
+// set for 02:30 exactly once, at 03:00.
+func TestRunDueSpringForward(t *testing.T) {
+	ny := newYork(t)
+	c := &clock{now: time.Date(2026, time.March, 8, 0, 0, 0, 0, ny)}
+	s := newScheduler(t, c, WithLocation(ny))
+	var r recorder
+	if err := s.Add("report", "30 2 * * *", r.run); err != nil {
+		t.Fatal(err)
+	}
+	for now := c.Now(); now.Before(time.Date(2026, time.March, 8, 6, 0, 0, 0, ny)); now = now.Add(time.Minute) {
+		c.Set(now)
+		s.RunDue(context.Background(), now)
+		s.Wait()
+	}
+	want := []time.Time{time.Date(2026, time.March, 8, 3, 0, 0, 0, ny)}
+	if got := r.times(); !slices.EqualFunc(got, want, time.Time.Equal) {
+		t.Errorf("ran at %v, want %v", got, want)
+	}
+}
+
+// Across fall back a job at 01:30 runs once, not at both 01:30s.
+func TestRunDueFallBack(t *testing.T) {
+	ny := newYork(t)
+	start := time.Date(2026, time.November, 1, 0, 0, 0, 0, ny)
+	c := &clock{now: start}
+	s := newScheduler(t, c, WithLocation(ny))
+	var r recorder
+	if err := s.Add("report", "30 1 * * *", r.run); err != nil {
+		t.Fatal(err)
+	}
+	// 4 real hours cover 00:00 EDT to 03:00 EST
+	for now := start; now.Before(start.Add(4 * time.Hour)); now = now.Add(time.Minute) {
+		c.Set(now)
+		s.RunDue(context.Background(), now)
+		s.Wait()
+	}
+	got := r.times()
+	if len(got) != 1 || got[0].In(ny).Format(time.RFC3339) != "2026-11-01T01:30:00-04:00" {
+		t.Errorf("ran at %v, want once at 01:30 EDT", got)
+	}
+}
+
+func TestMissedPolicies(t *testing.T) {
+	start := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	// a year of minutes went by unnoticed
+	now := start.Add(365*24*time.Hour + 30*time.Second)
+	lastDue := now.Truncate(time.Minute)
+	tests := []struct {
+		policy MissedPolicy
+		spec   string
+		runs   int
+	}{
+		{Skip, "* * * * *", 1}, // the newest is within the grace period
+		{RunOnce, "* * * * *", 1},
+		{RunAll, "* * * * *", MaxCatchUp},
+		{Skip, "@every 1m", 1},
+		{RunAll, "@every 1m", MaxCatchUp},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy.String()+"/"+tt.spec, func(t *testing.T) {
+			c := &clock{now: start}
+			s := newScheduler(t, c, WithLocation(time.UTC), WithHistory(2*MaxCatchUp))
+			var r recorder
+			if err := s.Add("job", tt.spec, r.run, WithMissed(tt.policy)); err != nil {
+				t.Fatal(err)
+			}
+			c.Set(now)
+			if n := s.RunDue(context.Background(), now); n != tt.runs {
+				t.Fatalf("RunDue started %d runs, want %d", n, tt.runs)
+			}
+			s.Wait()
+
+			got := r.times()
+			if !got[len(got)-1].Equal(lastDue) {
+				t.Errorf("newest run for %v, want %v", got[len(got)-1], lastDue)
+			}
+			for i := 1; i < len(got); i++ {
+				if got[i].Sub(got[i-1]) != time.Minute {
+					t.Fatalf("runs %v and %v are not a minute apart", got[i-1], got[i])
+				}
+			}
+
+			var missed []Run
+			for _, run := range s.History("job") {
+				if run.Outcome == Missed {
+					missed = append(missed, run)
+				}
+			}
+			firstRun := got[0]
+			if len(missed) != 1 || !missed[0].Scheduled.Equal(start.Add(time.Minute)) || !missed[0].Through.Equal(firstRun.Add(-time.Minute)) {
+				t.Errorf("missed = %+v, want one entry from %v through %v", missed, start.Add(time.Minute), firstRun.Add(-time.Minute))
+			}
+			if next, _ := s.Next("job"); !next.Equal(lastDue.Add(time.Minute)) {
+				t.Errorf("Next = %v, want %v", next, lastDue.Add(time.Minute))
+			}
+		})
+	}
+}
+
+func TestSkipLate(t *testing.T) {
+	start := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	c := &clock{now: start}
+	s := newScheduler(t, c, WithLocation(time.UTC))
+	var r recorder
+	s.Add("job", "0 2 * * *", r.run, WithMissed(Skip))
+
+	now := start.Add(10*24*time.Hour + 5*time.Hour) // 05:00, three hours late
+	if n := s.RunDue(context.Background(), now); n != 0 {
+		t.Fatalf("RunDue started %d runs, want 0", n)
+	}
+	h := s.History("job")
+	if len(h) != 1 || h[0].Outcome != Missed || h[0].Scheduled.Day() != 1 || h[0].Through.Day() != 11 {
+		t.Errorf("history = %+v, want one Missed entry for 1 to 11 January", h)
+	}
+}
+
+func TestRestartCatchUp(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cron.json")
+	start := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	c := &clock{now: start}
+	s := newScheduler(t, c, WithLocation(time.UTC), WithStateFile(path))
+	var r recorder
+	s.Add("renewals", "0 2 * * *", r.run, WithMissed(RunAll))
+	at := start.Add(2 * time.Hour)
+	c.Set(at)
+	s.RunDue(context.Background(), at)
+	s.Wait()
+
+	// down for three days
+	c.Set(at.Add(3*24*time.Hour + time.Hour))
+	s = newScheduler(t, c, WithLocation(time.UTC), WithStateFile(path))
+	s.Add("renewals", "0 2 * * *", r.run, WithMissed(RunAll))
+	if n := s.RunDue(context.Background(), c.Now()); n != 3 {
+		t.Fatalf("caught up %d runs, want 3", n)
+	}
+	s.Wait()
+	if got := r.times(); len(got) != 4 || got[3].Day() != 4 {
+		t.Errorf("ran %v", got)
+	}
+}
+
+// A job removed and added again while a run is still going must not start
+// a second run alongside it.
+func TestNoOverlapAcrossReAdd(t *testing.T) {
+	start := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	c := &clock{now: start}
+	s := newScheduler(t, c, WithLocation(time.UTC))
+	release := make(chan struct{})
+	started := make(chan struct{}, 10)
+	slow := func(ctx context.Context, at time.Time) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	}
+	s.Add("job", "* * * * *", slow)
+	if n := s.RunDue(context.Background(), start.Add(time.Minute)); n != 1 {
+		t.Fatalf("started %d runs", n)
+	}
+	<-started
+
+	if err := s.Remove("job"); err != nil {
+		t.Fatal(err)
+	}
+	c.Set(start.Add(time.Minute))
+	if err := s.Add("job", "* * * * *", slow); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.RunDue(context.Background(), start.Add(2*time.Minute)); n != 0 {
+		t.Errorf("started %d runs while the first is still going", n)
+	}
+	close(release)
+	s.Wait()
+
+	var outcomes []Outcome
+	for _, r := range s.History("job") {
+		outcomes = append(outcomes, r.Outcome)
+	}
+	if !slices.Equal(outcomes, []Outcome{Overlapped, Succeeded}) {
+		t.Errorf("history outcomes = %v, want overlapped then succeeded", outcomes)
+	}
+	if n := s.RunDue(context.Background(), start.Add(3*time.Minute)); n != 1 {
+		t.Errorf("started %d runs after the first finished, want 1", n)
+	}
+	s.Wait()
+}
+
+func TestLastActivation(t *testing.T) {
+	sched := MustParse("0 9 * * mon-fri", time.UTC)
+	from := time.Date(2026, time.January, 1, 9, 0, 0, 0, time.UTC) // a Thursday
+	var want time.Time
+	for at := from; !at.After(from.AddDate(3, 0, 0)); at = sched.Next(at) {
+		want = at
+	}
+	if got := lastActivation(sched, from, from.AddDate(3, 0, 0)); !got.Equal(want) {
+		t.Errorf("lastActivation = %v, want %v", got, want)
+	}
+	if got := lastActivation(sched, from, from.Add(time.Hour)); !got.Equal(from) {
+		t.Errorf("lastActivation with nothing newer = %v, want %v", got, from)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		spec, field, msg string
+	}{
+		{"* * * *", "", "want 5 fields, got 4"},
+		{"60 * * * *", "minute", "60 is outside 0-59"},
+		{"* x * * *", "hour", `"x" is not a number`},
+		{"* * 0 * *", "day-of-month", "0 is outside 1-31"},
+		{"* * * foo *", "month", `"foo" is not a number`},
+		{"* * 20-10 * *", "day-of-month", "range 20-10 is backwards"},
+		{"* * * * fri-mon", "day-of-week", "range fri-mon is backwards"},
+		{"*/0 * * * *", "minute", `bad step "0"`},
+		{"0-30/x * * * *", "minute", `bad step "x"`},
+		{"@fortnightly", "", "unknown descriptor @fortnightly"},
+		{"@every 500ms", "", "@every needs a duration of at least 1s"},
+		{"CRON_TZ=Mars/Olympus 0 * * * *", "", `unknown time zone "Mars/Olympus"`},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.spec, time.UTC)
+		var pe *ParseError
+		if !errors.As(err, &pe) || pe.Spec != tt.spec || pe.Field != tt.field || pe.Msg != tt.msg {
+			t.Errorf("Parse(%q) = %v, want %s field: %s", tt.spec, err, tt.field, tt.msg)
+		}
+	}
+
+	_, err := Parse("*/0 * * * *", time.UTC)
+	if want := `cron: "*/0 * * * *": minute field: bad step "0"`; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err, want)
+	}
+	_, err = Parse("@fortnightly", time.UTC)
+	if want := `cron: "@fortnightly": unknown descriptor @fortnightly`; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err, want)
+	}
+}
+
+// With both day fields restricted a day matching either runs, as in Vixie
+// cron; with one of them * only the other counts.
+func TestDayFields(t *testing.T) {
+	from := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC) // a Thursday
+	tests := []struct {
+		spec string
+		want []string
+	}{
+		{"0 0 13 * fri", []string{"2026-01-02", "2026-01-09", "2026-01-13", "2026-01-16", "2026-01-23"}},
+		{"0 0 13 * *", []string{"2026-01-13", "2026-02-13", "2026-03-13"}},
+		{"0 0 * * fri", []string{"2026-01-02", "2026-01-09", "2026-01-16"}},
+		{"0 0 ? * 5", []string{"2026-01-02", "2026-01-09", "2026-01-16"}},
+		{"0 0 1,15 * 0", []string{"2026-01-04", "2026-01-11", "2026-01-15", "2026-01-18"}},
+		{"0 0 29 feb 7", []string{"2026-02-01", "2026-02-08", "2026-02-15"}}, // the month still applies
+	}
+	for _, tt := range tests {
+		sched := MustParse(tt.spec, time.UTC)
+		at := from
+		var got []string
+		for range tt.want {
+			at = sched.Next(at)
+			got = append(got, at.Format(time.DateOnly))
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestHistoryFailures(t *testing.T) {
+	start := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	c := &clock{now: start}
+	s := newScheduler(t, c, WithLocation(time.UTC))
+	tests := []struct {
+		job      string
+		fn       Func
+		outcome  Outcome
+		err      string
+		duration time.Duration
+	}{
+		{"fails", func(context.Context, time.Time) error {
+			c.Set(c.Now().Add(3 * time.Second))
+			return errors.New("smtp down")
+		}, Failed, "smtp down", 3 * time.Second},
+		{"panics", func(context.Context, time.Time) error {
+			c.Set(c.Now().Add(2 * time.Second))
+			panic("nil map")
+		}, Failed, "panic: nil map", 2 * time.Second},
+		{"works", func(context.Context, time.Time) error { return nil }, Succeeded, "", 0},
+	}
+	// one job at a time, so each run sees only its own clock steps
+	for _, tt := range tests {
+		at := c.Now().Truncate(time.Minute).Add(time.Minute)
+		s.Add(tt.job, "* * * * *", tt.fn)
+		c.Set(at)
+		if n := s.RunDue(context.Background(), at); n != 1 {
+			t.Fatalf("%s: RunDue started %d runs, want 1", tt.job, n)
+		}
+		s.Wait()
+
+		h := s.History(tt.job)
+		if len(h) != 1 {
+			t.Errorf("%s: history = %+v, want one run", tt.job, h)
+			continue
+		}
+		r := h[0]
+		if r.Job != tt.job || r.Outcome != tt.outcome || r.Error != tt.err || r.Duration != tt.duration ||
+			!r.Scheduled.Equal(at) || !r.Started.Equal(at) {
+			t.Errorf("%s: run = %+v, want %v %q taking %v", tt.job, r, tt.outcome, tt.err, tt.duration)
+		}
+		s.Remove(tt.job)
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	start := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	c := &clock{now: start}
+	s := newScheduler(t, c, WithLocation(time.UTC))
+	hasDeadline := make(map[string]bool)
+	var mu sync.Mutex
+	wait := func(name string) Func {
+		return func(ctx context.Context, _ time.Time) error {
+			_, ok := ctx.Deadline()
+			mu.Lock()
+			hasDeadline[name] = ok
+			mu.Unlock()
+			if !ok {
+				return nil
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		}
+	}
+	s.Add("bounded", "* * * * *", wait("bounded"), WithTimeout(10*time.Millisecond))
+	s.Add("unbounded", "* * * * *", wait("unbounded"))
+
+	now := start.Add(time.Minute)
+	c.Set(now)
+	if n := s.RunDue(context.Background(), now); n != 2 {
+		t.Fatalf("RunDue started %d runs, want 2", n)
+	}
+	s.Wait()
+
+	if !hasDeadline["bounded"] || hasDeadline["unbounded"] {
+		t.Errorf("deadlines = %v, want only bounded to have one", hasDeadline)
+	}
+	if h := s.History("bounded"); len(h) != 1 || h[0].Outcome != Failed || h[0].Error != context.DeadlineExceeded.Error() {
+		t.Errorf("bounded history = %+v, want one run failed with %v", h, context.DeadlineExceeded)
+	}
+	if h := s.History("unbounded"); len(h) != 1 || h[0].Outcome != Succeeded {
+		t.Errorf("unbounded history = %+v, want one success", h)
+	}
+}
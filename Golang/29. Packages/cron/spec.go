@@ -0,0 +1,277 @@
+package cron
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule gives the activation times of a job.
+type Schedule interface {
+	// Next returns the first activation strictly after t, or the zero time
+	// if there is none.
+	Next(t time.Time) time.Time
+}
+
+// ParseError describes a bad expression.
+type ParseError struct {
+	Spec  string
+	Field string // "minute", "hour", ... or "" for the whole spec
+	Msg   string
+}
+
+func (e *ParseError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("cron: %q: %s", e.Spec, e.Msg)
+	}
+	return fmt.Sprintf("cron: %q: %s field: %s", e.Spec, e.Field, e.Msg)
+}
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse reads a schedule in loc:
+//
+//	minute hour day-of-month month day-of-week
+//
+// Fields take *, numbers, ranges (1-5), steps (*/15, 0-30/10) and lists
+// (1,15). Months and weekdays also take names (jan, mon); Sunday is 0 or 7.
+// When both day fields are restricted a day matching either is used, as in
+// Vixie cron. The descriptors @yearly, @monthly, @weekly, @daily and
+// @hourly stand for the usual expressions, and "@every 90m" runs at a fixed
+// interval regardless of zone. A "CRON_TZ=Asia/Kolkata " prefix overrides
+// loc.
+func Parse(spec string, loc *time.Location) (Schedule, error) {
+	s := strings.TrimSpace(spec)
+	if rest, ok := strings.CutPrefix(s, "CRON_TZ="); ok {
+		name, expr, _ := strings.Cut(rest, " ")
+		l, err := time.LoadLocation(name)
+		if err != nil {
+			return nil, &ParseError{Spec: spec, Msg: fmt.Sprintf("unknown time zone %q", name)}
+		}
+		loc, s = l, strings.TrimSpace(expr)
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+
+	if rest, ok := strings.CutPrefix(s, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || d < time.Second {
+			return nil, &ParseError{Spec: spec, Msg: "@every needs a duration of at least 1s"}
+		}
+		return Every(d), nil
+	}
+	if expr, ok := descriptors[s]; ok {
+		s = expr
+	} else if strings.HasPrefix(s, "@") {
+		return nil, &ParseError{Spec: spec, Msg: fmt.Sprintf("unknown descriptor %s", s)}
+	}
+
+	fs := strings.Fields(s)
+	if len(fs) != 5 {
+		return nil, &ParseError{Spec: spec, Msg: fmt.Sprintf("want 5 fields, got %d", len(fs))}
+	}
+	c := &cronSchedule{loc: loc}
+	for i, f := range fields {
+		set, err := f.parse(fs[i])
+		if err != nil {
+			return nil, &ParseError{Spec: spec, Field: f.name, Msg: err.Error()}
+		}
+		switch i {
+		case 0:
+			c.minute = set
+		case 1:
+			c.hour = set
+		case 2:
+			c.dom, c.domStar = set, fs[i] == "*" || fs[i] == "?"
+		case 3:
+			c.month = set
+		case 4:
+			// 7 is Sunday too
+			if set&(1<<7) != 0 {
+				set = set&^(1<<7) | 1
+			}
+			c.dow, c.dowStar = set, fs[i] == "*" || fs[i] == "?"
+		}
+	}
+	return c, nil
+}
+
+// MustParse is Parse for expressions known to be valid.
+func MustParse(spec string, loc *time.Location) Schedule {
+	s, err := Parse(spec, loc)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+type field struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var fields = []field{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day-of-month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}},
+	{name: "day-of-week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}},
+}
+
+// parse turns one field into a bitset of the values it allows.
+func (f field) parse(s string) (uint64, error) {
+	var set uint64
+	for part := range strings.SplitSeq(s, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		lo, hi := f.min, f.max
+		switch {
+		case rng == "*" || rng == "?":
+		case strings.Contains(rng, "-"):
+			a, b, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = f.value(a); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(b); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("range %s is backwards", rng)
+			}
+		default:
+			v, err := f.value(rng)
+			if err != nil {
+				return 0, err
+			}
+			lo, hi = v, v
+			if hasStep {
+				// "5/15" means from 5 to the end in steps of 15
+				hi = f.max
+			}
+		}
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("bad step %q", stepStr)
+			}
+			step = n
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+func (f field) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number", s)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("%d is outside %d-%d", v, f.min, f.max)
+	}
+	return v, nil
+}
+
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+	loc                           *time.Location
+}
+
+// Next works in wall-clock time in the schedule's zone and then converts.
+// Wall times skipped by a daylight saving change run at the moment of the
+// change (02:30 runs at 03:00 when 02:00 jumps to 03:00), and a wall time
+// that happens twice runs only the first time.
+func (c *cronSchedule) Next(t time.Time) time.Time {
+	l := t.In(c.loc)
+	w := time.Date(l.Year(), l.Month(), l.Day(), l.Hour(), l.Minute(), 0, 0, time.UTC).Add(time.Minute)
+	for {
+		w = c.nextWall(w)
+		if w.IsZero() {
+			return time.Time{}
+		}
+		at := time.Date(w.Year(), w.Month(), w.Day(), w.Hour(), w.Minute(), 0, 0, c.loc)
+		l := at.In(c.loc)
+		if got := time.Date(l.Year(), l.Month(), l.Day(), l.Hour(), l.Minute(), 0, 0, time.UTC); !got.Equal(w) {
+			// w doesn't exist in this zone and Date picked a time on one
+			// side of the gap; move it to the edge
+			start, end := at.ZoneBounds()
+			if got.Before(w) {
+				at = end
+			} else {
+				at = start
+			}
+		}
+		if at.After(t) {
+			return at
+		}
+		w = w.Add(time.Minute)
+	}
+}
+
+// nextWall finds the first matching wall time at or after w, which is in
+// UTC so the arithmetic ignores daylight saving. It gives up after five
+// years, which only an impossible date such as 30 February reaches.
+func (c *cronSchedule) nextWall(w time.Time) time.Time {
+	limit := w.Year() + 5
+	for w.Year() <= limit {
+		switch {
+		case c.month&(1<<uint(w.Month())) == 0:
+			w = time.Date(w.Year(), w.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !c.dayMatches(w):
+			w = time.Date(w.Year(), w.Month(), w.Day()+1, 0, 0, 0, 0, time.UTC)
+		case c.hour&(1<<uint(w.Hour())) == 0:
+			w = w.Truncate(time.Hour).Add(time.Hour)
+		case c.minute&(1<<uint(w.Minute())) == 0:
+			// jump straight to the next allowed minute of this hour
+			rest := c.minute >> uint(w.Minute())
+			if rest == 0 {
+				w = w.Truncate(time.Hour).Add(time.Hour)
+			} else {
+				w = w.Add(time.Duration(bits.TrailingZeros64(rest)) * time.Minute)
+			}
+		default:
+			return w
+		}
+	}
+	return time.Time{}
+}
+
+func (c *cronSchedule) dayMatches(w time.Time) bool {
+	dom := c.dom&(1<<uint(w.Day())) != 0
+	dow := c.dow&(1<<uint(w.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Every is a schedule at a fixed interval, counted from whole seconds.
+type Every time.Duration
+
+func (e Every) Next(t time.Time) time.Time {
+	return t.Truncate(time.Second).Add(time.Duration(e))
+}
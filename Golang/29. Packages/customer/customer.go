@@ -0,0 +1,60 @@
+// Package customer holds the customer type shared by orders, invoices and
+// payments.
+package customer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+var ErrNameRequired = errors.New("customer: name is required")
+
+type Customer struct {
+	Name    string      `json:"name"`
+	Phone   PhoneNumber `json:"phone"`
+	Country string      `json:"country,omitempty"`
+	// State is the state or province within Country, e.g. the place of
+	// supply for GST.
+	State string `json:"state,omitempty"`
+}
+
+// Validate checks the fields every order needs.
+func (c Customer) Validate() error {
+	if strings.TrimSpace(c.Name) == "" {
+		return ErrNameRequired
+	}
+	return nil
+}
+
+// UnmarshalJSON reads national phone numbers with the rules of Country
+// when it names a supported region, so {"phone": "020 7946 0018",
+// "country": "GB"} works. Unknown fields are rejected.
+func (c *Customer) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Name    string `json:"name"`
+		Phone   string `json:"phone"`
+		Country string `json:"country"`
+		State   string `json:"state"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&raw); err != nil {
+		return err
+	}
+
+	code := DefaultRegion
+	if regionByCode(raw.Country) != nil {
+		code = raw.Country
+	}
+	var phone PhoneNumber
+	if raw.Phone != "" {
+		var err error
+		if phone, err = ParsePhoneNumber(raw.Phone, code); err != nil {
+			return err
+		}
+	}
+	*c = Customer{Name: raw.Name, Phone: phone, Country: raw.Country, State: raw.State}
+	return nil
+}
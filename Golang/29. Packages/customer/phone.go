@@ -0,0 +1,305 @@
+package customer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidPhone = errors.New("customer: invalid phone number")
+
+// DefaultRegion is used for numbers written without a country code when
+// no better hint is available.
+var DefaultRegion = "IN"
+
+// PhoneError says why a phone number was rejected. It matches
+// ErrInvalidPhone with errors.Is.
+type PhoneError struct {
+	Input  string
+	Reason string
+}
+
+func (e *PhoneError) Error() string {
+	return fmt.Sprintf("customer: invalid phone number %q: %s", e.Input, e.Reason)
+}
+
+func (e *PhoneError) Is(target error) bool {
+	return target == ErrInvalidPhone
+}
+
+// region holds the numbering rules of one country, enough to validate and
+// lay out numbers without pulling in a full numbering plan database.
+type region struct {
+	codes     []string               // ISO 3166 codes sharing the plan, the first is reported
+	cc        string                 // country calling code
+	trunk     string                 // national prefix, dropped when parsing
+	lengths   []int                  // allowed lengths of the national significant number
+	leading   string                 // allowed first digits
+	layout    func(nsn string) []int // digit group sizes for display
+	sep       string
+	showTrunk bool // whether national format starts with the trunk prefix
+	check     func(nsn string) string
+}
+
+var regions = []*region{
+	{
+		codes: []string{"IN"}, cc: "91", trunk: "0",
+		lengths: []int{10}, leading: "123456789",
+		layout: fixed(5, 5), sep: " ", showTrunk: true,
+	},
+	{
+		codes: []string{"US", "CA"}, cc: "1", trunk: "1",
+		lengths: []int{10}, leading: "23456789",
+		layout: fixed(3, 3, 4), sep: "-",
+		check: func(nsn string) string {
+			if nsn[3] < '2' {
+				return "exchange code can't start with 0 or 1"
+			}
+			return ""
+		},
+	},
+	{
+		codes: []string{"GB"}, cc: "44", trunk: "0",
+		lengths: []int{9, 10}, leading: "12378",
+		sep: " ", showTrunk: true,
+		layout: func(nsn string) []int {
+			switch {
+			case nsn[0] == '2': // London, Cardiff, ...: 020 7946 0018
+				return []int{2, 4, 4}
+			case len(nsn) == 9:
+				return []int{4, 5}
+			}
+			return []int{4, 6}
+		},
+	},
+	{
+		codes: []string{"AU"}, cc: "61", trunk: "0",
+		lengths: []int{9}, leading: "23478",
+		layout: fixed(3, 3, 3), sep: " ", showTrunk: true,
+	},
+	{
+		codes: []string{"SG"}, cc: "65",
+		lengths: []int{8}, leading: "3689",
+		layout: fixed(4, 4), sep: " ",
+	},
+	{
+		codes: []string{"AE"}, cc: "971", trunk: "0",
+		lengths: []int{8, 9}, leading: "2345679",
+		sep: " ", showTrunk: true,
+		layout: func(nsn string) []int {
+			if len(nsn) == 8 { // landline: 04 123 4567
+				return []int{1, 3, 4}
+			}
+			return []int{2, 3, 4} // mobile: 050 123 4567
+		},
+	},
+}
+
+func fixed(sizes ...int) func(string) []int {
+	return func(string) []int { return sizes }
+}
+
+func regionByCode(code string) *region {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	for _, r := range regions {
+		for _, c := range r.codes {
+			if c == code {
+				return r
+			}
+		}
+	}
+	return nil
+}
+
+func regionByCC(digits string) *region {
+	for n := 1; n <= 3 && n <= len(digits); n++ {
+		for _, r := range regions {
+			if r.cc == digits[:n] {
+				return r
+			}
+		}
+	}
+	return nil
+}
+
+// validate returns why nsn is not a valid number in r, or "".
+func (r *region) validate(nsn string) string {
+	okLen := false
+	for _, n := range r.lengths {
+		okLen = okLen || len(nsn) == n
+	}
+	switch {
+	case !okLen:
+		return fmt.Sprintf("wrong number of digits for %s", r.codes[0])
+	case !strings.ContainsRune(r.leading, rune(nsn[0])):
+		return fmt.Sprintf("%s numbers can't start with %c", r.codes[0], nsn[0])
+	case r.check != nil:
+		return r.check(nsn)
+	}
+	return ""
+}
+
+func (r *region) group(nsn string) string {
+	var parts []string
+	for _, n := range r.layout(nsn) {
+		n = min(n, len(nsn))
+		parts = append(parts, nsn[:n])
+		nsn = nsn[n:]
+	}
+	if nsn != "" {
+		parts = append(parts, nsn)
+	}
+	return strings.Join(parts, r.sep)
+}
+
+// PhoneNumber is a phone number normalised to E.164. The zero value means
+// no number. PhoneNumbers are comparable, so two spellings of the same
+// number are ==.
+type PhoneNumber struct {
+	e164 string // "+" followed by digits
+}
+
+// ParsePhoneNumber accepts international numbers ("+91 98765 43210",
+// "0091...") and national ones ("098765 43210", "(415) 555-0132"), the
+// latter read with the rules of regionCode (an ISO 3166 code such as "IN").
+// Spaces, dots, dashes and parentheses are ignored. Errors are *PhoneError.
+func ParsePhoneNumber(s, regionCode string) (PhoneNumber, error) {
+	fail := func(reason string) (PhoneNumber, error) {
+		return PhoneNumber{}, &PhoneError{Input: s, Reason: reason}
+	}
+
+	var digits strings.Builder
+	international := false
+	for i, c := range strings.TrimSpace(s) {
+		switch {
+		case c >= '0' && c <= '9':
+			digits.WriteRune(c)
+		case c == '+' && i == 0:
+			international = true
+		case strings.ContainsRune(" .-()", c):
+		default:
+			return fail(fmt.Sprintf("unexpected %q", c))
+		}
+	}
+	d := digits.String()
+	if d == "" {
+		return fail("no digits")
+	}
+	if !international && strings.HasPrefix(d, "00") {
+		international, d = true, d[2:]
+	}
+
+	var r *region
+	var nsn string
+	if international {
+		if r = regionByCC(d); r == nil {
+			return fail("unsupported country code")
+		}
+		nsn = d[len(r.cc):]
+	} else {
+		if r = regionByCode(regionCode); r == nil {
+			return fail(fmt.Sprintf("unsupported region %q", regionCode))
+		}
+		nsn = d
+		switch {
+		case r.trunk != "" && strings.HasPrefix(d, r.trunk) && r.validate(d[len(r.trunk):]) == "":
+			nsn = d[len(r.trunk):]
+		case strings.HasPrefix(d, r.cc) && r.validate(d) != "" && r.validate(d[len(r.cc):]) == "":
+			// country code typed without the "+", e.g. 919876543210
+			nsn = d[len(r.cc):]
+		}
+	}
+
+	if nsn == "" {
+		return fail("no number after the country code")
+	}
+	if reason := r.validate(nsn); reason != "" {
+		return fail(reason)
+	}
+	return PhoneNumber{e164: "+" + r.cc + nsn}, nil
+}
+
+func (p PhoneNumber) IsZero() bool { return p.e164 == "" }
+
+// E164 returns the number as "+<country code><number>", or "".
+func (p PhoneNumber) E164() string { return p.e164 }
+
+func (p PhoneNumber) parts() (*region, string) {
+	if p.e164 == "" {
+		return nil, ""
+	}
+	r := regionByCC(p.e164[1:])
+	return r, p.e164[1+len(r.cc):]
+}
+
+// Region returns the ISO 3166 code the number belongs to. Numbers shared
+// by several countries (+1) report the first, "US".
+func (p PhoneNumber) Region() string {
+	r, _ := p.parts()
+	if r == nil {
+		return ""
+	}
+	return r.codes[0]
+}
+
+// International formats the number for display to anyone, e.g.
+// "+91 98765 43210" or "+1 415-555-0132".
+func (p PhoneNumber) International() string {
+	r, nsn := p.parts()
+	if r == nil {
+		return ""
+	}
+	return "+" + r.cc + " " + r.group(nsn)
+}
+
+// National formats the number as dialled inside its own country, e.g.
+// "098765 43210" or "(415) 555-0132".
+func (p PhoneNumber) National() string {
+	r, nsn := p.parts()
+	switch {
+	case r == nil:
+		return ""
+	case r.cc == "1":
+		return "(" + nsn[:3] + ") " + nsn[3:6] + "-" + nsn[6:]
+	case r.showTrunk:
+		return r.trunk + r.group(nsn)
+	}
+	return r.group(nsn)
+}
+
+func (p PhoneNumber) String() string {
+	return p.International()
+}
+
+// MarshalText encodes the number as E.164.
+func (p PhoneNumber) MarshalText() ([]byte, error) {
+	return []byte(p.e164), nil
+}
+
+// UnmarshalText parses any format ParsePhoneNumber accepts, using
+// DefaultRegion for national numbers. Empty text gives the zero number.
+func (p *PhoneNumber) UnmarshalText(b []byte) error {
+	if len(b) == 0 {
+		*p = PhoneNumber{}
+		return nil
+	}
+	n, err := ParsePhoneNumber(string(b), DefaultRegion)
+	if err != nil {
+		return err
+	}
+	*p = n
+	return nil
+}
+
+func (p PhoneNumber) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.e164)
+}
+
+func (p *PhoneNumber) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("customer: phone number must be a string")
+	}
+	return p.UnmarshalText([]byte(s))
+}
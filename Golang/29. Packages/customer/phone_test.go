@@ -0,0 +1,202 @@
+package customer
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func mustParse(t *testing.T, s, region string) PhoneNumber {
+	t.Helper()
+	p, err := ParsePhoneNumber(s, region)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestParsePhoneNumber(t *testing.T) {
+	for _, tc := range []struct {
+		in, region, want string
+	}{
+		{"+91 98765 43210", "", "+919876543210"},
+		{"0091 98765 43210", "US", "+919876543210"},
+		{"098765 43210", "IN", "+919876543210"},
+		{"98765.43210", "in", "+919876543210"},
+		{"919876543210", "IN", "+919876543210"}, // country code without the +
+		{"  +91-98765-43210 ", "", "+919876543210"},
+		{"(415) 555-0132", "US", "+14155550132"},
+		{"1-415-555-0132", "US", "+14155550132"},
+		{"+1 415 555 0132", "IN", "+14155550132"},
+		{"020 7946 0018", "GB", "+442079460018"},
+		{"01632 960961", "GB", "+441632960961"},
+		{"+61 2 1234 5678", "", "+61212345678"},
+		{"6123 4567", "SG", "+6561234567"},
+		{"+65 6123 4567", "", "+6561234567"},
+		{"04 123 4567", "AE", "+97141234567"},
+		{"+971 50 123 4567", "", "+971501234567"},
+	} {
+		p, err := ParsePhoneNumber(tc.in, tc.region)
+		if err != nil || p.E164() != tc.want {
+			t.Errorf("ParsePhoneNumber(%q, %q) = %q, %v, want %s", tc.in, tc.region, p.E164(), err, tc.want)
+		}
+	}
+
+	// spellings of one number compare equal
+	if mustParse(t, "+91 98765 43210", "") != mustParse(t, "098765-43210", "IN") {
+		t.Error("two spellings of the same number are not ==")
+	}
+}
+
+func TestParsePhoneNumberInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		in, region, reason string
+	}{
+		{"", "IN", "no digits"},
+		{" - ", "IN", "no digits"},
+		{"+91 98765 4321a", "", `unexpected 'a'`},
+		{"98765+43210", "IN", `unexpected '+'`},
+		{"+999 123 4567", "", "unsupported country code"},
+		{"98765 43210", "ZZ", `unsupported region "ZZ"`},
+		{"+91", "", "no number after the country code"},
+		{"12345", "IN", "wrong number of digits for IN"},
+		{"+91 98765 432101", "", "wrong number of digits for IN"},
+		{"0123456789", "IN", "IN numbers can't start with 0"},
+		{"(415) 155-0132", "US", "exchange code can't start with 0 or 1"},
+		{"+1 115 555 0132", "", "US numbers can't start with 1"},
+		{"+44 9946 0018 00", "", "GB numbers can't start with 9"},
+		{"+65 1234 5678", "", "SG numbers can't start with 1"},
+	} {
+		p, err := ParsePhoneNumber(tc.in, tc.region)
+		var pe *PhoneError
+		if !errors.As(err, &pe) || pe.Input != tc.in || pe.Reason != tc.reason {
+			t.Errorf("ParsePhoneNumber(%q, %q) = %v, want reason %q", tc.in, tc.region, err, tc.reason)
+			continue
+		}
+		if !errors.Is(err, ErrInvalidPhone) || !p.IsZero() {
+			t.Errorf("ParsePhoneNumber(%q, %q) = %q, %v", tc.in, tc.region, p.E164(), err)
+		}
+	}
+
+	_, err := ParsePhoneNumber("12345", "IN")
+	if want := `customer: invalid phone number "12345": wrong number of digits for IN`; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err, want)
+	}
+}
+
+func TestPhoneNumberFormat(t *testing.T) {
+	for _, tc := range []struct {
+		e164, region, international, national string
+	}{
+		{"+919876543210", "IN", "+91 98765 43210", "098765 43210"},
+		{"+14155550132", "US", "+1 415-555-0132", "(415) 555-0132"},
+		{"+442079460018", "GB", "+44 20 7946 0018", "020 7946 0018"},
+		{"+441632960961", "GB", "+44 1632 960961", "01632 960961"},
+		{"+44123456789", "GB", "+44 1234 56789", "01234 56789"},
+		{"+61212345678", "AU", "+61 212 345 678", "0212 345 678"},
+		{"+6561234567", "SG", "+65 6123 4567", "6123 4567"},
+		{"+97141234567", "AE", "+971 4 123 4567", "04 123 4567"},
+		{"+971501234567", "AE", "+971 50 123 4567", "050 123 4567"},
+	} {
+		p := mustParse(t, tc.e164, "")
+		if p.Region() != tc.region || p.International() != tc.international || p.National() != tc.national || p.String() != tc.international {
+			t.Errorf("%s: region %q, international %q, national %q, want %q, %q, %q",
+				tc.e164, p.Region(), p.International(), p.National(), tc.region, tc.international, tc.national)
+		}
+		// what National prints parses back to the same number
+		if back, err := ParsePhoneNumber(p.National(), p.Region()); err != nil || back != p {
+			t.Errorf("%s: national %q parses to %q, %v", tc.e164, p.National(), back.E164(), err)
+		}
+	}
+
+	var zero PhoneNumber
+	if !zero.IsZero() || zero.E164() != "" || zero.Region() != "" || zero.International() != "" || zero.National() != "" {
+		t.Errorf("zero number formats as %q", zero)
+	}
+}
+
+func TestPhoneNumberJSON(t *testing.T) {
+	c := Customer{Name: "Raja", Phone: mustParse(t, "98765 43210", "IN"), Country: "IN", State: "WB"}
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"name":"Raja","phone":"+919876543210","country":"IN","state":"WB"}`; string(b) != want {
+		t.Errorf("Marshal = %s, want %s", b, want)
+	}
+	var back Customer
+	if err := json.Unmarshal(b, &back); err != nil || back != c {
+		t.Errorf("round trip = %+v, %v", back, err)
+	}
+
+	b, _ = json.Marshal(Customer{Name: "Raja"})
+	if want := `{"name":"Raja","phone":""}`; string(b) != want {
+		t.Errorf("Marshal without a phone = %s, want %s", b, want)
+	}
+
+	for _, tc := range []struct {
+		json, want string
+	}{
+		{`"098765 43210"`, "+919876543210"}, // national, read as DefaultRegion
+		{`"+1 (415) 555-0132"`, "+14155550132"},
+		{`""`, ""},
+		{`null`, ""},
+	} {
+		p := mustParse(t, "+6561234567", "")
+		if err := json.Unmarshal([]byte(tc.json), &p); err != nil || p.E164() != tc.want {
+			t.Errorf("Unmarshal(%s) = %q, %v, want %q", tc.json, p.E164(), err, tc.want)
+		}
+	}
+}
+
+func TestPhoneNumberJSONInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		json, want string
+	}{
+		{`"12345"`, `customer: invalid phone number "12345": wrong number of digits for IN`},
+		{`"+999 1"`, `customer: invalid phone number "+999 1": unsupported country code`},
+		{`9876543210`, "customer: phone number must be a string"},
+	} {
+		p := mustParse(t, "+6561234567", "")
+		err := json.Unmarshal([]byte(tc.json), &p)
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("Unmarshal(%s) = %v, want %q", tc.json, err, tc.want)
+		}
+		if p.E164() != "+6561234567" {
+			t.Errorf("Unmarshal(%s) changed the number to %q", tc.json, p.E164())
+		}
+	}
+}
+
+func TestCustomerUnmarshalJSON(t *testing.T) {
+	for _, tc := range []struct {
+		json, phone string
+	}{
+		{`{"name":"Jo","phone":"020 7946 0018","country":"GB"}`, "+442079460018"},
+		{`{"name":"Jo","phone":"(415) 555-0132","country":"us"}`, "+14155550132"},
+		// an unsupported country falls back to DefaultRegion
+		{`{"name":"Jo","phone":"098765 43210","country":"NP"}`, "+919876543210"},
+		{`{"name":"Jo","phone":"+44 20 7946 0018","country":"IN"}`, "+442079460018"},
+		{`{"name":"Jo"}`, ""},
+	} {
+		var c Customer
+		if err := json.Unmarshal([]byte(tc.json), &c); err != nil || c.Phone.E164() != tc.phone {
+			t.Errorf("Unmarshal(%s) phone = %q, %v, want %q", tc.json, c.Phone.E164(), err, tc.phone)
+		}
+	}
+
+	for _, tc := range []struct {
+		json, want string
+	}{
+		{`{"name":"Jo","phone":"7946 0018","country":"GB"}`, `invalid phone number "7946 0018": wrong number of digits for GB`},
+		{`{"name":"Jo","phone":"7946 0018"}`, `invalid phone number "7946 0018": wrong number of digits for IN`},
+		{`{"name":"Jo","email":"jo@example.com"}`, `unknown field "email"`},
+	} {
+		var c Customer
+		err := json.Unmarshal([]byte(tc.json), &c)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("Unmarshal(%s) = %v, want %q", tc.json, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package dag
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func ok(context.Context) error { return nil }
+
+var errBoom = errors.New("boom")
+
+func fail(context.Context) error { return errBoom }
+
+func TestCycle(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(g *Graph)
+	}{
+		{"self", func(g *Graph) {
+			g.Add("x", ok, After("x"))
+		}},
+		{"three", func(g *Graph) {
+			g.Add("start", ok)
+			g.Add("a", ok, After("start", "c"))
+			g.Add("b", ok, After("a"))
+			g.Add("c", ok, After("b"))
+		}},
+		{"behind a diamond", func(g *Graph) {
+			g.Add("root", ok)
+			g.Add("left", ok, After("root"))
+			g.Add("right", ok, After("root", "loop2"))
+			g.Add("join", ok, After("left", "right"))
+			g.Add("loop1", ok, After("right"))
+			g.Add("loop2", ok, After("loop1"))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := New()
+			tt.build(g)
+			err := g.Validate()
+			var ce *CycleError
+			if !errors.As(err, &ce) {
+				t.Fatalf("Validate = %v, want a CycleError", err)
+			}
+			p := ce.Path
+			if len(p) < 2 || p[0] != p[len(p)-1] {
+				t.Fatalf("path %v does not start and end with the same task", p)
+			}
+			for i := range len(p) - 1 {
+				if !slices.Contains(g.tasks[p[i]].deps, p[i+1]) {
+					t.Errorf("path %v: %s does not depend on %s", p, p[i], p[i+1])
+				}
+			}
+			if _, err := g.Run(context.Background()); !errors.As(err, &ce) {
+				t.Errorf("Run = %v, want the cycle", err)
+			}
+		})
+	}
+}
+
+func TestMissing(t *testing.T) {
+	g := New()
+	g.Add("publish", ok, After("render"))
+	var me *MissingError
+	if err := g.Validate(); !errors.As(err, &me) || me.Task != "publish" || me.Dep != "render" {
+		t.Fatalf("Validate = %v", err)
+	}
+	if err := g.Add("publish", ok); !errors.Is(err, ErrExists) {
+		t.Errorf("second Add: err = %v, want ErrExists", err)
+	}
+}
+
+func TestRunOrder(t *testing.T) {
+	g := New()
+	var mu sync.Mutex
+	var ran []string
+	task := func(name string) Func {
+		return func(context.Context) error {
+			mu.Lock()
+			ran = append(ran, name)
+			mu.Unlock()
+			return nil
+		}
+	}
+	// added out of order; dependencies may come later
+	g.Add("publish", task("publish"), After("parse", "thumbs"))
+	g.Add("parse", task("parse"), After("fetch"))
+	g.Add("thumbs", task("thumbs"), After("fetch"))
+	g.Add("fetch", task("fetch"))
+	tr, err := g.Run(context.Background(), WithParallelism(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pos := func(name string) int { return slices.Index(ran, name) }
+	if pos("fetch") != 0 || pos("publish") != 3 {
+		t.Errorf("ran %v", ran)
+	}
+	var names []string
+	for _, tt := range tr.Tasks {
+		names = append(names, tt.Name)
+		if tt.State != Succeeded || tt.Attempts != 1 {
+			t.Errorf("%s: %v after %d attempts", tt.Name, tt.State, tt.Attempts)
+		}
+	}
+	if want := []string{"fetch", "parse", "thumbs", "publish"}; !slices.Equal(names, want) {
+		t.Errorf("trace order %v, want %v", names, want)
+	}
+}
+
+// A failure skips everything downstream, directly or not, while an
+// independent branch still runs.
+func TestSkipDownstream(t *testing.T) {
+	g := New()
+	var ranPublish, ranReport atomic.Bool
+	g.Add("fetch", fail)
+	g.Add("parse", ok, After("fetch"))
+	g.Add("publish", func(context.Context) error { ranPublish.Store(true); return nil }, After("parse"))
+	g.Add("stats", ok)
+	g.Add("report", func(context.Context) error { ranReport.Store(true); return nil }, After("stats"))
+	g.Add("bad", fail, After("stats"))
+	g.Add("notify", ok, After("bad", "report"))
+
+	tr, err := g.Run(context.Background(), WithParallelism(1))
+	var te *TaskError
+	if !errors.As(err, &te) || te.Task != "fetch" || !errors.Is(err, errBoom) {
+		t.Fatalf("Run = %v, want fetch's failure first", err)
+	}
+	if n := strings.Count(err.Error(), "failed"); n != 2 {
+		t.Errorf("error %q, want both failures", err)
+	}
+	want := map[string]struct {
+		state State
+		cause string
+	}{
+		"fetch":   {Failed, ""},
+		"parse":   {Skipped, "fetch"},
+		"publish": {Skipped, "fetch"},
+		"stats":   {Succeeded, ""},
+		"report":  {Succeeded, ""},
+		"bad":     {Failed, ""},
+		"notify":  {Skipped, "bad"},
+	}
+	for name, w := range want {
+		tt, _ := tr.Task(name)
+		if tt.State != w.state || tt.SkippedBecause != w.cause {
+			t.Errorf("%s: %v because %q, want %v because %q", name, tt.State, tt.SkippedBecause, w.state, w.cause)
+		}
+	}
+	if ranPublish.Load() || !ranReport.Load() {
+		t.Errorf("publish ran = %v, report ran = %v", ranPublish.Load(), ranReport.Load())
+	}
+}
+
+func TestRetries(t *testing.T) {
+	g := New()
+	var flaky, broken atomic.Int64
+	g.Add("flaky", func(context.Context) error {
+		if flaky.Add(1) < 3 {
+			return errBoom
+		}
+		return nil
+	}, WithRetries(2, time.Millisecond))
+	g.Add("broken", func(context.Context) error {
+		broken.Add(1)
+		return errBoom
+	}, WithRetries(2, time.Millisecond))
+	g.Add("after", ok, After("flaky"))
+
+	tr, err := g.Run(context.Background())
+	var te *TaskError
+	if !errors.As(err, &te) || te.Task != "broken" || te.Attempts != 3 {
+		t.Fatalf("Run = %v, want broken after 3 attempts", err)
+	}
+	if !strings.Contains(err.Error(), "failed after 3 attempts") {
+		t.Errorf("error %q does not count the attempts", err)
+	}
+	if tt, _ := tr.Task("flaky"); tt.State != Succeeded || tt.Attempts != 3 {
+		t.Errorf("flaky: %v after %d attempts, want success on the third", tt.State, tt.Attempts)
+	}
+	if tt, _ := tr.Task("after"); tt.State != Succeeded {
+		t.Errorf("after: %v", tt.State)
+	}
+	if n := broken.Load(); n != 3 {
+		t.Errorf("broken ran %d times, want 3", n)
+	}
+}
+
+// Cancelling the run stops retries and marks what never started.
+func TestCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	g := New()
+	g.Add("slow", func(ctx context.Context) error {
+		cancel()
+		<-ctx.Done()
+		return ctx.Err()
+	}, WithRetries(5, time.Hour))
+	g.Add("next", ok, After("slow"))
+	g.Add("other", ok, After("slow"))
+
+	tr, err := g.Run(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run = %v, want context.Canceled", err)
+	}
+	if tt, _ := tr.Task("slow"); tt.Attempts != 1 {
+		t.Errorf("slow: %d attempts after cancel, want 1", tt.Attempts)
+	}
+	for _, name := range []string{"next", "other"} {
+		if tt, _ := tr.Task(name); tt.State != Skipped && tt.State != Cancelled {
+			t.Errorf("%s: %v", name, tt.State)
+		}
+	}
+}
+
+func TestParallelism(t *testing.T) {
+	g := New()
+	var running, peak atomic.Int64
+	for _, name := range strings.Fields("a b c d e f g h") {
+		g.Add(name, func(context.Context) error {
+			n := running.Add(1)
+			for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+			}
+			time.Sleep(2 * time.Millisecond)
+			running.Add(-1)
+			return nil
+		})
+	}
+	if _, err := g.Run(context.Background(), WithParallelism(3)); err != nil {
+		t.Fatal(err)
+	}
+	if p := peak.Load(); p > 3 {
+		t.Errorf("%d tasks ran at once, limit is 3", p)
+	}
+}
+
+func TestPanic(t *testing.T) {
+	g := New()
+	g.Add("bad", func(context.Context) error { panic("nil map") })
+	tr, err := g.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "panic: nil map") {
+		t.Fatalf("Run = %v", err)
+	}
+	if tt, _ := tr.Task("bad"); tt.State != Failed {
+		t.Errorf("state %v", tt.State)
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	g := New()
+	g.Add(`say "hi"`, fail)
+	g.Add(`C:\tmp`+"\n"+`next`, ok, After(`say "hi"`))
+	tr, _ := g.Run(context.Background())
+
+	var b bytes.Buffer
+	if err := tr.WriteDOT(&b); err != nil {
+		t.Fatal(err)
+	}
+	dot := b.String()
+	for _, want := range []string{
+		`"say \"hi\"" [label="say \"hi\"\nfailed in 0s", color=red];`,
+		`"C:\\tmp\nnext" [label="C:\\tmp\nnext\nskipped\nbecause say \"hi\" failed", color=orange];`,
+		`"say \"hi\"" -> "C:\\tmp\nnext";`,
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("DOT is missing %s\n%s", want, dot)
+		}
+	}
+	if strings.Count(dot, "\n") != 7 {
+		t.Errorf("a raw newline leaked into the DOT:\n%s", dot)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	g := New()
+	g.Add("a", ok)
+	g.Add("b", fail, After("a"))
+	tr, _ := g.Run(context.Background())
+	var b bytes.Buffer
+	if err := tr.WriteJSON(&b); err != nil {
+		t.Fatal(err)
+	}
+	var back Trace
+	if err := json.Unmarshal(b.Bytes(), &back); err != nil {
+		t.Fatal(err)
+	}
+	if len(back.Tasks) != 2 || back.Tasks[1].State != Failed || back.Tasks[1].Error != "boom" || back.Tasks[1].Deps[0] != "a" {
+		t.Errorf("round trip = %+v", back.Tasks)
+	}
+}
@@ -0,0 +1,165 @@
+// Package dag runs tasks that depend on each other, starting each as soon
+// as everything it depends on has succeeded.
+//
+//	g := dag.New()
+//	g.Add("fetch", fetch)
+//	g.Add("parse", parse, dag.After("fetch"))
+//	g.Add("thumbs", thumbs, dag.After("fetch"), dag.WithRetries(2, time.Second))
+//	g.Add("publish", publish, dag.After("parse", "thumbs"))
+//	trace, err := g.Run(ctx, dag.WithParallelism(4))
+//
+// A failed task skips everything downstream of it; independent branches
+// carry on. The returned Trace records what ran, when and why, and can be
+// written as JSON or as a Graphviz DOT graph.
+package dag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrExists = errors.New("dag: task already exists")
+
+// MissingError is a dependency on a task that was never added.
+type MissingError struct {
+	Task, Dep string
+}
+
+func (e *MissingError) Error() string {
+	return fmt.Sprintf("dag: task %s depends on unknown task %s", e.Task, e.Dep)
+}
+
+// CycleError is a dependency cycle. Path starts and ends with the same
+// task, each depending on the next.
+type CycleError struct {
+	Path []string
+}
+
+func (e *CycleError) Error() string {
+	return "dag: dependency cycle: " + strings.Join(e.Path, " -> ")
+}
+
+// Func is the work of one task.
+type Func func(ctx context.Context) error
+
+type task struct {
+	name    string
+	fn      Func
+	deps    []string
+	retries int
+	backoff time.Duration
+	timeout time.Duration
+}
+
+// Graph is a set of tasks and their dependencies. Build it with Add, then
+// Run it as often as needed.
+type Graph struct {
+	mu    sync.Mutex
+	tasks map[string]*task
+	order []string // in the order added
+}
+
+func New() *Graph {
+	return &Graph{tasks: make(map[string]*task)}
+}
+
+type TaskOption func(*task)
+
+// After makes the task depend on others.
+func After(deps ...string) TaskOption {
+	return func(t *task) { t.deps = append(t.deps, deps...) }
+}
+
+// WithRetries runs a failing task up to n more times, waiting backoff
+// before the first retry and twice as long before each one after.
+func WithRetries(n int, backoff time.Duration) TaskOption {
+	return func(t *task) { t.retries, t.backoff = max(n, 0), backoff }
+}
+
+// WithTimeout limits each attempt of the task.
+func WithTimeout(d time.Duration) TaskOption {
+	return func(t *task) { t.timeout = d }
+}
+
+// Add declares a task. Dependencies may be added later, as long as they
+// exist by the time the graph is run.
+func (g *Graph) Add(name string, fn Func, opts ...TaskOption) error {
+	t := &task{name: name, fn: fn}
+	for _, opt := range opts {
+		opt(t)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.tasks[name]; ok {
+		return fmt.Errorf("%w: %s", ErrExists, name)
+	}
+	g.tasks[name] = t
+	g.order = append(g.order, name)
+	return nil
+}
+
+// Validate reports unknown dependencies and cycles.
+func (g *Graph) Validate() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	_, err := g.sort()
+	return err
+}
+
+// sort returns the tasks in an order where every task comes after its
+// dependencies, ties broken by the order they were added.
+func (g *Graph) sort() ([]*task, error) {
+	for _, name := range g.order {
+		for _, dep := range g.tasks[name].deps {
+			if _, ok := g.tasks[dep]; !ok {
+				return nil, &MissingError{Task: name, Dep: dep}
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int, len(g.tasks))
+	var stack, out []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case done:
+			return nil
+		case visiting:
+			i := slices.Index(stack, name)
+			// the stack runs from dependents to their dependencies
+			return &CycleError{Path: append(slices.Clone(stack[i:]), name)}
+		}
+		state[name] = visiting
+		stack = append(stack, name)
+		for _, dep := range g.tasks[name].deps {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[name] = done
+		out = append(out, name)
+		return nil
+	}
+	for _, name := range g.order {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+
+	tasks := make([]*task, len(out))
+	for i, name := range out {
+		tasks[i] = g.tasks[name]
+	}
+	return tasks, nil
+}
@@ -0,0 +1,182 @@
+package dag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"time"
+)
+
+// TaskError is a task that failed on every attempt.
+type TaskError struct {
+	Task     string
+	Attempts int
+	Err      error
+}
+
+func (e *TaskError) Error() string {
+	if e.Attempts > 1 {
+		return fmt.Sprintf("dag: task %s failed after %d attempts: %v", e.Task, e.Attempts, e.Err)
+	}
+	return fmt.Sprintf("dag: task %s failed: %v", e.Task, e.Err)
+}
+
+func (e *TaskError) Unwrap() error { return e.Err }
+
+type RunOption func(*runConfig)
+
+type runConfig struct {
+	parallelism int
+	now         func() time.Time
+}
+
+// WithParallelism runs at most n tasks at once, GOMAXPROCS by default.
+func WithParallelism(n int) RunOption {
+	return func(c *runConfig) { c.parallelism = max(n, 1) }
+}
+
+// WithClock sets the clock used for the trace.
+func WithClock(now func() time.Time) RunOption {
+	return func(c *runConfig) { c.now = now }
+}
+
+type result struct {
+	t        *task
+	attempts int
+	started  time.Time
+	finished time.Time
+	err      error
+}
+
+// Run validates the graph and runs it. The error joins the TaskError of
+// every failed task, in dependency order, and the context's error if it
+// ended the run early; tasks skipped because of either are only in the
+// trace.
+func (g *Graph) Run(ctx context.Context, opts ...RunOption) (*Trace, error) {
+	c := runConfig{parallelism: runtime.GOMAXPROCS(0), now: time.Now}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	g.mu.Lock()
+	tasks, err := g.sort()
+	g.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	tr := newTrace(tasks, c.now())
+	pending := make(map[string]int, len(tasks)) // unfinished dependencies
+	dependents := make(map[string][]*task)
+	var ready []*task // kept in dependency order
+	for _, t := range tasks {
+		pending[t.name] = len(t.deps)
+		for _, dep := range t.deps {
+			dependents[dep] = append(dependents[dep], t)
+		}
+		if len(t.deps) == 0 {
+			ready = append(ready, t)
+		}
+	}
+
+	results := make(chan result)
+	running := 0
+	var failed []*TaskError
+	for len(ready) > 0 || running > 0 {
+		for len(ready) > 0 && running < c.parallelism && ctx.Err() == nil {
+			t := ready[0]
+			ready = ready[1:]
+			tr.task(t.name).State = Running
+			running++
+			go func() { results <- g.attempt(ctx, t, c.now) }()
+		}
+		if ctx.Err() != nil && running == 0 {
+			break
+		}
+
+		r := <-results
+		running--
+		tt := tr.task(r.t.name)
+		tt.Attempts, tt.Started, tt.Finished = r.attempts, r.started, r.finished
+		tt.Duration = r.finished.Sub(r.started)
+		if r.err != nil {
+			tt.State, tt.Error = Failed, r.err.Error()
+			failed = append(failed, &TaskError{Task: r.t.name, Attempts: r.attempts, Err: r.err})
+			skipDownstream(tr, dependents, r.t.name, r.t.name)
+			continue
+		}
+		tt.State = Succeeded
+		for _, d := range dependents[r.t.name] {
+			pending[d.name]--
+			if pending[d.name] == 0 && tr.task(d.name).State == Pending {
+				ready = append(ready, d)
+			}
+		}
+	}
+
+	slices.SortFunc(failed, func(a, b *TaskError) int { return tr.index[a.Task] - tr.index[b.Task] })
+	var errs []error
+	for _, e := range failed {
+		errs = append(errs, e)
+	}
+	if ctx.Err() != nil {
+		for i := range tr.Tasks {
+			if tt := &tr.Tasks[i]; tt.State == Pending {
+				tt.State, tt.Error = Cancelled, ctx.Err().Error()
+			}
+		}
+		errs = append(errs, ctx.Err())
+	}
+	tr.Finished = c.now()
+	tr.Duration = tr.Finished.Sub(tr.Started)
+	return tr, errors.Join(errs...)
+}
+
+// skipDownstream marks everything depending on name, directly or not, as
+// skipped because root failed.
+func skipDownstream(tr *Trace, dependents map[string][]*task, name, root string) {
+	for _, d := range dependents[name] {
+		tt := tr.task(d.name)
+		if tt.State != Pending {
+			continue
+		}
+		tt.State, tt.SkippedBecause = Skipped, root
+		skipDownstream(tr, dependents, d.name, root)
+	}
+}
+
+// attempt runs t until it succeeds or runs out of retries.
+func (g *Graph) attempt(ctx context.Context, t *task, now func() time.Time) result {
+	r := result{t: t, started: now()}
+	backoff := t.backoff
+	for {
+		r.attempts++
+		r.err = call(ctx, t)
+		if r.err == nil || r.attempts > t.retries || ctx.Err() != nil {
+			break
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+		}
+		backoff *= 2
+	}
+	r.finished = now()
+	return r
+}
+
+func call(ctx context.Context, t *task) (err error) {
+	if t.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+		defer cancel()
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return t.fn(ctx)
+}
@@ -0,0 +1,139 @@
+package dag
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/enum"
+)
+
+// State is where a task ended up in a run.
+type State int
+
+const (
+	Pending State = iota
+	Running
+	Succeeded
+	Failed
+	Skipped   // an upstream task failed
+	Cancelled // the run's context ended first
+)
+
+var states = enum.New("State", map[State]string{
+	Pending:   "pending",
+	Running:   "running",
+	Succeeded: "succeeded",
+	Failed:    "failed",
+	Skipped:   "skipped",
+	Cancelled: "cancelled",
+})
+
+func (s State) String() string                { return states.Name(s) }
+func (s State) MarshalText() ([]byte, error)  { return states.MarshalText(s) }
+func (s *State) UnmarshalText(b []byte) error { return states.UnmarshalText(b, s) }
+
+// TaskTrace is one task's part in a run.
+type TaskTrace struct {
+	Name           string        `json:"name"`
+	Deps           []string      `json:"deps,omitempty"`
+	State          State         `json:"state"`
+	Attempts       int           `json:"attempts,omitempty"`
+	Started        time.Time     `json:"started,omitzero"`
+	Finished       time.Time     `json:"finished,omitzero"`
+	Duration       time.Duration `json:"duration,omitempty"`
+	Error          string        `json:"error,omitempty"`
+	SkippedBecause string        `json:"skipped_because,omitempty"` // the failed upstream task
+}
+
+// Trace records a run, tasks in dependency order.
+type Trace struct {
+	Started  time.Time     `json:"started"`
+	Finished time.Time     `json:"finished"`
+	Duration time.Duration `json:"duration"`
+	Tasks    []TaskTrace   `json:"tasks"`
+	index    map[string]int
+}
+
+func newTrace(tasks []*task, started time.Time) *Trace {
+	tr := &Trace{Started: started, Tasks: make([]TaskTrace, len(tasks)), index: make(map[string]int, len(tasks))}
+	for i, t := range tasks {
+		tr.Tasks[i] = TaskTrace{Name: t.name, Deps: slices.Clone(t.deps)}
+		tr.index[t.name] = i
+	}
+	return tr
+}
+
+func (tr *Trace) task(name string) *TaskTrace { return &tr.Tasks[tr.index[name]] }
+
+// Task returns the trace of one task.
+func (tr *Trace) Task(name string) (TaskTrace, bool) {
+	i, ok := tr.index[name]
+	if !ok {
+		return TaskTrace{}, false
+	}
+	return tr.Tasks[i], true
+}
+
+// WriteJSON writes the trace as indented JSON.
+func (tr *Trace) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(tr)
+}
+
+var dotColors = map[State]string{
+	Pending:   "gray",
+	Running:   "gray",
+	Succeeded: "darkgreen",
+	Failed:    "red",
+	Skipped:   "orange",
+	Cancelled: "gray",
+}
+
+// WriteDOT writes the trace as a Graphviz graph, edges pointing from a
+// dependency to the tasks that need it and nodes coloured by state. Render
+// it with dot -Tsvg.
+func (tr *Trace) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph dag {\n\trankdir=LR;\n\tnode [shape=box, style=rounded];\n")
+	for _, t := range tr.Tasks {
+		lines := []string{t.Name, t.State.String()}
+		switch {
+		case t.State == Succeeded || t.State == Failed:
+			lines[1] += " in " + t.Duration.Round(time.Millisecond).String()
+			if t.Attempts > 1 {
+				lines = append(lines, fmt.Sprintf("%d attempts", t.Attempts))
+			}
+		case t.State == Skipped:
+			lines = append(lines, "because "+t.SkippedBecause+" failed")
+		}
+		fmt.Fprintf(&b, "\t%s [label=%s, color=%s];\n", quote(t.Name), quote(lines...), dotColors[t.State])
+	}
+	for _, t := range tr.Tasks {
+		for _, dep := range t.Deps {
+			fmt.Fprintf(&b, "\t%s -> %s;\n", quote(dep), quote(t.Name))
+		}
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// quote makes a DOT string of lines, escaping each and joining them with
+// DOT's \n line break.
+func quote(lines ...string) string {
+	escaped := make([]string, len(lines))
+	for i, l := range lines {
+		escaped[i] = dotEscaper.Replace(l)
+	}
+	return `"` + strings.Join(escaped, `\n`) + `"`
+}
+
+// dotEscaper escapes text for a DOT string. A newline in a name becomes a
+// line break, and a carriage return, which DOT would read as one, is
+// dropped.
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", "")
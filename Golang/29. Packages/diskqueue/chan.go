@@ -0,0 +1,34 @@
+package diskqueue
+
+import "context"
+
+// Chan adapts the queue to code written against a plain channel:
+//
+//	for email := range q.Chan(ctx) {
+//		send(string(email))
+//	}
+//
+// Each item is acknowledged as soon as the consumer takes it from the
+// channel, so an item being handled when the process dies is lost; use
+// Receive and Ack where that matters. The channel is closed when ctx is
+// done, the queue is closed or an item can't be read.
+func (q *Queue) Chan(ctx context.Context) <-chan []byte {
+	ch := make(chan []byte)
+	go func() {
+		defer close(ch)
+		for {
+			it, err := q.Receive(ctx)
+			if err != nil {
+				return
+			}
+			select {
+			case ch <- it.Data:
+				q.Ack(it.Offset)
+			case <-ctx.Done():
+				q.Nack(it.Offset)
+				return
+			}
+		}
+	}()
+	return ch
+}
@@ -0,0 +1,455 @@
+// Package diskqueue is a persistent FIFO queue kept in a directory of
+// append-only segment files, so items survive a crash or restart.
+//
+// Delivery is at least once. Receive hands out an item and hides it for the
+// visibility timeout; Ack removes it for good and Nack makes it visible
+// again at once. Items that are neither acknowledged nor nacked in time are
+// delivered again, and after a restart every unacknowledged item is.
+//
+// Segments and the ack log use the checksummed line format of
+// internal/recordlog, shared with the order store. A torn write at the end
+// of a file is cut off when it is opened. A segment is deleted once every
+// item in it has been acknowledged.
+package diskqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/internal/recordlog"
+)
+
+var (
+	ErrClosed   = errors.New("diskqueue: queue is closed")
+	ErrNotFound = errors.New("diskqueue: item is not in flight")
+	ErrCorrupt  = errors.New("diskqueue: queue files are corrupt")
+)
+
+// Item is one delivery. Attempt counts deliveries since the queue was
+// opened, starting at 1.
+type Item struct {
+	Offset  uint64
+	Data    []byte
+	Attempt int
+}
+
+// entry is an item that has not been acknowledged.
+type entry struct {
+	seg      *segment
+	pos      int64
+	n        int
+	attempts int
+	deadline time.Time // while in flight
+}
+
+type Queue struct {
+	dir      string
+	segSize  int64
+	timeout  time.Duration
+	noSync   bool
+	now      func() time.Time
+	logf     func(format string, args ...any)
+	mu       sync.Mutex
+	segs     []*segment
+	acks     *recordlog.File
+	index    map[uint64]*entry
+	inflight map[uint64]*entry
+	read     uint64 // next offset never delivered
+	wake     chan struct{}
+	closed   bool
+}
+
+type Option func(*Queue)
+
+// WithSegmentSize sets the size in bytes after which a new segment is
+// started. The default is 8 MiB.
+func WithSegmentSize(n int64) Option {
+	return func(q *Queue) { q.segSize = n }
+}
+
+// WithVisibilityTimeout sets how long a received item stays hidden before
+// it is delivered again. The default is 30s.
+func WithVisibilityTimeout(d time.Duration) Option {
+	return func(q *Queue) { q.timeout = d }
+}
+
+// WithNoSync skips fsync after each write. A crash can then lose recent
+// appends and acks, which is fine for tests and little else.
+func WithNoSync() Option {
+	return func(q *Queue) { q.noSync = true }
+}
+
+// WithClock sets the clock used for visibility deadlines.
+func WithClock(now func() time.Time) Option {
+	return func(q *Queue) { q.now = now }
+}
+
+// WithLogger sets where failed background compactions are reported. The
+// default is log.Printf.
+func WithLogger(logf func(format string, args ...any)) Option {
+	return func(q *Queue) { q.logf = logf }
+}
+
+// Open opens the queue in dir, creating it if needed.
+func Open(dir string, opts ...Option) (*Queue, error) {
+	q := &Queue{
+		dir:      dir,
+		segSize:  8 << 20,
+		timeout:  30 * time.Second,
+		now:      time.Now,
+		logf:     log.Printf,
+		index:    make(map[uint64]*entry),
+		inflight: make(map[uint64]*entry),
+		wake:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(q)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	if err := q.load(); err != nil {
+		q.closeFiles()
+		return nil, err
+	}
+	return q, nil
+}
+
+func (q *Queue) load() error {
+	acked := make(map[uint64]bool)
+	var err error
+	q.acks, err = recordlog.Open(filepath.Join(q.dir, "acks.log"), q.noSync, func(rec record, _ int64, _ int) error {
+		acked[rec.Off] = true
+		return nil
+	})
+	if err != nil {
+		return corrupt(err)
+	}
+
+	bases, err := segmentBases(q.dir)
+	if err != nil {
+		return err
+	}
+	for _, base := range bases {
+		if n := len(q.segs); n > 0 && q.segs[n-1].next != base {
+			return fmt.Errorf("%w: segment %s does not follow offset %d", ErrCorrupt, segmentName(base), q.segs[n-1].next)
+		}
+		seg := &segment{base: base, next: base}
+		q.segs = append(q.segs, seg)
+		path := filepath.Join(q.dir, segmentName(base))
+		seg.log, err = recordlog.Open(path, q.noSync, func(rec record, pos int64, n int) error {
+			if rec.Off != seg.next {
+				return fmt.Errorf("%w: offset %d in %s, expected %d", ErrCorrupt, rec.Off, path, seg.next)
+			}
+			seg.next++
+			if !acked[rec.Off] {
+				q.index[rec.Off] = &entry{seg: seg, pos: pos, n: n}
+				seg.live++
+			}
+			return nil
+		})
+		if err != nil {
+			return corrupt(err)
+		}
+	}
+	if len(q.segs) == 0 {
+		if err := q.roll(0); err != nil {
+			return err
+		}
+	}
+	q.read = q.segs[0].base
+	return q.compact()
+}
+
+// corrupt reports a bad record found by recordlog as ErrCorrupt.
+func corrupt(err error) error {
+	if errors.Is(err, recordlog.ErrCorrupt) {
+		return fmt.Errorf("%w: %w", ErrCorrupt, err)
+	}
+	return err
+}
+
+// roll starts a new active segment at base.
+func (q *Queue) roll(base uint64) error {
+	log, err := recordlog.Create(filepath.Join(q.dir, segmentName(base)), q.noSync)
+	if err != nil {
+		return err
+	}
+	q.segs = append(q.segs, &segment{base: base, next: base, log: log})
+	return nil
+}
+
+func (q *Queue) active() *segment { return q.segs[len(q.segs)-1] }
+
+// Append adds data to the tail of the queue and returns its offset. It is
+// on disk when Append returns.
+func (q *Queue) Append(data []byte) (uint64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return 0, ErrClosed
+	}
+	seg := q.active()
+	if seg.log.Size() >= q.segSize && seg.next > seg.base {
+		if err := q.roll(seg.next); err != nil {
+			return 0, err
+		}
+		q.tryCompact()
+		seg = q.active()
+	}
+	off := seg.next
+	pos, n, err := seg.log.Append(record{Off: off, Data: data})
+	if err != nil {
+		return 0, err
+	}
+	q.index[off] = &entry{seg: seg, pos: pos, n: n}
+	seg.next++
+	seg.live++
+	q.signal()
+	return off, nil
+}
+
+// signal wakes every Receive waiting for an item.
+func (q *Queue) signal() {
+	close(q.wake)
+	q.wake = make(chan struct{})
+}
+
+// Receive waits for the next visible item: an expired or nacked one first,
+// lowest offset first, otherwise the oldest never delivered.
+func (q *Queue) Receive(ctx context.Context) (Item, error) {
+	for {
+		q.mu.Lock()
+		if q.closed {
+			q.mu.Unlock()
+			return Item{}, ErrClosed
+		}
+		it, ok, wait, err := q.next()
+		wake := q.wake
+		q.mu.Unlock()
+		if ok || err != nil {
+			return it, err
+		}
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-wake:
+		case <-timeout:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err != nil {
+			return Item{}, err
+		}
+	}
+}
+
+// next delivers the next visible item or, if there is none, says how long
+// until an in-flight one expires (0 if none is in flight).
+func (q *Queue) next() (Item, bool, time.Duration, error) {
+	now := q.now()
+	var (
+		due     uint64
+		found   bool
+		nextDue time.Time
+	)
+	for off, e := range q.inflight {
+		if !e.deadline.After(now) {
+			if !found || off < due {
+				due, found = off, true
+			}
+		} else if nextDue.IsZero() || e.deadline.Before(nextDue) {
+			nextDue = e.deadline
+		}
+	}
+	fresh := false
+	if !found {
+		// skip acknowledged offsets, but only move past an item once it
+		// has been read, so a failed read is retried rather than lost
+		for ; q.read < q.active().next; q.read++ {
+			if _, ok := q.index[q.read]; ok {
+				due, found, fresh = q.read, true, true
+				break
+			}
+		}
+	}
+	if !found {
+		var wait time.Duration
+		if !nextDue.IsZero() {
+			wait = max(nextDue.Sub(now), time.Millisecond)
+		}
+		return Item{}, false, wait, nil
+	}
+
+	e := q.index[due]
+	data, err := q.readData(due, e)
+	if err != nil {
+		return Item{}, false, 0, err
+	}
+	if fresh {
+		q.read = due + 1
+	}
+	e.attempts++
+	e.deadline = now.Add(q.timeout)
+	q.inflight[due] = e
+	return Item{Offset: due, Data: data, Attempt: e.attempts}, true, 0, nil
+}
+
+func (q *Queue) readData(off uint64, e *entry) ([]byte, error) {
+	var rec record
+	if err := e.seg.log.ReadAt(e.pos, e.n, &rec); err != nil || rec.Off != off {
+		return nil, fmt.Errorf("%w: offset %d in %s does not read back", ErrCorrupt, off, e.seg.log.Name())
+	}
+	return rec.Data, nil
+}
+
+// Ack removes an in-flight item from the queue for good. Once the ack is
+// on disk Ack succeeds; deleting a segment it emptied is left to a later
+// compaction if it fails.
+func (q *Queue) Ack(off uint64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	e, ok := q.inflight[off]
+	if !ok {
+		return ErrNotFound
+	}
+	if _, _, err := q.acks.Append(record{Off: off}); err != nil {
+		return err
+	}
+	delete(q.inflight, off)
+	delete(q.index, off)
+	e.seg.live--
+	if e.seg.live == 0 && e.seg == q.segs[0] && e.seg != q.active() {
+		q.tryCompact()
+	}
+	return nil
+}
+
+// Nack puts an in-flight item back so it is delivered again right away.
+func (q *Queue) Nack(off uint64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	e, ok := q.inflight[off]
+	if !ok {
+		return ErrNotFound
+	}
+	e.deadline = q.now()
+	q.signal()
+	return nil
+}
+
+// Compact deletes the oldest segments whose items have all been
+// acknowledged and rewrites the ack log without them. Ack and Append do
+// this on their own whenever the oldest segment empties or a new one is
+// started.
+func (q *Queue) Compact() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	return q.compact()
+}
+
+// tryCompact compacts after a write that has already succeeded, so a
+// failure is logged rather than returned; the next compaction retries.
+func (q *Queue) tryCompact() {
+	if err := q.compact(); err != nil {
+		q.logf("diskqueue: compacting %s: %v", q.dir, err)
+	}
+}
+
+func (q *Queue) compact() error {
+	n := 0
+	for n < len(q.segs)-1 && q.segs[n].live == 0 {
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	for i, seg := range q.segs[:n] {
+		seg.log.Close()
+		if err := os.Remove(seg.log.Name()); err != nil && !errors.Is(err, os.ErrNotExist) {
+			q.segs = slices.Delete(q.segs, 0, i)
+			return err
+		}
+	}
+	q.segs = slices.Delete(q.segs, 0, n)
+	return q.rewriteAcks()
+}
+
+// rewriteAcks replaces the ack log with the acks of the remaining
+// segments, which are exactly their offsets missing from the index.
+func (q *Queue) rewriteAcks() error {
+	return q.acks.Rewrite(func(add func(any) error) error {
+		for off := q.segs[0].base; off < q.active().next; off++ {
+			if _, ok := q.index[off]; ok {
+				continue
+			}
+			if err := add(record{Off: off}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Len returns the number of items not yet acknowledged, in flight or not.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.index)
+}
+
+// InFlight returns the number of items received but not yet acknowledged.
+func (q *Queue) InFlight() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.inflight)
+}
+
+// Close closes the queue files. Waiting Receive calls return ErrClosed.
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	q.signal()
+	return q.closeFiles()
+}
+
+func (q *Queue) closeFiles() error {
+	var errs []error
+	for _, seg := range q.segs {
+		if seg.log != nil {
+			errs = append(errs, seg.log.Close())
+		}
+	}
+	if q.acks != nil {
+		errs = append(errs, q.acks.Close())
+	}
+	return errors.Join(errs...)
+}
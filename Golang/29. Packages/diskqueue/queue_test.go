@@ -0,0 +1,366 @@
+package diskqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func open(t *testing.T, dir string, opts ...Option) *Queue {
+	t.Helper()
+	q, err := Open(dir, append([]Option{WithNoSync()}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+func appendN(t *testing.T, q *Queue, n int) {
+	t.Helper()
+	for i := range n {
+		if _, err := q.Append(fmt.Appendf(nil, "item %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// receive gets the next item without waiting.
+func receive(t *testing.T, q *Queue) Item {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	it, err := q.Receive(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return it
+}
+
+func empty(t *testing.T, q *Queue) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if it, err := q.Receive(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Receive = %+v, %v; want nothing visible", it, err)
+	}
+}
+
+func TestFIFO(t *testing.T) {
+	q := open(t, t.TempDir())
+	appendN(t, q, 5)
+	for i := range 5 {
+		it := receive(t, q)
+		if it.Offset != uint64(i) || string(it.Data) != fmt.Sprintf("item %d", i) || it.Attempt != 1 {
+			t.Fatalf("item %d = %+v", i, it)
+		}
+		if err := q.Ack(it.Offset); err != nil {
+			t.Fatal(err)
+		}
+	}
+	empty(t, q)
+	if err := q.Ack(0); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second Ack: err = %v, want ErrNotFound", err)
+	}
+	if q.Len() != 0 {
+		t.Errorf("Len = %d", q.Len())
+	}
+}
+
+func TestReceiveWaitsForAppend(t *testing.T) {
+	q := open(t, t.TempDir())
+	got := make(chan Item)
+	go func() {
+		it, err := q.Receive(context.Background())
+		if err == nil {
+			got <- it
+		}
+	}()
+	time.Sleep(10 * time.Millisecond)
+	appendN(t, q, 1)
+	select {
+	case it := <-got:
+		if it.Offset != 0 {
+			t.Errorf("got %+v", it)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Receive did not wake up")
+	}
+}
+
+func TestVisibilityTimeout(t *testing.T) {
+	var mu sync.Mutex
+	now := time.Date(2026, time.May, 4, 10, 0, 0, 0, time.UTC)
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		mu.Lock()
+		now = now.Add(d)
+		mu.Unlock()
+	}
+	q := open(t, t.TempDir(), WithClock(clock), WithVisibilityTimeout(time.Minute))
+	appendN(t, q, 2)
+
+	first := receive(t, q)
+	second := receive(t, q)
+	empty(t, q)
+	if q.InFlight() != 2 {
+		t.Fatalf("InFlight = %d, want 2", q.InFlight())
+	}
+	if err := q.Ack(second.Offset); err != nil {
+		t.Fatal(err)
+	}
+
+	advance(59 * time.Second)
+	empty(t, q)
+	advance(time.Second)
+	it := receive(t, q)
+	if it.Offset != first.Offset || it.Attempt != 2 {
+		t.Errorf("redelivered %+v, want offset %d attempt 2", it, first.Offset)
+	}
+
+	if err := q.Nack(it.Offset); err != nil {
+		t.Fatal(err)
+	}
+	if it := receive(t, q); it.Offset != first.Offset || it.Attempt != 3 {
+		t.Errorf("after Nack got %+v, want offset %d attempt 3", it, first.Offset)
+	}
+}
+
+// Everything appended survives a restart; whatever was not acknowledged,
+// in flight or not, is delivered again.
+func TestReopen(t *testing.T) {
+	dir := t.TempDir()
+	q, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendN(t, q, 4)
+	for range 3 {
+		it := receive(t, q)
+		if it.Offset != 1 {
+			q.Ack(it.Offset)
+		}
+	}
+	q.Close() // offset 1 in flight, 3 never delivered
+
+	q = open(t, dir)
+	if q.Len() != 2 {
+		t.Fatalf("Len after reopen = %d, want 2", q.Len())
+	}
+	for _, want := range []uint64{1, 3} {
+		if it := receive(t, q); it.Offset != want {
+			t.Errorf("got offset %d, want %d", it.Offset, want)
+		}
+	}
+	if off, err := q.Append([]byte("more")); err != nil || off != 4 {
+		t.Errorf("Append after reopen = %d, %v; want offset 4", off, err)
+	}
+}
+
+func TestTornTail(t *testing.T) {
+	dir := t.TempDir()
+	q, err := Open(dir, WithNoSync())
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendN(t, q, 3)
+	q.Ack(receive(t, q).Offset)
+	q.Close()
+
+	for _, name := range []string{segmentName(0), "acks.log"} {
+		f, err := os.OpenFile(filepath.Join(dir, name), os.O_APPEND|os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(`12345678 {"off":3,"da`)
+		f.Close()
+	}
+
+	q = open(t, dir)
+	if q.Len() != 2 {
+		t.Fatalf("Len = %d, want 2", q.Len())
+	}
+	if off, err := q.Append([]byte("x")); err != nil || off != 3 {
+		t.Fatalf("Append = %d, %v; want offset 3", off, err)
+	}
+	for _, want := range []uint64{1, 2, 3} {
+		if it := receive(t, q); it.Offset != want {
+			t.Errorf("got offset %d, want %d", it.Offset, want)
+		}
+	}
+}
+
+func TestCorruptMiddle(t *testing.T) {
+	dir := t.TempDir()
+	q, err := Open(dir, WithNoSync())
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendN(t, q, 3)
+	q.Close()
+
+	path := filepath.Join(dir, segmentName(0))
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b[12] ^= 0xff // inside the first record
+	os.WriteFile(path, b, 0o644)
+	if _, err := Open(dir, WithNoSync()); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("Open: err = %v, want ErrCorrupt", err)
+	}
+}
+
+// An item that can't be read back is reported every time, not skipped.
+func TestUnreadableItem(t *testing.T) {
+	dir := t.TempDir()
+	q := open(t, dir)
+	appendN(t, q, 2)
+
+	path := filepath.Join(dir, segmentName(0))
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt([]byte("x"), 12)
+	f.Close()
+
+	for range 2 {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		_, err := q.Receive(ctx)
+		cancel()
+		if !errors.Is(err, ErrCorrupt) {
+			t.Fatalf("Receive: err = %v, want ErrCorrupt", err)
+		}
+	}
+}
+
+func TestCompaction(t *testing.T) {
+	dir := t.TempDir()
+	q := open(t, dir, WithSegmentSize(1))
+	appendN(t, q, 4) // one item per segment
+	segs := func() int {
+		names, _ := filepath.Glob(filepath.Join(dir, "*.seg"))
+		return len(names)
+	}
+	if n := segs(); n != 4 {
+		t.Fatalf("%d segments, want 4", n)
+	}
+
+	// acking 1 leaves segment 0 in place; acking 0 frees both
+	a, b := receive(t, q), receive(t, q)
+	if err := q.Ack(b.Offset); err != nil {
+		t.Fatal(err)
+	}
+	if n := segs(); n != 4 {
+		t.Errorf("%d segments after acking offset 1, want 4", n)
+	}
+	if err := q.Ack(a.Offset); err != nil {
+		t.Fatal(err)
+	}
+	if n := segs(); n != 2 {
+		t.Errorf("%d segments after acking offsets 0 and 1, want 2", n)
+	}
+
+	// the active segment is kept even when it is empty
+	for range 2 {
+		q.Ack(receive(t, q).Offset)
+	}
+	if n := segs(); n != 1 {
+		t.Errorf("%d segments after acking everything, want 1", n)
+	}
+	q.Close()
+
+	acks, err := os.ReadFile(filepath.Join(dir, "acks.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q = open(t, dir)
+	if q.Len() != 0 {
+		t.Errorf("Len after reopen = %d, want 0 (acks %q)", q.Len(), acks)
+	}
+	if off, err := q.Append([]byte("x")); err != nil || off != 4 {
+		t.Errorf("Append = %d, %v; want offset 4", off, err)
+	}
+}
+
+func TestCompactionFailureIsNotAnAckFailure(t *testing.T) {
+	dir := t.TempDir()
+	var logged []string
+	q := open(t, dir, WithSegmentSize(1), WithLogger(func(format string, args ...any) {
+		logged = append(logged, fmt.Sprintf(format, args...))
+	}))
+	appendN(t, q, 2)
+
+	// swap the first segment for a non-empty directory of the same name,
+	// so deleting it fails once its only item is acked
+	it := receive(t, q)
+	seg := filepath.Join(dir, segmentName(0))
+	if err := os.Rename(seg, seg+".moved"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(seg, "x"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Ack(it.Offset); err != nil {
+		t.Fatalf("Ack = %v, want success once the ack is written", err)
+	}
+	if len(logged) != 1 {
+		t.Errorf("logged %q, want one compaction failure", logged)
+	}
+
+	os.RemoveAll(seg)
+	if err := q.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if q.Len() != 1 {
+		t.Errorf("Len = %d, want 1", q.Len())
+	}
+	if it := receive(t, q); it.Offset != 1 {
+		t.Errorf("got offset %d, want 1", it.Offset)
+	}
+}
+
+func TestChan(t *testing.T) {
+	q := open(t, t.TempDir())
+	appendN(t, q, 3)
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := q.Chan(ctx)
+	for i := range 3 {
+		if got := string(<-ch); got != fmt.Sprintf("item %d", i) {
+			t.Errorf("got %q", got)
+		}
+	}
+	cancel()
+	for range ch {
+	}
+	if q.Len() != 0 {
+		t.Errorf("Len = %d, want 0", q.Len())
+	}
+}
+
+func TestClose(t *testing.T) {
+	q := open(t, t.TempDir())
+	done := make(chan error)
+	go func() {
+		_, err := q.Receive(context.Background())
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	q.Close()
+	if err := <-done; !errors.Is(err, ErrClosed) {
+		t.Errorf("Receive: err = %v, want ErrClosed", err)
+	}
+	if _, err := q.Append(nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("Append: err = %v, want ErrClosed", err)
+	}
+}
@@ -0,0 +1,47 @@
+package diskqueue
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rajasur/programming-learning/GO/internal/recordlog"
+)
+
+// record is one line of a segment or of the ack log. Segment records carry
+// Data; ack records only the offset.
+type record struct {
+	Off  uint64 `json:"off"`
+	Data []byte `json:"data,omitempty"`
+}
+
+// segment is one file of the queue, holding offsets [base, next).
+type segment struct {
+	base uint64
+	next uint64
+	log  *recordlog.File
+	live int // records not yet acknowledged
+}
+
+func segmentName(base uint64) string {
+	return fmt.Sprintf("%020d.seg", base)
+}
+
+// segmentBases lists the segment files in dir, oldest first.
+func segmentBases(dir string) ([]uint64, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+	if err != nil {
+		return nil, err
+	}
+	var bases []uint64
+	for _, name := range names {
+		base, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(name), ".seg"), 10, 64)
+		if err != nil {
+			continue
+		}
+		bases = append(bases, base)
+	}
+	// zero-padded names glob in numeric order
+	return bases, nil
+}
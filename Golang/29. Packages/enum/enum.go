@@ -0,0 +1,162 @@
+// Package enum gives iota style enums names, parsing and text/JSON
+// encoding without writing the same switch statements for every type.
+//
+// Declare a Set next to the constants and forward the methods to it:
+//
+//	type Color int
+//
+//	const (
+//		Red Color = iota
+//		Green
+//	)
+//
+//	var colors = enum.New("Color", map[Color]string{Red: "red", Green: "green"})
+//
+//	func (c Color) String() string                { return colors.Name(c) }
+//	func (c Color) MarshalText() ([]byte, error)  { return colors.MarshalText(c) }
+//	func (c *Color) UnmarshalText(b []byte) error { return colors.UnmarshalText(b, c) }
+package enum
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// UnknownError is returned when a name or value isn't part of the enum.
+type UnknownError struct {
+	Type  string
+	Value string
+	Valid []string
+}
+
+func (e *UnknownError) Error() string {
+	return fmt.Sprintf("unknown %s %q, valid values are: %s", e.Type, e.Value, strings.Join(e.Valid, ", "))
+}
+
+// Set holds the names of an enum type. It is read only after New, so it is
+// safe for concurrent use.
+type Set[T cmp.Ordered] struct {
+	typeName string
+	values   []T
+	names    map[T]string
+	byName   map[string]T
+}
+
+// New creates a Set. typeName is used in error messages. Names are
+// matched case-insensitively when parsing, so they must be unique ignoring
+// case.
+func New[T cmp.Ordered](typeName string, names map[T]string) *Set[T] {
+	s := &Set[T]{
+		typeName: typeName,
+		values:   slices.Sorted(maps.Keys(names)),
+		names:    maps.Clone(names),
+		byName:   make(map[string]T, len(names)),
+	}
+	for v, name := range names {
+		key := strings.ToLower(name)
+		if _, dup := s.byName[key]; dup {
+			panic(fmt.Sprintf("enum: %s has duplicate name %q", typeName, name))
+		}
+		s.byName[key] = v
+	}
+	return s
+}
+
+// Name returns the name of v, or "Type(v)" when v is not a known value.
+func (s *Set[T]) Name(v T) string {
+	if name, ok := s.names[v]; ok {
+		return name
+	}
+	return fmt.Sprintf("%s(%v)", s.typeName, underlying(v))
+}
+
+// Valid reports whether v is one of the declared values.
+func (s *Set[T]) Valid(v T) bool {
+	_, ok := s.names[v]
+	return ok
+}
+
+// Values lists every declared value in ascending order.
+func (s *Set[T]) Values() []T {
+	return slices.Clone(s.values)
+}
+
+// Names lists the names of Values, in the same order.
+func (s *Set[T]) Names() []string {
+	names := make([]string, len(s.values))
+	for i, v := range s.values {
+		names[i] = s.names[v]
+	}
+	return names
+}
+
+// Parse looks name up ignoring case and surrounding spaces.
+func (s *Set[T]) Parse(name string) (T, error) {
+	v, ok := s.byName[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		var zero T
+		return zero, s.unknown(name)
+	}
+	return v, nil
+}
+
+func (s *Set[T]) MarshalText(v T) ([]byte, error) {
+	name, ok := s.names[v]
+	if !ok {
+		return nil, s.unknown(fmt.Sprint(underlying(v)))
+	}
+	return []byte(name), nil
+}
+
+func (s *Set[T]) UnmarshalText(b []byte, v *T) error {
+	parsed, err := s.Parse(string(b))
+	if err != nil {
+		return err
+	}
+	*v = parsed
+	return nil
+}
+
+func (s *Set[T]) EncodeJSON(v T) ([]byte, error) {
+	name, err := s.MarshalText(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(string(name))
+}
+
+// DecodeJSON only accepts JSON strings; numbers are rejected so that
+// reordering the constants can't silently change stored data.
+func (s *Set[T]) DecodeJSON(b []byte, v *T) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err != nil {
+		return fmt.Errorf("%s must be a JSON string: %w", s.typeName, err)
+	}
+	return s.UnmarshalText([]byte(name), v)
+}
+
+func (s *Set[T]) unknown(value string) error {
+	return &UnknownError{Type: s.typeName, Value: value, Valid: s.Names()}
+}
+
+// underlying strips the named type off v so that printing it doesn't call
+// back into a String method that uses this Set.
+func underlying(v any) any {
+	rv := reflect.ValueOf(v)
+	switch {
+	case rv.CanInt():
+		return rv.Int()
+	case rv.CanUint():
+		return rv.Uint()
+	case rv.CanFloat():
+		return rv.Float()
+	case rv.Kind() == reflect.String:
+		return rv.String()
+	}
+	return v
+}
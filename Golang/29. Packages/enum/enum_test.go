@@ -0,0 +1,147 @@
+package enum
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type color int
+
+const (
+	red color = iota
+	green
+	blue
+)
+
+var colors = New("color", map[color]string{blue: "blue", red: "red", green: "green"})
+
+func (c color) String() string                { return colors.Name(c) }
+func (c color) MarshalText() ([]byte, error)  { return colors.MarshalText(c) }
+func (c *color) UnmarshalText(b []byte) error { return colors.UnmarshalText(b, c) }
+
+// size is forwarded to EncodeJSON and DecodeJSON rather than the text
+// methods, like order.Status.
+type size string
+
+var sizes = New("size", map[size]string{"s": "small", "l": "large"})
+
+func (s size) MarshalJSON() ([]byte, error)  { return sizes.EncodeJSON(s) }
+func (s *size) UnmarshalJSON(b []byte) error { return sizes.DecodeJSON(b, s) }
+
+func TestName(t *testing.T) {
+	for _, tc := range []struct {
+		got, want string
+	}{
+		{green.String(), "green"},
+		{color(7).String(), "color(7)"}, // must not recurse into String
+		{color(-1).String(), "color(-1)"},
+		{sizes.Name("xl"), `size(xl)`},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("got %q, want %q", tc.got, tc.want)
+		}
+	}
+	if colors.Valid(color(7)) || !colors.Valid(blue) {
+		t.Error("Valid is wrong")
+	}
+	if !slices.Equal(colors.Values(), []color{red, green, blue}) || !slices.Equal(colors.Names(), []string{"red", "green", "blue"}) {
+		t.Errorf("Values %v, Names %v", colors.Values(), colors.Names())
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, in := range []string{"green", "GREEN", " Green\t"} {
+		if c, err := colors.Parse(in); err != nil || c != green {
+			t.Errorf("Parse(%q) = %v, %v", in, c, err)
+		}
+	}
+	_, err := colors.Parse("purple")
+	var ue *UnknownError
+	if !errors.As(err, &ue) || ue.Type != "color" || ue.Value != "purple" {
+		t.Fatalf("Parse(purple) = %v", err)
+	}
+	if want := `unknown color "purple", valid values are: red, green, blue`; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err, want)
+	}
+}
+
+func TestText(t *testing.T) {
+	b, err := blue.MarshalText()
+	if err != nil || string(b) != "blue" {
+		t.Errorf("MarshalText = %q, %v", b, err)
+	}
+	_, err = color(9).MarshalText()
+	var ue *UnknownError
+	if !errors.As(err, &ue) || ue.Value != "9" {
+		t.Errorf("MarshalText of an unknown value = %v", err)
+	}
+
+	c := green
+	if err := c.UnmarshalText([]byte("Blue")); err != nil || c != blue {
+		t.Errorf("UnmarshalText(Blue) = %v, %v", c, err)
+	}
+	if err := c.UnmarshalText([]byte("2")); !errors.As(err, &ue) || c != blue {
+		t.Errorf("UnmarshalText(2) = %v and changed the value to %v", err, c)
+	}
+}
+
+// Types with text methods get JSON strings and map keys from encoding/json.
+func TestTextJSON(t *testing.T) {
+	in := map[color][]color{red: {green, blue}}
+	b, err := json.Marshal(in)
+	if err != nil || string(b) != `{"red":["green","blue"]}` {
+		t.Fatalf("Marshal = %s, %v", b, err)
+	}
+	var out map[color][]color
+	if err := json.Unmarshal(b, &out); err != nil || !slices.Equal(out[red], in[red]) {
+		t.Errorf("round trip = %v, %v", out, err)
+	}
+	if _, err := json.Marshal([]color{color(5)}); err == nil {
+		t.Error("Marshal accepted an unknown value")
+	}
+}
+
+func TestEncodeDecodeJSON(t *testing.T) {
+	type shirt struct {
+		Size size `json:"size"`
+	}
+	b, err := json.Marshal(shirt{"l"})
+	if err != nil || string(b) != `{"size":"large"}` {
+		t.Fatalf("Marshal = %s, %v", b, err)
+	}
+	var s shirt
+	if err := json.Unmarshal(b, &s); err != nil || s.Size != "l" {
+		t.Errorf("round trip = %+v, %v", s, err)
+	}
+	if _, err := json.Marshal(shirt{"xl"}); err == nil {
+		t.Error("Marshal accepted an unknown value")
+	}
+
+	for _, tc := range []struct {
+		json, want string
+	}{
+		{`{"size":"medium"}`, `unknown size "medium", valid values are: large, small`},
+		{`{"size":0}`, "size must be a JSON string"},
+	} {
+		s := shirt{"s"}
+		err := json.Unmarshal([]byte(tc.json), &s)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("Unmarshal(%s) = %v, want %q", tc.json, err, tc.want)
+		}
+		if s.Size != "s" {
+			t.Errorf("Unmarshal(%s) changed the value to %q", tc.json, s.Size)
+		}
+	}
+}
+
+func TestDuplicateNamePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("New accepted names that only differ in case")
+		}
+	}()
+	New("dup", map[int]string{1: "One", 2: "one"})
+}
@@ -0,0 +1,253 @@
+// Package recordlog implements the append-only log format shared by the
+// order store, the deadline journal and the disk queue. Each record is one
+// line of JSON behind its CRC-32C checksum:
+//
+//	<crc32 as 8 hex digits> <json>\n
+//
+// A bad record at the very end of a file is a write torn by a crash and is
+// cut off when the file is opened; one followed by more data means the file
+// is damaged.
+package recordlog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// ErrCorrupt is returned by Open for a bad record that is not the last
+// one. Open callbacks return it to reject a record that decoded fine but
+// makes no sense to them, so it is treated like a checksum mismatch.
+var ErrCorrupt = errors.New("bad record")
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Encode frames v as one record line.
+func Encode(v any) ([]byte, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	out := fmt.Appendf(nil, "%08x ", crc32.Checksum(payload, castagnoli))
+	out = append(out, payload...)
+	return append(out, '\n'), nil
+}
+
+// Decode checks the checksum of line and unmarshals its payload into v.
+func Decode(line []byte, v any) bool {
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	if len(line) < 10 || line[8] != ' ' {
+		return false
+	}
+	sum, err := strconv.ParseUint(string(line[:8]), 16, 32)
+	if err != nil {
+		return false
+	}
+	payload := line[9:]
+	return crc32.Checksum(payload, castagnoli) == uint32(sum) && json.Unmarshal(payload, v) == nil
+}
+
+// File is an open log. It is not safe for concurrent use.
+type File struct {
+	f      *os.File
+	path   string
+	size   int64
+	noSync bool
+}
+
+// Open opens or creates the log at path and calls fn with every record in
+// it, together with the record's offset and length in bytes. A torn tail
+// is truncated and the file is left positioned for appending. noSync skips
+// every fsync, including the one after a truncation.
+func Open[T any](path string, noSync bool, fn func(rec T, pos int64, n int) error) (*File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return Create(path, noSync)
+	}
+	if err != nil {
+		return nil, err
+	}
+	l := &File{f: f, path: path, noSync: noSync}
+	if err := scan(l, fn); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Create creates an empty log at path, failing if the file exists. Unless
+// noSync is set the directory is synced so the file survives a crash.
+func Create(path string, noSync bool) (*File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if !noSync {
+		if err := SyncDir(filepath.Dir(path)); err != nil {
+			f.Close()
+			os.Remove(path)
+			return nil, err
+		}
+	}
+	return &File{f: f, path: path, noSync: noSync}, nil
+}
+
+func scan[T any](l *File, fn func(rec T, pos int64, n int) error) error {
+	r := bufio.NewReaderSize(l.f, 1<<20)
+	var good int64 // offset just past the last valid record
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				return l.truncate(good)
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		var rec T
+		err = ErrCorrupt
+		if Decode(line, &rec) {
+			err = fn(rec, good, len(line))
+		}
+		if errors.Is(err, ErrCorrupt) {
+			// only acceptable as the very last record
+			if _, err := r.Peek(1); err == io.EOF {
+				return l.truncate(good)
+			}
+			return fmt.Errorf("%w at offset %d of %s", ErrCorrupt, good, l.path)
+		}
+		if err != nil {
+			return err
+		}
+		good += int64(len(line))
+	}
+	l.size = good
+	_, err := l.f.Seek(good, io.SeekStart)
+	return err
+}
+
+// truncate cuts the file at size, makes that durable and moves the write
+// position there.
+func (l *File) truncate(size int64) error {
+	if err := l.f.Truncate(size); err != nil {
+		return err
+	}
+	if err := l.sync(); err != nil {
+		return err
+	}
+	l.size = size
+	_, err := l.f.Seek(size, io.SeekStart)
+	return err
+}
+
+func (l *File) sync() error {
+	if l.noSync {
+		return nil
+	}
+	return l.f.Sync()
+}
+
+// Append writes v as one record and syncs it. It returns the record's
+// offset and length. If the write or the sync fails, the file is cut back
+// to its previous size so no partial record is left behind.
+func (l *File) Append(v any) (pos int64, n int, err error) {
+	b, err := Encode(v)
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, err := l.f.Write(b); err != nil {
+		l.truncate(l.size)
+		return 0, 0, err
+	}
+	if err := l.sync(); err != nil {
+		l.truncate(l.size)
+		return 0, 0, err
+	}
+	pos = l.size
+	l.size += int64(len(b))
+	return pos, len(b), nil
+}
+
+// ReadAt decodes the record of length n at pos into v.
+func (l *File) ReadAt(pos int64, n int, v any) error {
+	b := make([]byte, n)
+	if _, err := l.f.ReadAt(b, pos); err != nil {
+		return err
+	}
+	if !Decode(b, v) {
+		return fmt.Errorf("%w at offset %d of %s", ErrCorrupt, pos, l.path)
+	}
+	return nil
+}
+
+// Rewrite replaces the log with the records fn adds, through a temporary
+// file that is renamed into place, so a crash leaves either the old or the
+// new log. On error the old log stays in use.
+func (l *File) Rewrite(fn func(add func(v any) error) error) error {
+	path := l.path
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".compact-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	w := bufio.NewWriterSize(tmp, 1<<20)
+	var size int64
+	err = fn(func(v any) error {
+		b, err := Encode(v)
+		if err != nil {
+			return err
+		}
+		size += int64(len(b))
+		_, err = w.Write(b)
+		return err
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil && !l.noSync {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	// the rename happened, so the new file is the log from here on
+	l.f.Close()
+	l.f, l.size = tmp, size
+	if l.noSync {
+		return nil
+	}
+	return SyncDir(filepath.Dir(path))
+}
+
+// Size returns the length of the log in bytes.
+func (l *File) Size() int64 { return l.size }
+
+// Name returns the path the log was opened with.
+func (l *File) Name() string { return l.path }
+
+func (l *File) Close() error { return l.f.Close() }
+
+// SyncDir makes a file creation, rename or removal in dir durable.
+func SyncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
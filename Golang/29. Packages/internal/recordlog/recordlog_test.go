@@ -0,0 +1,174 @@
+package recordlog
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+type rec struct {
+	N int `json:"n"`
+}
+
+func open(t *testing.T, path string) (*File, []int) {
+	t.Helper()
+	var got []int
+	l, err := Open(path, true, func(r rec, _ int64, _ int) error {
+		if r.N < 0 {
+			return ErrCorrupt
+		}
+		got = append(got, r.N)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l, got
+}
+
+func TestEncodeDecode(t *testing.T) {
+	b, err := Encode(rec{N: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "cb29818d {\"n\":7}\n"; string(b) != want {
+		t.Errorf("Encode = %q, want %q", b, want)
+	}
+	var r rec
+	if !Decode(b, &r) || r.N != 7 {
+		t.Errorf("Decode = %v, %+v", Decode(b, &r), r)
+	}
+	for _, bad := range []string{"cb29818d {\"n\":8}\n", "cb29818d{\"n\":7}\n", "zzzzzzzz {\"n\":7}\n", "f1b1 {}\n", ""} {
+		if Decode([]byte(bad), &r) {
+			t.Errorf("Decode(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestAppendReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	l, _ := open(t, path)
+	var size int64
+	for i := range 3 {
+		pos, n, err := l.Append(rec{N: i})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pos != size {
+			t.Errorf("record %d at %d, want %d", i, pos, size)
+		}
+		size += int64(n)
+		var r rec
+		if err := l.ReadAt(pos, n, &r); err != nil || r.N != i {
+			t.Errorf("ReadAt(%d) = %+v, %v", pos, r, err)
+		}
+	}
+	if l.Size() != size {
+		t.Errorf("Size = %d, want %d", l.Size(), size)
+	}
+	l.Close()
+
+	l, got := open(t, path)
+	defer l.Close()
+	if !slices.Equal(got, []int{0, 1, 2}) || l.Size() != size {
+		t.Errorf("reopened: %v, size %d", got, l.Size())
+	}
+}
+
+func TestTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	a, _ := Encode(rec{N: 1})
+	b, _ := Encode(rec{N: 2})
+	for name, tail := range map[string][]byte{
+		"partial line": b[:len(b)-4],
+		"no newline":   b[:len(b)-1],
+		"bad checksum": append([]byte("00000000"), b[8:]...),
+		"rejected":     must(Encode(rec{N: -1})),
+	} {
+		t.Run(name, func(t *testing.T) {
+			os.WriteFile(path, append(slices.Clone(a), tail...), 0o644)
+			l, got := open(t, path)
+			if !slices.Equal(got, []int{1}) || l.Size() != int64(len(a)) {
+				t.Fatalf("got %v, size %d", got, l.Size())
+			}
+			// the next append goes right after the last good record
+			if _, _, err := l.Append(rec{N: 3}); err != nil {
+				t.Fatal(err)
+			}
+			l.Close()
+			data, _ := os.ReadFile(path)
+			if want := append(slices.Clone(a), must(Encode(rec{N: 3}))...); string(data) != string(want) {
+				t.Errorf("file = %q, want %q", data, want)
+			}
+		})
+	}
+}
+
+func TestCorruptMiddle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	a, _ := Encode(rec{N: 1})
+	b, _ := Encode(rec{N: 2})
+	a[10] = 'x'
+	os.WriteFile(path, append(a, b...), 0o644)
+	_, err := Open(path, true, func(rec, int64, int) error { return nil })
+	if !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("Open = %v, want ErrCorrupt", err)
+	}
+	if data, _ := os.ReadFile(path); len(data) != len(a)+len(b) {
+		t.Error("damaged file was truncated")
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "log")
+	l, _ := open(t, path)
+	for i := range 10 {
+		l.Append(rec{N: i})
+	}
+	err := l.Rewrite(func(add func(any) error) error {
+		for _, n := range []int{3, 5} {
+			if err := add(rec{N: n}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Name() != path {
+		t.Errorf("Name = %q after rewrite", l.Name())
+	}
+	l.Append(rec{N: 6})
+	l.Close()
+
+	l, got := open(t, path)
+	l.Close()
+	if !slices.Equal(got, []int{3, 5, 6}) {
+		t.Errorf("after rewrite: %v", got)
+	}
+	if names, _ := filepath.Glob(filepath.Join(dir, "*")); len(names) != 1 {
+		t.Errorf("left behind: %v", names)
+	}
+
+	// a failed rewrite keeps the old log
+	l, _ = open(t, path)
+	boom := errors.New("boom")
+	if err := l.Rewrite(func(func(any) error) error { return boom }); err != boom {
+		t.Errorf("Rewrite = %v", err)
+	}
+	l.Close()
+	if _, got := open(t, path); !slices.Equal(got, []int{3, 5, 6}) {
+		t.Errorf("after failed rewrite: %v", got)
+	}
+}
+
+func must(b []byte, err error) []byte {
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
@@ -0,0 +1,58 @@
+package inventory
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// Adjustment is one entry of the audit trail: what changed on a level,
+// why, and the level afterwards.
+type Adjustment struct {
+	Seq      int64     `json:"seq"`
+	At       time.Time `json:"at"`
+	Key      Key       `json:"key"`
+	OnHand   int64     `json:"on_hand"`  // change to stock on hand
+	Reserved int64     `json:"reserved"` // change to reserved stock
+	Reason   string    `json:"reason"`
+	Order    string    `json:"order,omitempty"`
+	Actor    string    `json:"actor,omitempty"`
+	After    Level     `json:"after"`
+}
+
+// audit is the append-only trail. Entries are added with the level
+// locked, so the entries of one level are in the order they happened.
+type audit struct {
+	mu      sync.Mutex
+	entries []Adjustment
+}
+
+func (a *audit) add(adj Adjustment) {
+	a.mu.Lock()
+	adj.Seq = int64(len(a.entries) + 1)
+	a.entries = append(a.entries, adj)
+	a.mu.Unlock()
+}
+
+// Audit returns the trail of k, oldest first.
+func (inv *Inventory) Audit(k Key) []Adjustment {
+	inv.audit.mu.Lock()
+	defer inv.audit.mu.Unlock()
+	var out []Adjustment
+	for _, a := range inv.audit.entries {
+		if a.Key == k {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// AuditSince returns every entry with Seq > after.
+func (inv *Inventory) AuditSince(after int64) []Adjustment {
+	inv.audit.mu.Lock()
+	defer inv.audit.mu.Unlock()
+	if after >= int64(len(inv.audit.entries)) {
+		return nil
+	}
+	return slices.Clone(inv.audit.entries[max(after, 0):])
+}
@@ -0,0 +1,250 @@
+// Package inventory tracks stock per SKU and location and holds it for
+// orders between checkout and confirmation so it can't be sold twice.
+//
+// Every stock level has its own lock, so orders for different products
+// never wait on each other. A reservation covering several levels takes
+// their locks in a fixed order, which rules out deadlock between two
+// orders wanting the same items.
+package inventory
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInsufficientStock = errors.New("inventory: insufficient stock")
+	ErrNoReservation     = errors.New("inventory: no reservation for order")
+	ErrReservationExists = errors.New("inventory: order already has a reservation")
+	ErrExpired           = errors.New("inventory: reservation expired")
+	ErrInvalidQuantity   = errors.New("inventory: quantity must be positive")
+)
+
+// Key identifies one stock level.
+type Key struct {
+	SKU      string `json:"sku"`
+	Location string `json:"location"`
+}
+
+func (k Key) String() string { return k.SKU + "@" + k.Location }
+
+func compareKeys(a, b Key) int {
+	return cmp.Or(strings.Compare(a.SKU, b.SKU), strings.Compare(a.Location, b.Location))
+}
+
+// ShortageError says which level couldn't cover a request. It matches
+// ErrInsufficientStock.
+type ShortageError struct {
+	Key       Key
+	Requested int64
+	Available int64
+}
+
+func (e *ShortageError) Error() string {
+	return fmt.Sprintf("inventory: %v has %d available, %d requested", e.Key, e.Available, e.Requested)
+}
+
+func (e *ShortageError) Is(target error) bool { return target == ErrInsufficientStock }
+
+// Level is a snapshot of one stock level. Reserved units are still on
+// hand but promised to an order.
+type Level struct {
+	Key       Key   `json:"key"`
+	OnHand    int64 `json:"on_hand"`
+	Reserved  int64 `json:"reserved"`
+	Available int64 `json:"available"`
+}
+
+type level struct {
+	mu        sync.Mutex
+	key       Key
+	onHand    int64
+	reserved  int64
+	threshold int64 // low-stock alert below this, -1 uses the default
+}
+
+func (l *level) available() int64 { return l.onHand - l.reserved }
+
+func (l *level) snapshot() Level {
+	return Level{Key: l.key, OnHand: l.onHand, Reserved: l.reserved, Available: l.available()}
+}
+
+// Alert is passed to the low-stock callback when a level's available
+// stock drops below its threshold.
+type Alert struct {
+	Level     Level
+	Threshold int64
+}
+
+// Inventory is safe for concurrent use.
+type Inventory struct {
+	mu     sync.RWMutex // guards the levels map itself, not the levels
+	levels map[Key]*level
+
+	resMu        sync.Mutex
+	reservations map[string]*Reservation
+
+	audit audit
+
+	ttl        time.Duration
+	threshold  int64
+	onLowStock func(Alert)
+	now        func() time.Time
+}
+
+type Option func(*Inventory)
+
+// WithClock sets the clock used for expiry and the audit trail.
+func WithClock(now func() time.Time) Option {
+	return func(inv *Inventory) { inv.now = now }
+}
+
+// WithReservationTTL sets how long a reservation holds stock before it
+// expires. The default is 15 minutes.
+func WithReservationTTL(d time.Duration) Option {
+	return func(inv *Inventory) { inv.ttl = d }
+}
+
+// WithLowStock calls fn whenever a change takes a level's available
+// stock from at or above threshold to below it. fn runs after the locks
+// are released. SetThreshold overrides threshold per level.
+func WithLowStock(threshold int64, fn func(Alert)) Option {
+	return func(inv *Inventory) {
+		inv.threshold = threshold
+		inv.onLowStock = fn
+	}
+}
+
+func New(opts ...Option) *Inventory {
+	inv := &Inventory{
+		levels:       make(map[Key]*level),
+		reservations: make(map[string]*Reservation),
+		ttl:          15 * time.Minute,
+		now:          time.Now,
+	}
+	for _, opt := range opts {
+		opt(inv)
+	}
+	return inv
+}
+
+// get returns the level for k, creating an empty one if needed.
+func (inv *Inventory) get(k Key) *level {
+	inv.mu.RLock()
+	l, ok := inv.levels[k]
+	inv.mu.RUnlock()
+	if ok {
+		return l
+	}
+
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	if l, ok := inv.levels[k]; ok {
+		return l
+	}
+	l = &level{key: k, threshold: -1}
+	inv.levels[k] = l
+	return l
+}
+
+// Level returns the current stock of k.
+func (inv *Inventory) Level(k Key) Level {
+	l := inv.get(k)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.snapshot()
+}
+
+// Levels returns every known level, sorted by SKU and location.
+func (inv *Inventory) Levels() []Level {
+	inv.mu.RLock()
+	ls := make([]*level, 0, len(inv.levels))
+	for _, l := range inv.levels {
+		ls = append(ls, l)
+	}
+	inv.mu.RUnlock()
+
+	out := make([]Level, len(ls))
+	for i, l := range ls {
+		l.mu.Lock()
+		out[i] = l.snapshot()
+		l.mu.Unlock()
+	}
+	slices.SortFunc(out, func(a, b Level) int { return compareKeys(a.Key, b.Key) })
+	return out
+}
+
+// SetThreshold sets the low-stock threshold of one level.
+func (inv *Inventory) SetThreshold(k Key, n int64) {
+	l := inv.get(k)
+	l.mu.Lock()
+	l.threshold = n
+	l.mu.Unlock()
+}
+
+func (inv *Inventory) thresholdOf(l *level) int64 {
+	if l.threshold >= 0 {
+		return l.threshold
+	}
+	return inv.threshold
+}
+
+// lowStock returns an alert if a change moved l's available stock from
+// before to below its threshold. l must be locked.
+func (inv *Inventory) lowStock(l *level, before int64) []Alert {
+	t := inv.thresholdOf(l)
+	if inv.onLowStock == nil || before < t || l.available() >= t {
+		return nil
+	}
+	return []Alert{{Level: l.snapshot(), Threshold: t}}
+}
+
+func (inv *Inventory) alert(alerts []Alert) {
+	for _, a := range alerts {
+		inv.onLowStock(a)
+	}
+}
+
+// Adjust changes the stock on hand of k by delta, for deliveries (+),
+// stock counts, damage and the like. On-hand stock can never drop below
+// what is reserved.
+func (inv *Inventory) Adjust(k Key, delta int64, reason, actor string) (Level, error) {
+	l := inv.get(k)
+	l.mu.Lock()
+	before := l.available()
+	if l.onHand+delta < l.reserved {
+		l.mu.Unlock()
+		return Level{}, &ShortageError{Key: k, Requested: -delta, Available: before}
+	}
+	l.onHand += delta
+	lv := l.snapshot()
+	inv.audit.add(Adjustment{At: inv.now(), Key: k, OnHand: delta, Reason: reason, Actor: actor, After: lv})
+	alerts := inv.lowStock(l, before)
+	l.mu.Unlock()
+
+	inv.alert(alerts)
+	return lv, nil
+}
+
+// lockAll locks the levels for keys in sorted order and returns them in
+// that order with an unlock function.
+func (inv *Inventory) lockAll(keys []Key) ([]*level, func()) {
+	keys = slices.Clone(keys)
+	slices.SortFunc(keys, compareKeys)
+	keys = slices.Compact(keys)
+	ls := make([]*level, len(keys))
+	for i, k := range keys {
+		ls[i] = inv.get(k)
+		ls[i].mu.Lock()
+	}
+	return ls, func() {
+		for _, l := range slices.Backward(ls) {
+			l.mu.Unlock()
+		}
+	}
+}
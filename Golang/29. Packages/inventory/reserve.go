@@ -0,0 +1,276 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/order"
+)
+
+// Line asks for Quantity units of one level.
+type Line struct {
+	Key      Key   `json:"key"`
+	Quantity int64 `json:"quantity"`
+}
+
+// Reservation holds stock for one order until it is committed, released
+// or expires. A reservation without lines holds nothing and never
+// expires, so orders with no items can still be confirmed.
+type Reservation struct {
+	OrderID   string    `json:"order_id"`
+	Lines     []Line    `json:"lines"` // one per key, sorted
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+func (r *Reservation) expired(now time.Time) bool {
+	return !r.ExpiresAt.IsZero() && !now.Before(r.ExpiresAt)
+}
+
+func (r *Reservation) keys() []Key {
+	keys := make([]Key, len(r.Lines))
+	for i, ln := range r.Lines {
+		keys[i] = ln.Key
+	}
+	return keys
+}
+
+// merge adds up lines for the same key and sorts them.
+func merge(lines []Line) ([]Line, error) {
+	totals := make(map[Key]int64)
+	for _, ln := range lines {
+		if ln.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidQuantity, ln.Key)
+		}
+		totals[ln.Key] += ln.Quantity
+	}
+	out := make([]Line, 0, len(totals))
+	for k, q := range totals {
+		out = append(out, Line{k, q})
+	}
+	slices.SortFunc(out, func(a, b Line) int { return compareKeys(a.Key, b.Key) })
+	return out, nil
+}
+
+// Reserve holds stock for every line of orderID, or for none of them if
+// any level is short.
+func (inv *Inventory) Reserve(orderID string, lines []Line) (*Reservation, error) {
+	lines, err := merge(lines)
+	if err != nil {
+		return nil, err
+	}
+	now := inv.now()
+	r := &Reservation{OrderID: orderID, Lines: lines, CreatedAt: now}
+	if len(lines) > 0 {
+		r.ExpiresAt = now.Add(inv.ttl)
+	}
+
+	// claim the order id first so two calls for the same order can't both
+	// reserve
+	inv.resMu.Lock()
+	if _, ok := inv.reservations[orderID]; ok {
+		inv.resMu.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrReservationExists, orderID)
+	}
+	inv.reservations[orderID] = nil
+	inv.resMu.Unlock()
+
+	ls, unlock := inv.lockAll(r.keys())
+	for i, l := range ls {
+		if l.available() < lines[i].Quantity {
+			err := &ShortageError{Key: l.key, Requested: lines[i].Quantity, Available: l.available()}
+			unlock()
+			inv.resMu.Lock()
+			delete(inv.reservations, orderID)
+			inv.resMu.Unlock()
+			return nil, err
+		}
+	}
+	var alerts []Alert
+	for i, l := range ls {
+		before := l.available()
+		l.reserved += lines[i].Quantity
+		inv.audit.add(Adjustment{At: now, Key: l.key, Reserved: lines[i].Quantity, Reason: "reserve", Order: orderID, After: l.snapshot()})
+		alerts = append(alerts, inv.lowStock(l, before)...)
+	}
+	unlock()
+
+	inv.resMu.Lock()
+	inv.reservations[orderID] = r
+	inv.resMu.Unlock()
+	inv.alert(alerts)
+	return r, nil
+}
+
+// ReserveOrder reserves o's items at location.
+func (inv *Inventory) ReserveOrder(o *order.Order, location string) (*Reservation, error) {
+	lines := make([]Line, len(o.Items))
+	for i, li := range o.Items {
+		lines[i] = Line{Key{li.SKU, location}, int64(li.Quantity)}
+	}
+	return inv.Reserve(o.ID, lines)
+}
+
+// Reservation returns the live reservation of orderID.
+func (inv *Inventory) Reservation(orderID string) (Reservation, bool) {
+	inv.resMu.Lock()
+	defer inv.resMu.Unlock()
+	r := inv.reservations[orderID]
+	if r == nil {
+		return Reservation{}, false
+	}
+	return *r, true
+}
+
+// take removes the reservation of orderID so only one of commit, release
+// and expiry can act on it.
+func (inv *Inventory) take(orderID string, allowExpired bool) (*Reservation, error) {
+	inv.resMu.Lock()
+	defer inv.resMu.Unlock()
+	r := inv.reservations[orderID]
+	if r == nil {
+		return nil, fmt.Errorf("%w %s", ErrNoReservation, orderID)
+	}
+	if !allowExpired && r.expired(inv.now()) {
+		return nil, expiredError(r)
+	}
+	delete(inv.reservations, orderID)
+	return r, nil
+}
+
+func expiredError(r *Reservation) error {
+	return fmt.Errorf("%w: %s at %s", ErrExpired, r.OrderID, r.ExpiresAt.Format(time.RFC3339))
+}
+
+// Renew checks that orderID has a live reservation and pushes its expiry
+// a full TTL from now.
+func (inv *Inventory) Renew(orderID string) error {
+	inv.resMu.Lock()
+	defer inv.resMu.Unlock()
+	r := inv.reservations[orderID]
+	switch {
+	case r == nil:
+		return fmt.Errorf("%w %s", ErrNoReservation, orderID)
+	case r.expired(inv.now()):
+		return expiredError(r)
+	case len(r.Lines) > 0:
+		r.ExpiresAt = inv.now().Add(inv.ttl)
+	}
+	return nil
+}
+
+// Commit turns the reservation of orderID into a sale: the units leave
+// stock on hand for good. An expired reservation can't be committed.
+func (inv *Inventory) Commit(orderID, actor string) error {
+	return inv.commit(orderID, actor, false)
+}
+
+func (inv *Inventory) commit(orderID, actor string, allowExpired bool) error {
+	r, err := inv.take(orderID, allowExpired)
+	if err != nil {
+		return err
+	}
+	ls, unlock := inv.lockAll(r.keys())
+	defer unlock()
+	now := inv.now()
+	for i, l := range ls {
+		q := r.Lines[i].Quantity
+		l.onHand -= q
+		l.reserved -= q
+		inv.audit.add(Adjustment{At: now, Key: l.key, OnHand: -q, Reserved: -q, Reason: "commit", Order: orderID, Actor: actor, After: l.snapshot()})
+	}
+	return nil
+}
+
+// Release gives the stock held for orderID back.
+func (inv *Inventory) Release(orderID, reason, actor string) error {
+	r, err := inv.take(orderID, true)
+	if err != nil {
+		return err
+	}
+	inv.release(r, reason, actor)
+	return nil
+}
+
+func (inv *Inventory) release(r *Reservation, reason, actor string) {
+	ls, unlock := inv.lockAll(r.keys())
+	defer unlock()
+	now := inv.now()
+	for i, l := range ls {
+		q := r.Lines[i].Quantity
+		l.reserved -= q
+		inv.audit.add(Adjustment{At: now, Key: l.key, Reserved: -q, Reason: reason, Order: r.OrderID, Actor: actor, After: l.snapshot()})
+	}
+}
+
+// ExpireDue releases every reservation past its expiry and returns the
+// order ids.
+func (inv *Inventory) ExpireDue() []string {
+	now := inv.now()
+	var due []*Reservation
+	inv.resMu.Lock()
+	for id, r := range inv.reservations {
+		if r != nil && r.expired(now) {
+			due = append(due, r)
+			delete(inv.reservations, id)
+		}
+	}
+	inv.resMu.Unlock()
+
+	ids := make([]string, len(due))
+	for i, r := range due {
+		inv.release(r, "expired", "")
+		ids[i] = r.OrderID
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// Run calls ExpireDue every interval until ctx is done.
+func (inv *Inventory) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			inv.ExpireDue()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Attach ties reservations to m. Confirming an order needs a live
+// reservation: the guard only checks it and renews it for another TTL,
+// and the stock is sold by a hook once the confirm has been saved. So a
+// confirm that a later guard refuses, or that fails to save, leaves the
+// stock reserved until it expires like any other. Cancelling or failing
+// an order releases the stock. Errors from the hooks, which can't fail
+// the transition, go to onError.
+func (inv *Inventory) Attach(m *order.StatusMachine, onError func(error)) {
+	report := func(err error) {
+		if err != nil && onError != nil {
+			onError(err)
+		}
+	}
+	m.AddGuard(order.AnyStatus, order.Confirmed, func(c order.StatusChange) error {
+		return inv.Renew(c.OrderID)
+	})
+	m.OnTransition(order.AnyStatus, order.Confirmed, func(c order.StatusChange) {
+		// the guard renewed the reservation, so only a save slower than
+		// the TTL lets it expire first; the move is saved, so sell anyway
+		report(inv.commit(c.OrderID, c.Actor, true))
+	})
+	release := func(c order.StatusChange) {
+		err := inv.Release(c.OrderID, "order "+c.To.String(), c.Actor)
+		// orders cancelled after confirmation have nothing reserved
+		if !errors.Is(err, ErrNoReservation) {
+			report(err)
+		}
+	}
+	m.OnTransition(order.AnyStatus, order.Cancelled, release)
+	m.OnTransition(order.AnyStatus, order.Failed, release)
+}
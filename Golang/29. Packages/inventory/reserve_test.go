@@ -0,0 +1,360 @@
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/customer"
+	"github.com/rajasur/programming-learning/GO/order"
+	"github.com/rajasur/programming-learning/GO/order/api"
+	"github.com/rajasur/programming-learning/GO/order/store"
+)
+
+var t0 = time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)
+
+// clock is a settable clock that is safe to read from several goroutines.
+type clock struct{ ns atomic.Int64 }
+
+func newClock() *clock {
+	c := &clock{}
+	c.ns.Store(t0.UnixNano())
+	return c
+}
+
+func (c *clock) now() time.Time          { return time.Unix(0, c.ns.Load()).UTC() }
+func (c *clock) advance(d time.Duration) { c.ns.Add(int64(d)) }
+
+var pen = Key{"pen", "blr"}
+
+func setup(t *testing.T, c *clock, stock int64) (*Inventory, *order.StatusMachine) {
+	t.Helper()
+	inv := New(WithClock(c.now), WithReservationTTL(time.Minute))
+	if _, err := inv.Adjust(pen, stock, "delivery", "test"); err != nil {
+		t.Fatal(err)
+	}
+	m := order.NewStatusMachine(order.DefaultTransitions)
+	m.SetClock(c.now)
+	inv.Attach(m, func(err error) { t.Errorf("hook error: %v", err) })
+	return inv, m
+}
+
+func newOrder(t *testing.T, id string, m *order.StatusMachine, qty int) *order.Order {
+	t.Helper()
+	o, err := order.New(id, 1, order.Received, customer.Customer{Name: "Raja"}, order.WithStatusMachine(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.Items = []order.LineItem{{SKU: "pen", Quantity: qty, UnitPrice: 100}}
+	return o
+}
+
+// saved runs the hooks for o's last change, as the API does once the
+// order has been stored.
+func saved(o *order.Order) {
+	o.Notify(o.History[len(o.History)-1])
+}
+
+func TestReserveCommit(t *testing.T) {
+	c := newClock()
+	inv, m := setup(t, c, 10)
+	o := newOrder(t, "o1", m, 3)
+
+	if err := o.Confirm("shop"); !errors.Is(err, ErrNoReservation) {
+		t.Fatalf("confirm without a reservation: %v", err)
+	}
+	if _, err := inv.ReserveOrder(o, "blr"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := inv.ReserveOrder(o, "blr"); !errors.Is(err, ErrReservationExists) {
+		t.Errorf("second reservation: %v", err)
+	}
+	if lv := inv.Level(pen); lv.Reserved != 3 || lv.Available != 7 {
+		t.Errorf("after reserve: %+v", lv)
+	}
+	if err := o.Confirm("shop"); err != nil {
+		t.Fatal(err)
+	}
+	// nothing is sold until the confirm has been saved
+	if lv := inv.Level(pen); lv.OnHand != 10 || lv.Reserved != 3 {
+		t.Errorf("after the guard: %+v", lv)
+	}
+	saved(o)
+	if lv := inv.Level(pen); lv.OnHand != 7 || lv.Reserved != 0 {
+		t.Errorf("after commit: %+v", lv)
+	}
+
+	// expiry and cancellation have nothing left to release
+	c.advance(time.Hour)
+	if ids := inv.ExpireDue(); len(ids) != 0 {
+		t.Errorf("ExpireDue released %v after commit", ids)
+	}
+	if err := o.Cancel("shop"); err != nil {
+		t.Fatal(err)
+	}
+	saved(o)
+	if lv := inv.Level(pen); lv.OnHand != 7 || lv.Available != 7 {
+		t.Errorf("after cancel: %+v", lv)
+	}
+}
+
+func TestShortage(t *testing.T) {
+	inv, m := setup(t, newClock(), 2)
+	_, err := inv.ReserveOrder(newOrder(t, "o1", m, 3), "blr")
+	var short *ShortageError
+	if !errors.As(err, &short) || !errors.Is(err, ErrInsufficientStock) || short.Available != 2 {
+		t.Fatalf("Reserve = %v", err)
+	}
+	// the failed attempt doesn't block a retry
+	if _, err := inv.ReserveOrder(newOrder(t, "o1", m, 2), "blr"); err != nil {
+		t.Errorf("retry: %v", err)
+	}
+}
+
+func TestExpiredReservationRefusesConfirm(t *testing.T) {
+	c := newClock()
+	inv, m := setup(t, c, 5)
+	o := newOrder(t, "o1", m, 5)
+	inv.ReserveOrder(o, "blr")
+
+	c.advance(time.Minute)
+	if err := o.Confirm("shop"); !errors.Is(err, ErrExpired) {
+		t.Fatalf("confirm after expiry: %v", err)
+	}
+	if o.Status != order.Received {
+		t.Errorf("status = %v after a refused confirm", o.Status)
+	}
+	if ids := inv.ExpireDue(); len(ids) != 1 {
+		t.Errorf("ExpireDue = %v", ids)
+	}
+	if lv := inv.Level(pen); lv.OnHand != 5 || lv.Available != 5 {
+		t.Errorf("after expiry: %+v", lv)
+	}
+}
+
+// TestConfirmRenews confirms just before the reservation expires. The
+// guard renews it, so expiry running while the order is saved leaves the
+// stock for the commit.
+func TestConfirmRenews(t *testing.T) {
+	c := newClock()
+	inv, m := setup(t, c, 5)
+	o := newOrder(t, "o1", m, 5)
+	inv.ReserveOrder(o, "blr")
+
+	c.advance(time.Minute - time.Nanosecond)
+	if err := o.Confirm("shop"); err != nil {
+		t.Fatal(err)
+	}
+	c.advance(30 * time.Second)
+	if ids := inv.ExpireDue(); len(ids) != 0 {
+		t.Errorf("ExpireDue released %v while the confirm was saved", ids)
+	}
+	saved(o)
+	if lv := inv.Level(pen); lv.OnHand != 0 || lv.Available != 0 {
+		t.Errorf("confirmed order's stock is %+v", lv)
+	}
+}
+
+// A confirm that is refused after the inventory guard, or never saved,
+// takes no stock: the reservation just runs out as usual.
+func TestConfirmNotSaved(t *testing.T) {
+	c := newClock()
+	inv, m := setup(t, c, 5)
+	// runs after the inventory guard
+	m.AddGuard(order.AnyStatus, order.AnyStatus, func(order.StatusChange) error {
+		return errors.New("payment pending")
+	})
+	vetoed := newOrder(t, "o1", m, 2)
+	inv.ReserveOrder(vetoed, "blr")
+
+	other := order.NewStatusMachine(order.DefaultTransitions)
+	other.SetClock(c.now)
+	inv.Attach(other, func(err error) { t.Errorf("hook error: %v", err) })
+	unsaved := newOrder(t, "o2", other, 3)
+	inv.ReserveOrder(unsaved, "blr")
+
+	c.advance(30 * time.Second)
+	if err := vetoed.Confirm("shop"); err == nil {
+		t.Fatal("confirm went through a refusing guard")
+	}
+	if err := unsaved.Confirm("shop"); err != nil {
+		t.Fatal(err)
+	}
+	// the store failed, so the hooks never run
+
+	if lv := inv.Level(pen); lv.OnHand != 5 || lv.Reserved != 5 {
+		t.Errorf("before expiry: %+v", lv)
+	}
+	c.advance(time.Minute - time.Nanosecond)
+	if ids := inv.ExpireDue(); len(ids) != 0 {
+		t.Errorf("ExpireDue = %v before the renewed expiry", ids)
+	}
+	c.advance(time.Nanosecond)
+	if ids := inv.ExpireDue(); len(ids) != 2 {
+		t.Errorf("ExpireDue = %v", ids)
+	}
+	if lv := inv.Level(pen); lv.OnHand != 5 || lv.Available != 5 {
+		t.Errorf("after expiry: %+v", lv)
+	}
+}
+
+func TestCancelReleases(t *testing.T) {
+	for _, to := range []order.Status{order.Cancelled, order.Failed} {
+		inv, m := setup(t, newClock(), 5)
+		o := newOrder(t, "o1", m, 4)
+		inv.ReserveOrder(o, "blr")
+		if err := o.ChangeStatus(to, "shop"); err != nil {
+			t.Fatal(err)
+		}
+		saved(o)
+		if lv := inv.Level(pen); lv.Reserved != 0 || lv.Available != 5 {
+			t.Errorf("%s: level %+v", to, lv)
+		}
+		if _, ok := inv.Reservation("o1"); ok {
+			t.Errorf("%s: reservation still live", to)
+		}
+	}
+}
+
+// Orders without items reserve nothing, and that reservation never runs
+// out, so they can always be confirmed.
+func TestReserveNoItems(t *testing.T) {
+	c := newClock()
+	inv, m := setup(t, c, 5)
+	o := newOrder(t, "o1", m, 1)
+	o.Items = nil
+	r, err := inv.ReserveOrder(o, "blr")
+	if err != nil || len(r.Lines) != 0 || !r.ExpiresAt.IsZero() {
+		t.Fatalf("ReserveOrder = %+v, %v", r, err)
+	}
+	c.advance(24 * time.Hour)
+	if ids := inv.ExpireDue(); len(ids) != 0 {
+		t.Errorf("ExpireDue = %v", ids)
+	}
+	if err := o.Confirm("shop"); err != nil {
+		t.Fatal(err)
+	}
+	saved(o)
+	if _, ok := inv.Reservation("o1"); ok {
+		t.Error("reservation still live after the confirm")
+	}
+}
+
+// TestConfirmExpiryRace confirms orders while their reservations expire.
+// Each order must end up either confirmed with its stock sold or refused
+// with its stock released, never confirmed with the stock back on sale.
+func TestConfirmExpiryRace(t *testing.T) {
+	const n = 200
+	c := newClock()
+	inv, m := setup(t, c, n)
+	orders := make([]*order.Order, n)
+	for i := range orders {
+		orders[i] = newOrder(t, string(rune('A'+i%26))+string(rune('a'+i/26)), m, 1)
+		if _, err := inv.ReserveOrder(orders[i], "blr"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.advance(time.Minute - time.Nanosecond)
+
+	var wg sync.WaitGroup
+	for _, o := range orders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := o.Confirm("shop")
+			if err == nil {
+				saved(o)
+			} else if !errors.Is(err, ErrExpired) && !errors.Is(err, ErrNoReservation) {
+				t.Errorf("%s: %v", o.ID, err)
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.advance(time.Nanosecond)
+		for range 50 {
+			inv.ExpireDue()
+		}
+	}()
+	wg.Wait()
+	inv.ExpireDue()
+
+	confirmed := 0
+	for _, o := range orders {
+		if o.Status == order.Confirmed {
+			confirmed++
+		}
+	}
+	lv := inv.Level(pen)
+	if lv.Reserved != 0 || lv.OnHand != int64(n-confirmed) {
+		t.Errorf("%d confirmed but level is %+v", confirmed, lv)
+	}
+}
+
+// TestAPI wires the inventory into the order API the way orderd does:
+// creating an order reserves its items, confirming sells them and
+// cancelling gives them back.
+func TestAPI(t *testing.T) {
+	c := newClock()
+	inv, m := setup(t, c, 5)
+	srv := api.NewServer(store.NewMemoryStore(),
+		api.WithClock(c.now),
+		api.WithStatusMachine(m),
+		api.BeforeCreate(func(o *order.Order) error {
+			_, err := inv.ReserveOrder(o, "blr")
+			return err
+		}, func(o *order.Order) {
+			inv.Release(o.ID, "order not saved", "")
+		}),
+	)
+	post := func(path, body string) int {
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest("POST", path, strings.NewReader(body)))
+		return w.Code
+	}
+	create := func(id string, qty int) int {
+		return post("/orders", fmt.Sprintf(`{"id": %q, "customer": {"name": "Raja"}, "items": [{"sku": "pen", "quantity": %d, "unit_price": "1.00"}]}`, id, qty))
+	}
+
+	if code := create("o1", 3); code != http.StatusCreated {
+		t.Fatalf("create o1: %d", code)
+	}
+	if lv := inv.Level(pen); lv.Reserved != 3 {
+		t.Errorf("after create: %+v", lv)
+	}
+	if code := create("o2", 3); code != http.StatusConflict {
+		t.Errorf("create o2 with 2 pens left: %d", code)
+	}
+	// a duplicate id isn't saved, so its reservation is dropped again
+	if code := create("o1", 1); code != http.StatusConflict {
+		t.Errorf("duplicate create: %d", code)
+	}
+	if lv := inv.Level(pen); lv.Reserved != 3 || lv.Available != 2 {
+		t.Errorf("after refused creates: %+v", lv)
+	}
+	if code := post("/orders", `{"id": "o3", "amount": "10.00", "customer": {"name": "Raja"}}`); code != http.StatusCreated {
+		t.Fatalf("create o3 without items: %d", code)
+	}
+	if code := create("o4", 2); code != http.StatusCreated {
+		t.Fatalf("create o4: %d", code)
+	}
+
+	for _, id := range []string{"o1", "o3"} {
+		if code := post("/orders/"+id+"/status", `{"status": "confirmed"}`); code != http.StatusOK {
+			t.Errorf("confirm %s: %d", id, code)
+		}
+	}
+	if code := post("/orders/o4/cancel", ""); code != http.StatusOK {
+		t.Errorf("cancel o4: %d", code)
+	}
+	if lv := inv.Level(pen); lv.OnHand != 2 || lv.Reserved != 0 || lv.Available != 2 {
+		t.Errorf("after confirm and cancel: %+v", lv)
+	}
+}
@@ -0,0 +1,190 @@
+// Package invoice issues numbered tax invoices for orders and renders them
+// as printable HTML, a plain-text receipt or CSV for accounting.
+package invoice
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/customer"
+	"github.com/rajasur/programming-learning/GO/internal/recordlog"
+	"github.com/rajasur/programming-learning/GO/order"
+)
+
+var (
+	ErrNoItems  = errors.New("invoice: order has no items")
+	ErrNotFound = errors.New("invoice: not found")
+	ErrCorrupt  = errors.New("invoice: log is corrupt")
+)
+
+// IST is the default time zone for invoice dates and financial years.
+var IST = time.FixedZone("IST", 5*60*60+30*60)
+
+// Seller is the business issuing the invoice.
+type Seller struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	GSTIN   string `json:"gstin,omitempty"`
+	State   string `json:"state"`
+}
+
+// Invoice is an issued invoice. It is a record: once issued it is never
+// recalculated, even if tax rules change.
+type Invoice struct {
+	Number        string            `json:"number"`
+	FinancialYear string            `json:"financial_year"`
+	Seq           int64             `json:"seq"`
+	Date          time.Time         `json:"date"`
+	OrderID       string            `json:"order_id"`
+	Seller        Seller            `json:"seller"`
+	Customer      customer.Customer `json:"customer"`
+	PlaceOfSupply string            `json:"place_of_supply,omitempty"`
+	order.Breakdown
+}
+
+// FinancialYear returns the Indian financial year (April to March) t falls
+// in, e.g. "2026-27".
+func FinancialYear(t time.Time) string {
+	y := t.Year()
+	if t.Month() < time.April {
+		y--
+	}
+	return fmt.Sprintf("%d-%02d", y, (y+1)%100)
+}
+
+// Issuer hands out invoice numbers that run 1, 2, 3... within each
+// financial year with no gaps. Every issued invoice is appended to a
+// checksummed log as a single record and the counters are rebuilt from it
+// on open, so a number is only taken once its invoice is safely on disk.
+type Issuer struct {
+	mu     sync.Mutex
+	log    *recordlog.File
+	seq    map[string]int64 // financial year -> last number issued
+	pos    map[string]span  // invoice number -> record in the log
+	seller Seller
+	prefix string
+	loc    *time.Location
+	now    func() time.Time
+}
+
+type span struct {
+	pos int64
+	n   int
+}
+
+type Option func(*Issuer)
+
+// WithPrefix sets the number prefix. The default is "INV".
+func WithPrefix(p string) Option {
+	return func(is *Issuer) { is.prefix = p }
+}
+
+// WithLocation sets the zone invoice dates and years are taken in.
+func WithLocation(loc *time.Location) Option {
+	return func(is *Issuer) { is.loc = loc }
+}
+
+// WithClock sets the clock used to date invoices.
+func WithClock(now func() time.Time) Option {
+	return func(is *Issuer) { is.now = now }
+}
+
+// NewIssuer opens or creates the invoice log at path and picks up the
+// numbering where it left off. A torn last record from a crash is dropped;
+// a record that breaks the numbering is reported as ErrCorrupt.
+func NewIssuer(path string, seller Seller, opts ...Option) (*Issuer, error) {
+	is := &Issuer{
+		seq:    make(map[string]int64),
+		pos:    make(map[string]span),
+		seller: seller,
+		prefix: "INV",
+		loc:    IST,
+		now:    time.Now,
+	}
+	for _, opt := range opts {
+		opt(is)
+	}
+	log, err := recordlog.Open(path, false, func(inv Invoice, pos int64, n int) error {
+		if inv.Number == "" || inv.Seq != is.seq[inv.FinancialYear]+1 {
+			return recordlog.ErrCorrupt
+		}
+		is.seq[inv.FinancialYear] = inv.Seq
+		is.pos[inv.Number] = span{pos, n}
+		return nil
+	})
+	if errors.Is(err, recordlog.ErrCorrupt) {
+		return nil, fmt.Errorf("%w: %w", ErrCorrupt, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	is.log = log
+	return is, nil
+}
+
+// Issue prices o's items with rule and gives the invoice the next number.
+// For GST the place of supply is the rule's buyer state.
+func (is *Issuer) Issue(o *order.Order, rule order.TaxRule) (Invoice, error) {
+	if len(o.Items) == 0 {
+		return Invoice{}, fmt.Errorf("%w: %s", ErrNoItems, o.ID)
+	}
+	b, err := o.Totals(rule)
+	if err != nil {
+		return Invoice{}, err
+	}
+	inv := Invoice{
+		OrderID:   o.ID,
+		Seller:    is.seller,
+		Customer:  o.Customer,
+		Breakdown: b,
+	}
+	if g, ok := rule.(order.GST); ok {
+		inv.PlaceOfSupply = g.BuyerState
+	}
+
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	inv.Date = is.now().In(is.loc)
+	inv.FinancialYear = FinancialYear(inv.Date)
+	inv.Seq = is.seq[inv.FinancialYear] + 1
+	inv.Number = fmt.Sprintf("%s/%s/%06d", is.prefix, inv.FinancialYear, inv.Seq)
+
+	pos, n, err := is.log.Append(inv)
+	if err != nil {
+		return Invoice{}, err
+	}
+	is.seq[inv.FinancialYear] = inv.Seq
+	is.pos[inv.Number] = span{pos, n}
+	return inv, nil
+}
+
+// Get reads back an issued invoice by number.
+func (is *Issuer) Get(number string) (Invoice, error) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	sp, ok := is.pos[number]
+	if !ok {
+		return Invoice{}, fmt.Errorf("%w: %s", ErrNotFound, number)
+	}
+	var inv Invoice
+	if err := is.log.ReadAt(sp.pos, sp.n, &inv); err != nil {
+		return Invoice{}, err
+	}
+	return inv, nil
+}
+
+// Last returns the last number issued in a financial year.
+func (is *Issuer) Last(fy string) int64 {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	return is.seq[fy]
+}
+
+// Close closes the log.
+func (is *Issuer) Close() error {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	return is.log.Close()
+}
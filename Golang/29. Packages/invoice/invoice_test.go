@@ -0,0 +1,189 @@
+package invoice
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/order"
+)
+
+var seller = Seller{Name: "Rasoi", Address: "MG Road, Bengaluru", State: "Karnataka"}
+
+func testOrder(id string) *order.Order {
+	return &order.Order{
+		ID:    id,
+		Items: []order.LineItem{{SKU: "thali", Quantity: 2, UnitPrice: 25000}},
+	}
+}
+
+func gst() order.TaxRule {
+	return order.GST{Rate: 500, SellerState: "Karnataka", BuyerState: "Karnataka"}
+}
+
+func TestFinancialYear(t *testing.T) {
+	tests := []struct {
+		t    time.Time
+		want string
+	}{
+		{time.Date(2026, time.April, 1, 0, 0, 0, 0, IST), "2026-27"},
+		{time.Date(2027, time.March, 31, 23, 59, 59, 0, IST), "2026-27"},
+		{time.Date(2027, time.January, 15, 12, 0, 0, 0, IST), "2026-27"},
+		{time.Date(2099, time.June, 1, 0, 0, 0, 0, IST), "2099-00"},
+	}
+	for _, tt := range tests {
+		if got := FinancialYear(tt.t); got != tt.want {
+			t.Errorf("FinancialYear(%v) = %q, want %q", tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestIssueNumbering(t *testing.T) {
+	now := time.Date(2027, time.March, 31, 18, 0, 0, 0, time.UTC) // 23:30 IST
+	is, err := NewIssuer(filepath.Join(t.TempDir(), "invoices.log"), seller, WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer is.Close()
+
+	want := []string{"INV/2026-27/000001", "INV/2026-27/000002"}
+	for i, w := range want {
+		inv, err := is.Issue(testOrder("o"), gst())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if inv.Number != w || inv.Seq != int64(i+1) {
+			t.Errorf("invoice %d = %s (seq %d), want %s", i, inv.Number, inv.Seq, w)
+		}
+	}
+
+	// 18:30 UTC is already 1 April in India: a new year starts at 1
+	now = now.Add(30 * time.Minute)
+	inv, err := is.Issue(testOrder("o"), gst())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.Number != "INV/2027-28/000001" {
+		t.Errorf("first invoice of the new year = %s", inv.Number)
+	}
+	if inv.Date.Location() != IST {
+		t.Errorf("date in %v, want IST", inv.Date.Location())
+	}
+	if got := is.Last("2026-27"); got != 2 {
+		t.Errorf("Last(2026-27) = %d, want 2", got)
+	}
+}
+
+func TestIssueNoItems(t *testing.T) {
+	is, err := NewIssuer(filepath.Join(t.TempDir(), "invoices.log"), seller)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer is.Close()
+	if _, err := is.Issue(&order.Order{ID: "o1"}, gst()); !errors.Is(err, ErrNoItems) {
+		t.Fatalf("err = %v, want ErrNoItems", err)
+	}
+	if got := is.Last(FinancialYear(time.Now().In(IST))); got != 0 {
+		t.Errorf("a failed issue took number %d", got)
+	}
+}
+
+func TestReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "invoices.log")
+	now := func() time.Time { return time.Date(2026, time.May, 4, 10, 0, 0, 0, IST) }
+	is, err := NewIssuer(path, seller, WithClock(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := is.Issue(testOrder("o1"), gst())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := is.Issue(testOrder("o2"), gst()); err != nil {
+		t.Fatal(err)
+	}
+	is.Close()
+
+	is, err = NewIssuer(path, seller, WithClock(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer is.Close()
+	if got := is.Last("2026-27"); got != 2 {
+		t.Fatalf("Last after reopen = %d, want 2", got)
+	}
+	got, err := is.Get(first.Number)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.OrderID != "o1" || got.Total != first.Total || !got.Date.Equal(first.Date) {
+		t.Errorf("Get(%s) = %+v, want %+v", first.Number, got, first)
+	}
+	inv, err := is.Issue(testOrder("o3"), gst())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.Seq != 3 {
+		t.Errorf("seq after reopen = %d, want 3", inv.Seq)
+	}
+	if _, err := is.Get("INV/2026-27/000009"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get unknown: err = %v, want ErrNotFound", err)
+	}
+}
+
+// A crash in the middle of writing an invoice leaves a torn record. It was
+// never handed out, so its number is issued again rather than skipped.
+func TestTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "invoices.log")
+	now := func() time.Time { return time.Date(2026, time.May, 4, 10, 0, 0, 0, IST) }
+	is, err := NewIssuer(path, seller, WithClock(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := is.Issue(testOrder("o1"), gst()); err != nil {
+		t.Fatal(err)
+	}
+	is.Close()
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`0badc0de {"number":"INV/2026-27/0000`)
+	f.Close()
+
+	is, err = NewIssuer(path, seller, WithClock(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer is.Close()
+	inv, err := is.Issue(testOrder("o2"), gst())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.Number != "INV/2026-27/000002" {
+		t.Errorf("number after torn tail = %s, want INV/2026-27/000002", inv.Number)
+	}
+}
+
+func TestGapIsCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "invoices.log")
+	is, err := NewIssuer(path, seller)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a bad last record could be a torn write, so the gap is followed by
+	// another invoice
+	for _, seq := range []int64{2, 3} {
+		if _, _, err := is.log.Append(Invoice{Number: fmt.Sprintf("INV/2026-27/%06d", seq), FinancialYear: "2026-27", Seq: seq}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	is.Close()
+	if _, err := NewIssuer(path, seller); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("err = %v, want ErrCorrupt", err)
+	}
+}
@@ -0,0 +1,123 @@
+package invoice
+
+import (
+	"embed"
+	"encoding/csv"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/rajasur/programming-learning/GO/money"
+	"github.com/rajasur/programming-learning/GO/order"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+var funcs = map[string]any{
+	"rate": order.FormatRate,
+	"date": func(inv Invoice) string { return inv.Date.Format("02 Jan 2006") },
+	"taxes": func(lt order.LineTotal) money.Money {
+		var sum money.Money
+		for _, t := range lt.Taxes {
+			sum += t.Amount
+		}
+		return sum
+	},
+	"discount": func(lt order.LineTotal) money.Money { return lt.ItemDiscount + lt.OrderDiscount },
+	// left and right pad to a width in runes, for the text receipt
+	"left": func(n int, v any) string {
+		s := fmt.Sprint(v)
+		return s + strings.Repeat(" ", max(n-utf8.RuneCountInString(s), 0))
+	},
+	"right": func(n int, v any) string {
+		s := fmt.Sprint(v)
+		return strings.Repeat(" ", max(n-utf8.RuneCountInString(s), 0)) + s
+	},
+	"rule": func(n int) string { return strings.Repeat("-", n) },
+	"inc":  func(i int) int { return i + 1 },
+}
+
+var (
+	htmlTmpl = htmltemplate.Must(htmltemplate.New("invoice.html.tmpl").Funcs(funcs).ParseFS(templateFS, "templates/invoice.html.tmpl"))
+	textTmpl = template.Must(template.New("receipt.txt.tmpl").Funcs(funcs).ParseFS(templateFS, "templates/receipt.txt.tmpl"))
+)
+
+// WriteHTML renders a printable invoice.
+func WriteHTML(w io.Writer, inv Invoice) error {
+	return htmlTmpl.Execute(w, inv)
+}
+
+// WriteText renders a 48 column plain-text receipt.
+func WriteText(w io.Writer, inv Invoice) error {
+	return textTmpl.Execute(w, inv)
+}
+
+// formulaSafe stops a spreadsheet from running text as a formula by
+// prefixing a quote to cells that start with one of its formula signs.
+func formulaSafe(s string) string {
+	if s != "" && strings.ContainsRune("=+-@", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// WriteCSV writes one row per line item of every invoice, with a column
+// per tax name found in any of them, for import into accounting software.
+// Amounts are plain decimals without a currency sign. Names, SKUs and
+// descriptions that look like formulas get a leading quote.
+func WriteCSV(w io.Writer, invs ...Invoice) error {
+	var names []string
+	for _, inv := range invs {
+		for _, t := range inv.Taxes {
+			if !slices.Contains(names, t.Name) {
+				names = append(names, t.Name)
+			}
+		}
+	}
+	slices.Sort(names)
+
+	cw := csv.NewWriter(w)
+	header := []string{"invoice", "date", "order", "customer", "phone", "sku", "description", "quantity", "unit_price", "gross", "discount", "taxable"}
+	for _, n := range names {
+		header = append(header, strings.ToLower(n))
+	}
+	header = append(header, "total")
+	cw.Write(header)
+
+	for _, inv := range invs {
+		for _, lt := range inv.Lines {
+			row := []string{
+				inv.Number,
+				inv.Date.Format("2006-01-02"),
+				inv.OrderID,
+				formulaSafe(inv.Customer.Name),
+				inv.Customer.Phone.E164(),
+				formulaSafe(lt.Item.SKU),
+				formulaSafe(lt.Item.Name),
+				strconv.Itoa(lt.Item.Quantity),
+				lt.Item.UnitPrice.Decimal(),
+				lt.Gross.Decimal(),
+				(lt.ItemDiscount + lt.OrderDiscount).Decimal(),
+				lt.Taxable.Decimal(),
+			}
+			for _, n := range names {
+				var sum money.Money
+				for _, t := range lt.Taxes {
+					if t.Name == n {
+						sum += t.Amount
+					}
+				}
+				row = append(row, sum.Decimal())
+			}
+			cw.Write(append(row, lt.Total.Decimal()))
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
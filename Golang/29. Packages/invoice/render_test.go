@@ -0,0 +1,146 @@
+package invoice
+
+import (
+	"bytes"
+	"encoding/csv"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/customer"
+	"github.com/rajasur/programming-learning/GO/order"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// golden compares got with testdata/name, or rewrites the file with -update.
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs, rerun with -update if the change is intended\ngot:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+// renderInvoices issues two invoices: one within Karnataka with a
+// discount, and one to Tamil Nadu whose names look like spreadsheet
+// formulas.
+func renderInvoices(t *testing.T) []Invoice {
+	t.Helper()
+	now := time.Date(2026, time.May, 4, 10, 30, 0, 0, IST)
+	is, err := NewIssuer(filepath.Join(t.TempDir(), "invoices.log"),
+		Seller{Name: "Rasoi & Co", Address: "MG Road, Bengaluru", GSTIN: "29ABCDE1234F1Z5", State: "Karnataka"},
+		WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer is.Close()
+	phone, err := customer.ParsePhoneNumber("+91 98765 43210", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	local := &order.Order{
+		ID:       "o1",
+		Customer: customer.Customer{Name: "Raja <Sur>", Phone: phone},
+		Items: []order.LineItem{
+			{SKU: "thali", Name: "Veg thali", Quantity: 2, UnitPrice: 25000},
+			{SKU: "lassi", Quantity: 3, UnitPrice: 6000, Discount: order.Discount{Percent: 1000}, TaxRate: 1200},
+		},
+		Discount: order.Discount{Amount: 1000},
+	}
+	away := &order.Order{
+		ID:       "o2",
+		Customer: customer.Customer{Name: `=HYPERLINK("http://evil.example","x")`},
+		Items: []order.LineItem{
+			{SKU: "+sku", Name: "@SUM(A1:A9)", Quantity: 1, UnitPrice: 9999},
+			{SKU: "-1", Name: "plain, with a comma", Quantity: 1, UnitPrice: 1},
+		},
+	}
+
+	var invs []Invoice
+	for _, tc := range []struct {
+		o     *order.Order
+		buyer string
+	}{{local, "Karnataka"}, {away, "Tamil Nadu"}} {
+		inv, err := is.Issue(tc.o, order.GST{Rate: 500, SellerState: "Karnataka", BuyerState: tc.buyer})
+		if err != nil {
+			t.Fatal(err)
+		}
+		invs = append(invs, inv)
+	}
+	return invs
+}
+
+func TestWriteHTML(t *testing.T) {
+	for i, inv := range renderInvoices(t) {
+		var buf bytes.Buffer
+		if err := WriteHTML(&buf, inv); err != nil {
+			t.Fatal(err)
+		}
+		golden(t, []string{"local.html.golden", "interstate.html.golden"}[i], buf.Bytes())
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	for i, inv := range renderInvoices(t) {
+		var buf bytes.Buffer
+		if err := WriteText(&buf, inv); err != nil {
+			t.Fatal(err)
+		}
+		golden(t, []string{"local.txt.golden", "interstate.txt.golden"}[i], buf.Bytes())
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, renderInvoices(t)...); err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "invoices.csv.golden", buf.Bytes())
+
+	// the customer, sku and description columns never start a formula
+	rows, err := csv.NewReader(bytes.NewReader(buf.Bytes())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows[1:] {
+		for _, col := range []int{3, 5, 6} {
+			if cell := row[col]; cell != "" && strings.ContainsRune("=+-@", rune(cell[0])) {
+				t.Errorf("%s column %d = %q, starts a formula", row[0], col, cell)
+			}
+		}
+	}
+}
+
+func TestFormulaSafe(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"Raja", "Raja"},
+		{"=1+1", "'=1+1"},
+		{"+91", "'+91"},
+		{"-5", "'-5"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"a=b", "a=b"},
+		{"'quoted", "'quoted"},
+	} {
+		if got := formulaSafe(tc.in); got != tc.want {
+			t.Errorf("formulaSafe(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
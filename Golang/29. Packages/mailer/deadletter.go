@@ -0,0 +1,68 @@
+package mailer
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+var ErrNotFound = errors.New("mailer: no such dead letter")
+
+// DeadLetter is a message that could not be delivered.
+type DeadLetter struct {
+	Message  Message   `json:"message"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// DeadLetterQueue keeps failed messages until they are replayed or
+// discarded.
+type DeadLetterQueue interface {
+	Put(dl DeadLetter) error
+	List() ([]DeadLetter, error)
+	Get(id string) (DeadLetter, error)
+	Remove(id string) error
+}
+
+// MemoryDLQ is a DeadLetterQueue that lives as long as the process.
+type MemoryDLQ struct {
+	mu      sync.Mutex
+	letters []DeadLetter
+}
+
+func (q *MemoryDLQ) Put(dl DeadLetter) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.letters = append(q.letters, dl)
+	return nil
+}
+
+// List returns the dead letters, oldest first.
+func (q *MemoryDLQ) List() ([]DeadLetter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return slices.Clone(q.letters), nil
+}
+
+func (q *MemoryDLQ) Get(id string) (DeadLetter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	i := slices.IndexFunc(q.letters, func(dl DeadLetter) bool { return dl.Message.ID == id })
+	if i < 0 {
+		return DeadLetter{}, ErrNotFound
+	}
+	return q.letters[i], nil
+}
+
+func (q *MemoryDLQ) Remove(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	i := slices.IndexFunc(q.letters, func(dl DeadLetter) bool { return dl.Message.ID == id })
+	if i < 0 {
+		return ErrNotFound
+	}
+	q.letters = slices.Delete(q.letters, i, i+1)
+	return nil
+}
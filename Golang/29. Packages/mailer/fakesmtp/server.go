@@ -0,0 +1,343 @@
+// Package fakesmtp is a small SMTP server that keeps what it receives in
+// memory, so code that sends mail can be exercised without a network or a
+// real mail provider. It speaks enough of the protocol for net/smtp:
+// EHLO, STARTTLS with a throwaway certificate, AUTH PLAIN and LOGIN, MAIL,
+// RCPT, DATA, RSET, NOOP and QUIT.
+package fakesmtp
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Received is one message as the server got it.
+type Received struct {
+	From string
+	To   []string
+	Data []byte // the message as sent after DATA, dot-unstuffed
+	User string // authenticated user, if any
+	TLS  bool
+}
+
+// Parse reads the captured message headers and body.
+func (r Received) Parse() (*mail.Message, error) {
+	return mail.ReadMessage(bytes.NewReader(r.Data))
+}
+
+// Server is a running fake SMTP server.
+type Server struct {
+	ln      net.Listener
+	tlsConf *tls.Config
+	pool    *x509.CertPool
+
+	mu       sync.Mutex
+	received []Received
+	notify   chan struct{}
+
+	// Users maps usernames to passwords. When it is non-empty, AUTH is
+	// advertised and required before MAIL.
+	Users map[string]string
+	// NoTLS stops the server from offering STARTTLS.
+	NoTLS bool
+	// Reject makes RCPT fail with 550 for these addresses, and TempFail
+	// with 451.
+	Reject   []string
+	TempFail []string
+
+	wg sync.WaitGroup
+}
+
+// Start listens on a free port on 127.0.0.1. Set the exported fields
+// before sending any mail.
+func Start() (*Server, error) {
+	cert, pool, err := selfSigned()
+	if err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		ln:      ln,
+		tlsConf: &tls.Config{Certificates: []tls.Certificate{cert}},
+		pool:    pool,
+		notify:  make(chan struct{}, 1),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr is the host:port to send to.
+func (s *Server) Addr() string { return s.ln.Addr().String() }
+
+// ClientTLSConfig trusts the server's certificate.
+func (s *Server) ClientTLSConfig() *tls.Config {
+	return &tls.Config{RootCAs: s.pool, ServerName: "127.0.0.1"}
+}
+
+// Close stops the server and waits for open sessions to end.
+func (s *Server) Close() error {
+	err := s.ln.Close()
+	s.wg.Wait()
+	return err
+}
+
+// Messages returns what has been received so far.
+func (s *Server) Messages() []Received {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.received)
+}
+
+// Reset forgets the received messages.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	s.received = nil
+	s.mu.Unlock()
+}
+
+// WaitFor waits until at least n messages have arrived or timeout passes,
+// and returns them.
+func (s *Server) WaitFor(n int, timeout time.Duration) ([]Received, error) {
+	deadline := time.After(timeout)
+	for {
+		if msgs := s.Messages(); len(msgs) >= n {
+			return msgs, nil
+		}
+		select {
+		case <-s.notify:
+		case <-deadline:
+			got := len(s.Messages())
+			return s.Messages(), fmt.Errorf("fakesmtp: got %d messages, want %d", got, n)
+		}
+	}
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(time.Minute))
+			s.session(conn)
+		}()
+	}
+}
+
+type session struct {
+	s    *Server
+	conn net.Conn
+	tp   *textproto.Conn
+	tls  bool
+	user string
+	from string
+	to   []string
+}
+
+func (s *Server) session(conn net.Conn) {
+	ss := &session{s: s, conn: conn, tp: textproto.NewConn(conn)}
+	ss.reply(220, "fakesmtp ready")
+	for {
+		line, err := ss.tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		if !ss.handle(strings.ToUpper(verb), arg) {
+			return
+		}
+	}
+}
+
+func (ss *session) reply(code int, lines ...string) {
+	for i, l := range lines {
+		sep := "-"
+		if i == len(lines)-1 {
+			sep = " "
+		}
+		ss.tp.PrintfLine("%d%s%s", code, sep, l)
+	}
+}
+
+// handle runs one command and reports whether the session goes on.
+func (ss *session) handle(verb, arg string) bool {
+	s := ss.s
+	switch verb {
+	case "EHLO", "HELO":
+		lines := []string{"fakesmtp", "8BITMIME"}
+		if !s.NoTLS && !ss.tls {
+			lines = append(lines, "STARTTLS")
+		}
+		if len(s.Users) > 0 {
+			lines = append(lines, "AUTH PLAIN LOGIN")
+		}
+		ss.reply(250, lines...)
+	case "STARTTLS":
+		if s.NoTLS || ss.tls {
+			ss.reply(502, "not available")
+			return true
+		}
+		ss.reply(220, "go ahead")
+		tc := tls.Server(ss.conn, s.tlsConf)
+		if err := tc.Handshake(); err != nil {
+			return false
+		}
+		ss.conn, ss.tp, ss.tls = tc, textproto.NewConn(tc), true
+		ss.user, ss.from, ss.to = "", "", nil
+	case "AUTH":
+		ss.auth(arg)
+	case "MAIL":
+		if len(s.Users) > 0 && ss.user == "" {
+			ss.reply(530, "authentication required")
+			return true
+		}
+		ss.from = addrArg(arg, "FROM:")
+		ss.to = nil
+		ss.reply(250, "ok")
+	case "RCPT":
+		if ss.from == "" {
+			ss.reply(503, "MAIL first")
+			return true
+		}
+		to := addrArg(arg, "TO:")
+		switch {
+		case slices.Contains(s.Reject, to):
+			ss.reply(550, "no such user "+to)
+		case slices.Contains(s.TempFail, to):
+			ss.reply(451, "try again later")
+		default:
+			ss.to = append(ss.to, to)
+			ss.reply(250, "ok")
+		}
+	case "DATA":
+		if len(ss.to) == 0 {
+			ss.reply(503, "RCPT first")
+			return true
+		}
+		ss.reply(354, "end with <CRLF>.<CRLF>")
+		data, err := ss.tp.ReadDotBytes()
+		if err != nil {
+			return false
+		}
+		s.mu.Lock()
+		s.received = append(s.received, Received{From: ss.from, To: ss.to, Data: data, User: ss.user, TLS: ss.tls})
+		s.mu.Unlock()
+		select {
+		case s.notify <- struct{}{}:
+		default:
+		}
+		ss.from, ss.to = "", nil
+		ss.reply(250, "queued")
+	case "RSET":
+		ss.from, ss.to = "", nil
+		ss.reply(250, "ok")
+	case "NOOP":
+		ss.reply(250, "ok")
+	case "QUIT":
+		ss.reply(221, "bye")
+		return false
+	default:
+		ss.reply(502, "unknown command")
+	}
+	return true
+}
+
+func (ss *session) auth(arg string) {
+	mech, initial, _ := strings.Cut(arg, " ")
+	var user, pass string
+	switch strings.ToUpper(mech) {
+	case "PLAIN":
+		if initial == "" {
+			ss.reply(334, "")
+			line, _ := ss.tp.ReadLine()
+			initial = line
+		}
+		b, err := base64.StdEncoding.DecodeString(initial)
+		parts := strings.Split(string(b), "\x00")
+		if err != nil || len(parts) != 3 {
+			ss.reply(501, "malformed PLAIN response")
+			return
+		}
+		user, pass = parts[1], parts[2]
+	case "LOGIN":
+		prompt := func(p string) string {
+			ss.reply(334, base64.StdEncoding.EncodeToString([]byte(p)))
+			line, _ := ss.tp.ReadLine()
+			b, _ := base64.StdEncoding.DecodeString(line)
+			return string(b)
+		}
+		user, pass = prompt("Username:"), prompt("Password:")
+	default:
+		ss.reply(504, "unsupported mechanism")
+		return
+	}
+	if want, ok := ss.s.Users[user]; !ok || want != pass {
+		ss.reply(535, "authentication failed")
+		return
+	}
+	ss.user = user
+	ss.reply(235, "authenticated")
+}
+
+// addrArg extracts the address from "FROM:<a@b> SIZE=123".
+func addrArg(arg, prefix string) string {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return ""
+	}
+	addr, _, _ := strings.Cut(strings.TrimSpace(arg[len(prefix):]), " ")
+	return strings.Trim(addr, "<>")
+}
+
+// selfSigned makes a certificate for 127.0.0.1 valid for a day.
+func selfSigned() (tls.Certificate, *x509.CertPool, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fakesmtp"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		DNSNames:              []string{"localhost"},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool, nil
+}
@@ -0,0 +1,200 @@
+package fakesmtp
+
+import (
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+func start(t *testing.T) *Server {
+	t.Helper()
+	s, err := Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func dial(t *testing.T, s *Server) *smtp.Client {
+	t.Helper()
+	c, err := smtp.Dial(s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	if err := c.Hello("test"); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func code(err error) int {
+	if perr, ok := err.(*textproto.Error); ok {
+		return perr.Code
+	}
+	return 0
+}
+
+func sendData(t *testing.T, c *smtp.Client, data string) {
+	t.Helper()
+	w, err := c.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReceive(t *testing.T) {
+	s := start(t)
+	c := dial(t, s)
+	if err := c.StartTLS(s.ClientTLSConfig()); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Mail("a@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	for _, to := range []string{"b@example.com", "c@example.com"} {
+		if err := c.Rcpt(to); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sendData(t, c, "Subject: hi\r\n\r\n.leading dot\r\nbye\r\n")
+	if err := c.Quit(); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs, err := s.WaitFor(1, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := msgs[0]
+	if r.From != "a@example.com" || strings.Join(r.To, ",") != "b@example.com,c@example.com" || !r.TLS {
+		t.Errorf("received %+v", r)
+	}
+	m, err := r.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Header.Get("Subject") != "hi" {
+		t.Errorf("Subject = %q", m.Header.Get("Subject"))
+	}
+	if !strings.HasPrefix(string(r.Data[strings.Index(string(r.Data), "\n\n")+2:]), ".leading dot\n") {
+		t.Errorf("data %q was not dot-unstuffed", r.Data)
+	}
+
+	s.Reset()
+	if n := len(s.Messages()); n != 0 {
+		t.Errorf("%d messages after Reset", n)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	s := start(t)
+	s.Users = map[string]string{"u": "p"}
+	c := dial(t, s)
+	if ok, mechs := c.Extension("AUTH"); !ok || mechs != "PLAIN LOGIN" {
+		t.Errorf("AUTH extension = %v %q", ok, mechs)
+	}
+	if err := c.Mail("a@example.com"); code(err) != 530 {
+		t.Errorf("MAIL before AUTH: err = %v, want 530", err)
+	}
+	if err := c.StartTLS(s.ClientTLSConfig()); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Auth(smtp.PlainAuth("", "u", "p", "127.0.0.1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Mail("a@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Rcpt("b@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	sendData(t, c, "Subject: hi\r\n\r\nhello\r\n")
+	msgs, err := s.WaitFor(1, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgs[0].User != "u" {
+		t.Errorf("User = %q, want u", msgs[0].User)
+	}
+}
+
+func TestBadPassword(t *testing.T) {
+	s := start(t)
+	s.Users = map[string]string{"u": "p"}
+	c := dial(t, s)
+	if err := c.StartTLS(s.ClientTLSConfig()); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Auth(smtp.PlainAuth("", "u", "wrong", "127.0.0.1")); code(err) != 535 {
+		t.Errorf("bad password: err = %v, want 535", err)
+	}
+}
+
+func TestCommandOrder(t *testing.T) {
+	s := start(t)
+	c := dial(t, s)
+	if err := c.Rcpt("b@example.com"); code(err) != 503 {
+		t.Errorf("RCPT before MAIL: err = %v, want 503", err)
+	}
+	if err := c.Mail("a@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Data(); code(err) != 503 {
+		t.Errorf("DATA before RCPT: err = %v, want 503", err)
+	}
+	if err := c.Rcpt("b@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Rcpt("b@example.com"); code(err) != 503 {
+		t.Errorf("RCPT after RSET: err = %v, want 503", err)
+	}
+	if err := c.Noop(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRecipientFailures(t *testing.T) {
+	s := start(t)
+	s.Reject = []string{"gone@example.com"}
+	s.TempFail = []string{"full@example.com"}
+	c := dial(t, s)
+	if err := c.Mail("a@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Rcpt("gone@example.com"); code(err) != 550 {
+		t.Errorf("rejected: err = %v, want 550", err)
+	}
+	if err := c.Rcpt("full@example.com"); code(err) != 451 {
+		t.Errorf("temporary failure: err = %v, want 451", err)
+	}
+}
+
+func TestNoTLS(t *testing.T) {
+	s := start(t)
+	s.NoTLS = true
+	c := dial(t, s)
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		t.Error("STARTTLS offered with NoTLS set")
+	}
+}
+
+func TestWaitForTimeout(t *testing.T) {
+	s := start(t)
+	msgs, err := s.WaitFor(1, 10*time.Millisecond)
+	if err == nil || len(msgs) != 0 {
+		t.Errorf("WaitFor = %v, %v; want a timeout error", msgs, err)
+	}
+}
@@ -0,0 +1,94 @@
+// Package mailer queues outgoing email and hands it to a Sender from a
+// pool of workers, retrying failures with backoff and parking messages
+// that can't be delivered in a dead-letter queue for inspection and
+// replay.
+package mailer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+var ErrInvalidMessage = errors.New("mailer: invalid message")
+
+// Message is one email. Headers are extra header fields; From, To and
+// Subject have their own fields and the MIME headers are set when the
+// message is rendered, so none of those may appear in Headers. Body is
+// the plain-text part and HTML, when set, an alternative for mail
+// clients that show it.
+type Message struct {
+	ID          string            `json:"id"`
+	From        string            `json:"from"`
+	To          []string          `json:"to"`
+	Subject     string            `json:"subject"`
+	Body        string            `json:"body"`
+	HTML        string            `json:"html,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Attachments []Attachment      `json:"attachments,omitempty"`
+}
+
+// Attachment is a file sent along with a message.
+type Attachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"` // guessed from Filename if empty
+	Data        []byte `json:"data"`
+}
+
+// Validate checks the addresses and that there is something to send.
+func (m Message) Validate() error {
+	if _, err := mail.ParseAddress(m.From); err != nil {
+		return fmt.Errorf("%w: from %q: %v", ErrInvalidMessage, m.From, err)
+	}
+	if len(m.To) == 0 {
+		return fmt.Errorf("%w: no recipients", ErrInvalidMessage)
+	}
+	for _, to := range m.To {
+		if _, err := mail.ParseAddress(to); err != nil {
+			return fmt.Errorf("%w: to %q: %v", ErrInvalidMessage, to, err)
+		}
+	}
+	for k, v := range m.Headers {
+		if strings.ContainsAny(k+v, "\r\n") || strings.ContainsAny(k, ": ") {
+			return fmt.Errorf("%w: header %q", ErrInvalidMessage, k)
+		}
+		if reserved[textproto.CanonicalMIMEHeaderKey(k)] {
+			return fmt.Errorf("%w: header %q is set by the mailer", ErrInvalidMessage, k)
+		}
+	}
+	return nil
+}
+
+// reserved are the header fields Bytes writes itself, plus Cc and Bcc,
+// which would not match the envelope recipients.
+var reserved = map[string]bool{
+	"From":                      true,
+	"To":                        true,
+	"Cc":                        true,
+	"Bcc":                       true,
+	"Subject":                   true,
+	"Date":                      true,
+	"Message-Id":                true,
+	"Mime-Version":              true,
+	"Content-Type":              true,
+	"Content-Transfer-Encoding": true,
+}
+
+// parseAddr returns the bare address of a "Name <addr>" string.
+func parseAddr(s string) (string, error) {
+	a, err := mail.ParseAddress(s)
+	if err != nil {
+		return "", err
+	}
+	return a.Address, nil
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,70 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"net/mail"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(*Message)
+		ok   bool
+	}{
+		{"valid", func(*Message) {}, true},
+		{"extra header", func(m *Message) { m.Headers = map[string]string{"X-Order": "o1"} }, true},
+		{"bad from", func(m *Message) { m.From = "not an address" }, false},
+		{"no recipients", func(m *Message) { m.To = nil }, false},
+		{"bad recipient", func(m *Message) { m.To = []string{"a@example.com", "nope"} }, false},
+		{"header injection", func(m *Message) { m.Headers = map[string]string{"X-Order": "o1\r\nBcc: x@example.com"} }, false},
+		{"colon in name", func(m *Message) { m.Headers = map[string]string{"X-Order:": "o1"} }, false},
+		{"from header", func(m *Message) { m.Headers = map[string]string{"From": "boss@example.com"} }, false},
+		{"lower case subject", func(m *Message) { m.Headers = map[string]string{"subject": "hi"} }, false},
+		{"bcc", func(m *Message) { m.Headers = map[string]string{"BCC": "x@example.com"} }, false},
+		{"content type", func(m *Message) { m.Headers = map[string]string{"content-type": "text/html"} }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := testMessage("a@example.com")
+			tt.edit(&m)
+			err := m.Validate()
+			if tt.ok && err != nil {
+				t.Errorf("Validate() = %v", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrInvalidMessage) {
+				t.Errorf("Validate() = %v, want ErrInvalidMessage", err)
+			}
+		})
+	}
+}
+
+// Bytes can be called on a message that was never validated; reserved
+// headers are still not overridden.
+func TestBytesReservedHeaders(t *testing.T) {
+	m := testMessage("a@example.com")
+	m.ID = "abc"
+	m.Headers = map[string]string{"From": "boss@evil.example", "to": "x@evil.example", "X-Order": "o1"}
+	b, err := m.Bytes(time.Date(2026, time.May, 4, 10, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"From":       `"Rasoi" <orders@rasoi.example>`,
+		"To":         "<a@example.com>",
+		"X-Order":    "o1",
+		"Message-Id": "<abc@rasoi.example>",
+		"Date":       "Mon, 04 May 2026 10:00:00 +0000",
+	}
+	for k, v := range want {
+		if got := msg.Header[k]; len(got) != 1 || got[0] != v {
+			t.Errorf("%s = %q, want %q", k, got, v)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package mailer
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Bytes renders m as an RFC 5322 message, ready for SMTP DATA. The MIME
+// structure depends on what m has:
+//
+//	text only            text/plain
+//	text and HTML        multipart/alternative
+//	with attachments     multipart/mixed holding the above and the files
+func (m Message) Bytes(date time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return nil, err
+	}
+
+	h := make(textproto.MIMEHeader)
+	h.Set("From", from.String())
+	to := make([]string, len(m.To))
+	for i, addr := range m.To {
+		a, err := mail.ParseAddress(addr)
+		if err != nil {
+			return nil, err
+		}
+		to[i] = a.String()
+	}
+	h.Set("To", strings.Join(to, ", "))
+	h.Set("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	h.Set("Date", date.Format(time.RFC1123Z))
+	domain := from.Address[strings.LastIndexByte(from.Address, '@')+1:]
+	h.Set("Message-ID", fmt.Sprintf("<%s@%s>", cmp.Or(m.ID, newID()), domain))
+	h.Set("MIME-Version", "1.0")
+	for k, v := range m.Headers {
+		if reserved[textproto.CanonicalMIMEHeaderKey(k)] {
+			continue
+		}
+		h.Set(k, mime.QEncoding.Encode("utf-8", v))
+	}
+
+	switch {
+	case len(m.Attachments) > 0:
+		mw := multipart.NewWriter(&buf)
+		h.Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+		writeHeader(&buf, h)
+		if err := m.writeBody(mw); err != nil {
+			return nil, err
+		}
+		for _, a := range m.Attachments {
+			if err := writeAttachment(mw, a); err != nil {
+				return nil, err
+			}
+		}
+		if err := mw.Close(); err != nil {
+			return nil, err
+		}
+	case m.HTML != "":
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		h.Set("Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+		writeHeader(&buf, h)
+		if err := writeText(mw, "text/plain", m.Body); err != nil {
+			return nil, err
+		}
+		if err := writeText(mw, "text/html", m.HTML); err != nil {
+			return nil, err
+		}
+		if err := mw.Close(); err != nil {
+			return nil, err
+		}
+		buf.Write(body.Bytes())
+	default:
+		h.Set("Content-Type", "text/plain; charset=utf-8")
+		h.Set("Content-Transfer-Encoding", "quoted-printable")
+		writeHeader(&buf, h)
+		qp := quotedprintable.NewWriter(&buf)
+		io.WriteString(qp, crlf(m.Body))
+		qp.Close()
+	}
+	return buf.Bytes(), nil
+}
+
+// writeBody adds the text part, or a nested multipart/alternative when
+// there is HTML too, to a multipart/mixed message.
+func (m Message) writeBody(mw *multipart.Writer) error {
+	if m.HTML == "" {
+		return writeText(mw, "text/plain", m.Body)
+	}
+	var alt bytes.Buffer
+	aw := multipart.NewWriter(&alt)
+	if err := writeText(aw, "text/plain", m.Body); err != nil {
+		return err
+	}
+	if err := writeText(aw, "text/html", m.HTML); err != nil {
+		return err
+	}
+	if err := aw.Close(); err != nil {
+		return err
+	}
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Type", "multipart/alternative; boundary="+aw.Boundary())
+	w, err := mw.CreatePart(h)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(alt.Bytes())
+	return err
+}
+
+func writeText(mw *multipart.Writer, contentType, s string) error {
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Type", contentType+"; charset=utf-8")
+	h.Set("Content-Transfer-Encoding", "quoted-printable")
+	w, err := mw.CreatePart(h)
+	if err != nil {
+		return err
+	}
+	qp := quotedprintable.NewWriter(w)
+	if _, err := io.WriteString(qp, crlf(s)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+func writeAttachment(mw *multipart.Writer, a Attachment) error {
+	ct := a.ContentType
+	if ct == "" {
+		ct = mime.TypeByExtension(filepath.Ext(a.Filename))
+	}
+	if ct == "" {
+		ct = "application/octet-stream"
+	}
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Type", ct)
+	h.Set("Content-Transfer-Encoding", "base64")
+	h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename}))
+	w, err := mw.CreatePart(h)
+	if err != nil {
+		return err
+	}
+	// base64 in lines of 76 characters, as RFC 2045 requires
+	enc := base64.StdEncoding.EncodeToString(a.Data)
+	for len(enc) > 76 {
+		io.WriteString(w, enc[:76]+"\r\n")
+		enc = enc[76:]
+	}
+	_, err = io.WriteString(w, enc+"\r\n")
+	return err
+}
+
+// writeHeader writes h in a stable order followed by the blank line.
+func writeHeader(buf *bytes.Buffer, h textproto.MIMEHeader) {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		for _, v := range h[k] {
+			fmt.Fprintf(buf, "%s: %s\r\n", k, v)
+		}
+	}
+	buf.WriteString("\r\n")
+}
+
+// crlf normalises line endings to CRLF.
+func crlf(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.ReplaceAll(s, "\n", "\r\n")
+}
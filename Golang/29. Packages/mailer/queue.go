@@ -0,0 +1,302 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrClosed = errors.New("mailer: queue is shut down")
+
+// Stats counts what the queue has done since it was created.
+type Stats struct {
+	Queued  int64 `json:"queued"`
+	Sent    int64 `json:"sent"`
+	Retried int64 `json:"retried"`
+	Dead    int64 `json:"dead"`
+}
+
+// Queue is a buffered mail queue served by a pool of workers.
+//
+//	q := mailer.NewQueue(sender, mailer.WithWorkers(8))
+//	q.Start()
+//	q.Enqueue(ctx, msg)
+//	...
+//	q.Shutdown(ctx) // stop taking mail, finish what is queued
+type Queue struct {
+	sender Sender
+	dlq    DeadLetterQueue
+
+	workers     int
+	buffer      int
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	timeout     time.Duration
+	logf        func(format string, args ...any)
+	now         func() time.Time
+
+	ch        chan Message
+	mu        sync.Mutex // guards closed and started
+	closed    bool
+	started   bool
+	closing   chan struct{}  // closed when Shutdown begins
+	senders   sync.WaitGroup // Enqueue calls that may still send on ch
+	closeCh   sync.Once
+	abort     chan struct{} // closed when Shutdown gives up waiting
+	abortOnce sync.Once
+	wg        sync.WaitGroup
+
+	queued, sent, retried, dead atomic.Int64
+}
+
+type Option func(*Queue)
+
+// WithWorkers sets the number of concurrent senders. The default is 4.
+func WithWorkers(n int) Option {
+	return func(q *Queue) { q.workers = n }
+}
+
+// WithBuffer sets how many messages can wait before Enqueue blocks. The
+// default is 1000.
+func WithBuffer(n int) Option {
+	return func(q *Queue) { q.buffer = n }
+}
+
+// WithRetry sets the attempts per message and the backoff between them:
+// base doubled each attempt, capped at max, with up to 50% jitter. The
+// default is 5 attempts from 1s up to 1m.
+func WithRetry(attempts int, base, max time.Duration) Option {
+	return func(q *Queue) { q.maxAttempts, q.baseDelay, q.maxDelay = attempts, base, max }
+}
+
+// WithSendTimeout bounds each attempt. The default is 30 seconds.
+func WithSendTimeout(d time.Duration) Option {
+	return func(q *Queue) { q.timeout = d }
+}
+
+// WithDeadLetterQueue sets where undeliverable messages go. The default
+// is a MemoryDLQ.
+func WithDeadLetterQueue(dlq DeadLetterQueue) Option {
+	return func(q *Queue) { q.dlq = dlq }
+}
+
+// WithLogger sets where failures are reported.
+func WithLogger(logf func(format string, args ...any)) Option {
+	return func(q *Queue) { q.logf = logf }
+}
+
+func NewQueue(s Sender, opts ...Option) *Queue {
+	q := &Queue{
+		sender:      s,
+		dlq:         &MemoryDLQ{},
+		workers:     4,
+		buffer:      1000,
+		maxAttempts: 5,
+		baseDelay:   time.Second,
+		maxDelay:    time.Minute,
+		timeout:     30 * time.Second,
+		logf:        log.Printf,
+		now:         time.Now,
+		closing:     make(chan struct{}),
+		abort:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(q)
+	}
+	q.ch = make(chan Message, q.buffer)
+	return q
+}
+
+// Start launches the workers. Calls after the first do nothing.
+func (q *Queue) Start() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.start()
+}
+
+// start launches the workers once. q.mu must be held.
+func (q *Queue) start() {
+	if q.started {
+		return
+	}
+	q.started = true
+	for range max(q.workers, 1) {
+		q.wg.Add(1)
+		go q.worker()
+	}
+}
+
+// Enqueue validates m, gives it an ID if it has none, and queues it. It
+// blocks while the buffer is full, until ctx is done or Shutdown begins.
+func (q *Queue) Enqueue(ctx context.Context, m Message) (string, error) {
+	if err := m.Validate(); err != nil {
+		return "", err
+	}
+	if m.ID == "" {
+		m.ID = newID()
+	}
+
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return "", ErrClosed
+	}
+	q.senders.Add(1)
+	q.mu.Unlock()
+	defer q.senders.Done()
+
+	select {
+	case q.ch <- m:
+		q.queued.Add(1)
+		return m.ID, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-q.closing:
+		return "", ErrClosed
+	}
+}
+
+// Shutdown stops Enqueue and waits for the workers to deliver everything
+// already queued, starting them if Start was never called. If ctx ends
+// first, messages still queued or waiting to retry go to the dead-letter
+// queue, and ctx's error is returned. It is safe to call more than once.
+func (q *Queue) Shutdown(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.closing)
+	}
+	q.start()
+	q.mu.Unlock()
+
+	// blocked senders see closing and return, so ch can be closed
+	// without anyone sending on it
+	q.senders.Wait()
+	q.closeCh.Do(func() { close(q.ch) })
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		q.abortOnce.Do(func() { close(q.abort) })
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (q *Queue) worker() {
+	defer q.wg.Done()
+	for m := range q.ch {
+		q.deliver(m)
+	}
+}
+
+// deliver tries m until it is sent, fails permanently or runs out of
+// attempts. Backoff waits hold the worker, which keeps the number of
+// connections to the mail server at most the worker count.
+func (q *Queue) deliver(m Message) {
+	var err error
+	attempt := 0
+	for attempt < q.maxAttempts {
+		attempt++
+		select {
+		case <-q.abort:
+			q.bury(m, attempt-1, ErrClosed)
+			return
+		default:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), q.timeout)
+		err = q.sender.Send(ctx, m)
+		cancel()
+		if err == nil {
+			q.sent.Add(1)
+			return
+		}
+		if errors.Is(err, ErrPermanent) || attempt == q.maxAttempts {
+			break
+		}
+
+		q.retried.Add(1)
+		t := time.NewTimer(q.backoff(attempt))
+		select {
+		case <-t.C:
+		case <-q.abort:
+			t.Stop()
+			q.bury(m, attempt, err)
+			return
+		}
+	}
+	q.bury(m, attempt, err)
+}
+
+func (q *Queue) backoff(attempt int) time.Duration {
+	d := q.baseDelay << (attempt - 1)
+	if d > q.maxDelay || d <= 0 {
+		d = q.maxDelay
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+func (q *Queue) bury(m Message, attempts int, err error) {
+	q.dead.Add(1)
+	q.logf("mailer: giving up on %s to %v after %d attempts: %v", m.ID, m.To, attempts, err)
+	dl := DeadLetter{Message: m, Attempts: attempts, Error: err.Error(), FailedAt: q.now()}
+	if perr := q.dlq.Put(dl); perr != nil {
+		q.logf("mailer: dead-letter queue: %v", perr)
+	}
+}
+
+// DeadLetters returns the dead-letter queue for inspection.
+func (q *Queue) DeadLetters() DeadLetterQueue {
+	return q.dlq
+}
+
+// Replay takes the dead letters with the given IDs, or all of them if
+// none are given, and queues them again with fresh attempts.
+func (q *Queue) Replay(ctx context.Context, ids ...string) (int, error) {
+	if len(ids) == 0 {
+		all, err := q.dlq.List()
+		if err != nil {
+			return 0, err
+		}
+		for _, dl := range all {
+			ids = append(ids, dl.Message.ID)
+		}
+	}
+	n := 0
+	for _, id := range ids {
+		dl, err := q.dlq.Get(id)
+		if err != nil {
+			return n, err
+		}
+		if _, err := q.Enqueue(ctx, dl.Message); err != nil {
+			return n, err
+		}
+		if err := q.dlq.Remove(id); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (q *Queue) Stats() Stats {
+	return Stats{
+		Queued:  q.queued.Load(),
+		Sent:    q.sent.Load(),
+		Retried: q.retried.Load(),
+		Dead:    q.dead.Load(),
+	}
+}
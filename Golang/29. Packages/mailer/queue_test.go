@@ -0,0 +1,196 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testMessage(to string) Message {
+	return Message{From: "Rasoi <orders@rasoi.example>", To: []string{to}, Subject: "Your order", Body: "Thanks!"}
+}
+
+func quiet(string, ...any) {}
+
+func TestQueueDelivers(t *testing.T) {
+	var sent atomic.Int64
+	q := NewQueue(SenderFunc(func(context.Context, Message) error {
+		sent.Add(1)
+		return nil
+	}), WithLogger(quiet))
+	q.Start()
+	for range 100 {
+		if _, err := q.Enqueue(context.Background(), testMessage("a@example.com")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := sent.Load(); got != 100 {
+		t.Errorf("sent %d, want 100", got)
+	}
+	if st := q.Stats(); st.Queued != 100 || st.Sent != 100 {
+		t.Errorf("stats = %+v", st)
+	}
+	if _, err := q.Enqueue(context.Background(), testMessage("a@example.com")); !errors.Is(err, ErrClosed) {
+		t.Errorf("Enqueue after Shutdown: err = %v, want ErrClosed", err)
+	}
+}
+
+func TestQueueShutdownWithoutStart(t *testing.T) {
+	var sent atomic.Int64
+	q := NewQueue(SenderFunc(func(context.Context, Message) error {
+		sent.Add(1)
+		return nil
+	}), WithLogger(quiet))
+	for range 3 {
+		if _, err := q.Enqueue(context.Background(), testMessage("a@example.com")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := sent.Load(); got != 3 {
+		t.Errorf("sent %d, want 3", got)
+	}
+}
+
+func TestQueueShutdownFullWithoutStart(t *testing.T) {
+	var sent atomic.Int64
+	q := NewQueue(SenderFunc(func(context.Context, Message) error {
+		sent.Add(1)
+		return nil
+	}), WithBuffer(1), WithLogger(quiet))
+	if _, err := q.Enqueue(context.Background(), testMessage("a@example.com")); err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing drains the buffer, so this blocks until Shutdown
+	blocked := make(chan error)
+	go func() {
+		_, err := q.Enqueue(context.Background(), testMessage("b@example.com"))
+		blocked <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := q.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown = %v", err)
+	}
+	if err := <-blocked; !errors.Is(err, ErrClosed) {
+		t.Errorf("blocked Enqueue: err = %v, want ErrClosed", err)
+	}
+	if got := sent.Load(); got != 1 {
+		t.Errorf("sent %d, want 1", got)
+	}
+}
+
+func TestQueueStartTwice(t *testing.T) {
+	var wg sync.WaitGroup
+	q := NewQueue(SenderFunc(func(context.Context, Message) error { return nil }), WithWorkers(2), WithLogger(quiet))
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.Start()
+		}()
+	}
+	wg.Wait()
+	if err := q.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQueueRetry(t *testing.T) {
+	var calls atomic.Int64
+	q := NewQueue(SenderFunc(func(context.Context, Message) error {
+		if calls.Add(1) < 3 {
+			return errors.New("451 try again")
+		}
+		return nil
+	}), WithRetry(5, time.Millisecond, time.Millisecond), WithLogger(quiet))
+	q.Start()
+	q.Enqueue(context.Background(), testMessage("a@example.com"))
+	if err := q.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if st := q.Stats(); st.Sent != 1 || st.Retried != 2 || st.Dead != 0 {
+		t.Errorf("stats = %+v, want 1 sent after 2 retries", st)
+	}
+}
+
+func TestQueuePermanentAndReplay(t *testing.T) {
+	var fail atomic.Bool
+	fail.Store(true)
+	q := NewQueue(SenderFunc(func(context.Context, Message) error {
+		if fail.Load() {
+			return Permanent(errors.New("550 no such user"))
+		}
+		return nil
+	}), WithRetry(5, time.Millisecond, time.Millisecond), WithLogger(quiet))
+	q.Start()
+	defer q.Shutdown(context.Background())
+
+	id, err := q.Enqueue(context.Background(), testMessage("nobody@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dl DeadLetter
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		if dl, err = q.DeadLetters().Get(id); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("message never reached the dead-letter queue")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if dl.Attempts != 1 || !strings.Contains(dl.Error, "550") {
+		t.Errorf("dead letter = %+v, want one attempt with the 550", dl)
+	}
+
+	fail.Store(false)
+	if n, err := q.Replay(context.Background()); err != nil || n != 1 {
+		t.Fatalf("Replay = %d, %v", n, err)
+	}
+	if all, _ := q.DeadLetters().List(); len(all) != 0 {
+		t.Errorf("%d dead letters left after replay", len(all))
+	}
+}
+
+// Shutdown gives up when ctx ends, burying what is still waiting. Calling
+// it again with an expired context must not panic.
+func TestQueueShutdownExpired(t *testing.T) {
+	release := make(chan struct{})
+	q := NewQueue(SenderFunc(func(ctx context.Context, m Message) error {
+		<-release
+		return errors.New("421 busy")
+	}), WithWorkers(1), WithRetry(5, time.Hour, time.Hour), WithLogger(quiet))
+	q.Start()
+	for range 3 {
+		q.Enqueue(context.Background(), testMessage("a@example.com"))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+	}()
+	if err := q.Shutdown(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Shutdown: err = %v, want context.Canceled", err)
+	}
+	if err := q.Shutdown(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		t.Fatalf("second Shutdown: err = %v", err)
+	}
+	if st := q.Stats(); st.Dead != 3 || st.Sent != 0 {
+		t.Errorf("stats = %+v, want all 3 dead", st)
+	}
+}
@@ -0,0 +1,50 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Sender delivers one message. Errors are retried unless wrapped with
+// Permanent.
+type Sender interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// SenderFunc adapts a function to Sender.
+type SenderFunc func(ctx context.Context, m Message) error
+
+func (f SenderFunc) Send(ctx context.Context, m Message) error { return f(ctx, m) }
+
+var ErrPermanent = errors.New("mailer: permanent failure")
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string        { return e.err.Error() }
+func (e permanentError) Unwrap() []error      { return []error{e.err, ErrPermanent} }
+func (e permanentError) Is(target error) bool { return target == ErrPermanent }
+
+// Permanent marks err as not worth retrying, such as a rejected address.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+// WriterSender prints messages to a writer instead of sending them, for
+// development.
+type WriterSender struct {
+	mu sync.Mutex
+	W  io.Writer
+}
+
+func (s *WriterSender) Send(ctx context.Context, m Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := fmt.Fprintf(s.W, "From: %s\nTo: %v\nSubject: %s\n\n%s\n\n", m.From, m.To, m.Subject, m.Body)
+	return err
+}
@@ -0,0 +1,191 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Auth mechanisms understood by SMTPSender.
+const (
+	AuthNone  = ""
+	AuthPlain = "PLAIN"
+	AuthLogin = "LOGIN"
+)
+
+var ErrNoStartTLS = errors.New("mailer: server does not offer STARTTLS")
+
+// SMTPSender delivers messages to an SMTP server, upgrading the
+// connection with STARTTLS before authenticating.
+type SMTPSender struct {
+	Addr     string // host:port, usually port 587
+	Username string
+	Password string
+	Auth     string // AuthPlain, AuthLogin or AuthNone
+
+	// TLSConfig is used for STARTTLS; ServerName defaults to the host of
+	// Addr. Insecure allows plain-text sessions when the server offers no
+	// STARTTLS, and should only be set for local test servers.
+	TLSConfig *tls.Config
+	Insecure  bool
+
+	LocalName string // name sent in EHLO, "localhost" if empty
+	Now       func() time.Time
+}
+
+func (s *SMTPSender) Send(ctx context.Context, m Message) error {
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+	data, err := m.Bytes(now())
+	if err != nil {
+		return Permanent(err)
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		conn.Close()
+		return Permanent(err)
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if err := s.session(c, host, m, data); err != nil {
+		return classify(err)
+	}
+	return c.Quit()
+}
+
+func (s *SMTPSender) session(c *smtp.Client, host string, m Message, data []byte) error {
+	local := s.LocalName
+	if local == "" {
+		local = "localhost"
+	}
+	if err := c.Hello(local); err != nil {
+		return err
+	}
+
+	encrypted := false
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		cfg := &tls.Config{ServerName: host}
+		if s.TLSConfig != nil {
+			cfg = s.TLSConfig.Clone()
+			if cfg.ServerName == "" {
+				cfg.ServerName = host
+			}
+		}
+		if err := c.StartTLS(cfg); err != nil {
+			return err
+		}
+		encrypted = true
+	} else if !s.Insecure {
+		return Permanent(ErrNoStartTLS)
+	}
+
+	if s.Auth != AuthNone {
+		if !encrypted && !s.Insecure {
+			return Permanent(errors.New("mailer: refusing to authenticate without TLS"))
+		}
+		var a smtp.Auth
+		switch strings.ToUpper(s.Auth) {
+		case AuthPlain:
+			a = plainAuth{s.Username, s.Password}
+		case AuthLogin:
+			a = &loginAuth{username: s.Username, password: s.Password}
+		default:
+			return Permanent(fmt.Errorf("mailer: unknown auth %q", s.Auth))
+		}
+		if err := c.Auth(a); err != nil {
+			return err
+		}
+	}
+
+	from, _ := parseAddr(m.From)
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, to := range m.To {
+		addr, _ := parseAddr(to)
+		if err := c.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// classify marks 5xx replies as permanent; 4xx and network errors are
+// worth retrying.
+func classify(err error) error {
+	var perr *textproto.Error
+	if errors.As(err, &perr) && perr.Code >= 500 {
+		return Permanent(err)
+	}
+	return err
+}
+
+// plainAuth is PLAIN (RFC 4616). Unlike smtp.PlainAuth it leaves the
+// decision to send credentials without TLS to SMTPSender.Insecure.
+type plainAuth struct {
+	username, password string
+}
+
+func (a plainAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	return AuthPlain, []byte("\x00" + a.username + "\x00" + a.password), nil
+}
+
+func (a plainAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		return nil, errors.New("mailer: unexpected PLAIN challenge")
+	}
+	return nil, nil
+}
+
+// loginAuth is the LOGIN mechanism many providers still require: the
+// server prompts for "Username:" and "Password:" in turn.
+type loginAuth struct {
+	username, password string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	return AuthLogin, nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSuffix(string(fromServer), ":")) {
+	case "username":
+		return []byte(a.username), nil
+	case "password":
+		return []byte(a.password), nil
+	}
+	return nil, fmt.Errorf("mailer: unexpected LOGIN prompt %q", fromServer)
+}
@@ -0,0 +1,199 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/mailer/fakesmtp"
+)
+
+func startSMTP(t *testing.T) *fakesmtp.Server {
+	t.Helper()
+	srv, err := fakesmtp.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	return srv
+}
+
+func sender(srv *fakesmtp.Server) *SMTPSender {
+	return &SMTPSender{Addr: srv.Addr(), TLSConfig: srv.ClientTLSConfig()}
+}
+
+func send(t *testing.T, s *SMTPSender, m Message) error {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return s.Send(ctx, m)
+}
+
+func TestSMTPAuth(t *testing.T) {
+	for _, mech := range []string{AuthPlain, AuthLogin} {
+		t.Run(mech, func(t *testing.T) {
+			srv := startSMTP(t)
+			srv.Users = map[string]string{"rasoi": "s3cret"}
+			s := sender(srv)
+			s.Auth, s.Username, s.Password = mech, "rasoi", "s3cret"
+
+			m := testMessage("Asha <asha@example.com>")
+			m.To = append(m.To, "ravi@example.com")
+			if err := send(t, s, m); err != nil {
+				t.Fatal(err)
+			}
+			got := srv.Messages()
+			if len(got) != 1 {
+				t.Fatalf("server got %d messages", len(got))
+			}
+			r := got[0]
+			if !r.TLS || r.User != "rasoi" {
+				t.Errorf("TLS = %v, user = %q; want an authenticated TLS session", r.TLS, r.User)
+			}
+			if r.From != "orders@rasoi.example" || strings.Join(r.To, ",") != "asha@example.com,ravi@example.com" {
+				t.Errorf("envelope = %s -> %v", r.From, r.To)
+			}
+		})
+	}
+}
+
+func TestSMTPBadPassword(t *testing.T) {
+	srv := startSMTP(t)
+	srv.Users = map[string]string{"rasoi": "s3cret"}
+	s := sender(srv)
+	s.Auth, s.Username, s.Password = AuthPlain, "rasoi", "wrong"
+	err := send(t, s, testMessage("a@example.com"))
+	if !errors.Is(err, ErrPermanent) {
+		t.Fatalf("err = %v, want a permanent failure", err)
+	}
+	if n := len(srv.Messages()); n != 0 {
+		t.Errorf("server got %d messages", n)
+	}
+}
+
+func TestSMTPNoStartTLS(t *testing.T) {
+	srv := startSMTP(t)
+	srv.NoTLS = true
+	s := sender(srv)
+	if err := send(t, s, testMessage("a@example.com")); !errors.Is(err, ErrNoStartTLS) || !errors.Is(err, ErrPermanent) {
+		t.Fatalf("err = %v, want a permanent ErrNoStartTLS", err)
+	}
+
+	s.Insecure = true
+	if err := send(t, s, testMessage("a@example.com")); err != nil {
+		t.Fatal(err)
+	}
+	if got := srv.Messages(); len(got) != 1 || got[0].TLS {
+		t.Errorf("got %+v, want one plain-text message", got)
+	}
+}
+
+func TestSMTPRecipientErrors(t *testing.T) {
+	srv := startSMTP(t)
+	srv.Reject = []string{"gone@example.com"}
+	srv.TempFail = []string{"full@example.com"}
+	s := sender(srv)
+
+	err := send(t, s, testMessage("gone@example.com"))
+	if !errors.Is(err, ErrPermanent) || !strings.Contains(err.Error(), "550") {
+		t.Errorf("rejected: err = %v, want a permanent 550", err)
+	}
+	err = send(t, s, testMessage("full@example.com"))
+	if err == nil || errors.Is(err, ErrPermanent) || !strings.Contains(err.Error(), "451") {
+		t.Errorf("temporary failure: err = %v, want a retryable 451", err)
+	}
+}
+
+func TestSMTPMessageContent(t *testing.T) {
+	srv := startSMTP(t)
+	s := sender(srv)
+	s.Now = func() time.Time { return time.Date(2026, time.May, 4, 10, 0, 0, 0, time.UTC) }
+
+	m := testMessage("a@example.com")
+	m.Subject = "आपका ऑर्डर"
+	m.Body = "Line one\n.hidden by dot-stuffing\nदाल मखनी ₹250"
+	m.HTML = "<p>Thanks!</p>"
+	m.Attachments = []Attachment{{Filename: "invoice.csv", Data: []byte("sku,qty\nthali,2\n")}}
+	if err := send(t, s, m); err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := srv.WaitFor(1, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm, err := msgs[0].Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dec mime.WordDecoder
+	if subj, _ := dec.DecodeHeader(pm.Header.Get("Subject")); subj != m.Subject {
+		t.Errorf("Subject = %q, want %q", subj, m.Subject)
+	}
+	mt, params, err := mime.ParseMediaType(pm.Header.Get("Content-Type"))
+	if err != nil || mt != "multipart/mixed" {
+		t.Fatalf("Content-Type = %q, %v", mt, err)
+	}
+
+	mr := multipart.NewReader(pm.Body, params["boundary"])
+	var parts []string
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		ct, ap, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		parts = append(parts, ct)
+		switch ct {
+		case "multipart/alternative":
+			ar := multipart.NewReader(p, ap["boundary"])
+			text, err := ar.NextPart() // decodes quoted-printable
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, _ := io.ReadAll(text)
+			if string(b) != m.Body {
+				t.Errorf("text part = %q, want %q", b, m.Body)
+			}
+		case "text/csv":
+			if p.FileName() != "invoice.csv" {
+				t.Errorf("attachment name = %q", p.FileName())
+			}
+		}
+	}
+	if strings.Join(parts, " ") != "multipart/alternative text/csv" {
+		t.Errorf("parts = %v", parts)
+	}
+}
+
+// The queue dead-letters a rejected address without retrying it and
+// delivers the rest through real SMTP sessions.
+func TestQueueSMTP(t *testing.T) {
+	srv := startSMTP(t)
+	srv.Reject = []string{"gone@example.com"}
+	q := NewQueue(sender(srv), WithWorkers(3), WithRetry(3, time.Millisecond, time.Millisecond), WithLogger(quiet))
+	q.Start()
+
+	for _, to := range []string{"a@example.com", "b@example.com", "gone@example.com", "c@example.com"} {
+		if _, err := q.Enqueue(context.Background(), testMessage(to)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(srv.Messages()); n != 3 {
+		t.Errorf("server got %d messages, want 3", n)
+	}
+	dead, _ := q.DeadLetters().List()
+	if len(dead) != 1 || dead[0].Message.To[0] != "gone@example.com" || dead[0].Attempts != 1 {
+		t.Errorf("dead letters = %+v, want gone@example.com after one attempt", dead)
+	}
+}
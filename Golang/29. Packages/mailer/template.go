@@ -0,0 +1,136 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+var ErrNoTemplate = errors.New("mailer: no such template")
+
+// Templates renders messages from a directory of templates, one directory
+// per message and one set of files per locale:
+//
+//	order_confirmed/en.subject.tmpl
+//	order_confirmed/en.txt.tmpl
+//	order_confirmed/en.html.tmpl     optional
+//	order_confirmed/hi.subject.tmpl
+//	...
+//
+// A locale such as "hi-IN" falls back to "hi" and then to the default.
+type Templates struct {
+	fsys          fs.FS
+	defaultLocale string
+	funcs         map[string]any
+
+	mu    sync.Mutex
+	cache map[string]*localeSet // "name/locale"
+}
+
+type localeSet struct {
+	subject *template.Template
+	text    *template.Template
+	html    *htmltemplate.Template // nil if there is no HTML variant
+}
+
+// NewTemplates reads templates from fsys, which may be an embed.FS.
+// funcs are made available to every template.
+func NewTemplates(fsys fs.FS, defaultLocale string, funcs map[string]any) *Templates {
+	return &Templates{fsys: fsys, defaultLocale: defaultLocale, funcs: funcs, cache: make(map[string]*localeSet)}
+}
+
+// candidates lists the locales to try for locale, most specific first.
+func (t *Templates) candidates(locale string) []string {
+	var out []string
+	locale = strings.ReplaceAll(locale, "_", "-")
+	for locale != "" {
+		out = append(out, locale)
+		i := strings.LastIndexByte(locale, '-')
+		if i < 0 {
+			break
+		}
+		locale = locale[:i]
+	}
+	return append(out, t.defaultLocale)
+}
+
+func (t *Templates) load(name, locale string) (*localeSet, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, loc := range t.candidates(locale) {
+		key := name + "/" + loc
+		if set, ok := t.cache[key]; ok {
+			return set, nil
+		}
+		base := path.Join(name, loc)
+		if _, err := fs.Stat(t.fsys, base+".txt.tmpl"); err != nil {
+			continue
+		}
+
+		set := &localeSet{}
+		var err error
+		if set.subject, err = t.parseText(base + ".subject.tmpl"); err != nil {
+			return nil, err
+		}
+		if set.text, err = t.parseText(base + ".txt.tmpl"); err != nil {
+			return nil, err
+		}
+		if _, err := fs.Stat(t.fsys, base+".html.tmpl"); err == nil {
+			file := base + ".html.tmpl"
+			if set.html, err = htmltemplate.New(path.Base(file)).Funcs(t.funcs).ParseFS(t.fsys, file); err != nil {
+				return nil, err
+			}
+		}
+		t.cache[key] = set
+		return set, nil
+	}
+	return nil, fmt.Errorf("%w: %s for locale %q", ErrNoTemplate, name, locale)
+}
+
+func (t *Templates) parseText(file string) (*template.Template, error) {
+	return template.New(path.Base(file)).Funcs(t.funcs).ParseFS(t.fsys, file)
+}
+
+type executor interface {
+	Execute(w io.Writer, data any) error
+}
+
+func execute(tmpl executor, data any) (string, error) {
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, data)
+	return buf.String(), err
+}
+
+// Render fills in Subject, Body and, if the template has an HTML variant,
+// HTML of m from template name in the best matching locale.
+func (t *Templates) Render(m *Message, name, locale string, data any) error {
+	set, err := t.load(name, locale)
+	if err != nil {
+		return err
+	}
+	subject, err := execute(set.subject, data)
+	if err != nil {
+		return err
+	}
+	body, err := execute(set.text, data)
+	if err != nil {
+		return err
+	}
+	var html string
+	if set.html != nil {
+		if html, err = execute(set.html, data); err != nil {
+			return err
+		}
+	}
+	// a subject is one line however the template file ends
+	m.Subject = strings.Join(strings.Fields(subject), " ")
+	m.Body, m.HTML = body, html
+	return nil
+}
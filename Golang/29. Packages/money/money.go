@@ -0,0 +1,137 @@
+// Package money stores rupee amounts as whole paise so that adding up
+// orders never suffers float rounding.
+package money
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount in paise (1/100 of a rupee).
+type Money int64
+
+// FromRupees converts a float amount, rounding half away from zero to the
+// nearest paisa. Use Parse for user input to avoid floats entirely.
+func FromRupees(r float64) Money {
+	return Money(math.Round(r * 100))
+}
+
+// Parse reads "500", "500.5" or "500.50", optionally with a leading minus.
+// Only digits are accepted on either side of the point and more than two
+// decimals is an error.
+func Parse(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	unsigned, neg := strings.CutPrefix(s, "-")
+
+	whole, frac, hasFrac := strings.Cut(unsigned, ".")
+	if !digits(whole) || hasFrac && !digits(frac) || len(frac) > 2 {
+		return 0, fmt.Errorf("money: invalid amount %q", s)
+	}
+	frac += strings.Repeat("0", 2-len(frac))
+
+	r, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || r > math.MaxInt64/100-1 {
+		return 0, fmt.Errorf("money: amount %q out of range", s)
+	}
+	p, _ := strconv.ParseInt(frac, 10, 64)
+
+	m := Money(r*100 + p)
+	if neg {
+		m = -m
+	}
+	return m, nil
+}
+
+func digits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range []byte(s) {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Rupees returns the amount as a float, for display or legacy APIs only.
+func (m Money) Rupees() float64 {
+	return float64(m) / 100
+}
+
+// Paise returns the raw amount.
+func (m Money) Paise() int64 {
+	return int64(m)
+}
+
+// Decimal formats m as "500.50" without a currency sign.
+func (m Money) Decimal() string {
+	sign := ""
+	v := int64(m)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/100, v%100)
+}
+
+func (m Money) String() string {
+	if m < 0 {
+		return "-₹" + (-m).Decimal()
+	}
+	return "₹" + m.Decimal()
+}
+
+// MarshalJSON writes a JSON number with two decimals, e.g. 500.50.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.Decimal()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a quoted numeric string, parsed
+// exactly. null leaves m unchanged.
+func (m *Money) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if s == "null" {
+		return nil
+	}
+	if strings.HasPrefix(s, `"`) {
+		if err := json.Unmarshal(b, &s); err != nil {
+			return fmt.Errorf("money: invalid amount %s", b)
+		}
+	}
+	v, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// MulRatio returns m * num / den rounded half away from zero. It is used
+// for percentages and tax rates given in basis points.
+func (m Money) MulRatio(num, den int64) Money {
+	if den == 0 {
+		panic("money: division by zero")
+	}
+	p := int64(m) * num
+	q, r := p/den, p%den
+	// round half away from zero
+	if 2*abs(r) >= abs(den) {
+		if (p < 0) != (den < 0) {
+			q--
+		} else {
+			q++
+		}
+	}
+	return Money(q)
+}
+
+func abs(x int64) int64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
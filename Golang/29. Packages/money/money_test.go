@@ -0,0 +1,99 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want Money
+		ok   bool
+	}{
+		{"500", 50000, true},
+		{"500.5", 50050, true},
+		{"500.50", 50050, true},
+		{"0.05", 5, true},
+		{"-0.50", -50, true},
+		{" 12.34 ", 1234, true},
+		{"92233720368547757.99", 9223372036854775799, true},
+		{"92233720368547758", 0, false},
+		{"--5", 0, false},
+		{"-+5", 0, false},
+		{"+5", 0, false},
+		{"1.+5", 0, false},
+		{"1.-5", 0, false},
+		{"1.555", 0, false},
+		{"1.", 0, false},
+		{".5", 0, false},
+		{"-", 0, false},
+		{"1e3", 0, false},
+		{"1_000", 0, false},
+		{"", 0, false},
+	} {
+		got, err := Parse(tc.in)
+		if tc.ok != (err == nil) || got != tc.want {
+			t.Errorf("Parse(%q) = %d, %v", tc.in, got, err)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want Money
+		ok   bool
+	}{
+		{`500.5`, 50050, true},
+		{`"500.50"`, 50050, true},
+		{`-1`, -100, true},
+		{`"500.50`, 0, false},
+		{`500.50"`, 0, false},
+		{`""500""`, 0, false},
+		{`"5"`, 500, true},
+		{`true`, 0, false},
+	} {
+		var m Money
+		err := m.UnmarshalJSON([]byte(tc.in))
+		if tc.ok != (err == nil) || m != tc.want {
+			t.Errorf("UnmarshalJSON(%s) = %d, %v", tc.in, m, err)
+		}
+	}
+
+	var v struct{ Total Money }
+	if err := json.Unmarshal([]byte(`{"Total":"12.30"}`), &v); err != nil || v.Total != 1230 {
+		t.Fatalf("Unmarshal = %d, %v", v.Total, err)
+	}
+	b, err := json.Marshal(v)
+	if err != nil || string(b) != `{"Total":12.30}` {
+		t.Errorf("Marshal = %s, %v", b, err)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	for m, want := range map[Money]string{0: "₹0.00", 5: "₹0.05", 50050: "₹500.50", -1999: "-₹19.99"} {
+		if got := m.String(); got != want {
+			t.Errorf("%d.String() = %q, want %q", int64(m), got, want)
+		}
+	}
+}
+
+func TestMulRatio(t *testing.T) {
+	for _, tc := range []struct {
+		m        Money
+		num, den int64
+		want     Money
+	}{
+		{1000, 1800, 10000, 180},
+		{25, 1, 2, 13},
+		{-25, 1, 2, -13},
+		{25, -1, 2, -13},
+		{24, 1, 2, 12},
+		{1, 1, 3, 0},
+	} {
+		if got := tc.m.MulRatio(tc.num, tc.den); got != tc.want {
+			t.Errorf("%d.MulRatio(%d, %d) = %d, want %d", tc.m, tc.num, tc.den, got, tc.want)
+		}
+	}
+}
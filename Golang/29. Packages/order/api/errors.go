@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/rajasur/programming-learning/GO/customer"
+	"github.com/rajasur/programming-learning/GO/enum"
+	"github.com/rajasur/programming-learning/GO/order"
+	"github.com/rajasur/programming-learning/GO/order/store"
+)
+
+// errorBody is the shape of every error response:
+//
+//	{"error": {"code": "validation_failed", "message": "...", "fields": [...]}}
+type errorBody struct {
+	Error apiError `json:"error"`
+}
+
+type apiError struct {
+	Code    string             `json:"code"`
+	Message string             `json:"message"`
+	Fields  []order.FieldError `json:"fields,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, msg string, fields ...order.FieldError) {
+	writeJSON(w, status, errorBody{Error: apiError{Code: code, Message: msg, Fields: fields}})
+}
+
+// badRequest reports a request whose fields contradict each other.
+func badRequest(w http.ResponseWriter, field, msg string) {
+	writeError(w, http.StatusBadRequest, "bad_request", field+" "+msg, order.FieldError{Field: field, Message: msg})
+}
+
+// writeErr maps domain errors to status codes.
+func writeErr(w http.ResponseWriter, err error) {
+	var verr *order.ValidationError
+	var terr *order.TransitionError
+	switch {
+	case errors.As(err, &verr):
+		writeError(w, http.StatusUnprocessableEntity, "validation_failed", "request has invalid fields", verr.Fields...)
+	case errors.As(err, &terr):
+		writeError(w, http.StatusConflict, "illegal_transition", err.Error())
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, http.StatusNotFound, "not_found", "order not found")
+	case errors.Is(err, store.ErrExists):
+		writeError(w, http.StatusConflict, "already_exists", "an order with this id already exists")
+	default:
+		writeError(w, http.StatusInternalServerError, "internal", "internal error")
+	}
+}
+
+const maxBody = 1 << 20
+
+// decode reads a JSON body into v, rejecting unknown fields and trailing
+// data. Errors are returned as a ValidationError naming the field where
+// possible.
+func decode(w http.ResponseWriter, r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBody))
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(v)
+	if err == nil {
+		if dec.Decode(&struct{}{}) != io.EOF {
+			return invalid("body", "must contain a single JSON object")
+		}
+		return nil
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	var enumErr *enum.UnknownError
+	var maxErr *http.MaxBytesError
+	var phoneErr *customer.PhoneError
+	switch {
+	case errors.As(err, &typeErr):
+		field := typeErr.Field
+		if field == "" {
+			field = "body"
+		}
+		return invalid(field, fmt.Sprintf("must be %s", typeErr.Type))
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return invalid("body", "malformed JSON")
+	case errors.Is(err, io.EOF):
+		return invalid("body", "must not be empty")
+	case errors.As(err, &maxErr):
+		return invalid("body", "too large")
+	case errors.As(err, &phoneErr):
+		return invalid("customer.phone", phoneErr.Reason)
+	case errors.As(err, &enumErr):
+		return invalid("status", enumErr.Error())
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		name := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return invalid(name, "unknown field")
+	}
+	return invalid("body", err.Error())
+}
+
+func invalid(field, msg string) error {
+	return &order.ValidationError{Fields: []order.FieldError{{Field: field, Message: msg}}}
+}
@@ -0,0 +1,210 @@
+package api
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/customer"
+	"github.com/rajasur/programming-learning/GO/money"
+	"github.com/rajasur/programming-learning/GO/order"
+	"github.com/rajasur/programming-learning/GO/order/query"
+	"github.com/rajasur/programming-learning/GO/order/store"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+type listResponse struct {
+	Orders     []*order.Order `json:"orders"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// cursor points just past the last order of the previous page. It carries
+// the sort so a cursor can't be reused with a different one.
+type cursor struct {
+	Sort      string    `json:"s"`
+	CreatedAt time.Time `json:"c,omitzero"`
+	Amount    int64     `json:"a,omitempty"`
+	ID        string    `json:"i"`
+}
+
+func (c cursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (cursor, bool) {
+	var c cursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(b, &c) != nil {
+		return c, false
+	}
+	return c, true
+}
+
+var sorts = map[string]func(a, b *order.Order) int{
+	"created_at": func(a, b *order.Order) int { return a.CreatedAt.Compare(b.CreatedAt) },
+	"amount":     func(a, b *order.Order) int { return cmp.Compare(a.Amount, b.Amount) },
+}
+
+// list handles GET /orders. Query parameters:
+//
+//	q                            query language, see package query
+//	status, phone, name          exact filters
+//	created_from, created_to     RFC 3339 or YYYY-MM-DD, [from, to)
+//	sort                         created_at (default), amount; "-" prefix for descending
+//	limit                        1..500, default 50
+//	cursor                       next_cursor from the previous page
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	q, p, verr := parseListQuery(r)
+	if len(verr.Fields) > 0 {
+		writeErr(w, &verr)
+		return
+	}
+
+	orders, err := s.store.Find(q)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	if p.filter != nil {
+		orders = p.filter.Filter(orders)
+	}
+
+	byKey := sorts[p.sortKey]
+	compare := func(a, b *order.Order) int {
+		c := cmp.Or(byKey(a, b), strings.Compare(a.ID, b.ID))
+		if p.desc {
+			return -c
+		}
+		return c
+	}
+	slices.SortFunc(orders, compare)
+
+	start := 0
+	if p.after != nil {
+		ref := &order.Order{ID: p.after.ID, CreatedAt: p.after.CreatedAt, Amount: money.Money(p.after.Amount)}
+		start, _ = slices.BinarySearchFunc(orders, ref, func(o, ref *order.Order) int {
+			// first order strictly after the cursor
+			if compare(o, ref) <= 0 {
+				return -1
+			}
+			return 1
+		})
+	}
+
+	end := min(start+p.limit, len(orders))
+	resp := listResponse{Orders: orders[start:end]}
+	if resp.Orders == nil {
+		resp.Orders = []*order.Order{}
+	}
+	if end < len(orders) {
+		last := orders[end-1]
+		resp.NextCursor = cursor{Sort: p.sort, CreatedAt: last.CreatedAt, Amount: last.Amount.Paise(), ID: last.ID}.encode()
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+type page struct {
+	sort    string
+	sortKey string
+	desc    bool
+	limit   int
+	after   *cursor
+	filter  *query.Query
+}
+
+func parseListQuery(r *http.Request) (store.Query, page, order.ValidationError) {
+	v := r.URL.Query()
+	var q store.Query
+	var verr order.ValidationError
+	p := page{sort: "created_at", limit: defaultLimit}
+
+	if s := v.Get("q"); s != "" {
+		f, err := query.Parse(s)
+		if err != nil {
+			verr.Fields = append(verr.Fields, order.FieldError{Field: "q", Message: err.Error()})
+		} else {
+			// the explicit parameters below override what q narrowed
+			q, p.filter = f.Index(), f
+		}
+	}
+	if s := v.Get("status"); s != "" {
+		st, err := order.ParseStatus(s)
+		if err != nil {
+			verr.Fields = append(verr.Fields, order.FieldError{Field: "status", Message: err.Error()})
+		} else {
+			q.Status = &st
+		}
+	}
+	if s := v.Get("phone"); s != "" {
+		phone, err := customer.ParsePhoneNumber(s, customer.DefaultRegion)
+		if err != nil {
+			verr.Fields = append(verr.Fields, order.FieldError{Field: "phone", Message: err.(*customer.PhoneError).Reason})
+		} else {
+			q.CustomerPhone = phone
+		}
+	}
+	if s := v.Get("name"); s != "" {
+		q.CustomerName = s
+	}
+
+	for _, f := range []struct {
+		name string
+		dst  *time.Time
+	}{{"created_from", &q.CreatedFrom}, {"created_to", &q.CreatedTo}} {
+		s := v.Get(f.name)
+		if s == "" {
+			continue
+		}
+		t, err := parseTime(s)
+		if err != nil {
+			verr.Fields = append(verr.Fields, order.FieldError{Field: f.name, Message: "must be RFC 3339 or YYYY-MM-DD"})
+			continue
+		}
+		*f.dst = t
+	}
+
+	if s := v.Get("sort"); s != "" {
+		p.sort = s
+	}
+	p.sortKey = strings.TrimPrefix(p.sort, "-")
+	p.desc = strings.HasPrefix(p.sort, "-")
+	if _, ok := sorts[p.sortKey]; !ok {
+		verr.Fields = append(verr.Fields, order.FieldError{Field: "sort", Message: "must be created_at or amount, optionally prefixed with -"})
+	}
+
+	if s := v.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxLimit {
+			verr.Fields = append(verr.Fields, order.FieldError{Field: "limit", Message: "must be between 1 and 500"})
+		} else {
+			p.limit = n
+		}
+	}
+
+	if s := v.Get("cursor"); s != "" {
+		c, ok := decodeCursor(s)
+		if !ok || c.Sort != p.sort {
+			verr.Fields = append(verr.Fields, order.FieldError{Field: "cursor", Message: "invalid or issued for a different sort"})
+		} else {
+			p.after = &c
+		}
+	}
+	return q, p, verr
+}
+
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, s)
+}
@@ -0,0 +1,326 @@
+// Package api serves orders over HTTP as JSON.
+//
+//	POST /orders                 create an order
+//	GET  /orders                 list with filters, sorting and cursor pagination
+//	GET  /orders/{id}            fetch one order, with an ETag
+//	POST /orders/{id}/status     change status (honours If-Match)
+//	POST /orders/{id}/cancel     cancel (honours If-Match)
+//
+// More routes, such as the live tracking streams, can be added with Handle.
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/customer"
+	"github.com/rajasur/programming-learning/GO/money"
+	"github.com/rajasur/programming-learning/GO/order"
+	"github.com/rajasur/programming-learning/GO/order/store"
+)
+
+// Server is an http.Handler for the order endpoints.
+type Server struct {
+	store    store.OrderStore
+	tax      func(*order.Order) order.TaxRule
+	clock    order.Clock
+	machine  *order.StatusMachine
+	newID    func() string
+	onChange []func(*order.Order, order.StatusChange)
+	onCreate []func(*order.Order)
+	before   []beforeCreate
+
+	// mu makes read-check-write sequences (If-Match, status changes)
+	// atomic with respect to each other
+	mu  sync.Mutex
+	mux *http.ServeMux
+}
+
+type Option func(*Server)
+
+// WithTaxRule sets the rule used to price orders created with items.
+func WithTaxRule(r order.TaxRule) Option {
+	return WithTaxRuleFor(func(*order.Order) order.TaxRule { return r })
+}
+
+// WithTaxRuleFor picks the rule for each new order, for taxes that depend
+// on the customer, such as GST on the buyer's state.
+func WithTaxRuleFor(fn func(*order.Order) order.TaxRule) Option {
+	return func(s *Server) { s.tax = fn }
+}
+
+// WithClock sets the clock given to new orders.
+func WithClock(c order.Clock) Option {
+	return func(s *Server) { s.clock = c }
+}
+
+// WithStatusMachine makes orders follow m's rules and run its hooks once a
+// change has been saved, instead of DefaultStatusMachine's.
+func WithStatusMachine(m *order.StatusMachine) Option {
+	return func(s *Server) { s.machine = m }
+}
+
+// WithIDGenerator replaces the random order id generator.
+func WithIDGenerator(f func() string) Option {
+	return func(s *Server) { s.newID = f }
+}
+
+// OnStatusChange calls fn after an order's status change has been saved.
+func OnStatusChange(fn func(*order.Order, order.StatusChange)) Option {
+	return func(s *Server) { s.onChange = append(s.onChange, fn) }
+}
+
+// OnCreate calls fn after a new order has been saved.
+func OnCreate(fn func(*order.Order)) Option {
+	return func(s *Server) { s.onCreate = append(s.onCreate, fn) }
+}
+
+type beforeCreate struct {
+	fn   func(*order.Order) error
+	undo func(*order.Order)
+}
+
+// BeforeCreate calls fn before a new order is saved, for work such as
+// reserving stock that has to succeed for the order to be taken. An error
+// from fn refuses the order with 409 Conflict. If the order isn't saved
+// after all, undo (which may be nil) is called for every fn that succeeded.
+func BeforeCreate(fn func(*order.Order) error, undo func(*order.Order)) Option {
+	return func(s *Server) { s.before = append(s.before, beforeCreate{fn, undo}) }
+}
+
+func NewServer(st store.OrderStore, opts ...Option) *Server {
+	s := &Server{
+		store: st,
+		tax:   func(*order.Order) order.TaxRule { return order.NoTax{} },
+		clock: time.Now,
+		newID: randomID,
+		mux:   http.NewServeMux(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.mux.HandleFunc("POST /orders", s.create)
+	s.mux.HandleFunc("GET /orders", s.list)
+	s.mux.HandleFunc("GET /orders/{id}", s.get)
+	s.mux.HandleFunc("POST /orders/{id}/status", s.changeStatus)
+	s.mux.HandleFunc("POST /orders/{id}/cancel", s.cancel)
+	return s
+}
+
+// Handle registers an extra route on the server's mux.
+func (s *Server) Handle(pattern string, h http.Handler) {
+	s.mux.Handle(pattern, h)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func randomID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "ord_" + hex.EncodeToString(b)
+}
+
+// etag is a strong validator derived from the order's JSON encoding.
+func etag(o *order.Order) string {
+	b, _ := json.Marshal(o)
+	sum := sha256.Sum256(b)
+	return `"` + hex.EncodeToString(sum[:12]) + `"`
+}
+
+func writeOrder(w http.ResponseWriter, status int, o *order.Order) {
+	w.Header().Set("ETag", etag(o))
+	writeJSON(w, status, o)
+}
+
+type createRequest struct {
+	ID       string            `json:"id"`
+	Amount   money.Money       `json:"amount"`
+	Customer customer.Customer `json:"customer"`
+	Items    []order.LineItem  `json:"items"`
+	Discount order.Discount    `json:"discount"`
+}
+
+func (s *Server) create(w http.ResponseWriter, r *http.Request) {
+	var req createRequest
+	if err := decode(w, r, &req); err != nil {
+		writeErr(w, err)
+		return
+	}
+	if req.ID == "" {
+		req.ID = s.newID()
+	}
+
+	amount := req.Amount
+	if len(req.Items) > 0 {
+		if amount != 0 {
+			badRequest(w, "amount", "must be omitted when items are given")
+			return
+		}
+		// the real total is set below; this only has to pass validation
+		amount = 1
+	} else if req.Discount != (order.Discount{}) {
+		badRequest(w, "discount", "needs items to apply to")
+		return
+	}
+
+	// new orders always start out received; later statuses are reached
+	// through /orders/{id}/status so guards and hooks run
+	o, err := order.New(req.ID, amount, order.Received, req.Customer, order.WithClock(s.clock), order.WithStatusMachine(s.machine))
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	if len(req.Items) > 0 {
+		if _, err := o.SetItems(req.Items, req.Discount, s.tax(o)); err != nil {
+			writeErr(w, err)
+			return
+		}
+	}
+
+	for i, b := range s.before {
+		if err := b.fn(o); err != nil {
+			s.undoCreate(o, i)
+			writeError(w, http.StatusConflict, "refused", err.Error())
+			return
+		}
+	}
+	if err := s.store.Create(o); err != nil {
+		s.undoCreate(o, len(s.before))
+		writeErr(w, err)
+		return
+	}
+	for _, fn := range s.onCreate {
+		fn(o)
+	}
+	w.Header().Set("Location", "/orders/"+o.ID)
+	writeOrder(w, http.StatusCreated, o)
+}
+
+// undoCreate reverts the first n BeforeCreate calls, latest first.
+func (s *Server) undoCreate(o *order.Order, n int) {
+	for _, b := range slices.Backward(s.before[:n]) {
+		if b.undo != nil {
+			b.undo(o)
+		}
+	}
+}
+
+func (s *Server) get(w http.ResponseWriter, r *http.Request) {
+	o, err := s.store.Get(r.PathValue("id"))
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	if match := r.Header.Get("If-None-Match"); match != "" && match == etag(o) {
+		w.Header().Set("ETag", match)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeOrder(w, http.StatusOK, o)
+}
+
+type statusRequest struct {
+	Status *order.Status `json:"status"`
+	Actor  string        `json:"actor"`
+}
+
+func (s *Server) changeStatus(w http.ResponseWriter, r *http.Request) {
+	var req statusRequest
+	if err := decode(w, r, &req); err != nil {
+		writeErr(w, err)
+		return
+	}
+	if req.Status == nil {
+		writeErr(w, invalid("status", "is required"))
+		return
+	}
+	s.update(w, r, req.Actor, func(o *order.Order, actor string) error {
+		return o.ChangeStatus(*req.Status, actor)
+	})
+}
+
+type cancelRequest struct {
+	Actor string `json:"actor"`
+}
+
+func (s *Server) cancel(w http.ResponseWriter, r *http.Request) {
+	var req cancelRequest
+	if r.ContentLength != 0 {
+		if err := decode(w, r, &req); err != nil {
+			writeErr(w, err)
+			return
+		}
+	}
+	s.update(w, r, req.Actor, (*order.Order).Cancel)
+}
+
+var errPrecondition = errors.New("api: If-Match does not match")
+
+// update runs change for the order in the path through apply, honouring
+// If-Match, and writes the result.
+func (s *Server) update(w http.ResponseWriter, r *http.Request, actor string, change func(*order.Order, string) error) {
+	if actor == "" {
+		actor = "api"
+	}
+	o, err := s.apply(r.PathValue("id"), r.Header.Get("If-Match"), actor, change)
+	if errors.Is(err, errPrecondition) {
+		writeError(w, http.StatusPreconditionFailed, "precondition_failed", "order was modified, fetch it again")
+		return
+	}
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeOrder(w, http.StatusOK, o)
+}
+
+// Update applies change to order id on behalf of actor, saves it and runs
+// the status machine's hooks and the OnStatusChange hooks, exactly as the
+// HTTP endpoints do. Background jobs such as deadlines must change orders
+// through it so they neither race the API nor bypass the hooks. Nothing is
+// saved if change fails.
+func (s *Server) Update(id, actor string, change func(*order.Order, string) error) (*order.Order, error) {
+	return s.apply(id, "", actor, change)
+}
+
+// apply loads the order, checks ifMatch, applies change and saves it, all
+// under s.mu so two writers can't both pass the same If-Match.
+func (s *Server) apply(id, ifMatch, actor string, change func(*order.Order, string) error) (*order.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, err := s.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if ifMatch != "" && ifMatch != "*" && ifMatch != etag(o) {
+		return nil, errPrecondition
+	}
+
+	o.SetClock(s.clock)
+	o.UseMachine(s.machine)
+	seen := len(o.History)
+	if err := change(o, actor); err != nil {
+		return nil, err
+	}
+	if err := s.store.Update(o); err != nil {
+		return nil, err
+	}
+	for _, c := range o.History[seen:] {
+		o.Notify(c)
+		for _, fn := range s.onChange {
+			fn(o, c)
+		}
+	}
+	return o, nil
+}
@@ -0,0 +1,335 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/customer"
+	"github.com/rajasur/programming-learning/GO/money"
+	"github.com/rajasur/programming-learning/GO/order"
+	"github.com/rajasur/programming-learning/GO/order/store"
+)
+
+type testServer struct {
+	*httptest.Server
+	t       *testing.T
+	created []string
+	changes []order.StatusChange
+}
+
+func newTestServer(t *testing.T) *testServer {
+	now := time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)
+	n := 0
+	ts := &testServer{t: t}
+	srv := NewServer(store.NewMemoryStore(),
+		WithClock(func() time.Time { now = now.Add(time.Second); return now }),
+		WithIDGenerator(func() string { n++; return fmt.Sprintf("ord_%d", n) }),
+		OnCreate(func(o *order.Order) { ts.created = append(ts.created, o.ID) }),
+		OnStatusChange(func(_ *order.Order, c order.StatusChange) { ts.changes = append(ts.changes, c) }),
+	)
+	ts.Server = httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// do sends a request and decodes the JSON response into out, if not nil.
+func (ts *testServer) do(method, path, body string, header map[string]string, out any) *http.Response {
+	ts.t.Helper()
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	if out != nil && len(b) > 0 {
+		if err := json.Unmarshal(b, out); err != nil {
+			ts.t.Fatalf("%s %s: %v in %s", method, path, err, b)
+		}
+	}
+	return resp
+}
+
+func (ts *testServer) create(body string) *order.Order {
+	ts.t.Helper()
+	var o order.Order
+	if resp := ts.do("POST", "/orders", body, nil, &o); resp.StatusCode != http.StatusCreated {
+		ts.t.Fatalf("create %s: %s", body, resp.Status)
+	}
+	return &o
+}
+
+func TestCreate(t *testing.T) {
+	ts := newTestServer(t)
+
+	var o order.Order
+	resp := ts.do("POST", "/orders", `{"amount": "499.50", "customer": {"name": "Raja", "phone": "+91 98765 43210"}}`, nil, &o)
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("Location") != "/orders/ord_1" {
+		t.Fatalf("create: %s, Location %q", resp.Status, resp.Header.Get("Location"))
+	}
+	if o.ID != "ord_1" || o.Amount != 49950 || o.Status != order.Received || resp.Header.Get("ETag") == "" {
+		t.Errorf("created %+v", o)
+	}
+
+	o = *ts.create(`{"id": "o2", "customer": {"name": "Raja"}, "discount": {"percent": 1000},
+		"items": [{"sku": "A", "quantity": 2, "unit_price": 100}, {"sku": "B", "quantity": 1, "unit_price": 50}]}`)
+	if o.ID != "o2" || o.Amount != 22500 || len(o.Items) != 2 {
+		t.Errorf("created with items: %+v", o)
+	}
+	if len(ts.created) != 2 {
+		t.Errorf("OnCreate ran for %v", ts.created)
+	}
+
+	for _, tc := range []struct {
+		body  string
+		code  int
+		field string
+	}{
+		// clients can't pick the initial status
+		{`{"amount": 1, "customer": {"name": "Raja"}, "status": "delivered"}`, 422, "status"},
+		{`{"amount": 1, "customer": {"name": "Raja"}, "discount": {"amount": 5}}`, 400, "discount"},
+		{`{"amount": 1, "customer": {"name": "Raja"}, "items": [{"sku": "A", "quantity": 1, "unit_price": 1}]}`, 400, "amount"},
+		{`{"amount": 0, "customer": {"name": "Raja"}}`, 422, "amount"},
+		{`{"amount": 1, "customer": {"name": ""}}`, 422, "customer.name"},
+		{`{"amount": 1, "customer": {"name": "Raja"}, "colour": "red"}`, 422, "colour"},
+		{`{"amount": 1,`, 422, "body"},
+		{`{"id": "o2", "amount": 1, "customer": {"name": "Raja"}}`, 409, ""},
+	} {
+		var body errorBody
+		resp := ts.do("POST", "/orders", tc.body, nil, &body)
+		if resp.StatusCode != tc.code {
+			t.Errorf("%s: %s, want %d", tc.body, resp.Status, tc.code)
+			continue
+		}
+		if tc.field != "" && (len(body.Error.Fields) == 0 || body.Error.Fields[0].Field != tc.field) {
+			t.Errorf("%s: fields %+v, want %s", tc.body, body.Error.Fields, tc.field)
+		}
+	}
+	if len(ts.created) != 2 {
+		t.Errorf("OnCreate ran for rejected orders: %v", ts.created)
+	}
+}
+
+func TestGetAndETag(t *testing.T) {
+	ts := newTestServer(t)
+	ts.create(`{"id": "o1", "amount": 10, "customer": {"name": "Raja"}}`)
+
+	resp := ts.do("GET", "/orders/o1", "", nil, nil)
+	tag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || tag == "" {
+		t.Fatalf("get: %s, ETag %q", resp.Status, tag)
+	}
+	if resp := ts.do("GET", "/orders/o1", "", map[string]string{"If-None-Match": tag}, nil); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("If-None-Match: %s", resp.Status)
+	}
+	if resp := ts.do("GET", "/orders/nope", "", nil, nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("missing order: %s", resp.Status)
+	}
+}
+
+func TestStatusChanges(t *testing.T) {
+	ts := newTestServer(t)
+	ts.create(`{"id": "o1", "amount": 10, "customer": {"name": "Raja"}}`)
+	stale := ts.do("GET", "/orders/o1", "", nil, nil).Header.Get("ETag")
+
+	var o order.Order
+	resp := ts.do("POST", "/orders/o1/status", `{"status": "confirmed", "actor": "shop"}`, map[string]string{"If-Match": stale}, &o)
+	if resp.StatusCode != http.StatusOK || o.Status != order.Confirmed {
+		t.Fatalf("confirm: %s, %v", resp.Status, o.Status)
+	}
+	if len(ts.changes) != 1 || ts.changes[0].From != order.Received || ts.changes[0].Actor != "shop" {
+		t.Errorf("OnStatusChange got %+v", ts.changes)
+	}
+
+	// the ETag changed with the status
+	resp = ts.do("POST", "/orders/o1/status", `{"status": "prepared"}`, map[string]string{"If-Match": stale}, nil)
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("stale If-Match: %s", resp.Status)
+	}
+
+	var body errorBody
+	resp = ts.do("POST", "/orders/o1/status", `{"status": "refunded"}`, nil, &body)
+	if resp.StatusCode != http.StatusConflict || body.Error.Code != "illegal_transition" {
+		t.Errorf("illegal transition: %s %+v", resp.Status, body)
+	}
+	for _, bad := range []string{`{}`, `{"status": "shipped"}`} {
+		if resp := ts.do("POST", "/orders/o1/status", bad, nil, nil); resp.StatusCode != http.StatusUnprocessableEntity {
+			t.Errorf("%s: %s", bad, resp.Status)
+		}
+	}
+
+	resp = ts.do("POST", "/orders/o1/cancel", "", nil, &o)
+	if resp.StatusCode != http.StatusOK || o.Status != order.Cancelled || o.History[1].Actor != "api" {
+		t.Errorf("cancel: %s, %+v", resp.Status, o.Lifecycle)
+	}
+	if resp := ts.do("POST", "/orders/o1/cancel", "", nil, nil); resp.StatusCode != http.StatusConflict {
+		t.Errorf("second cancel: %s", resp.Status)
+	}
+	if len(ts.changes) != 2 {
+		t.Errorf("%d status changes reported, want 2", len(ts.changes))
+	}
+}
+
+func TestList(t *testing.T) {
+	ts := newTestServer(t)
+	for i := range 5 {
+		ts.create(fmt.Sprintf(`{"id": "o%d", "amount": %d, "customer": {"name": "Raja"}}`, i, 100-i))
+	}
+	ts.do("POST", "/orders/o3/status", `{"status": "confirmed"}`, nil, nil)
+
+	var page listResponse
+	var got []string
+	path := "/orders?limit=2&sort=-amount"
+	for path != "" {
+		if resp := ts.do("GET", path, "", nil, &page); resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s: %s", path, resp.Status)
+		}
+		for _, o := range page.Orders {
+			got = append(got, o.ID)
+		}
+		path = ""
+		if page.NextCursor != "" {
+			path = "/orders?limit=2&sort=-amount&cursor=" + page.NextCursor
+		}
+		page = listResponse{}
+	}
+	if strings.Join(got, ",") != "o0,o1,o2,o3,o4" {
+		t.Errorf("pages = %v", got)
+	}
+
+	ts.do("GET", "/orders?status=confirmed", "", nil, &page)
+	if len(page.Orders) != 1 || page.Orders[0].ID != "o3" {
+		t.Errorf("status filter: %+v", page.Orders)
+	}
+	if resp := ts.do("GET", "/orders?limit=0", "", nil, nil); resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("limit=0: %s", resp.Status)
+	}
+}
+
+// failingStore refuses every update.
+type failingStore struct {
+	store.OrderStore
+}
+
+func (failingStore) Update(*order.Order) error { return errors.New("disk full") }
+
+// A status change that can't be saved runs no hooks, neither the machine's
+// nor the server's.
+func TestHooksRunAfterSave(t *testing.T) {
+	m := order.NewStatusMachine(order.DefaultTransitions)
+	var machineSaw []order.StatusChange
+	m.OnTransition(order.AnyStatus, order.AnyStatus, func(c order.StatusChange) { machineSaw = append(machineSaw, c) })
+	var serverSaw int
+	st := store.NewMemoryStore()
+	o, _ := order.New("o1", 100, order.Received, customer.Customer{Name: "Raja"})
+	st.Create(o)
+
+	srv := NewServer(failingStore{st}, WithStatusMachine(m), OnStatusChange(func(*order.Order, order.StatusChange) { serverSaw++ }))
+	if _, err := srv.Update("o1", "shop", (*order.Order).Confirm); err == nil {
+		t.Fatal("Update with a failing store succeeded")
+	}
+	if len(machineSaw) != 0 || serverSaw != 0 {
+		t.Fatalf("hooks ran for an unsaved change: machine %v, server %d", machineSaw, serverSaw)
+	}
+
+	srv = NewServer(st, WithStatusMachine(m), OnStatusChange(func(*order.Order, order.StatusChange) { serverSaw++ }))
+	if _, err := srv.Update("o1", "shop", (*order.Order).Confirm); err != nil {
+		t.Fatal(err)
+	}
+	if len(machineSaw) != 1 || machineSaw[0].To != order.Confirmed || serverSaw != 1 {
+		t.Errorf("after a saved confirm: machine %v, server %d", machineSaw, serverSaw)
+	}
+}
+
+// GST follows the buyer's state: out of state orders pay IGST, which
+// rounds differently from the two halves charged within the state.
+func TestTaxByBuyerState(t *testing.T) {
+	gst := order.GST{Rate: 1800, SellerState: "WB"}
+	srv := httptest.NewServer(NewServer(store.NewMemoryStore(),
+		WithTaxRuleFor(func(o *order.Order) order.TaxRule { return gst.ForBuyer(o.Customer) })))
+	defer srv.Close()
+	ts := &testServer{Server: srv, t: t}
+
+	// 0.05 at 18%: IGST 0.009 rounds to 0.01, each half (0.0045) to 0
+	for _, tc := range []struct {
+		state string
+		want  money.Money
+	}{
+		{"KA", 6},
+		{"WB", 5},
+		{"", 5},
+	} {
+		o := ts.create(fmt.Sprintf(`{"customer": {"name": "Raja", "state": %q}, "items": [{"sku": "A", "quantity": 1, "unit_price": "0.05"}]}`, tc.state))
+		if o.Amount != tc.want || o.Customer.State != tc.state {
+			t.Errorf("buyer in %q: amount %d, customer %+v, want %d", tc.state, o.Amount, o.Customer, tc.want)
+		}
+	}
+}
+
+// BeforeCreate can refuse an order, and whatever earlier calls did is
+// undone when the order isn't saved.
+func TestBeforeCreate(t *testing.T) {
+	var log []string
+	record := func(what string) func(*order.Order) {
+		return func(o *order.Order) { log = append(log, what+" "+o.ID) }
+	}
+	var created int
+	srv := httptest.NewServer(NewServer(store.NewMemoryStore(),
+		BeforeCreate(func(o *order.Order) error { record("reserve")(o); return nil }, record("release")),
+		BeforeCreate(func(o *order.Order) error {
+			if o.Customer.Name == "Nope" {
+				return errors.New("out of stock")
+			}
+			return nil
+		}, record("undo second")),
+		BeforeCreate(func(*order.Order) error { return nil }, nil),
+		OnCreate(func(*order.Order) { created++ }),
+	))
+	defer srv.Close()
+	ts := &testServer{Server: srv, t: t}
+
+	ts.create(`{"id": "o1", "amount": 1, "customer": {"name": "Raja"}}`)
+	if want := []string{"reserve o1"}; !slices.Equal(log, want) || created != 1 {
+		t.Errorf("after a create: %v, %d created", log, created)
+	}
+
+	log = nil
+	var body errorBody
+	resp := ts.do("POST", "/orders", `{"id": "o2", "amount": 1, "customer": {"name": "Nope"}}`, nil, &body)
+	if resp.StatusCode != http.StatusConflict || body.Error.Code != "refused" || body.Error.Message != "out of stock" {
+		t.Errorf("refused create: %s %+v", resp.Status, body)
+	}
+	if want := []string{"reserve o2", "release o2"}; !slices.Equal(log, want) {
+		t.Errorf("refused create: %v, want %v", log, want)
+	}
+	if resp := ts.do("GET", "/orders/o2", "", nil, nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("refused order was saved: %s", resp.Status)
+	}
+
+	// the save fails: every call is undone, latest first
+	log = nil
+	resp = ts.do("POST", "/orders", `{"id": "o1", "amount": 1, "customer": {"name": "Raja"}}`, nil, nil)
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("duplicate create: %s", resp.Status)
+	}
+	if want := []string{"reserve o1", "undo second o1", "release o1"}; !slices.Equal(log, want) {
+		t.Errorf("failed save: %v, want %v", log, want)
+	}
+	if created != 1 {
+		t.Errorf("OnCreate ran %d times", created)
+	}
+}
@@ -0,0 +1,98 @@
+package deadline
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/order"
+	"github.com/rajasur/programming-learning/GO/order/store"
+)
+
+// Kinds of deadline the order service schedules.
+const (
+	KindAutoCancel    = "auto_cancel"    // still Received: cancel
+	KindPaymentExpiry = "payment_expiry" // never paid: fail
+)
+
+// Updater changes an order under the same lock as every other writer and
+// runs the status change hooks. *api.Server implements it.
+type Updater interface {
+	Update(id, actor string, change func(*order.Order, string) error) (*order.Order, error)
+}
+
+// errSkip tells Updater.Update to leave an order that has moved on alone.
+var errSkip = errors.New("deadline: order has moved on")
+
+// Expire returns a handler that moves the order to status to if it is
+// still in one of from, on behalf of actor "deadline:<kind>". An order
+// that has moved on or no longer exists counts as done, which keeps the
+// handler idempotent.
+func Expire(u Updater, to order.Status, from ...order.Status) Handler {
+	return func(ctx context.Context, d Deadline) error {
+		_, err := u.Update(d.OrderID, "deadline:"+d.Kind, func(o *order.Order, actor string) error {
+			if !slices.Contains(from, o.Status) {
+				return errSkip
+			}
+			return o.ChangeStatus(to, actor)
+		})
+		var terr *order.TransitionError
+		if errors.Is(err, errSkip) || errors.Is(err, store.ErrNotFound) || errors.As(err, &terr) {
+			return nil
+		}
+		return err
+	}
+}
+
+// Policy says which deadlines a new order gets. A zero duration leaves
+// that kind out.
+type Policy struct {
+	// CancelAfter cancels orders still Received after this long.
+	CancelAfter time.Duration
+	// PayWithin fails orders that have not been paid for, and so not
+	// moved past Confirmed, after this long.
+	PayWithin time.Duration
+}
+
+// pending lists the statuses in which each kind of deadline still applies.
+var pending = map[string][]order.Status{
+	KindAutoCancel:    {order.Received},
+	KindPaymentExpiry: {order.Received, order.Confirmed},
+}
+
+// HandleOrders registers the handlers for KindAutoCancel and
+// KindPaymentExpiry, changing orders through u.
+func (s *Scheduler) HandleOrders(u Updater) {
+	s.Handle(KindAutoCancel, Expire(u, order.Cancelled, pending[KindAutoCancel]...))
+	s.Handle(KindPaymentExpiry, Expire(u, order.Failed, pending[KindPaymentExpiry]...))
+}
+
+// Watch returns hooks for api.OnCreate and api.OnStatusChange. The first
+// schedules p's deadlines for a new order, the second cancels each one
+// once the order has left the statuses it guards. Errors go to the
+// scheduler's logger, since hooks can't fail.
+func (s *Scheduler) Watch(p Policy) (onCreate func(*order.Order), onChange func(*order.Order, order.StatusChange)) {
+	after := map[string]time.Duration{KindAutoCancel: p.CancelAfter, KindPaymentExpiry: p.PayWithin}
+	onCreate = func(o *order.Order) {
+		for kind, d := range after {
+			if d <= 0 || !slices.Contains(pending[kind], o.Status) {
+				continue
+			}
+			if err := s.After(o.ID, kind, d); err != nil {
+				s.logf("deadline: schedule %s for %s: %v", kind, o.ID, err)
+			}
+		}
+	}
+	onChange = func(o *order.Order, c order.StatusChange) {
+		for kind, statuses := range pending {
+			if slices.Contains(statuses, c.To) || !slices.Contains(statuses, c.From) {
+				continue
+			}
+			if _, err := s.Cancel(o.ID, kind); err != nil {
+				s.logf("deadline: cancel %s for %s: %v", kind, o.ID, err)
+			}
+		}
+	}
+	return onCreate, onChange
+}
@@ -0,0 +1,193 @@
+package deadline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/customer"
+	"github.com/rajasur/programming-learning/GO/order"
+	"github.com/rajasur/programming-learning/GO/order/api"
+	"github.com/rajasur/programming-learning/GO/order/store"
+)
+
+type changes struct {
+	mu   sync.Mutex
+	seen []order.StatusChange
+}
+
+func (c *changes) hook(_ *order.Order, sc order.StatusChange) {
+	c.mu.Lock()
+	c.seen = append(c.seen, sc)
+	c.mu.Unlock()
+}
+
+func newServer(t *testing.T, ids ...string) (*api.Server, store.OrderStore, *changes) {
+	t.Helper()
+	st := store.NewMemoryStore()
+	for _, id := range ids {
+		o, err := order.New(id, 100, order.Received, customer.Customer{Name: "Raja"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		st.Create(o)
+	}
+	var c changes
+	return api.NewServer(st, api.OnStatusChange(c.hook)), st, &c
+}
+
+func TestExpire(t *testing.T) {
+	srv, st, c := newServer(t, "o1", "o2")
+	cancel := Expire(srv, order.Cancelled, order.Received)
+	ctx := context.Background()
+
+	if err := cancel(ctx, Deadline{OrderID: "o1", Kind: KindAutoCancel}); err != nil {
+		t.Fatal(err)
+	}
+	o, _ := st.Get("o1")
+	if o.Status != order.Cancelled || o.History[0].Actor != "deadline:auto_cancel" {
+		t.Errorf("o1 is %v after expiry: %+v", o.Status, o.History)
+	}
+	if len(c.seen) != 1 || c.seen[0].OrderID != "o1" {
+		t.Errorf("hooks saw %+v", c.seen)
+	}
+
+	// an order that moved on, or is gone, is left alone
+	srv.Update("o2", "shop", (*order.Order).Confirm)
+	before, _ := st.Get("o2")
+	for _, id := range []string{"o1", "o2", "missing"} {
+		if err := cancel(ctx, Deadline{OrderID: id, Kind: KindAutoCancel}); err != nil {
+			t.Errorf("%s: %v", id, err)
+		}
+	}
+	if after, _ := st.Get("o2"); after.UpdatedAt != before.UpdatedAt || after.Status != order.Confirmed {
+		t.Errorf("confirmed order changed: %+v", after)
+	}
+	if len(c.seen) != 2 {
+		t.Errorf("hooks ran %d times, want 2", len(c.seen))
+	}
+
+	// failing a cancelled order is an illegal move, also left alone
+	if err := Expire(srv, order.Failed, order.Cancelled)(ctx, Deadline{OrderID: "o1"}); err != nil {
+		t.Errorf("illegal move: %v", err)
+	}
+}
+
+type failingUpdater struct{ err error }
+
+func (u failingUpdater) Update(string, string, func(*order.Order, string) error) (*order.Order, error) {
+	return nil, u.err
+}
+
+func TestExpireRetriesStoreErrors(t *testing.T) {
+	boom := errors.New("disk full")
+	err := Expire(failingUpdater{boom}, order.Cancelled, order.Received)(context.Background(), Deadline{OrderID: "o1"})
+	if err != boom {
+		t.Errorf("Expire = %v, want the store error so the deadline is retried", err)
+	}
+}
+
+// TestExpireRacesAPI confirms orders through the server while their
+// auto-cancel deadlines fire. Each order must see exactly one change,
+// reported once to the hooks; a lost update would show up as a confirmed
+// order with a cancel in its history, or a change the hooks missed.
+func TestExpireRacesAPI(t *testing.T) {
+	const n = 100
+	var ids []string
+	for i := range n {
+		ids = append(ids, fmt.Sprint("o", i))
+	}
+	srv, st, c := newServer(t, ids...)
+	cancel := Expire(srv, order.Cancelled, order.Received)
+
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			srv.Update(id, "shop", (*order.Order).Confirm)
+		}()
+		go func() {
+			defer wg.Done()
+			if err := cancel(context.Background(), Deadline{OrderID: id, Kind: KindAutoCancel}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, id := range ids {
+		o, _ := st.Get(id)
+		if len(o.History) != 1 {
+			t.Errorf("%s: history %+v", id, o.History)
+		}
+	}
+	if len(c.seen) != n {
+		t.Errorf("hooks saw %d changes, want %d", len(c.seen), n)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	var logged []string
+	s, _ := New(nil, WithLogger(func(format string, args ...any) { logged = append(logged, fmt.Sprintf(format, args...)) }))
+	onCreate, onChange := s.Watch(Policy{CancelAfter: time.Hour, PayWithin: 24 * time.Hour})
+
+	o, _ := order.New("o1", 100, order.Received, customer.Customer{Name: "Raja"})
+	onCreate(o)
+	if _, ok := s.Get("o1", KindAutoCancel); !ok {
+		t.Error("no auto-cancel deadline")
+	}
+	if d, ok := s.Get("o1", KindPaymentExpiry); !ok || d.At.Sub(time.Now()) < 23*time.Hour {
+		t.Errorf("payment deadline = %+v, %v", d, ok)
+	}
+
+	onChange(o, order.StatusChange{OrderID: "o1", From: order.Received, To: order.Confirmed})
+	if _, ok := s.Get("o1", KindAutoCancel); ok {
+		t.Error("auto-cancel deadline kept after confirmation")
+	}
+	if _, ok := s.Get("o1", KindPaymentExpiry); !ok {
+		t.Error("payment deadline dropped before payment")
+	}
+	onChange(o, order.StatusChange{OrderID: "o1", From: order.Confirmed, To: order.Prepared})
+	if s.Len() != 0 {
+		t.Errorf("%d deadlines left after the order was prepared", s.Len())
+	}
+	if len(logged) != 0 {
+		t.Errorf("logged %q", logged)
+	}
+
+	// only the kinds the policy asks for are scheduled
+	onCreate, _ = s.Watch(Policy{PayWithin: time.Minute})
+	onCreate(&order.Order{ID: "o2"})
+	if _, ok := s.Get("o2", KindAutoCancel); ok || s.Len() != 1 {
+		t.Errorf("Policy without CancelAfter scheduled %d deadlines", s.Len())
+	}
+}
+
+func TestHandleOrdersEndToEnd(t *testing.T) {
+	srv, st, c := newServer(t, "o1", "o2")
+	s, _ := New(nil)
+	s.HandleOrders(srv)
+	srv.Update("o2", "shop", (*order.Order).Confirm)
+
+	s.After("o1", KindAutoCancel, 0)
+	s.After("o2", KindPaymentExpiry, 0)
+	stop := run(t, s)
+	defer stop()
+	waitFor(t, "both deadlines", func() bool { return s.Len() == 0 })
+	waitFor(t, "both expiries", func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return len(c.seen) == 3
+	})
+
+	if o, _ := st.Get("o1"); o.Status != order.Cancelled {
+		t.Errorf("o1 is %v", o.Status)
+	}
+	if o, _ := st.Get("o2"); o.Status != order.Failed {
+		t.Errorf("o2 is %v", o.Status)
+	}
+}
@@ -0,0 +1,48 @@
+package deadline
+
+import "time"
+
+type entry struct {
+	d     Deadline
+	index int // position in the heap, maintained by the heap methods
+}
+
+// timers is a min-heap of entries ordered by due time, for container/heap.
+type timers []*entry
+
+func (h timers) Len() int { return len(h) }
+
+func (h timers) Less(i, j int) bool {
+	if !h[i].d.At.Equal(h[j].d.At) {
+		return h[i].d.At.Before(h[j].d.At)
+	}
+	return h[i].d.ID() < h[j].d.ID()
+}
+
+func (h timers) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *timers) Push(x any) {
+	e := x.(*entry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *timers) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	e.index = -1
+	*h = old[:len(old)-1]
+	return e
+}
+
+func (h timers) peek() (time.Time, bool) {
+	if len(h) == 0 {
+		return time.Time{}, false
+	}
+	return h[0].d.At, true
+}
@@ -0,0 +1,164 @@
+package deadline
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+
+	"github.com/rajasur/programming-learning/GO/internal/recordlog"
+)
+
+var ErrCorrupt = errors.New("deadline: journal is corrupt")
+
+// Journal makes pending deadlines durable. Save replaces the deadline
+// with the same ID.
+type Journal interface {
+	Save(d Deadline) error
+	Delete(id string) error
+	Load() ([]Deadline, error)
+}
+
+type nopJournal struct{}
+
+func (nopJournal) Save(Deadline) error       { return nil }
+func (nopJournal) Delete(string) error       { return nil }
+func (nopJournal) Load() ([]Deadline, error) { return nil, nil }
+
+// FileJournal appends set and delete records to a file in the same
+// checksummed format as the order store:
+//
+//	<crc32 as 8 hex digits> <json>\n
+//
+// Load compacts the file to one record per pending deadline, and so does
+// any write once dead records outnumber live ones.
+type FileJournal struct {
+	mu      sync.Mutex
+	log     *recordlog.File
+	live    map[string]Deadline
+	records int
+	logf    func(format string, args ...any)
+}
+
+type JournalOption func(*FileJournal)
+
+// WithJournalLogger sets where failed compactions are reported. They
+// don't fail the write that triggered them. The default is log.Printf.
+func WithJournalLogger(logf func(format string, args ...any)) JournalOption {
+	return func(j *FileJournal) { j.logf = logf }
+}
+
+type journalRecord struct {
+	Op       string    `json:"op"` // "set" or "del"
+	ID       string    `json:"id,omitempty"`
+	Deadline *Deadline `json:"deadline,omitempty"`
+}
+
+// OpenJournal opens or creates the journal at path. noSync skips fsync
+// after each write.
+func OpenJournal(path string, noSync bool, opts ...JournalOption) (*FileJournal, error) {
+	j := &FileJournal{live: make(map[string]Deadline), logf: log.Printf}
+	for _, opt := range opts {
+		opt(j)
+	}
+	log, err := recordlog.Open(path, noSync, func(rec journalRecord, _ int64, _ int) error {
+		if !(rec.Op == "set" && rec.Deadline != nil || rec.Op == "del" && rec.ID != "") {
+			return recordlog.ErrCorrupt
+		}
+		j.apply(rec)
+		j.records++
+		return nil
+	})
+	if errors.Is(err, recordlog.ErrCorrupt) {
+		return nil, fmt.Errorf("%w: %w", ErrCorrupt, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	j.log = log
+	return j, nil
+}
+
+func (j *FileJournal) apply(rec journalRecord) {
+	switch rec.Op {
+	case "set":
+		j.live[rec.Deadline.ID()] = *rec.Deadline
+	case "del":
+		delete(j.live, rec.ID)
+	}
+}
+
+func (j *FileJournal) write(rec journalRecord) error {
+	if _, _, err := j.log.Append(rec); err != nil {
+		return err
+	}
+	j.apply(rec)
+	j.records++
+	if j.records >= 1000 && j.records > 2*len(j.live) {
+		j.tryCompact()
+	}
+	return nil
+}
+
+// tryCompact compacts after a write. The record is already durable, so a
+// failure is only logged; the next write tries again.
+func (j *FileJournal) tryCompact() {
+	if err := j.compact(); err != nil {
+		j.logf("deadline: compacting %s: %v", j.log.Name(), err)
+	}
+}
+
+func (j *FileJournal) Save(d Deadline) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.write(journalRecord{Op: "set", Deadline: &d})
+}
+
+func (j *FileJournal) Delete(id string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, ok := j.live[id]; !ok {
+		return nil
+	}
+	return j.write(journalRecord{Op: "del", ID: id})
+}
+
+// Load returns the pending deadlines, earliest first, and compacts the
+// file.
+func (j *FileJournal) Load() ([]Deadline, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.compact(); err != nil {
+		return nil, err
+	}
+	out := make([]Deadline, 0, len(j.live))
+	for _, d := range j.live {
+		out = append(out, d)
+	}
+	slices.SortFunc(out, func(a, b Deadline) int { return a.At.Compare(b.At) })
+	return out, nil
+}
+
+// compact rewrites the journal with only the live deadlines.
+func (j *FileJournal) compact() error {
+	err := j.log.Rewrite(func(add func(any) error) error {
+		for _, d := range j.live {
+			if err := add(journalRecord{Op: "set", Deadline: &d}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	j.records = len(j.live)
+	return nil
+}
+
+func (j *FileJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.log.Close()
+}
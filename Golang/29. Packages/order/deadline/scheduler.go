@@ -0,0 +1,327 @@
+// Package deadline fires per-order deadlines such as "cancel if still
+// received after 30 minutes" or "expire if unpaid after a day".
+//
+// All deadlines live in one min-heap watched by a single timer, so a
+// million open orders cost a million small heap entries rather than a
+// million goroutines or runtime timers. Pending deadlines are written to a
+// Journal and reloaded on start, so they survive restarts.
+package deadline
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotFound  = errors.New("deadline: not found")
+	ErrNoHandler = errors.New("deadline: no handler for kind")
+)
+
+// Deadline asks for Kind's handler to run for OrderID at At.
+type Deadline struct {
+	OrderID  string    `json:"order_id"`
+	Kind     string    `json:"kind"`
+	At       time.Time `json:"at"`
+	Attempts int       `json:"attempts,omitempty"` // failed runs so far
+}
+
+// ID identifies a deadline: an order has at most one of each kind.
+func (d Deadline) ID() string { return d.OrderID + "/" + d.Kind }
+
+// Handler acts on a due deadline. Returning an error retries it later.
+type Handler func(ctx context.Context, d Deadline) error
+
+// Scheduler is safe for concurrent use.
+type Scheduler struct {
+	mu       sync.Mutex
+	heap     timers
+	byID     map[string]*entry
+	handlers map[string]Handler
+	journal  Journal
+	wake     chan struct{} // nudges Run when the earliest deadline changes
+
+	now        func() time.Time
+	workers    int
+	retryDelay time.Duration
+	maxRetries int
+	logf       func(format string, args ...any)
+}
+
+type Option func(*Scheduler)
+
+// WithClock sets the clock deadlines are compared with.
+func WithClock(now func() time.Time) Option {
+	return func(s *Scheduler) { s.now = now }
+}
+
+// WithWorkers sets how many handlers may run at once. The default is 4.
+func WithWorkers(n int) Option {
+	return func(s *Scheduler) { s.workers = n }
+}
+
+// WithRetry sets the delay after a failed handler, doubled on each
+// attempt, and how many attempts are made before the deadline is dropped.
+// The default is 10 seconds and 5 attempts.
+func WithRetry(delay time.Duration, attempts int) Option {
+	return func(s *Scheduler) { s.retryDelay, s.maxRetries = delay, attempts }
+}
+
+// WithLogger sets where dropped deadlines and journal errors are reported.
+func WithLogger(logf func(format string, args ...any)) Option {
+	return func(s *Scheduler) { s.logf = logf }
+}
+
+// New creates a scheduler and loads the deadlines pending in j. A nil
+// journal keeps deadlines in memory only.
+func New(j Journal, opts ...Option) (*Scheduler, error) {
+	if j == nil {
+		j = nopJournal{}
+	}
+	s := &Scheduler{
+		byID:       make(map[string]*entry),
+		handlers:   make(map[string]Handler),
+		journal:    j,
+		wake:       make(chan struct{}, 1),
+		now:        time.Now,
+		workers:    4,
+		retryDelay: 10 * time.Second,
+		maxRetries: 5,
+		logf:       log.Printf,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	pending, err := j.Load()
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range pending {
+		s.push(d)
+	}
+	return s, nil
+}
+
+// Handle registers the handler for a kind of deadline.
+func (s *Scheduler) Handle(kind string, h Handler) {
+	s.mu.Lock()
+	s.handlers[kind] = h
+	s.mu.Unlock()
+}
+
+// push adds or moves d in the heap. s.mu must be held.
+func (s *Scheduler) push(d Deadline) {
+	if e, ok := s.byID[d.ID()]; ok {
+		e.d = d
+		heap.Fix(&s.heap, e.index)
+		return
+	}
+	e := &entry{d: d}
+	heap.Push(&s.heap, e)
+	s.byID[d.ID()] = e
+}
+
+func (s *Scheduler) nudge() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Schedule sets the kind deadline of orderID to at, replacing any
+// existing one.
+func (s *Scheduler) Schedule(orderID, kind string, at time.Time) error {
+	d := Deadline{OrderID: orderID, Kind: kind, At: at}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.journal.Save(d); err != nil {
+		return err
+	}
+	s.push(d)
+	s.nudge()
+	return nil
+}
+
+// After is Schedule relative to now.
+func (s *Scheduler) After(orderID, kind string, d time.Duration) error {
+	return s.Schedule(orderID, kind, s.now().Add(d))
+}
+
+// Reschedule moves an existing deadline. Unlike Schedule it fails with
+// ErrNotFound if the deadline has already fired or been cancelled.
+func (s *Scheduler) Reschedule(orderID, kind string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.byID[Deadline{OrderID: orderID, Kind: kind}.ID()]
+	if !ok {
+		return fmt.Errorf("%w: %s %s", ErrNotFound, orderID, kind)
+	}
+	d := e.d
+	d.At = at
+	if err := s.journal.Save(d); err != nil {
+		return err
+	}
+	s.push(d)
+	s.nudge()
+	return nil
+}
+
+// Cancel removes a deadline. It reports false if there was none, which
+// includes one whose handler has already started.
+func (s *Scheduler) Cancel(orderID, kind string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := Deadline{OrderID: orderID, Kind: kind}.ID()
+	e, ok := s.byID[id]
+	if !ok {
+		return false, nil
+	}
+	if err := s.journal.Delete(id); err != nil {
+		return false, err
+	}
+	heap.Remove(&s.heap, e.index)
+	delete(s.byID, id)
+	return true, nil
+}
+
+// CancelOrder removes every deadline of orderID.
+func (s *Scheduler) CancelOrder(orderID string) error {
+	s.mu.Lock()
+	var kinds []string
+	for _, e := range s.byID {
+		if e.d.OrderID == orderID {
+			kinds = append(kinds, e.d.Kind)
+		}
+	}
+	s.mu.Unlock()
+	for _, k := range kinds {
+		if _, err := s.Cancel(orderID, k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns the pending deadline of kind for orderID.
+func (s *Scheduler) Get(orderID, kind string) (Deadline, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.byID[Deadline{OrderID: orderID, Kind: kind}.ID()]
+	if !ok {
+		return Deadline{}, false
+	}
+	return e.d, true
+}
+
+// Len returns the number of pending deadlines.
+func (s *Scheduler) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.heap)
+}
+
+// popDue removes and returns the earliest deadline if it is due, or how
+// long to wait for it.
+func (s *Scheduler) popDue() (Deadline, time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	at, ok := s.heap.peek()
+	if !ok {
+		return Deadline{}, -1, false
+	}
+	if wait := at.Sub(s.now()); wait > 0 {
+		return Deadline{}, wait, false
+	}
+	e := heap.Pop(&s.heap).(*entry)
+	delete(s.byID, e.d.ID())
+	return e.d, 0, true
+}
+
+// Run fires deadlines as they fall due until ctx is done, then waits for
+// running handlers.
+//
+// A deadline leaves the heap before its handler starts, so within a
+// process it fires exactly once even if it is rescheduled or cancelled at
+// the same moment. It leaves the journal only when the handler returns, so
+// after a crash mid-handler it fires again: handlers must be idempotent.
+func (s *Scheduler) Run(ctx context.Context) error {
+	sem := make(chan struct{}, max(s.workers, 1))
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		d, wait, ok := s.popDue()
+		if ok {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				// put it back for the next run
+				s.mu.Lock()
+				s.push(d)
+				s.mu.Unlock()
+				return ctx.Err()
+			}
+			wg.Add(1)
+			go func() {
+				defer func() { <-sem; wg.Done() }()
+				s.fire(ctx, d)
+			}()
+			continue
+		}
+
+		if wait < 0 {
+			wait = time.Hour
+		}
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-s.wake:
+			timer.Stop()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *Scheduler) fire(ctx context.Context, d Deadline) {
+	s.mu.Lock()
+	h := s.handlers[d.Kind]
+	s.mu.Unlock()
+
+	err := ErrNoHandler
+	if h != nil {
+		err = h(ctx, d)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, again := s.byID[d.ID()]; again {
+		// rescheduled while running; the new deadline owns the journal entry
+		return
+	}
+	if err == nil || d.Attempts+1 >= s.maxRetries {
+		if err != nil {
+			s.logf("deadline: dropping %s after %d attempts: %v", d.ID(), d.Attempts+1, err)
+		}
+		if jerr := s.journal.Delete(d.ID()); jerr != nil {
+			s.logf("deadline: %v", jerr)
+		}
+		return
+	}
+
+	d.Attempts++
+	d.At = s.now().Add(s.retryDelay << (d.Attempts - 1))
+	if jerr := s.journal.Save(d); jerr != nil {
+		s.logf("deadline: %v", jerr)
+	}
+	s.push(d)
+	s.nudge()
+}
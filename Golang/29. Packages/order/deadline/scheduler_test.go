@@ -0,0 +1,315 @@
+package deadline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// run starts s and returns a function that stops it and waits.
+func run(t *testing.T, s *Scheduler) func() {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+type recorder struct {
+	mu    sync.Mutex
+	fired []Deadline
+}
+
+func (r *recorder) handle(_ context.Context, d Deadline) error {
+	r.mu.Lock()
+	r.fired = append(r.fired, d)
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *recorder) orders() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ids []string
+	for _, d := range r.fired {
+		ids = append(ids, d.OrderID)
+	}
+	return ids
+}
+
+func TestFiresInOrder(t *testing.T) {
+	s, _ := New(nil, WithWorkers(1))
+	var r recorder
+	s.Handle("k", r.handle)
+	now := time.Now()
+	s.Schedule("c", "k", now.Add(30*time.Millisecond))
+	s.Schedule("a", "k", now.Add(10*time.Millisecond))
+	s.Schedule("b", "k", now.Add(20*time.Millisecond))
+	s.Schedule("z", "k", now.Add(time.Hour))
+	stop := run(t, s)
+	defer stop()
+
+	waitFor(t, "three deadlines", func() bool { return len(r.orders()) == 3 })
+	if got := r.orders(); !slices.Equal(got, []string{"a", "b", "c"}) {
+		t.Errorf("fired %v", got)
+	}
+	if s.Len() != 1 {
+		t.Errorf("Len = %d, want the one an hour away", s.Len())
+	}
+}
+
+func TestScheduleMoves(t *testing.T) {
+	s, _ := New(nil)
+	var r recorder
+	s.Handle("k", r.handle)
+	far := time.Now().Add(time.Hour)
+	s.Schedule("a", "k", far)
+	s.Schedule("b", "k", far)
+	s.Schedule("b", "other", far)
+	stop := run(t, s)
+	defer stop()
+
+	if err := s.Reschedule("missing", "k", far); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Reschedule of a missing deadline: %v", err)
+	}
+	// moving a deadline forward wakes Run up
+	if err := s.Reschedule("a", "k", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "rescheduled deadline", func() bool { return len(r.orders()) == 1 })
+	if _, ok := s.Get("a", "k"); ok {
+		t.Error("fired deadline still pending")
+	}
+	if err := s.Reschedule("a", "k", far); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Reschedule after firing: %v", err)
+	}
+
+	if ok, err := s.Cancel("b", "k"); !ok || err != nil {
+		t.Errorf("Cancel = %v, %v", ok, err)
+	}
+	if ok, _ := s.Cancel("b", "k"); ok {
+		t.Error("second Cancel reported a deadline")
+	}
+	s.Schedule("b", "k", far)
+	if err := s.CancelOrder("b"); err != nil || s.Len() != 0 {
+		t.Errorf("CancelOrder: %v, %d left", err, s.Len())
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var logged []string
+	var mu sync.Mutex
+	s, _ := New(nil, WithRetry(time.Millisecond, 3), WithLogger(func(format string, args ...any) {
+		mu.Lock()
+		logged = append(logged, fmt.Sprintf(format, args...))
+		mu.Unlock()
+	}))
+	var attempts sync.Map
+	s.Handle("k", func(_ context.Context, d Deadline) error {
+		attempts.Store(d.OrderID+fmt.Sprint(d.Attempts), true)
+		if d.OrderID == "flaky" && d.Attempts == 1 {
+			return nil
+		}
+		return errors.New("boom")
+	})
+	s.After("flaky", "k", 0)
+	s.After("broken", "k", 0)
+	s.After("nobody", "unhandled", 0)
+	stop := run(t, s)
+	defer stop()
+
+	// Len is briefly 0 while a retry is between attempts, so wait for
+	// both drops to be logged instead
+	waitFor(t, "retries to finish", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(logged) == 2
+	})
+	waitFor(t, "flaky to succeed", func() bool { return s.Len() == 0 })
+	for _, key := range []string{"flaky0", "flaky1", "broken0", "broken1", "broken2"} {
+		if _, ok := attempts.Load(key); !ok {
+			t.Errorf("attempt %s missing", key)
+		}
+	}
+	if _, ok := attempts.Load("flaky2"); ok {
+		t.Error("flaky retried after it succeeded")
+	}
+}
+
+func TestJournalRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deadlines")
+	j, err := OpenJournal(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, _ := New(j)
+	far := time.Now().Add(time.Hour).Truncate(time.Second)
+	s.Schedule("a", KindAutoCancel, far)
+	s.Schedule("b", KindAutoCancel, far.Add(time.Minute))
+	s.Schedule("b", KindPaymentExpiry, far)
+	s.Reschedule("a", KindAutoCancel, far.Add(2*time.Minute))
+	s.Cancel("b", KindPaymentExpiry)
+	j.Close()
+
+	j, err = OpenJournal(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := j.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Deadline{
+		{OrderID: "b", Kind: KindAutoCancel, At: far.Add(time.Minute)},
+		{OrderID: "a", Kind: KindAutoCancel, At: far.Add(2 * time.Minute)},
+	}
+	if len(got) != 2 || got[0].ID() != want[0].ID() || !got[0].At.Equal(want[0].At) || got[1].ID() != want[1].ID() || !got[1].At.Equal(want[1].At) {
+		t.Errorf("after restart: %+v", got)
+	}
+
+	// a fired deadline leaves the journal
+	s, _ = New(j)
+	var r recorder
+	s.Handle(KindAutoCancel, r.handle)
+	s.Reschedule("a", KindAutoCancel, time.Now())
+	stop := run(t, s)
+	waitFor(t, "deadline a", func() bool { return len(r.orders()) == 1 })
+	stop()
+	j.Close()
+	j, _ = OpenJournal(path, false)
+	defer j.Close()
+	if got, _ := j.Load(); len(got) != 1 || got[0].OrderID != "b" {
+		t.Errorf("after firing: %+v", got)
+	}
+}
+
+func TestJournalTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deadlines")
+	j, _ := OpenJournal(path, false)
+	at := time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)
+	j.Save(Deadline{OrderID: "a", Kind: "k", At: at})
+	j.Close()
+
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	f.WriteString(`0badc0de {"op":"set","dead`)
+	f.Close()
+
+	j, err := OpenJournal(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// this write must land after the good record, not after the torn one
+	if err := j.Save(Deadline{OrderID: "b", Kind: "k", At: at}); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+
+	j, err = OpenJournal(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	got, _ := j.Load()
+	if len(got) != 2 {
+		t.Errorf("after torn tail and a new write: %+v", got)
+	}
+}
+
+func TestJournalCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deadlines")
+	j, _ := OpenJournal(path, true)
+	j.Save(Deadline{OrderID: "a", Kind: "k"})
+	j.Save(Deadline{OrderID: "b", Kind: "k"})
+	j.Close()
+	data, _ := os.ReadFile(path)
+	data[12] ^= 1
+	os.WriteFile(path, data, 0o644)
+	if _, err := OpenJournal(path, true); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("OpenJournal = %v, want ErrCorrupt", err)
+	}
+}
+
+// A write whose compaction fails has still been recorded, so it succeeds
+// and the failure is only logged.
+func TestJournalCompactionFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deadlines")
+	var logged []string
+	j, err := OpenJournal(path, true, WithJournalLogger(func(format string, args ...any) {
+		logged = append(logged, fmt.Sprintf(format, args...))
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	at := time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)
+	j.Save(Deadline{OrderID: "keep", Kind: "k", At: at})
+
+	// a non-empty directory where the compacted file would be renamed to
+	// makes every compaction fail; appends still reach the open file
+	moved := path + ".moved"
+	if err := os.Rename(path, moved); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(path, "x"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 1000 {
+		d := Deadline{OrderID: fmt.Sprint(i), Kind: "k", At: at}
+		if err := j.Save(d); err != nil {
+			t.Fatalf("Save %d = %v", i, err)
+		}
+		if err := j.Delete(d.ID()); err != nil {
+			t.Fatalf("Delete %d = %v", i, err)
+		}
+	}
+	if len(logged) == 0 || !strings.Contains(logged[0], "deadline: compacting "+path) {
+		t.Fatalf("logged %q, want compaction failures", logged)
+	}
+
+	// once the path is usable again the next write compacts
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(moved, path); err != nil {
+		t.Fatal(err)
+	}
+	n := len(logged)
+	if err := j.Save(Deadline{OrderID: "last", Kind: "k", At: at}); err != nil {
+		t.Fatal(err)
+	}
+	if len(logged) != n {
+		t.Errorf("compaction failed again: %q", logged[n:])
+	}
+	data, _ := os.ReadFile(path)
+	if lines := strings.Count(string(data), "\n"); lines != 2 {
+		t.Errorf("journal has %d records after compaction, want 2", lines)
+	}
+	got, err := j.Load()
+	if err != nil || len(got) != 2 {
+		t.Errorf("Load = %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,127 @@
+// Package events records every change to an order as an immutable event in
+// a per-order stream. The current state of an order is rebuilt by replaying
+// its stream, optionally starting from a snapshot, and read models such as
+// "orders per status" are projections that can be rebuilt from the log.
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/customer"
+	"github.com/rajasur/programming-learning/GO/money"
+	"github.com/rajasur/programming-learning/GO/order"
+)
+
+// Payload is the body of an event. The set of payloads is closed; new
+// kinds of change need a new type here and a case in State.Apply.
+type Payload interface {
+	Type() string
+}
+
+// Created starts a stream. Amount is the order's total until items are
+// added; from then on the items priced with Discount decide it.
+type Created struct {
+	Amount   money.Money       `json:"amount"`
+	Customer customer.Customer `json:"customer"`
+	Status   order.Status      `json:"status"`
+	Discount order.Discount    `json:"discount,omitzero"`
+}
+
+type ItemAdded struct {
+	Item order.LineItem `json:"item"`
+}
+
+type StatusChanged struct {
+	From  order.Status `json:"from"`
+	To    order.Status `json:"to"`
+	Actor string       `json:"actor"`
+}
+
+type Paid struct {
+	Amount    money.Money `json:"amount"`
+	Method    string      `json:"method"` // e.g. "card", "upi"
+	Reference string      `json:"reference,omitempty"`
+}
+
+type Refunded struct {
+	Amount money.Money `json:"amount"`
+	Reason string      `json:"reason,omitempty"`
+}
+
+func (Created) Type() string       { return "created" }
+func (ItemAdded) Type() string     { return "item_added" }
+func (StatusChanged) Type() string { return "status_changed" }
+func (Paid) Type() string          { return "paid" }
+func (Refunded) Type() string      { return "refunded" }
+
+// Event is one entry of an order's stream. Seq starts at 1 for each order;
+// Position is the event's place in the log of all orders.
+type Event struct {
+	OrderID  string
+	Seq      int
+	Position int64
+	At       time.Time
+	Payload  Payload
+}
+
+type eventJSON struct {
+	OrderID  string          `json:"order_id"`
+	Seq      int             `json:"seq"`
+	Position int64           `json:"position"`
+	At       time.Time       `json:"at"`
+	Type     string          `json:"type"`
+	Data     json.RawMessage `json:"data"`
+}
+
+func (e Event) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(e.Payload)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(eventJSON{
+		OrderID:  e.OrderID,
+		Seq:      e.Seq,
+		Position: e.Position,
+		At:       e.At,
+		Type:     e.Payload.Type(),
+		Data:     data,
+	})
+}
+
+func (e *Event) UnmarshalJSON(b []byte) error {
+	var raw eventJSON
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	var p Payload
+	var err error
+	switch raw.Type {
+	case "created":
+		p, err = decode[Created](raw.Data)
+	case "item_added":
+		p, err = decode[ItemAdded](raw.Data)
+	case "status_changed":
+		p, err = decode[StatusChanged](raw.Data)
+	case "paid":
+		p, err = decode[Paid](raw.Data)
+	case "refunded":
+		p, err = decode[Refunded](raw.Data)
+	default:
+		return fmt.Errorf("events: unknown event type %q", raw.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("events: decode %s: %w", raw.Type, err)
+	}
+
+	*e = Event{OrderID: raw.OrderID, Seq: raw.Seq, Position: raw.Position, At: raw.At, Payload: p}
+	return nil
+}
+
+func decode[T Payload](data json.RawMessage) (Payload, error) {
+	var p T
+	err := json.Unmarshal(data, &p)
+	return p, err
+}
@@ -0,0 +1,252 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/customer"
+	"github.com/rajasur/programming-learning/GO/order"
+)
+
+var (
+	t0   = time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)
+	gst  = order.GST{Rate: 1800, SellerState: "WB", BuyerState: "WB"}
+	raja = customer.Customer{Name: "Raja"}
+)
+
+// newStore returns a store whose clock moves a minute per append.
+func newStore(opts ...StoreOption) *Store {
+	now := t0
+	clock := func() time.Time { now = now.Add(time.Minute); return now }
+	return NewStore(append([]StoreOption{WithClock(clock), WithTaxRule(gst)}, opts...)...)
+}
+
+func mustAppend(t *testing.T, s *Store, id string, payloads ...Payload) {
+	t.Helper()
+	st, err := s.Load(id)
+	if err != nil && !errors.Is(err, ErrNotCreated) {
+		t.Fatal(err)
+	}
+	if _, err := s.Append(id, st.Version, payloads...); err != nil {
+		t.Fatalf("append to %s: %v", id, err)
+	}
+}
+
+// fill gives the store a few orders with a bit of everything.
+func fill(t *testing.T, s *Store) {
+	t.Helper()
+	for i := range 5 {
+		id := fmt.Sprint("o", i)
+		mustAppend(t, s, id, Created{Customer: raja, Status: order.Received, Discount: order.Discount{Percent: 500}})
+		mustAppend(t, s, id,
+			ItemAdded{order.LineItem{SKU: "pen", Quantity: i + 1, UnitPrice: 333}},
+			ItemAdded{order.LineItem{SKU: "ink", Quantity: 1, UnitPrice: 1250, TaxRate: 1200}},
+		)
+		if i%2 == 0 {
+			mustAppend(t, s, id, StatusChanged{From: order.Received, To: order.Confirmed, Actor: "shop"})
+			mustAppend(t, s, id, Paid{Amount: 5000, Method: "upi"})
+		}
+		if i == 4 {
+			mustAppend(t, s, id, StatusChanged{From: order.Confirmed, To: order.Cancelled, Actor: "raja"})
+			mustAppend(t, s, id, Refunded{Amount: 2000, Reason: "cancelled"})
+		}
+	}
+}
+
+func TestReplayDeterministic(t *testing.T) {
+	s := newStore()
+	fill(t, s)
+	for i := range 5 {
+		id := fmt.Sprint("o", i)
+		events := s.Events(id, 1)
+		first := Replay(events, gst)
+		second := Replay(events, gst)
+		if !reflect.DeepEqual(first, second) {
+			t.Fatalf("%s: two replays differ:\n%+v\n%+v", id, first, second)
+		}
+		loaded, err := s.Load(id)
+		if err != nil || !reflect.DeepEqual(first, loaded) {
+			t.Errorf("%s: Load = %+v, %v, replay = %+v", id, loaded, err, first)
+		}
+
+		// events that went through JSON replay to the same state
+		b, err := json.Marshal(events)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded []Event
+		if err := json.Unmarshal(b, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if got := Replay(decoded, gst); !reflect.DeepEqual(first, got) {
+			t.Errorf("%s: replay after JSON = %+v, want %+v", id, got, first)
+		}
+	}
+
+	st, _ := s.Load("o4")
+	if st.Status != order.Cancelled || len(st.History) != 2 || st.Paid != 5000 || st.Refunded != 2000 || st.Version != 7 {
+		t.Errorf("o4 = %+v", st)
+	}
+}
+
+// The amount rebuilt from events is what order.SetItems gives the stored
+// order, tax and discounts included.
+func TestReplayAmountMatchesOrder(t *testing.T) {
+	s := newStore()
+	fill(t, s)
+	for i := range 5 {
+		id := fmt.Sprint("o", i)
+		st, _ := s.Load(id)
+
+		o, err := order.New(id, 1, order.Received, raja)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := o.SetItems(st.Items, st.Discount, gst); err != nil {
+			t.Fatal(err)
+		}
+		if st.Amount != o.Amount {
+			t.Errorf("%s: replayed amount %v, order amount %v", id, st.Amount, o.Amount)
+		}
+	}
+}
+
+func TestSnapshotPlusTail(t *testing.T) {
+	withSnaps := newStore(WithSnapshotEvery(3))
+	without := newStore()
+	for _, s := range []*Store{withSnaps, without} {
+		fill(t, s)
+		// a few more on top of o0's snapshot
+		mustAppend(t, s, "o0", StatusChanged{From: order.Confirmed, To: order.Prepared, Actor: "shop"})
+		mustAppend(t, s, "o0", StatusChanged{From: order.Prepared, To: order.Delivered, Actor: "courier"})
+	}
+
+	snap, ok := withSnaps.Snapshot("o0")
+	if !ok || snap.State.Version != 6 {
+		t.Fatalf("snapshot = %+v, %v, want one at version 6", snap, ok)
+	}
+	if snap.Position != withSnaps.Events("o0", 6)[0].Position {
+		t.Errorf("snapshot position %d does not match event 6", snap.Position)
+	}
+	if _, ok := without.Snapshot("o0"); ok {
+		t.Error("snapshot taken with snapshots disabled")
+	}
+
+	for i := range 5 {
+		id := fmt.Sprint("o", i)
+		got, err := withSnaps.Load(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := Replay(withSnaps.Events(id, 1), gst); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: snapshot + tail = %+v\nfull replay = %+v", id, got, want)
+		}
+		if other, _ := without.Load(id); !reflect.DeepEqual(got, other) {
+			t.Errorf("%s: differs from the store without snapshots", id)
+		}
+	}
+
+	// the snapshot is a copy; later events don't reach into it
+	snap.State.History[0].Actor = "changed"
+	if again, _ := withSnaps.Snapshot("o0"); again.State.History[0].Actor != "shop" {
+		t.Error("Snapshot shares its history with the store")
+	}
+}
+
+func TestRebuildOrdersPerStatus(t *testing.T) {
+	s := newStore()
+	live := NewOrdersPerStatus()
+	s.Subscribe(live.Apply)
+	fill(t, s)
+
+	want := map[order.Status]int{order.Received: 2, order.Confirmed: 2, order.Cancelled: 1}
+	if got := live.Counts(); !maps.Equal(got, want) {
+		t.Errorf("live counts = %v, want %v", got, want)
+	}
+
+	p := NewOrdersPerStatus()
+	p.Apply(Event{OrderID: "stale", Payload: Created{Status: order.Failed}})
+	pos := Rebuild(p, s)
+	if got := p.Counts(); !maps.Equal(got, want) {
+		t.Errorf("rebuilt counts = %v, want %v", got, want)
+	}
+	if n := int64(len(s.All(0))); pos != n {
+		t.Errorf("Rebuild returned position %d, log has %d events", pos, n)
+	}
+
+	// catch up from the returned position
+	mustAppend(t, s, "o1", StatusChanged{From: order.Received, To: order.Confirmed, Actor: "shop"})
+	for _, e := range s.All(pos) {
+		p.Apply(e)
+	}
+	if p.Count(order.Received) != 1 || p.Count(order.Confirmed) != 3 || !maps.Equal(p.Counts(), live.Counts()) {
+		t.Errorf("after catching up %v, live %v", p.Counts(), live.Counts())
+	}
+	if _, ok := p.Counts()[order.Failed]; ok {
+		t.Error("Rebuild kept counts from before the reset")
+	}
+}
+
+func TestVersionConflict(t *testing.T) {
+	s := newStore()
+	mustAppend(t, s, "o1", Created{Customer: raja, Status: order.Received})
+
+	// two writers both read version 1
+	if _, err := s.Append("o1", 1, StatusChanged{From: order.Received, To: order.Confirmed, Actor: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := s.Append("o1", 1, StatusChanged{From: order.Received, To: order.Cancelled, Actor: "b"})
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("stale append = %v, want ErrVersionConflict", err)
+	}
+	if want := "events: stream was changed concurrently: o1 is at version 2, expected 1"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err, want)
+	}
+	if _, err := s.Append("o2", 1, Paid{Amount: 1}); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("append to a missing stream at version 1 = %v", err)
+	}
+	if st, _ := s.Load("o1"); st.Version != 2 || st.Status != order.Confirmed {
+		t.Errorf("state after the conflict = %+v", st)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	s := newStore()
+	for _, tc := range []struct {
+		name     string
+		version  int
+		payloads []Payload
+		want     string
+	}{
+		{"not created", 0, []Payload{Paid{Amount: 1}}, ErrNotCreated.Error()},
+		{"bad status", 0, []Payload{Created{Status: order.Status(42)}}, "events: unknown status order status(42)"},
+		{"negative amount", 0, []Payload{Created{Amount: -1}}, "events: amount must not be negative"},
+		{"created twice", 0, []Payload{Created{}, Created{}}, ErrAlreadyCreated.Error()},
+		{"bad item", 0, []Payload{Created{}, ItemAdded{order.LineItem{SKU: "pen"}}}, "items[0].quantity: must be positive"},
+		{"bad discount", 0, []Payload{Created{Discount: order.Discount{Percent: -5}}, ItemAdded{order.LineItem{SKU: "pen", Quantity: 1}}}, "discount: percent must be between"},
+		{"wrong from", 0, []Payload{Created{}, StatusChanged{From: order.Confirmed, To: order.Prepared}}, "events: order is received, not confirmed"},
+		{"illegal move", 0, []Payload{Created{}, StatusChanged{From: order.Received, To: order.Delivered}}, "illegal status transition received -> delivered"},
+		{"items after confirm", 0, []Payload{Created{}, StatusChanged{From: order.Received, To: order.Confirmed}, ItemAdded{order.LineItem{SKU: "pen", Quantity: 1}}}, "can't add items to a confirmed order"},
+		{"zero payment", 0, []Payload{Created{}, Paid{}}, "payment must be positive"},
+		{"refund over payment", 0, []Payload{Created{}, Paid{Amount: 100}, Refunded{Amount: 101}}, "refund of ₹1.01 exceeds ₹1.00 paid"},
+	} {
+		_, err := s.Append(tc.name, tc.version, tc.payloads...)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: Append = %v, want %q", tc.name, err, tc.want)
+		}
+		// a rejected batch writes nothing, not even the payloads before
+		// the bad one
+		if evs := s.Events(tc.name, 1); len(evs) != 0 {
+			t.Errorf("%s: %d events written by a rejected append", tc.name, len(evs))
+		}
+	}
+	if n := len(s.All(0)); n != 0 {
+		t.Errorf("log has %d events after rejected appends", n)
+	}
+}
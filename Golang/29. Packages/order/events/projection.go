@@ -0,0 +1,78 @@
+package events
+
+import (
+	"maps"
+	"sync"
+
+	"github.com/rajasur/programming-learning/GO/order"
+)
+
+// Projection is a read model fed from the event log. Reset must bring it
+// back to its empty state so it can be rebuilt from scratch.
+type Projection interface {
+	Apply(Event)
+	Reset()
+}
+
+// Rebuild resets p and replays the whole log into it. It returns the last
+// position applied, so the caller can pick up new events with All(pos).
+func Rebuild(p Projection, s *Store) int64 {
+	p.Reset()
+	var pos int64
+	for _, e := range s.All(0) {
+		p.Apply(e)
+		pos = e.Position
+	}
+	return pos
+}
+
+// OrdersPerStatus counts orders by their current status.
+type OrdersPerStatus struct {
+	mu      sync.RWMutex
+	current map[string]order.Status
+	counts  map[order.Status]int
+}
+
+func NewOrdersPerStatus() *OrdersPerStatus {
+	p := &OrdersPerStatus{}
+	p.Reset()
+	return p
+}
+
+func (p *OrdersPerStatus) Reset() {
+	p.mu.Lock()
+	p.current = make(map[string]order.Status)
+	p.counts = make(map[order.Status]int)
+	p.mu.Unlock()
+}
+
+func (p *OrdersPerStatus) Apply(e Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch pl := e.Payload.(type) {
+	case Created:
+		p.current[e.OrderID] = pl.Status
+		p.counts[pl.Status]++
+	case StatusChanged:
+		p.counts[pl.From]--
+		if p.counts[pl.From] == 0 {
+			delete(p.counts, pl.From)
+		}
+		p.current[e.OrderID] = pl.To
+		p.counts[pl.To]++
+	}
+}
+
+// Counts returns a copy of the current counts.
+func (p *OrdersPerStatus) Counts() map[order.Status]int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return maps.Clone(p.counts)
+}
+
+// Count returns the number of orders currently in s.
+func (p *OrdersPerStatus) Count(s order.Status) int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.counts[s]
+}
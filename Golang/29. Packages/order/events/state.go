@@ -0,0 +1,128 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/customer"
+	"github.com/rajasur/programming-learning/GO/money"
+	"github.com/rajasur/programming-learning/GO/order"
+)
+
+var (
+	ErrNotCreated     = errors.New("events: order has not been created")
+	ErrAlreadyCreated = errors.New("events: order already created")
+)
+
+// State is an order as rebuilt from its events. Version is the Seq of the
+// last event applied.
+type State struct {
+	ID        string               `json:"id"`
+	Version   int                  `json:"version"`
+	Amount    money.Money          `json:"amount"`
+	Customer  customer.Customer    `json:"customer"`
+	Status    order.Status         `json:"status"`
+	Items     []order.LineItem     `json:"items,omitempty"`
+	Discount  order.Discount       `json:"discount,omitzero"`
+	History   []order.StatusChange `json:"history,omitempty"`
+	Paid      money.Money          `json:"paid"`
+	Refunded  money.Money          `json:"refunded"`
+	CreatedAt time.Time            `json:"created_at"`
+	UpdatedAt time.Time            `json:"updated_at"`
+}
+
+// Clone returns a copy that shares no slices with s.
+func (s State) Clone() State {
+	s.Items = slices.Clone(s.Items)
+	s.History = slices.Clone(s.History)
+	return s
+}
+
+// Check reports whether p can be applied to s, using m for status rules.
+// It is what Store.Append runs before accepting new events.
+func (s State) Check(p Payload, m *order.StatusMachine) error {
+	if _, ok := p.(Created); !ok && s.Version == 0 {
+		return ErrNotCreated
+	}
+	switch p := p.(type) {
+	case Created:
+		if s.Version != 0 {
+			return ErrAlreadyCreated
+		}
+		if !p.Status.Valid() {
+			return fmt.Errorf("events: unknown status %v", p.Status)
+		}
+		if p.Amount < 0 {
+			return errors.New("events: amount must not be negative")
+		}
+	case StatusChanged:
+		if p.From != s.Status {
+			return fmt.Errorf("events: order is %v, not %v", s.Status, p.From)
+		}
+		if !m.Can(p.From, p.To) {
+			return &order.TransitionError{From: p.From, To: p.To}
+		}
+	case ItemAdded:
+		if s.Status != order.Received {
+			return fmt.Errorf("events: can't add items to a %v order", s.Status)
+		}
+		// the items must price, or Apply couldn't work out the amount
+		if _, err := order.Calculate(append(slices.Clone(s.Items), p.Item), s.Discount, nil); err != nil {
+			return err
+		}
+	case Paid:
+		if p.Amount <= 0 {
+			return errors.New("events: payment must be positive")
+		}
+	case Refunded:
+		if p.Amount <= 0 || s.Refunded+p.Amount > s.Paid {
+			return fmt.Errorf("events: refund of %v exceeds %v paid", p.Amount, s.Paid-s.Refunded)
+		}
+	}
+	return nil
+}
+
+// Apply folds e into s, pricing items with rule exactly as
+// order.SetItems does, so Amount matches the stored order. It never looks
+// at the clock or anything outside the event and the rule, so replaying
+// the same events always gives the same state.
+func (s *State) Apply(e Event, rule order.TaxRule) {
+	switch p := e.Payload.(type) {
+	case Created:
+		s.ID = e.OrderID
+		s.Amount = p.Amount
+		s.Customer = p.Customer
+		s.Status = p.Status
+		s.Discount = p.Discount
+		s.CreatedAt = e.At
+	case ItemAdded:
+		s.Items = append(s.Items, p.Item)
+		// Check has made sure the items price
+		if b, err := order.Calculate(s.Items, s.Discount, rule); err == nil {
+			s.Amount = b.Total
+		}
+	case StatusChanged:
+		s.Status = p.To
+		s.History = append(s.History, order.StatusChange{
+			OrderID: e.OrderID, From: p.From, To: p.To, At: e.At, Actor: p.Actor,
+		})
+	case Paid:
+		s.Paid += p.Amount
+	case Refunded:
+		s.Refunded += p.Amount
+	}
+	s.Version = e.Seq
+	s.UpdatedAt = e.At
+}
+
+// Replay builds the state of one order from its events, pricing items
+// with rule.
+func Replay(events []Event, rule order.TaxRule) State {
+	var s State
+	for _, e := range events {
+		s.Apply(e, rule)
+	}
+	return s
+}
@@ -0,0 +1,179 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/order"
+)
+
+var ErrVersionConflict = errors.New("events: stream was changed concurrently")
+
+// Snapshot is a State saved at some version so replay can start there.
+type Snapshot struct {
+	State    State
+	Position int64 // log position of the last event included
+}
+
+// Store is an in-memory event log. Streams are append only; events are
+// never modified or removed. It is safe for concurrent use.
+type Store struct {
+	mu        sync.RWMutex
+	log       []Event          // every event, in append order
+	streams   map[string][]int // order id -> indexes into log
+	snapshots map[string]Snapshot
+	every     int // snapshot after this many events per order, 0 disables
+	machine   *order.StatusMachine
+	tax       order.TaxRule
+	now       func() time.Time
+	subs      []func(Event)
+}
+
+type StoreOption func(*Store)
+
+// WithSnapshotEvery snapshots an order's state every n events.
+func WithSnapshotEvery(n int) StoreOption {
+	return func(s *Store) { s.every = n }
+}
+
+// WithClock sets the clock used to stamp new events.
+func WithClock(now func() time.Time) StoreOption {
+	return func(s *Store) { s.now = now }
+}
+
+// WithStatusMachine sets the rules status changes are checked against.
+func WithStatusMachine(m *order.StatusMachine) StoreOption {
+	return func(s *Store) { s.machine = m }
+}
+
+// WithTaxRule sets the rule items are priced with when the state of an
+// order is rebuilt. It must stay the same for the life of the log, or the
+// amounts of old orders change on replay.
+func WithTaxRule(r order.TaxRule) StoreOption {
+	return func(s *Store) { s.tax = r }
+}
+
+func NewStore(opts ...StoreOption) *Store {
+	s := &Store{
+		streams:   make(map[string][]int),
+		snapshots: make(map[string]Snapshot),
+		machine:   order.DefaultStatusMachine,
+		tax:       order.NoTax{},
+		now:       time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Subscribe calls fn with every event appended from now on, in log order.
+// fn runs while the store is locked, so it must not call back into it.
+func (s *Store) Subscribe(fn func(Event)) {
+	s.mu.Lock()
+	s.subs = append(s.subs, fn)
+	s.mu.Unlock()
+}
+
+// Append adds payloads to the stream of order id. expectedVersion must be
+// the version the caller based its decision on (0 for a new order);
+// ErrVersionConflict means someone else appended first. Each payload is
+// checked against the state it would apply to.
+func (s *Store) Append(id string, expectedVersion int, payloads ...Payload) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.load(id)
+	if state.Version != expectedVersion {
+		return nil, fmt.Errorf("%w: %s is at version %d, expected %d", ErrVersionConflict, id, state.Version, expectedVersion)
+	}
+
+	at := s.now()
+	var out []Event
+	for _, p := range payloads {
+		if err := state.Check(p, s.machine); err != nil {
+			return nil, err
+		}
+		e := Event{
+			OrderID:  id,
+			Seq:      state.Version + 1,
+			Position: int64(len(s.log) + len(out) + 1),
+			At:       at,
+			Payload:  p,
+		}
+		state.Apply(e, s.tax)
+		out = append(out, e)
+	}
+
+	// nothing is written until every payload has been checked
+	for _, e := range out {
+		s.streams[id] = append(s.streams[id], len(s.log))
+		s.log = append(s.log, e)
+		if s.every > 0 && e.Seq%s.every == 0 {
+			s.snapshots[id] = Snapshot{State: state.Clone(), Position: e.Position}
+		}
+		for _, fn := range s.subs {
+			fn(e)
+		}
+	}
+	return out, nil
+}
+
+// Events returns the stream of order id from seq onwards (1 for all).
+func (s *Store) Events(id string, from int) []Event {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []Event
+	for _, i := range s.streams[id] {
+		if s.log[i].Seq >= from {
+			out = append(out, s.log[i])
+		}
+	}
+	return out
+}
+
+// All returns every event with Position > after, in log order.
+func (s *Store) All(after int64) []Event {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if after >= int64(len(s.log)) {
+		return nil
+	}
+	return slices.Clone(s.log[max(after, 0):])
+}
+
+// Load rebuilds the current state of order id, starting from its latest
+// snapshot if there is one.
+func (s *Store) Load(id string) (State, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	st := s.load(id)
+	if st.Version == 0 {
+		return State{}, ErrNotCreated
+	}
+	return st, nil
+}
+
+func (s *Store) load(id string) State {
+	var st State
+	if snap, ok := s.snapshots[id]; ok {
+		st = snap.State.Clone()
+	}
+	// stream index k holds Seq k+1, so skip what the snapshot covers
+	for _, i := range s.streams[id][st.Version:] {
+		st.Apply(s.log[i], s.tax)
+	}
+	return st
+}
+
+// Snapshot returns a copy of the latest snapshot of order id.
+func (s *Store) Snapshot(id string) (Snapshot, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snap, ok := s.snapshots[id]
+	snap.State = snap.State.Clone()
+	return snap, ok
+}
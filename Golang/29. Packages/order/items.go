@@ -0,0 +1,235 @@
+package order
+
+import (
+	"cmp"
+	"fmt"
+	"math/bits"
+	"slices"
+	"strings"
+
+	"github.com/rajasur/programming-learning/GO/money"
+)
+
+// Discount takes either a percentage (in basis points) or a fixed amount
+// off. The zero value is no discount.
+type Discount struct {
+	Percent int64       `json:"percent,omitempty"` // basis points, 1000 is 10%
+	Amount  money.Money `json:"amount,omitempty"`
+}
+
+func (d Discount) validate() error {
+	switch {
+	case d.Percent < 0 || d.Percent > 10000:
+		return fmt.Errorf("percent must be between 0 and 10000 basis points")
+	case d.Amount < 0:
+		return fmt.Errorf("amount must not be negative")
+	case d.Percent != 0 && d.Amount != 0:
+		return fmt.Errorf("use either percent or amount, not both")
+	}
+	return nil
+}
+
+// Off returns how much the discount takes off base, never more than base.
+func (d Discount) Off(base money.Money) money.Money {
+	if d.Percent != 0 {
+		return base.MulRatio(d.Percent, 10000)
+	}
+	return min(d.Amount, base)
+}
+
+type LineItem struct {
+	SKU       string      `json:"sku"`
+	Name      string      `json:"name,omitempty"`
+	Quantity  int         `json:"quantity"`
+	UnitPrice money.Money `json:"unit_price"`
+	Discount  Discount    `json:"discount,omitzero"`
+	// TaxRate overrides the tax rule's rate for this item (e.g. a GST slab),
+	// in basis points. TaxExempt items are never taxed.
+	TaxRate   int64 `json:"tax_rate,omitempty"`
+	TaxExempt bool  `json:"tax_exempt,omitempty"`
+}
+
+func (li LineItem) taxRate(def int64) int64 {
+	if li.TaxExempt {
+		return 0
+	}
+	if li.TaxRate != 0 {
+		return li.TaxRate
+	}
+	return def
+}
+
+func (li LineItem) validate(i int, verr *ValidationError) {
+	field := fmt.Sprintf("items[%d]", i)
+	if strings.TrimSpace(li.SKU) == "" {
+		verr.add(field+".sku", "must not be empty")
+	}
+	if li.Quantity <= 0 {
+		verr.add(field+".quantity", "must be positive")
+	}
+	if li.UnitPrice < 0 {
+		verr.add(field+".unit_price", "must not be negative")
+	}
+	if li.TaxRate < 0 {
+		verr.add(field+".tax_rate", "must not be negative")
+	}
+	if err := li.Discount.validate(); err != nil {
+		verr.add(field+".discount", err.Error())
+	}
+}
+
+// LineTotal is the itemized calculation for one line.
+type LineTotal struct {
+	Item          LineItem    `json:"item"`
+	Gross         money.Money `json:"gross"`          // quantity * unit price
+	ItemDiscount  money.Money `json:"item_discount"`  // the line's own discount
+	OrderDiscount money.Money `json:"order_discount"` // share of the order discount
+	Taxable       money.Money `json:"taxable"`
+	Taxes         []TaxLine   `json:"taxes,omitempty"`
+	Total         money.Money `json:"total"`
+}
+
+// Breakdown is everything an invoice needs to show how the total was
+// reached.
+type Breakdown struct {
+	Lines         []LineTotal `json:"lines"`
+	Subtotal      money.Money `json:"subtotal"` // sum of gross
+	ItemDiscounts money.Money `json:"item_discounts"`
+	OrderDiscount money.Money `json:"order_discount"`
+	Taxable       money.Money `json:"taxable"`
+	Taxes         []TaxLine   `json:"taxes,omitempty"` // summed by name and rate
+	TaxTotal      money.Money `json:"tax_total"`
+	Total         money.Money `json:"total"`
+}
+
+// Calculate prices items. Every amount is rounded to the paisa at the point
+// it would be printed on an invoice, and the order discount is spread over
+// the lines so that the line totals always add up to Total exactly.
+func Calculate(items []LineItem, discount Discount, rule TaxRule) (Breakdown, error) {
+	var verr ValidationError
+	if len(items) == 0 {
+		verr.add("items", "must not be empty")
+	}
+	for i, li := range items {
+		li.validate(i, &verr)
+	}
+	if err := discount.validate(); err != nil {
+		verr.add("discount", err.Error())
+	}
+	if err := verr.err(); err != nil {
+		return Breakdown{}, err
+	}
+	if rule == nil {
+		rule = NoTax{}
+	}
+
+	var b Breakdown
+	b.Lines = make([]LineTotal, len(items))
+	net := make([]money.Money, len(items))
+	var netTotal money.Money
+	for i, li := range items {
+		lt := LineTotal{Item: li, Gross: li.UnitPrice * money.Money(li.Quantity)}
+		lt.ItemDiscount = li.Discount.Off(lt.Gross)
+		net[i] = lt.Gross - lt.ItemDiscount
+		netTotal += net[i]
+
+		b.Subtotal += lt.Gross
+		b.ItemDiscounts += lt.ItemDiscount
+		b.Lines[i] = lt
+	}
+
+	b.OrderDiscount = discount.Off(netTotal)
+	shares := allocate(b.OrderDiscount, net)
+
+	type taxKey struct {
+		name string
+		rate int64
+	}
+	taxes := make(map[taxKey]*TaxLine)
+	for i := range b.Lines {
+		lt := &b.Lines[i]
+		lt.OrderDiscount = shares[i]
+		lt.Taxable = net[i] - shares[i]
+		lt.Taxes = rule.Taxes(lt.Item, lt.Taxable)
+		lt.Total = lt.Taxable
+		for _, t := range lt.Taxes {
+			lt.Total += t.Amount
+
+			key := taxKey{t.Name, t.Rate}
+			if sum, ok := taxes[key]; ok {
+				sum.Amount += t.Amount
+			} else {
+				taxes[key] = &t
+			}
+		}
+
+		b.Taxable += lt.Taxable
+		b.Total += lt.Total
+	}
+
+	for _, t := range taxes {
+		b.Taxes = append(b.Taxes, *t)
+		b.TaxTotal += t.Amount
+	}
+	slices.SortFunc(b.Taxes, func(x, y TaxLine) int {
+		return cmp.Or(cmp.Compare(x.Rate, y.Rate), strings.Compare(x.Name, y.Name))
+	})
+	return b, nil
+}
+
+// allocate splits total over weights in proportion, using the largest
+// remainder method so the parts add up to total exactly. Ties go to the
+// earlier line, which keeps the result deterministic. total and the
+// weights must not be negative; total * weight is worked out in 128 bits
+// so large amounts can't overflow.
+func allocate(total money.Money, weights []money.Money) []money.Money {
+	parts := make([]money.Money, len(weights))
+	var sum money.Money
+	for _, w := range weights {
+		sum += w
+	}
+	if total == 0 || sum == 0 {
+		return parts
+	}
+
+	type rem struct {
+		i int
+		r uint64
+	}
+	rems := make([]rem, len(weights))
+	var given money.Money
+	for i, w := range weights {
+		hi, lo := bits.Mul64(uint64(total), uint64(w))
+		// w <= sum, so the quotient is at most total and fits
+		q, r := bits.Div64(hi, lo, uint64(sum))
+		parts[i] = money.Money(q)
+		rems[i] = rem{i, r}
+		given += parts[i]
+	}
+
+	slices.SortStableFunc(rems, func(a, b rem) int { return cmp.Compare(b.r, a.r) })
+	for k := 0; given < total; k++ {
+		parts[rems[k].i]++
+		given++
+	}
+	return parts
+}
+
+// SetItems replaces the order's items and discount and sets Amount to the
+// tax inclusive total computed with rule.
+func (o *Order) SetItems(items []LineItem, discount Discount, rule TaxRule) (Breakdown, error) {
+	b, err := Calculate(items, discount, rule)
+	if err != nil {
+		return Breakdown{}, err
+	}
+	o.Items = slices.Clone(items)
+	o.Discount = discount
+	o.Amount = b.Total
+	o.UpdatedAt = o.now()
+	return b, nil
+}
+
+// Totals recomputes the breakdown of the order's items with rule.
+func (o *Order) Totals(rule TaxRule) (Breakdown, error) {
+	return Calculate(o.Items, o.Discount, rule)
+}
@@ -0,0 +1,226 @@
+package order
+
+import (
+	"errors"
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/rajasur/programming-learning/GO/customer"
+	"github.com/rajasur/programming-learning/GO/money"
+)
+
+func TestAllocate(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		total   money.Money
+		weights []money.Money
+		want    []money.Money
+	}{
+		{"largest remainder gets the extra paisa", 10, []money.Money{1, 2, 3}, []money.Money{2, 3, 5}},
+		{"ties go to the earlier line", 2, []money.Money{1, 1, 1}, []money.Money{1, 1, 0}},
+		{"exact split", 100, []money.Money{25, 75}, []money.Money{25, 75}},
+		{"zero weight gets nothing", 3, []money.Money{0, 5, 0, 5}, []money.Money{0, 2, 0, 1}},
+		{"nothing to split", 0, []money.Money{5, 5}, []money.Money{0, 0}},
+		{"no weight", 7, []money.Money{0, 0}, []money.Money{0, 0}},
+		// total * weight is far beyond int64
+		{"large amounts", 4e18, []money.Money{3e18, 1e18}, []money.Money{3e18, 1e18}},
+		{"large with a remainder", 1e18, []money.Money{1e18 - 1, 1}, []money.Money{1e18 - 1, 1}},
+		{"large uneven", 5e18, []money.Money{3e18, 3e18, 3e18 - 1}, []money.Money{1666666666666666667, 1666666666666666667, 1666666666666666666}},
+	} {
+		if got := allocate(tc.total, tc.weights); !slices.Equal(got, tc.want) {
+			t.Errorf("%s: allocate(%d, %v) = %v, want %v", tc.name, tc.total, tc.weights, got, tc.want)
+		}
+	}
+}
+
+// Whatever the weights, the parts add up to the total and none is more
+// than a paisa away from its exact share.
+func TestAllocateSums(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	for range 1000 {
+		weights := make([]money.Money, 1+r.IntN(8))
+		var sum money.Money
+		for i := range weights {
+			weights[i] = money.Money(r.Int64N(1e6))
+			sum += weights[i]
+		}
+		if sum == 0 {
+			continue
+		}
+		total := money.Money(r.Int64N(int64(sum) + 1))
+		parts := allocate(total, weights)
+		var got money.Money
+		for i, p := range parts {
+			got += p
+			exact := float64(total) * float64(weights[i]) / float64(sum)
+			if float64(p) < exact-1 || float64(p) > exact+1 {
+				t.Fatalf("allocate(%d, %v)[%d] = %d, exact share %.2f", total, weights, i, p, exact)
+			}
+		}
+		if got != total {
+			t.Fatalf("allocate(%d, %v) = %v, adds up to %d", total, weights, parts, got)
+		}
+	}
+}
+
+func TestCalculate(t *testing.T) {
+	items := []LineItem{
+		{SKU: "pen", Quantity: 3, UnitPrice: 333},
+		{SKU: "book", Quantity: 1, UnitPrice: 1000, Discount: Discount{Percent: 1000}},
+		{SKU: "milk", Quantity: 2, UnitPrice: 50, TaxExempt: true},
+	}
+	b, err := Calculate(items, Discount{Amount: 100}, GST{Rate: 1800, SellerState: "WB", BuyerState: "wb "})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the order discount of 1.00 is spread as 50, 45 and 5 paise: 49.97
+	// rounds down but has the largest remainder, so it gets the extra one
+	for i, want := range []struct {
+		gross, itemDisc, orderDisc, taxable, half, total money.Money
+	}{
+		{999, 0, 50, 949, 85, 1119},    // 85.41 each half
+		{1000, 100, 45, 855, 77, 1009}, // 76.95 each half
+		{100, 0, 5, 95, 0, 95},
+	} {
+		lt := b.Lines[i]
+		if lt.Gross != want.gross || lt.ItemDiscount != want.itemDisc || lt.OrderDiscount != want.orderDisc || lt.Taxable != want.taxable || lt.Total != want.total {
+			t.Errorf("line %d = %+v, want %+v", i, lt, want)
+		}
+		var halves []money.Money
+		for _, tl := range lt.Taxes {
+			halves = append(halves, tl.Amount)
+		}
+		if want.half == 0 && len(halves) != 0 || want.half != 0 && !slices.Equal(halves, []money.Money{want.half, want.half}) {
+			t.Errorf("line %d taxes = %+v, want two halves of %d", i, lt.Taxes, want.half)
+		}
+	}
+
+	want := Breakdown{Subtotal: 2099, ItemDiscounts: 100, OrderDiscount: 100, Taxable: 1899, TaxTotal: 324, Total: 2223}
+	if b.Subtotal != want.Subtotal || b.ItemDiscounts != want.ItemDiscounts || b.OrderDiscount != want.OrderDiscount ||
+		b.Taxable != want.Taxable || b.TaxTotal != want.TaxTotal || b.Total != want.Total {
+		t.Errorf("breakdown = %+v", b)
+	}
+	if wantTaxes := []TaxLine{{"CGST", 900, 162}, {"SGST", 900, 162}}; !slices.Equal(b.Taxes, wantTaxes) {
+		t.Errorf("taxes = %+v, want %+v", b.Taxes, wantTaxes)
+	}
+	var sum money.Money
+	for _, lt := range b.Lines {
+		sum += lt.Total
+	}
+	if sum != b.Total || b.Taxable+b.TaxTotal != b.Total {
+		t.Errorf("lines add up to %d, taxable + tax to %d, total is %d", sum, b.Taxable+b.TaxTotal, b.Total)
+	}
+}
+
+func TestCalculateSlabs(t *testing.T) {
+	items := []LineItem{
+		{SKU: "a", Quantity: 1, UnitPrice: 10000, TaxRate: 500},
+		{SKU: "b", Quantity: 1, UnitPrice: 10000, TaxRate: 1200},
+		{SKU: "c", Quantity: 1, UnitPrice: 10000},
+	}
+	b, err := Calculate(items, Discount{Percent: 5000}, VAT{Rate: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []TaxLine{{"VAT", 500, 500}, {"VAT", 1200, 600}}
+	if !slices.Equal(b.Taxes, want) || b.Total != 15000+1100 {
+		t.Errorf("taxes %+v, total %d", b.Taxes, b.Total)
+	}
+}
+
+func TestGSTRounding(t *testing.T) {
+	item := LineItem{SKU: "x", Quantity: 1}
+	intra := GST{Rate: 1800, SellerState: "KA", BuyerState: "KA"}
+	inter := GST{Rate: 1800, SellerState: "KA", BuyerState: "TN"}
+
+	// 5 paise at 18% is 0.9 paisa: IGST rounds it up to 1, each half
+	// (0.45) rounds down to 0
+	if got := inter.Taxes(item, 5); !slices.Equal(got, []TaxLine{{"IGST", 1800, 1}}) {
+		t.Errorf("IGST = %+v", got)
+	}
+	if got := intra.Taxes(item, 5); !slices.Equal(got, []TaxLine{{"CGST", 900, 0}, {"SGST", 900, 0}}) {
+		t.Errorf("CGST/SGST = %+v", got)
+	}
+
+	// an odd rate still adds up: 25 bp splits 12 + 13
+	odd := LineItem{SKU: "gem", Quantity: 1, TaxRate: 25}
+	got := intra.Taxes(odd, 100000)
+	if !slices.Equal(got, []TaxLine{{"CGST", 12, 120}, {"SGST", 13, 130}}) || got[0].Rate+got[1].Rate != 25 {
+		t.Errorf("odd rate = %+v", got)
+	}
+	if got := inter.Taxes(odd, 100000); !slices.Equal(got, []TaxLine{{"IGST", 25, 250}}) {
+		t.Errorf("odd rate IGST = %+v", got)
+	}
+	if got := intra.Taxes(LineItem{TaxExempt: true, TaxRate: 500}, 100); got != nil {
+		t.Errorf("exempt item taxed: %+v", got)
+	}
+}
+
+func TestGSTForBuyer(t *testing.T) {
+	g := GST{Rate: 1800, SellerState: "WB"}
+	if got := g.ForBuyer(customer.Customer{Name: "Raja", State: "KA"}); got.BuyerState != "KA" || got.Intrastate() {
+		t.Errorf("buyer in KA: %+v", got)
+	}
+	if got := g.ForBuyer(customer.Customer{Name: "Raja", State: "wb"}); !got.Intrastate() {
+		t.Errorf("buyer in wb: %+v", got)
+	}
+	if got := g.ForBuyer(customer.Customer{Name: "Raja"}); got.BuyerState != "WB" || !got.Intrastate() {
+		t.Errorf("buyer without a state: %+v", got)
+	}
+	if g.BuyerState != "" {
+		t.Error("ForBuyer changed the receiver")
+	}
+}
+
+func TestCalculateInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		items    []LineItem
+		discount Discount
+		field    string
+	}{
+		{nil, Discount{}, "items"},
+		{[]LineItem{{SKU: " ", Quantity: 1}}, Discount{}, "items[0].sku"},
+		{[]LineItem{{SKU: "a", Quantity: 0}}, Discount{}, "items[0].quantity"},
+		{[]LineItem{{SKU: "a", Quantity: 1, UnitPrice: -1}}, Discount{}, "items[0].unit_price"},
+		{[]LineItem{{SKU: "a", Quantity: 1, Discount: Discount{Percent: 10001}}}, Discount{}, "items[0].discount"},
+		{[]LineItem{{SKU: "a", Quantity: 1}}, Discount{Percent: 100, Amount: 5}, "discount"},
+	} {
+		_, err := Calculate(tc.items, tc.discount, nil)
+		var verr *ValidationError
+		if !errors.As(err, &verr) || verr.Fields[0].Field != tc.field {
+			t.Errorf("Calculate(%+v, %+v) = %v, want an error for %s", tc.items, tc.discount, err, tc.field)
+		}
+	}
+}
+
+// A fixed discount larger than the order takes it to zero, not below.
+func TestDiscountCapped(t *testing.T) {
+	b, err := Calculate([]LineItem{{SKU: "a", Quantity: 1, UnitPrice: 300, Discount: Discount{Amount: 500}}}, Discount{Amount: 100}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.ItemDiscounts != 300 || b.OrderDiscount != 0 || b.Total != 0 {
+		t.Errorf("breakdown = %+v", b)
+	}
+}
+
+func TestSetItems(t *testing.T) {
+	o, err := New("o1", 1, Received, customer.Customer{Name: "Raja"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := []LineItem{{SKU: "pen", Quantity: 2, UnitPrice: 1000}}
+	b, err := o.SetItems(items, Discount{}, GST{Rate: 1800, SellerState: "WB", BuyerState: "WB"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Amount != 2360 || b.Total != o.Amount {
+		t.Errorf("amount %d, breakdown total %d", o.Amount, b.Total)
+	}
+	items[0].Quantity = 5
+	if o.Items[0].Quantity != 2 {
+		t.Error("SetItems kept the caller's slice")
+	}
+}
@@ -0,0 +1,159 @@
+package order
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/customer"
+	"github.com/rajasur/programming-learning/GO/money"
+)
+
+// FieldError describes one invalid field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationError lists every invalid field, so a caller can report them
+// all at once instead of one per attempt.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Error()
+	}
+	return "order: invalid order: " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) add(field, msg string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: msg})
+}
+
+func (e *ValidationError) err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Clock returns the current time. Tests inject a fixed one.
+type Clock func() time.Time
+
+type Order struct {
+	ID        string            `json:"id"`
+	Amount    money.Money       `json:"amount"`
+	Customer  customer.Customer `json:"customer"`
+	Items     []LineItem        `json:"items,omitempty"`
+	Discount  Discount          `json:"discount,omitzero"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	Lifecycle
+
+	clock Clock
+}
+
+type Option func(*Order)
+
+// WithClock sets the clock used for CreatedAt and UpdatedAt.
+func WithClock(c Clock) Option {
+	return func(o *Order) { o.clock = c }
+}
+
+// WithStatusMachine makes the order follow m's transition rules.
+func WithStatusMachine(m *StatusMachine) Option {
+	return func(o *Order) { o.UseMachine(m) }
+}
+
+// New creates a validated order.
+func New(id string, amount money.Money, status Status, c customer.Customer, opts ...Option) (*Order, error) {
+	o := &Order{
+		ID:        strings.TrimSpace(id),
+		Amount:    amount,
+		Customer:  c,
+		Lifecycle: Lifecycle{Status: status},
+		clock:     time.Now,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+
+	o.CreatedAt = o.clock()
+	o.UpdatedAt = o.CreatedAt
+	return o, nil
+}
+
+// Validate checks the invariants New enforces. It is useful after decoding
+// an order from JSON.
+func (o *Order) Validate() error {
+	var verr ValidationError
+	if o.ID == "" {
+		verr.add("id", "must not be empty")
+	}
+	if o.Amount <= 0 {
+		verr.add("amount", "must be positive")
+	}
+	if !o.Status.Valid() {
+		verr.add("status", "unknown status "+o.Status.String())
+	}
+	if err := o.Customer.Validate(); err != nil {
+		verr.add("customer.name", "must not be empty")
+	}
+	for i, li := range o.Items {
+		li.validate(i, &verr)
+	}
+	return verr.err()
+}
+
+// SetClock replaces the clock of an order that was decoded rather than
+// created with New.
+func (o *Order) SetClock(c Clock) {
+	o.clock = c
+}
+
+func (o *Order) now() time.Time {
+	if o.clock == nil {
+		return time.Now()
+	}
+	return o.clock()
+}
+
+// ChangeStatus moves the order to status on behalf of actor, following the
+// rules of its status machine.
+func (o *Order) ChangeStatus(status Status, actor string) error {
+	if err := o.Transition(o.ID, status, actor); err != nil {
+		return err
+	}
+	o.UpdatedAt = o.now()
+	return nil
+}
+
+func (o *Order) Confirm(actor string) error { return o.ChangeStatus(Confirmed, actor) }
+func (o *Order) Prepare(actor string) error { return o.ChangeStatus(Prepared, actor) }
+func (o *Order) Deliver(actor string) error { return o.ChangeStatus(Delivered, actor) }
+func (o *Order) Cancel(actor string) error  { return o.ChangeStatus(Cancelled, actor) }
+func (o *Order) Refund(actor string) error  { return o.ChangeStatus(Refunded, actor) }
+
+// IsFinal reports whether no further status change is possible.
+func (o *Order) IsFinal() bool {
+	return len(o.statusMachine().Next(o.Status)) == 0
+}
+
+// Clone returns a deep copy of o, so stores can hand out orders without
+// sharing slices.
+func (o *Order) Clone() *Order {
+	c := *o
+	c.Items = slices.Clone(o.Items)
+	c.History = slices.Clone(o.History)
+	return &c
+}
@@ -0,0 +1,322 @@
+package promo
+
+import (
+	"cmp"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/money"
+	"github.com/rajasur/programming-learning/GO/order"
+)
+
+var (
+	ErrDuplicateCode = errors.New("promo: duplicate code")
+	ErrRejected      = errors.New("promo: coupon rejected")
+	ErrNoRedemption  = errors.New("promo: no such redemption")
+)
+
+// Applied is a promotion that went into the result.
+type Applied struct {
+	Code         string      `json:"code"`
+	Kind         string      `json:"kind"`
+	Discount     money.Money `json:"discount"`
+	FreeDelivery bool        `json:"free_delivery,omitempty"`
+	Explain      string      `json:"explain"`
+}
+
+// Result is the outcome of evaluating a cart.
+type Result struct {
+	Applied     []Applied   `json:"applied"`
+	Rejected    []Rejection `json:"rejected,omitempty"`
+	Subtotal    money.Money `json:"subtotal"`
+	Discount    money.Money `json:"discount"`
+	DeliveryFee money.Money `json:"delivery_fee"` // after free delivery
+	Total       money.Money `json:"total"`
+}
+
+// OrderDiscount is the result's item discount in the form
+// order.Order.SetItems takes.
+func (r Result) OrderDiscount() order.Discount {
+	return order.Discount{Amount: r.Discount}
+}
+
+// Redemption records the usage a successful Redeem took, so it can be
+// given back with Release if the order is cancelled.
+type Redemption struct {
+	ID         string   `json:"id"`
+	CustomerID string   `json:"customer_id"`
+	Codes      []string `json:"codes"`
+	Result     Result   `json:"result"`
+}
+
+// Engine holds the promotions and their usage counts. It is safe for
+// concurrent use; Redeem checks and counts usage atomically, so limits
+// hold even when many checkouts race for the last coupon.
+type Engine struct {
+	mu          sync.Mutex
+	promos      map[string]Promotion
+	uses        map[string]int
+	customerUse map[string]map[string]int // code -> customer -> uses
+	redemptions map[string]Redemption
+	now         func() time.Time
+}
+
+type Option func(*Engine)
+
+// WithClock sets the clock validity windows are checked against.
+func WithClock(now func() time.Time) Option {
+	return func(e *Engine) { e.now = now }
+}
+
+func NewEngine(opts ...Option) *Engine {
+	e := &Engine{
+		promos:      make(map[string]Promotion),
+		uses:        make(map[string]int),
+		customerUse: make(map[string]map[string]int),
+		redemptions: make(map[string]Redemption),
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Add registers p. Codes are case-insensitive.
+func (e *Engine) Add(p Promotion) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	p.Code = normCode(p.Code)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.promos[p.Code]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateCode, p.Code)
+	}
+	e.promos[p.Code] = p
+	return nil
+}
+
+// Remove withdraws a promotion. Its usage counts are kept in case it is
+// added again.
+func (e *Engine) Remove(code string) {
+	e.mu.Lock()
+	delete(e.promos, normCode(code))
+	e.mu.Unlock()
+}
+
+// Uses returns how many times code has been redeemed.
+func (e *Engine) Uses(code string) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.uses[normCode(code)]
+}
+
+// Evaluate works out the best discount for c using the given codes plus
+// any automatic promotions. It consumes no usage.
+func (e *Engine) Evaluate(c Cart, codes ...string) Result {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.evaluate(c, codes)
+}
+
+// Redeem is Evaluate followed by counting the usage of every applied
+// promotion. If any entered code was rejected nothing is counted and its
+// Rejection is returned as the error, so a checkout never silently goes
+// ahead without a coupon the customer typed.
+func (e *Engine) Redeem(c Cart, codes ...string) (Redemption, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	res := e.evaluate(c, codes)
+	entered := make(map[string]bool)
+	for _, code := range codes {
+		entered[normCode(code)] = true
+	}
+	for _, r := range res.Rejected {
+		if entered[r.Code] {
+			return Redemption{}, r
+		}
+	}
+
+	red := Redemption{ID: newID(), CustomerID: c.CustomerID, Result: res}
+	for _, a := range res.Applied {
+		red.Codes = append(red.Codes, a.Code)
+		e.uses[a.Code]++
+		if c.CustomerID != "" {
+			if e.customerUse[a.Code] == nil {
+				e.customerUse[a.Code] = make(map[string]int)
+			}
+			e.customerUse[a.Code][c.CustomerID]++
+		}
+	}
+	e.redemptions[red.ID] = red
+	return red, nil
+}
+
+// Release gives back the usage taken by a redemption.
+func (e *Engine) Release(id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	red, ok := e.redemptions[id]
+	if !ok {
+		return ErrNoRedemption
+	}
+	delete(e.redemptions, id)
+	for _, code := range red.Codes {
+		e.uses[code]--
+		if red.CustomerID != "" {
+			e.customerUse[code][red.CustomerID]--
+		}
+	}
+	return nil
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "red_" + hex.EncodeToString(b)
+}
+
+// kindOrder is the order promotions are applied in: free items first,
+// then percentages on what is left, then fixed amounts.
+var kindOrder = map[string]int{KindBuyXGetY: 0, KindPercent: 1, KindFixed: 2, KindFreeDelivery: 3}
+
+func (e *Engine) evaluate(c Cart, codes []string) Result {
+	now := e.now()
+	subtotal := c.Subtotal()
+	res := Result{Subtotal: subtotal}
+
+	// entered codes first, then automatic promotions nobody typed
+	var candidates []Promotion
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		code = normCode(code)
+		if code == "" || seen[code] {
+			continue
+		}
+		seen[code] = true
+		p, ok := e.promos[code]
+		if !ok {
+			res.Rejected = append(res.Rejected, Rejection{code, ReasonUnknownCode, "this code doesn't exist"})
+			continue
+		}
+		candidates = append(candidates, p)
+	}
+	var autos []Promotion
+	for code, p := range e.promos {
+		if p.Auto && !seen[code] {
+			autos = append(autos, p)
+		}
+	}
+	slices.SortFunc(autos, func(a, b Promotion) int { return strings.Compare(a.Code, b.Code) })
+	candidates = append(candidates, autos...)
+
+	var ok []Promotion
+	for _, p := range candidates {
+		if r, rejected := e.check(p, c, subtotal, now); rejected {
+			res.Rejected = append(res.Rejected, r)
+			continue
+		}
+		ok = append(ok, p)
+	}
+
+	// the stack of combinable promotions against the best exclusive one
+	var stack []Promotion
+	var exclusive []Promotion
+	for _, p := range ok {
+		if p.Exclusive {
+			exclusive = append(exclusive, p)
+		} else {
+			stack = append(stack, p)
+		}
+	}
+	best, bestSaving := e.apply(c, stack, subtotal)
+	var losers []Promotion
+	winner := ""
+	for _, p := range exclusive {
+		applied, saving := e.apply(c, []Promotion{p}, subtotal)
+		if saving > bestSaving {
+			losers = append(losers, stack...)
+			stack, best, bestSaving, winner = []Promotion{p}, applied, saving, p.Code
+		} else {
+			losers = append(losers, p)
+		}
+	}
+	for _, p := range losers {
+		detail := "can't be combined with other offers, and they save you more"
+		if winner != "" {
+			detail = fmt.Sprintf("can't be combined with %s, which saves you more", winner)
+		}
+		res.Rejected = append(res.Rejected, Rejection{p.Code, ReasonExclusive, detail})
+	}
+
+	res.DeliveryFee = c.DeliveryFee
+	for _, a := range best {
+		if a.Discount == 0 && !a.FreeDelivery {
+			res.Rejected = append(res.Rejected, Rejection{a.Code, ReasonNothingOff, "nothing in your cart qualifies"})
+			continue
+		}
+		res.Applied = append(res.Applied, a)
+		res.Discount += a.Discount
+		if a.FreeDelivery {
+			res.DeliveryFee = 0
+		}
+	}
+	res.Total = subtotal - res.Discount + res.DeliveryFee
+	return res
+}
+
+// apply runs promotions in kindOrder, each on what the previous left,
+// and returns what each took off plus the total saving.
+func (e *Engine) apply(c Cart, ps []Promotion, subtotal money.Money) ([]Applied, money.Money) {
+	ps = slices.Clone(ps)
+	slices.SortStableFunc(ps, func(a, b Promotion) int {
+		return cmp.Compare(kindOrder[a.Kind], kindOrder[b.Kind])
+	})
+	remaining := subtotal
+	var saving money.Money
+	var out []Applied
+	for _, p := range ps {
+		off, free, explain := p.discount(c, remaining)
+		remaining -= off
+		saving += off
+		if free {
+			saving += c.DeliveryFee
+		}
+		out = append(out, Applied{Code: p.Code, Kind: p.Kind, Discount: off, FreeDelivery: free, Explain: explain})
+	}
+	return out, saving
+}
+
+// check returns the first condition p fails for c.
+func (e *Engine) check(p Promotion, c Cart, subtotal money.Money, now time.Time) (Rejection, bool) {
+	reject := func(reason, format string, args ...any) (Rejection, bool) {
+		return Rejection{p.Code, reason, fmt.Sprintf(format, args...)}, true
+	}
+	switch {
+	case !p.ValidFrom.IsZero() && now.Before(p.ValidFrom):
+		return reject(ReasonNotStarted, "starts on %s", p.ValidFrom.Format(time.DateOnly))
+	case !p.ValidTo.IsZero() && !now.Before(p.ValidTo):
+		return reject(ReasonExpired, "expired on %s", p.ValidTo.Format(time.DateOnly))
+	case len(p.Segments) > 0 && !slices.ContainsFunc(c.Segments, func(s string) bool { return slices.Contains(p.Segments, s) }):
+		return reject(ReasonSegment, "only for %s customers", strings.Join(p.Segments, " or "))
+	case p.FirstOrderOnly && !c.FirstOrder:
+		return reject(ReasonFirstOrder, "only valid on your first order")
+	case subtotal < p.MinOrder:
+		return reject(ReasonMinOrder, "needs an order of at least %v, add %v more", p.MinOrder, p.MinOrder-subtotal)
+	case p.MaxUses > 0 && e.uses[p.Code] >= p.MaxUses:
+		return reject(ReasonUsedUp, "has been fully redeemed")
+	case p.MaxUsesPerCustomer > 0 && c.CustomerID == "":
+		return reject(ReasonCustomerLimit, "sign in to use this code")
+	case p.MaxUsesPerCustomer > 0 && e.customerUse[p.Code][c.CustomerID] >= p.MaxUsesPerCustomer:
+		return reject(ReasonCustomerLimit, "you have used it the maximum %d times", p.MaxUsesPerCustomer)
+	}
+	return Rejection{}, false
+}
@@ -0,0 +1,437 @@
+package promo
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/money"
+	"github.com/rajasur/programming-learning/GO/order"
+)
+
+var t0 = time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+
+// cart is three pens at ₹100 and a book at ₹500, ₹800 in all, with ₹40
+// delivery.
+func cart() Cart {
+	return Cart{
+		CustomerID: "c1",
+		Items: []order.LineItem{
+			{SKU: "pen", Quantity: 3, UnitPrice: 10000},
+			{SKU: "book", Quantity: 1, UnitPrice: 50000},
+		},
+		DeliveryFee: 4000,
+	}
+}
+
+func newEngine(t *testing.T, ps ...Promotion) *Engine {
+	t.Helper()
+	e := NewEngine(WithClock(func() time.Time { return t0 }))
+	for _, p := range ps {
+		if err := e.Add(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return e
+}
+
+func codes(applied []Applied) []string {
+	var out []string
+	for _, a := range applied {
+		out = append(out, a.Code)
+	}
+	return out
+}
+
+func TestKinds(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		p        Promotion
+		discount money.Money
+		delivery money.Money
+		explain  string
+	}{
+		{"percent", Promotion{Code: "P", Kind: KindPercent, Percent: 1000}, 8000, 4000, "10% off ₹800.00"},
+		{"percent capped", Promotion{Code: "P", Kind: KindPercent, Percent: 1250, MaxDiscount: 5000}, 5000, 4000, "12.5% off ₹800.00, capped at ₹50.00"},
+		{"fixed", Promotion{Code: "F", Kind: KindFixed, Amount: 20000}, 20000, 4000, "₹200.00 off"},
+		{"fixed above the subtotal", Promotion{Code: "F", Kind: KindFixed, Amount: 100000}, 80000, 4000, "₹800.00 off"},
+		// pens are ₹100 each: the third is free
+		{"buy 2 get 1 pens", Promotion{Code: "B", Kind: KindBuyXGetY, Buy: 2, Get: 1, SKUs: []string{"pen"}}, 10000, 4000, "buy 2 get 1: 1 free"},
+		// the book is paid for, the cheapest unit of the group is free
+		{"buy 2 get 1 anything", Promotion{Code: "B", Kind: KindBuyXGetY, Buy: 2, Get: 1}, 10000, 4000, "buy 2 get 1: 1 free"},
+		{"buy 1 get 1", Promotion{Code: "B", Kind: KindBuyXGetY, Buy: 1, Get: 1}, 20000, 4000, "buy 1 get 1: 2 free"},
+		{"free delivery", Promotion{Code: "D", Kind: KindFreeDelivery}, 0, 0, "₹40.00 delivery waived"},
+	} {
+		e := newEngine(t, tc.p)
+		res := e.Evaluate(cart(), tc.p.Code)
+		if len(res.Applied) != 1 || len(res.Rejected) != 0 {
+			t.Errorf("%s: applied %+v, rejected %+v", tc.name, res.Applied, res.Rejected)
+			continue
+		}
+		a := res.Applied[0]
+		if a.Discount != tc.discount || a.Explain != tc.explain || a.Kind != tc.p.Kind {
+			t.Errorf("%s: applied %+v, want %v off explained as %q", tc.name, a, tc.discount, tc.explain)
+		}
+		if res.Subtotal != 80000 || res.Discount != tc.discount || res.DeliveryFee != tc.delivery || res.Total != 80000-tc.discount+tc.delivery {
+			t.Errorf("%s: result %+v", tc.name, res)
+		}
+		if res.OrderDiscount() != (order.Discount{Amount: tc.discount}) {
+			t.Errorf("%s: OrderDiscount = %+v", tc.name, res.OrderDiscount())
+		}
+	}
+}
+
+// Promotions that fit the cart but take nothing off are rejected rather
+// than listed as applied.
+func TestNothingOff(t *testing.T) {
+	e := newEngine(t,
+		Promotion{Code: "INK", Kind: KindBuyXGetY, Buy: 1, Get: 1, SKUs: []string{"ink"}},
+		Promotion{Code: "SHIP", Kind: KindFreeDelivery},
+	)
+	c := cart()
+	c.DeliveryFee = 0
+	res := e.Evaluate(c, "ink", "ship")
+	want := []Rejection{
+		{"INK", ReasonNothingOff, "nothing in your cart qualifies"},
+		{"SHIP", ReasonNothingOff, "nothing in your cart qualifies"},
+	}
+	if len(res.Applied) != 0 || !slices.Equal(res.Rejected, want) || res.Total != 80000 {
+		t.Errorf("applied %+v, rejected %+v, total %v", res.Applied, res.Rejected, res.Total)
+	}
+}
+
+func TestConditions(t *testing.T) {
+	base := Promotion{Code: "SAVE", Kind: KindFixed, Amount: 1000}
+	for _, tc := range []struct {
+		name   string
+		edit   func(p *Promotion, c *Cart)
+		reason string
+		detail string
+	}{
+		{"no conditions", func(p *Promotion, c *Cart) {}, "", ""},
+
+		{"not started", func(p *Promotion, c *Cart) { p.ValidFrom = time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC) },
+			ReasonNotStarted, "starts on 2026-04-01"},
+		{"starts now", func(p *Promotion, c *Cart) { p.ValidFrom = t0 }, "", ""},
+		{"expired", func(p *Promotion, c *Cart) { p.ValidTo = t0 }, // ValidTo is exclusive
+			ReasonExpired, "expired on 2026-03-01"},
+		{"ends later", func(p *Promotion, c *Cart) { p.ValidFrom, p.ValidTo = t0.Add(-time.Hour), t0.Add(time.Second) }, "", ""},
+
+		{"wrong segment", func(p *Promotion, c *Cart) { p.Segments = []string{"gold", "staff"}; c.Segments = []string{"silver"} },
+			ReasonSegment, "only for gold or staff customers"},
+		{"no segment", func(p *Promotion, c *Cart) { p.Segments = []string{"gold"} },
+			ReasonSegment, "only for gold customers"},
+		{"one of the segments", func(p *Promotion, c *Cart) {
+			p.Segments = []string{"gold", "staff"}
+			c.Segments = []string{"new", "staff"}
+		}, "", ""},
+
+		{"not the first order", func(p *Promotion, c *Cart) { p.FirstOrderOnly = true },
+			ReasonFirstOrder, "only valid on your first order"},
+		{"first order", func(p *Promotion, c *Cart) { p.FirstOrderOnly = true; c.FirstOrder = true }, "", ""},
+
+		{"below the minimum", func(p *Promotion, c *Cart) { p.MinOrder = 100000 },
+			ReasonMinOrder, "needs an order of at least ₹1000.00, add ₹200.00 more"},
+		{"exactly the minimum", func(p *Promotion, c *Cart) { p.MinOrder = 80000 }, "", ""},
+		// line discounts count against the minimum
+		{"minimum after line discounts", func(p *Promotion, c *Cart) {
+			p.MinOrder = 80000
+			c.Items[1].Discount = order.Discount{Amount: 1}
+		}, ReasonMinOrder, "needs an order of at least ₹800.00, add ₹0.01 more"},
+
+		{"per customer limit without a customer", func(p *Promotion, c *Cart) { p.MaxUsesPerCustomer = 1; c.CustomerID = "" },
+			ReasonCustomerLimit, "sign in to use this code"},
+		{"global limit without a customer", func(p *Promotion, c *Cart) { p.MaxUses = 1; c.CustomerID = "" }, "", ""},
+
+		// the first failing condition is the one reported
+		{"several fail", func(p *Promotion, c *Cart) { p.ValidTo = t0; p.FirstOrderOnly = true; p.MinOrder = 100000 },
+			ReasonExpired, "expired on 2026-03-01"},
+	} {
+		p, c := base, cart()
+		tc.edit(&p, &c)
+		e := newEngine(t, p)
+		res := e.Evaluate(c, "save")
+
+		if tc.reason == "" {
+			if len(res.Rejected) != 0 || !slices.Equal(codes(res.Applied), []string{"SAVE"}) {
+				t.Errorf("%s: applied %v, rejected %+v", tc.name, codes(res.Applied), res.Rejected)
+			}
+			continue
+		}
+		want := Rejection{"SAVE", tc.reason, tc.detail}
+		if len(res.Applied) != 0 || !slices.Equal(res.Rejected, []Rejection{want}) {
+			t.Errorf("%s: applied %v, rejected %+v, want %+v", tc.name, codes(res.Applied), res.Rejected, want)
+		}
+		_, err := e.Redeem(c, "save")
+		if !errors.Is(err, ErrRejected) || err != error(want) {
+			t.Errorf("%s: Redeem = %v, want %v", tc.name, err, want)
+		}
+		if e.Uses("SAVE") != 0 {
+			t.Errorf("%s: a rejected redeem was counted", tc.name)
+		}
+	}
+}
+
+func TestUnknownCode(t *testing.T) {
+	e := newEngine(t, Promotion{Code: "SAVE", Kind: KindFixed, Amount: 1000})
+	res := e.Evaluate(cart(), " save ", "SAVE", "nope", "")
+	if !slices.Equal(codes(res.Applied), []string{"SAVE"}) {
+		t.Errorf("applied %v, want SAVE once", codes(res.Applied))
+	}
+	want := Rejection{"NOPE", ReasonUnknownCode, "this code doesn't exist"}
+	if !slices.Equal(res.Rejected, []Rejection{want}) {
+		t.Errorf("rejected %+v", res.Rejected)
+	}
+	if want.Error() != "promo: NOPE not applied: this code doesn't exist" {
+		t.Errorf("Error() = %q", want.Error())
+	}
+
+	// one bad code stops the whole redemption
+	_, err := e.Redeem(cart(), "save", "nope")
+	var r Rejection
+	if !errors.As(err, &r) || r != want {
+		t.Errorf("Redeem = %v, want %v", err, want)
+	}
+	if e.Uses("save") != 0 {
+		t.Error("SAVE counted although the redemption failed")
+	}
+}
+
+func TestStacking(t *testing.T) {
+	p10 := Promotion{Code: "P10", Kind: KindPercent, Percent: 1000}
+	f50 := Promotion{Code: "F50", Kind: KindFixed, Amount: 5000}
+	b2g1 := Promotion{Code: "B2G1", Kind: KindBuyXGetY, Buy: 2, Get: 1, SKUs: []string{"pen"}}
+	ship := Promotion{Code: "SHIP", Kind: KindFreeDelivery}
+	x := func(code string, amount money.Money) Promotion {
+		return Promotion{Code: code, Kind: KindFixed, Amount: amount, Exclusive: true}
+	}
+
+	for _, tc := range []struct {
+		name     string
+		promos   []Promotion
+		codes    []string
+		applied  []string
+		discount money.Money
+		rejected []Rejection
+	}{
+		// free items, then percentages on what is left, then fixed amounts,
+		// whatever order the codes were typed in
+		{"stack", []Promotion{p10, f50, b2g1, ship}, []string{"ship", "f50", "p10", "b2g1"},
+			[]string{"B2G1", "P10", "F50", "SHIP"}, 10000 + 7000 + 5000, nil},
+		{"percent before fixed", []Promotion{p10, f50}, []string{"f50", "p10"},
+			[]string{"P10", "F50"}, 8000 + 5000, nil},
+
+		// ₹200 off beats the ₹130 the stack saves
+		{"exclusive wins", []Promotion{p10, f50, x("X200", 20000)}, []string{"p10", "f50", "x200"},
+			[]string{"X200"}, 20000, []Rejection{
+				{"P10", ReasonExclusive, "can't be combined with X200, which saves you more"},
+				{"F50", ReasonExclusive, "can't be combined with X200, which saves you more"},
+			}},
+		{"stack wins", []Promotion{p10, f50, x("X100", 10000)}, []string{"x100", "p10", "f50"},
+			[]string{"P10", "F50"}, 13000, []Rejection{
+				{"X100", ReasonExclusive, "can't be combined with other offers, and they save you more"},
+			}},
+		// on a tie the stack is kept
+		{"tie", []Promotion{p10, f50, x("X130", 13000)}, []string{"p10", "f50", "x130"},
+			[]string{"P10", "F50"}, 13000, []Rejection{
+				{"X130", ReasonExclusive, "can't be combined with other offers, and they save you more"},
+			}},
+		// the waived delivery counts as a saving
+		{"free delivery in the stack", []Promotion{ship, x("X30", 3000)}, []string{"x30", "ship"},
+			[]string{"SHIP"}, 0, []Rejection{
+				{"X30", ReasonExclusive, "can't be combined with other offers, and they save you more"},
+			}},
+		{"best of two exclusives", []Promotion{p10, x("X200", 20000), x("X300", 30000)}, []string{"x200", "p10", "x300"},
+			[]string{"X300"}, 30000, []Rejection{
+				{"P10", ReasonExclusive, "can't be combined with X300, which saves you more"},
+				{"X200", ReasonExclusive, "can't be combined with X300, which saves you more"},
+			}},
+		{"exclusive alone", []Promotion{x("X100", 10000)}, []string{"x100"},
+			[]string{"X100"}, 10000, nil},
+	} {
+		e := newEngine(t, tc.promos...)
+		res := e.Evaluate(cart(), tc.codes...)
+		if !slices.Equal(codes(res.Applied), tc.applied) || res.Discount != tc.discount || !slices.Equal(res.Rejected, tc.rejected) {
+			t.Errorf("%s: applied %v for %v, rejected %+v\nwant %v for %v, rejected %+v",
+				tc.name, codes(res.Applied), res.Discount, res.Rejected, tc.applied, tc.discount, tc.rejected)
+		}
+	}
+}
+
+func TestAutoPromotions(t *testing.T) {
+	e := newEngine(t,
+		Promotion{Code: "WELCOME", Kind: KindPercent, Percent: 500, Auto: true, FirstOrderOnly: true},
+		Promotion{Code: "BULK", Kind: KindFixed, Amount: 2000, Auto: true, MinOrder: 50000},
+		Promotion{Code: "P10", Kind: KindPercent, Percent: 1000},
+	)
+	res := e.Evaluate(cart())
+	if !slices.Equal(codes(res.Applied), []string{"BULK"}) || res.Discount != 2000 {
+		t.Errorf("applied %v for %v", codes(res.Applied), res.Discount)
+	}
+	if want := []Rejection{{"WELCOME", ReasonFirstOrder, "only valid on your first order"}}; !slices.Equal(res.Rejected, want) {
+		t.Errorf("rejected %+v, want %+v", res.Rejected, want)
+	}
+
+	// a rejected automatic promotion doesn't stop a redemption
+	red, err := e.Redeem(cart(), "p10")
+	if err != nil || !slices.Equal(red.Codes, []string{"P10", "BULK"}) {
+		t.Fatalf("Redeem = %+v, %v", red, err)
+	}
+	if e.Uses("bulk") != 1 || e.Uses("welcome") != 0 {
+		t.Errorf("uses: BULK %d, WELCOME %d", e.Uses("bulk"), e.Uses("welcome"))
+	}
+
+	// typing an automatic code doesn't apply it twice
+	if res := e.Evaluate(cart(), "bulk"); !slices.Equal(codes(res.Applied), []string{"BULK"}) {
+		t.Errorf("applied %v", codes(res.Applied))
+	}
+}
+
+func TestUsageLimits(t *testing.T) {
+	e := newEngine(t,
+		Promotion{Code: "ONCE", Kind: KindFixed, Amount: 1000, MaxUses: 1},
+		Promotion{Code: "TWICE", Kind: KindFixed, Amount: 1000, MaxUsesPerCustomer: 2},
+	)
+	red, err := e.Redeem(cart(), "once")
+	if err != nil || e.Uses("ONCE") != 1 {
+		t.Fatalf("first Redeem = %v, uses %d", err, e.Uses("ONCE"))
+	}
+	other := cart()
+	other.CustomerID = "c2"
+	_, err = e.Redeem(other, "once")
+	if want := (Rejection{"ONCE", ReasonUsedUp, "has been fully redeemed"}); err != error(want) {
+		t.Errorf("second Redeem = %v, want %v", err, want)
+	}
+	// Evaluate never takes usage
+	for range 3 {
+		e.Evaluate(other, "once")
+	}
+	if e.Uses("ONCE") != 1 {
+		t.Errorf("uses = %d after Evaluate", e.Uses("ONCE"))
+	}
+
+	// releasing gives the use back
+	if err := e.Release(red.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Release(red.ID); !errors.Is(err, ErrNoRedemption) {
+		t.Errorf("second Release = %v, want ErrNoRedemption", err)
+	}
+	if _, err := e.Redeem(other, "once"); err != nil || e.Uses("ONCE") != 1 {
+		t.Errorf("Redeem after Release = %v, uses %d", err, e.Uses("ONCE"))
+	}
+
+	// per customer
+	var reds []Redemption
+	for range 2 {
+		red, err := e.Redeem(cart(), "twice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		reds = append(reds, red)
+	}
+	_, err = e.Redeem(cart(), "twice")
+	if want := (Rejection{"TWICE", ReasonCustomerLimit, "you have used it the maximum 2 times"}); err != error(want) {
+		t.Errorf("third Redeem by c1 = %v, want %v", err, want)
+	}
+	if _, err := e.Redeem(other, "twice"); err != nil {
+		t.Errorf("Redeem by c2 = %v", err)
+	}
+	if err := e.Release(reds[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Redeem(cart(), "twice"); err != nil {
+		t.Errorf("Redeem by c1 after a Release = %v", err)
+	}
+	if e.Uses("TWICE") != 3 {
+		t.Errorf("TWICE used %d times, want 3", e.Uses("TWICE"))
+	}
+}
+
+// Many checkouts racing for the last coupons never redeem more than the
+// limits allow. Run with -race.
+func TestUsageLimitsConcurrent(t *testing.T) {
+	e := newEngine(t,
+		Promotion{Code: "FIRST10", Kind: KindFixed, Amount: 1000, MaxUses: 10},
+		Promotion{Code: "ONEEACH", Kind: KindPercent, Percent: 500, MaxUsesPerCustomer: 1},
+	)
+	const customers, attempts = 5, 40
+
+	var mu sync.Mutex
+	won := make(map[string]int) // code -> successful redemptions
+	perCustomer := make(map[string]int)
+	var wg sync.WaitGroup
+	for i := range customers * attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := cart()
+			c.CustomerID = fmt.Sprint("c", i%customers)
+			code := "first10"
+			if i%2 == 1 {
+				code = "oneeach"
+			}
+			e.Evaluate(c, code)
+			red, err := e.Redeem(c, code)
+			if err != nil {
+				if !errors.Is(err, ErrRejected) {
+					t.Errorf("Redeem = %v", err)
+				}
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			won[red.Codes[0]]++
+			if red.Codes[0] == "ONEEACH" {
+				perCustomer[c.CustomerID]++
+			}
+		}()
+	}
+	wg.Wait()
+
+	if won["FIRST10"] != 10 || e.Uses("FIRST10") != 10 {
+		t.Errorf("FIRST10 redeemed %d times, counted %d, limit 10", won["FIRST10"], e.Uses("FIRST10"))
+	}
+	if won["ONEEACH"] != customers || e.Uses("ONEEACH") != customers {
+		t.Errorf("ONEEACH redeemed %d times, counted %d, want one per customer", won["ONEEACH"], e.Uses("ONEEACH"))
+	}
+	for id, n := range perCustomer {
+		if n != 1 {
+			t.Errorf("%s redeemed ONEEACH %d times", id, n)
+		}
+	}
+}
+
+func TestAdd(t *testing.T) {
+	e := newEngine(t, Promotion{Code: "save10", Kind: KindPercent, Percent: 1000})
+	if err := e.Add(Promotion{Code: " SAVE10 ", Kind: KindFixed, Amount: 1}); !errors.Is(err, ErrDuplicateCode) {
+		t.Errorf("Add of a duplicate code = %v", err)
+	}
+
+	for _, tc := range []struct {
+		p    Promotion
+		want string
+	}{
+		{Promotion{Code: " ", Kind: KindFixed, Amount: 1}, "promo: code is required"},
+		{Promotion{Code: "X", Kind: "bogo"}, `promo: X: unknown kind "bogo"`},
+		{Promotion{Code: "X", Kind: KindPercent}, "promo: X: percent must be between 1 and 10000 basis points"},
+		{Promotion{Code: "X", Kind: KindPercent, Percent: 10001}, "promo: X: percent must be between 1 and 10000 basis points"},
+		{Promotion{Code: "X", Kind: KindFixed}, "promo: X: amount must be positive"},
+		{Promotion{Code: "X", Kind: KindBuyXGetY, Buy: 2}, "promo: X: buy and get must be positive"},
+		{Promotion{Code: "X", Kind: KindFreeDelivery, MinOrder: -1}, "promo: X: amounts must not be negative"},
+		{Promotion{Code: "X", Kind: KindFreeDelivery, MaxUses: -1}, "promo: X: limits must not be negative"},
+		{Promotion{Code: "X", Kind: KindFreeDelivery, ValidFrom: t0, ValidTo: t0}, "promo: X: valid_to must be after valid_from"},
+	} {
+		if err := e.Add(tc.p); err == nil || err.Error() != tc.want {
+			t.Errorf("Add(%+v) = %v, want %q", tc.p, err, tc.want)
+		}
+	}
+
+	e.Remove("Save10")
+	if res := e.Evaluate(cart(), "save10"); res.Rejected[0].Reason != ReasonUnknownCode {
+		t.Errorf("removed code: %+v", res.Rejected)
+	}
+}
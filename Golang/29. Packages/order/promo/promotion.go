@@ -0,0 +1,176 @@
+// Package promo applies coupons and automatic promotions to a cart and
+// says why each one did or didn't apply.
+package promo
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/money"
+	"github.com/rajasur/programming-learning/GO/order"
+)
+
+// Promotion kinds.
+const (
+	KindPercent      = "percent"       // Percent off the cart, up to MaxDiscount
+	KindFixed        = "fixed"         // Amount off the cart
+	KindBuyXGetY     = "buy_x_get_y"   // buy Buy units, the cheapest Get more are free
+	KindFreeDelivery = "free_delivery" // waives the delivery fee
+)
+
+// Promotion is one rule as marketing configures it. Only the fields
+// relevant to Kind are used.
+type Promotion struct {
+	Code string `json:"code"`
+	Kind string `json:"kind"`
+	// Auto promotions apply to every cart that qualifies, without a code.
+	Auto bool `json:"auto,omitempty"`
+
+	Percent     int64       `json:"percent,omitempty"` // basis points
+	MaxDiscount money.Money `json:"max_discount,omitempty"`
+	Amount      money.Money `json:"amount,omitempty"`
+	Buy         int         `json:"buy,omitempty"`
+	Get         int         `json:"get,omitempty"`
+	SKUs        []string    `json:"skus,omitempty"` // buy_x_get_y items, all if empty
+
+	// conditions
+	MinOrder       money.Money `json:"min_order,omitempty"`
+	FirstOrderOnly bool        `json:"first_order_only,omitempty"`
+	Segments       []string    `json:"segments,omitempty"` // any of these, all customers if empty
+	ValidFrom      time.Time   `json:"valid_from,omitzero"`
+	ValidTo        time.Time   `json:"valid_to,omitzero"` // exclusive
+
+	// limits, 0 is unlimited
+	MaxUses            int `json:"max_uses,omitempty"`
+	MaxUsesPerCustomer int `json:"max_uses_per_customer,omitempty"`
+
+	// Exclusive promotions never combine with others; the engine picks
+	// whichever of the exclusive one or the stack saves more.
+	Exclusive bool `json:"exclusive,omitempty"`
+}
+
+func normCode(c string) string {
+	return strings.ToUpper(strings.TrimSpace(c))
+}
+
+func (p Promotion) validate() error {
+	bad := func(format string, args ...any) error {
+		return fmt.Errorf("promo: %s: %s", p.Code, fmt.Sprintf(format, args...))
+	}
+	if normCode(p.Code) == "" {
+		return fmt.Errorf("promo: code is required")
+	}
+	switch p.Kind {
+	case KindPercent:
+		if p.Percent <= 0 || p.Percent > 10000 {
+			return bad("percent must be between 1 and 10000 basis points")
+		}
+	case KindFixed:
+		if p.Amount <= 0 {
+			return bad("amount must be positive")
+		}
+	case KindBuyXGetY:
+		if p.Buy <= 0 || p.Get <= 0 {
+			return bad("buy and get must be positive")
+		}
+	case KindFreeDelivery:
+	default:
+		return bad("unknown kind %q", p.Kind)
+	}
+	switch {
+	case p.MaxDiscount < 0 || p.MinOrder < 0:
+		return bad("amounts must not be negative")
+	case p.MaxUses < 0 || p.MaxUsesPerCustomer < 0:
+		return bad("limits must not be negative")
+	case !p.ValidFrom.IsZero() && !p.ValidTo.IsZero() && !p.ValidTo.After(p.ValidFrom):
+		return bad("valid_to must be after valid_from")
+	}
+	return nil
+}
+
+// Cart is what promotions are evaluated against.
+type Cart struct {
+	CustomerID  string // whatever identifies a customer for per-customer limits
+	Segments    []string
+	FirstOrder  bool
+	Items       []order.LineItem
+	DeliveryFee money.Money
+}
+
+// CartFor builds a cart from an order's items, identifying the customer
+// by phone number.
+func CartFor(o *order.Order, firstOrder bool, segments ...string) Cart {
+	return Cart{
+		CustomerID: o.Customer.Phone.E164(),
+		Segments:   segments,
+		FirstOrder: firstOrder,
+		Items:      o.Items,
+	}
+}
+
+// Subtotal is the items total after their own line discounts.
+func (c Cart) Subtotal() money.Money {
+	var sum money.Money
+	for _, li := range c.Items {
+		gross := li.UnitPrice * money.Money(li.Quantity)
+		sum += gross - li.Discount.Off(gross)
+	}
+	return sum
+}
+
+// discount works out what p takes off c, given what earlier promotions
+// in the stack already took off the subtotal.
+func (p Promotion) discount(c Cart, remaining money.Money) (off money.Money, freeDelivery bool, explain string) {
+	switch p.Kind {
+	case KindPercent:
+		off = remaining.MulRatio(p.Percent, 10000)
+		explain = fmt.Sprintf("%s off %v", order.FormatRate(p.Percent), remaining)
+		if p.MaxDiscount > 0 && off > p.MaxDiscount {
+			off = p.MaxDiscount
+			explain += fmt.Sprintf(", capped at %v", p.MaxDiscount)
+		}
+	case KindFixed:
+		off = min(p.Amount, remaining)
+		explain = fmt.Sprintf("%v off", off)
+	case KindBuyXGetY:
+		var free int
+		off, free = p.freeUnits(c)
+		off = min(off, remaining)
+		explain = fmt.Sprintf("buy %d get %d: %d free", p.Buy, p.Get, free)
+	case KindFreeDelivery:
+		freeDelivery = c.DeliveryFee > 0
+		explain = fmt.Sprintf("%v delivery waived", c.DeliveryFee)
+	}
+	return off, freeDelivery, explain
+}
+
+// freeUnits lines up every qualifying unit from dearest to cheapest and
+// makes the last Get of each Buy+Get group free, so customers always pay
+// for the dearer units.
+func (p Promotion) freeUnits(c Cart) (money.Money, int) {
+	var prices []money.Money
+	for _, li := range c.Items {
+		if len(p.SKUs) > 0 && !slices.Contains(p.SKUs, li.SKU) {
+			continue
+		}
+		unit := li.UnitPrice - li.Discount.Off(li.UnitPrice)
+		for range li.Quantity {
+			prices = append(prices, unit)
+		}
+	}
+	slices.SortFunc(prices, func(a, b money.Money) int { return cmp.Compare(b, a) })
+
+	var off money.Money
+	free := 0
+	group := p.Buy + p.Get
+	for i, price := range prices {
+		if i%group >= p.Buy && i-i%group+group <= len(prices) {
+			off += price
+			free++
+		}
+	}
+	return off, free
+}
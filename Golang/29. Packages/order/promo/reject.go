@@ -0,0 +1,34 @@
+package promo
+
+import "fmt"
+
+// Reasons a promotion is rejected.
+const (
+	ReasonUnknownCode   = "unknown_code"
+	ReasonNotStarted    = "not_started"
+	ReasonExpired       = "expired"
+	ReasonSegment       = "segment"
+	ReasonFirstOrder    = "first_order_only"
+	ReasonMinOrder      = "min_order"
+	ReasonUsedUp        = "used_up"
+	ReasonCustomerLimit = "customer_limit"
+	ReasonNothingOff    = "nothing_off"
+	ReasonExclusive     = "exclusive"
+)
+
+// Rejection explains why a code the customer entered, or an automatic
+// promotion they might have expected, was not applied.
+type Rejection struct {
+	Code   string `json:"code"`
+	Reason string `json:"reason"`
+	Detail string `json:"detail"` // a sentence fit to show the customer
+}
+
+func (r Rejection) Error() string {
+	return fmt.Sprintf("promo: %s not applied: %s", r.Code, r.Detail)
+}
+
+// Is makes every Rejection match ErrRejected.
+func (r Rejection) Is(target error) bool {
+	return target == ErrRejected
+}
@@ -0,0 +1,230 @@
+package query
+
+import (
+	"cmp"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/customer"
+	"github.com/rajasur/programming-learning/GO/money"
+	"github.com/rajasur/programming-learning/GO/order"
+	"github.com/rajasur/programming-learning/GO/order/store"
+)
+
+// Fields lists the names a query can filter on, in the order they are
+// documented to users.
+var Fields = []string{"id", "status", "name", "phone", "country", "amount", "items", "created", "updated"}
+
+var fieldAliases = map[string]string{
+	"created_at": "created",
+	"updated_at": "updated",
+	"customer":   "name",
+}
+
+// countryAliases maps the country names people type to ISO codes, so
+// country:India finds customers stored with "IN" and the other way round.
+var countryAliases = map[string]string{
+	"india":                "in",
+	"united states":        "us",
+	"usa":                  "us",
+	"canada":               "ca",
+	"united kingdom":       "gb",
+	"uk":                   "gb",
+	"australia":            "au",
+	"singapore":            "sg",
+	"united arab emirates": "ae",
+	"uae":                  "ae",
+}
+
+func normCountry(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if code, ok := countryAliases[s]; ok {
+		return code
+	}
+	return s
+}
+
+// country is the customer's country, falling back to the region of
+// their phone number.
+func country(o *order.Order) string {
+	if o.Customer.Country != "" {
+		return normCountry(o.Customer.Country)
+	}
+	return strings.ToLower(o.Customer.Phone.Region())
+}
+
+// compile checks n's field, operator and value and sets its matcher.
+// On failure it returns a message and the column to report it at.
+func compile(n *Cmp, valueCol int) (string, int) {
+	field := strings.ToLower(n.Field)
+	if f, ok := fieldAliases[field]; ok {
+		field = f
+	}
+
+	switch field {
+	case "id", "name":
+		if n.Op != "=" && n.Op != "!=" {
+			break
+		}
+		get := func(o *order.Order) string { return o.ID }
+		want := n.Value
+		if field == "name" {
+			get = func(o *order.Order) string { return strings.ToLower(o.Customer.Name) }
+			want = strings.ToLower(want)
+		}
+		if prefix, ok := strings.CutSuffix(want, "*"); ok {
+			n.match = negate(n.Op, func(o *order.Order) bool { return strings.HasPrefix(get(o), prefix) })
+			return "", 0
+		}
+		n.match = negate(n.Op, func(o *order.Order) bool { return get(o) == want })
+		if n.Op == "=" && field == "name" {
+			n.narrow = func(q *store.Query) { q.CustomerName = want }
+		}
+		return "", 0
+
+	case "status":
+		if n.Op != "=" && n.Op != "!=" {
+			break
+		}
+		st, err := order.ParseStatus(n.Value)
+		if err != nil {
+			return err.Error(), valueCol
+		}
+		n.match = negate(n.Op, func(o *order.Order) bool { return o.Status == st })
+		if n.Op == "=" {
+			n.narrow = func(q *store.Query) { q.Status = &st }
+		}
+		return "", 0
+
+	case "phone":
+		if n.Op != "=" && n.Op != "!=" {
+			break
+		}
+		phone, err := customer.ParsePhoneNumber(n.Value, customer.DefaultRegion)
+		if err != nil {
+			return err.(*customer.PhoneError).Reason, valueCol
+		}
+		n.match = negate(n.Op, func(o *order.Order) bool { return o.Customer.Phone == phone })
+		if n.Op == "=" {
+			n.narrow = func(q *store.Query) { q.CustomerPhone = phone }
+		}
+		return "", 0
+
+	case "country":
+		if n.Op != "=" && n.Op != "!=" {
+			break
+		}
+		want := normCountry(n.Value)
+		n.match = negate(n.Op, func(o *order.Order) bool { return country(o) == want })
+		return "", 0
+
+	case "amount":
+		m, err := money.Parse(strings.TrimPrefix(n.Value, "₹"))
+		if err != nil {
+			return fmt.Sprintf("amount must be like 500 or 499.50, not %q", n.Value), valueCol
+		}
+		n.match = ordered(n.Op, m, func(o *order.Order) money.Money { return o.Amount })
+		return "", 0
+
+	case "items":
+		c, err := strconv.Atoi(n.Value)
+		if err != nil {
+			return fmt.Sprintf("items must be a whole number, not %q", n.Value), valueCol
+		}
+		n.match = ordered(n.Op, c, func(o *order.Order) int { return len(o.Items) })
+		return "", 0
+
+	case "created", "updated":
+		from, to, err := timeRange(n.Value)
+		if err != nil {
+			return fmt.Sprintf("%s must be a date (2026-01-31) or an RFC 3339 time, not %q", field, n.Value), valueCol
+		}
+		get := func(o *order.Order) time.Time { return o.UpdatedAt }
+		if field == "created" {
+			get = func(o *order.Order) time.Time { return o.CreatedAt }
+		}
+		n.match, n.narrow = timeMatch(n.Op, from, to, get)
+		if field == "updated" {
+			n.narrow = nil
+		}
+		return "", 0
+
+	default:
+		return fmt.Sprintf("unknown field %q, use one of %s", n.Field, strings.Join(Fields, ", ")), n.Col
+	}
+	return fmt.Sprintf("%s can only be compared with ':', '=' or '!='", field), n.Col
+}
+
+func negate(op string, f func(*order.Order) bool) func(*order.Order) bool {
+	if op == "!=" {
+		return func(o *order.Order) bool { return !f(o) }
+	}
+	return f
+}
+
+func ordered[T cmp.Ordered](op string, want T, get func(*order.Order) T) func(*order.Order) bool {
+	return func(o *order.Order) bool {
+		c := cmp.Compare(get(o), want)
+		switch op {
+		case "=":
+			return c == 0
+		case "!=":
+			return c != 0
+		case "<":
+			return c < 0
+		case "<=":
+			return c <= 0
+		case ">":
+			return c > 0
+		}
+		return c >= 0
+	}
+}
+
+// timeRange reads a date as the whole day [from, to) in UTC, and an RFC
+// 3339 time as the single instant it names.
+func timeRange(s string) (from, to time.Time, err error) {
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, t.AddDate(0, 0, 1), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	return t, t.Add(time.Nanosecond), err
+}
+
+// timeMatch compares against the range [from, to), so created:>2026-01-01
+// starts on the 2nd and created:<=2026-01-01 includes all of the 1st.
+func timeMatch(op string, from, to time.Time, get func(*order.Order) time.Time) (func(*order.Order) bool, func(*store.Query)) {
+	lo, hi := time.Time{}, time.Time{} // [lo, hi), zero means open
+	switch op {
+	case "=":
+		lo, hi = from, to
+	case ">":
+		lo = to
+	case ">=":
+		lo = from
+	case "<":
+		hi = from
+	case "<=":
+		hi = to
+	case "!=":
+		return func(o *order.Order) bool {
+			t := get(o)
+			return t.Before(from) || !t.Before(to)
+		}, nil
+	}
+	match := func(o *order.Order) bool {
+		t := get(o)
+		return (lo.IsZero() || !t.Before(lo)) && (hi.IsZero() || t.Before(hi))
+	}
+	narrow := func(q *store.Query) {
+		if !lo.IsZero() && (q.CreatedFrom.IsZero() || lo.After(q.CreatedFrom)) {
+			q.CreatedFrom = lo
+		}
+		if !hi.IsZero() && (q.CreatedTo.IsZero() || hi.Before(q.CreatedTo)) {
+			q.CreatedTo = hi
+		}
+	}
+	return match, narrow
+}
@@ -0,0 +1,146 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokColon
+	tokOp // = != < <= > >=
+	tokLParen
+	tokRParen
+	tokAnd
+	tokOr
+	tokNot
+)
+
+func (k tokenKind) String() string {
+	switch k {
+	case tokEOF:
+		return "end of query"
+	case tokWord:
+		return "word"
+	case tokString:
+		return "quoted string"
+	case tokColon:
+		return "':'"
+	case tokOp:
+		return "operator"
+	case tokLParen:
+		return "'('"
+	case tokRParen:
+		return "')'"
+	case tokAnd:
+		return "AND"
+	case tokOr:
+		return "OR"
+	case tokNot:
+		return "NOT"
+	}
+	return "token"
+}
+
+type token struct {
+	kind tokenKind
+	text string // the value for words and strings, the operator for tokOp
+	col  int    // 1-based column of the first rune
+}
+
+// SyntaxError points at the column where the query went wrong.
+type SyntaxError struct {
+	Query  string
+	Column int // 1-based, in runes
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("query: column %d: %s", e.Column, e.Msg)
+}
+
+// Caret returns the query with a marker under the bad column:
+//
+//	status:prepared amount>
+//	                       ^
+func (e *SyntaxError) Caret() string {
+	return e.Query + "\n" + strings.Repeat(" ", max(e.Column-1, 0)) + "^"
+}
+
+func isWordRune(r rune) bool {
+	return !unicode.IsSpace(r) && !strings.ContainsRune(`():=!<>"`, r)
+}
+
+// lex splits q into tokens. Keywords are recognised case-insensitively
+// only as bare words, so status:"and" is still a value.
+func lex(q string) ([]token, error) {
+	rs := []rune(q)
+	var toks []token
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		col := i + 1
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			toks = append(toks, token{tokLParen, "(", col})
+			i++
+		case r == ')':
+			toks = append(toks, token{tokRParen, ")", col})
+			i++
+		case r == ':':
+			toks = append(toks, token{tokColon, ":", col})
+			i++
+		case r == '=':
+			toks = append(toks, token{tokOp, "=", col})
+			i++
+		case r == '<' || r == '>' || r == '!':
+			op := string(r)
+			if i+1 < len(rs) && rs[i+1] == '=' {
+				op += "="
+			}
+			i += len(op)
+			if op == "!" {
+				toks = append(toks, token{tokNot, op, col})
+			} else {
+				toks = append(toks, token{tokOp, op, col})
+			}
+		case r == '"':
+			var b strings.Builder
+			i++
+			for ; i < len(rs) && rs[i] != '"'; i++ {
+				if rs[i] == '\\' && i+1 < len(rs) {
+					i++
+				}
+				b.WriteRune(rs[i])
+			}
+			if i == len(rs) {
+				return nil, &SyntaxError{q, col, "unterminated quoted string"}
+			}
+			i++
+			toks = append(toks, token{tokString, b.String(), col})
+		default:
+			start := i
+			for i < len(rs) && isWordRune(rs[i]) {
+				i++
+			}
+			word := string(rs[start:i])
+			switch strings.ToUpper(word) {
+			case "AND":
+				toks = append(toks, token{tokAnd, word, col})
+			case "OR":
+				toks = append(toks, token{tokOr, word, col})
+			case "NOT":
+				toks = append(toks, token{tokNot, word, col})
+			default:
+				toks = append(toks, token{tokWord, word, col})
+			}
+		}
+	}
+	return append(toks, token{tokEOF, "", len(rs) + 1}), nil
+}
@@ -0,0 +1,167 @@
+package query
+
+import (
+	"fmt"
+
+	"github.com/rajasur/programming-learning/GO/order"
+	"github.com/rajasur/programming-learning/GO/order/store"
+)
+
+// Node is a parsed query expression.
+type Node interface {
+	Match(o *order.Order) bool
+	String() string
+}
+
+type And struct{ L, R Node }
+type Or struct{ L, R Node }
+type Not struct{ X Node }
+
+// Cmp compares one field with a literal, e.g. amount>500.
+type Cmp struct {
+	Field string
+	Op    string // = != < <= > >=
+	Value string
+	Col   int
+
+	match  func(*order.Order) bool
+	narrow func(*store.Query) // nil when no index can help
+}
+
+func (n *And) Match(o *order.Order) bool { return n.L.Match(o) && n.R.Match(o) }
+func (n *Or) Match(o *order.Order) bool  { return n.L.Match(o) || n.R.Match(o) }
+func (n *Not) Match(o *order.Order) bool { return !n.X.Match(o) }
+func (n *Cmp) Match(o *order.Order) bool { return n.match(o) }
+
+func (n *And) String() string { return "(" + n.L.String() + " AND " + n.R.String() + ")" }
+func (n *Or) String() string  { return "(" + n.L.String() + " OR " + n.R.String() + ")" }
+func (n *Not) String() string { return "NOT " + n.X.String() }
+func (n *Cmp) String() string { return fmt.Sprintf("%s%s%q", n.Field, n.Op, n.Value) }
+
+// Grammar, loosest binding first:
+//
+//	expr   = and { OR and }
+//	and    = unary { [AND] unary }      adjacent terms are ANDed
+//	unary  = (NOT | "!") unary | "(" expr ")" | cmp
+//	cmp    = field ( ":" [op] | op ) value
+//	value  = word | "quoted string"
+type parser struct {
+	q    string
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) errorf(t token, format string, args ...any) error {
+	return &SyntaxError{Query: p.q, Column: t.col, Msg: fmt.Sprintf(format, args...)}
+}
+
+func describe(t token) string {
+	switch t.kind {
+	case tokWord, tokString:
+		return fmt.Sprintf("%q", t.text)
+	case tokOp:
+		return "'" + t.text + "'"
+	}
+	return t.kind.String()
+}
+
+func (p *parser) expr() (Node, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOr {
+		p.next()
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = &Or{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (Node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch p.peek().kind {
+		case tokAnd:
+			p.next()
+		case tokWord, tokNot, tokLParen:
+			// implicit AND
+		default:
+			return left, nil
+		}
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = &And{left, right}
+	}
+}
+
+func (p *parser) unary() (Node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNot:
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{x}, nil
+	case tokLParen:
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if c := p.next(); c.kind != tokRParen {
+			if c.kind == tokEOF {
+				return nil, p.errorf(t, "'(' is never closed")
+			}
+			return nil, p.errorf(c, "expected ')', found %s", describe(c))
+		}
+		return x, nil
+	case tokWord:
+		return p.cmp(t)
+	case tokEOF:
+		return nil, p.errorf(t, "expected a condition such as status:prepared")
+	}
+	return nil, p.errorf(t, "expected a field name, found %s", describe(t))
+}
+
+func (p *parser) cmp(field token) (Node, error) {
+	op := "="
+	switch t := p.next(); t.kind {
+	case tokColon:
+		if p.peek().kind == tokOp {
+			op = p.next().text
+		}
+	case tokOp:
+		op = t.text
+	default:
+		return nil, p.errorf(t, "expected ':' or an operator after %q", field.text)
+	}
+
+	v := p.next()
+	if v.kind != tokWord && v.kind != tokString {
+		return nil, p.errorf(v, "expected a value for %s, found %s", field.text, describe(v))
+	}
+	n := &Cmp{Field: field.text, Op: op, Value: v.text, Col: field.col}
+	if msg, col := compile(n, v.col); msg != "" {
+		return nil, &SyntaxError{Query: p.q, Column: col, Msg: msg}
+	}
+	return n, nil
+}
@@ -0,0 +1,101 @@
+// Package query parses and runs the filter language support staff use to
+// find orders, for example
+//
+//	status:prepared country:India amount>500 created:>2026-01-01
+//	(status:received OR status:confirmed) AND NOT name:"test*"
+//
+// A condition is field:value, field:<op>value or field<op>value with op
+// one of = != < <= > >=. Conditions next to each other are ANDed; AND, OR,
+// NOT (or !) and parentheses combine them, with NOT binding tightest and
+// OR loosest. Dates are whole days in UTC; times with a ':' must be
+// quoted. A trailing * on id or name matches a prefix.
+package query
+
+import (
+	"github.com/rajasur/programming-learning/GO/order"
+	"github.com/rajasur/programming-learning/GO/order/store"
+)
+
+// Query is a parsed query. The zero Query matches every order.
+type Query struct {
+	Source string
+	Root   Node // nil matches everything
+}
+
+// Parse parses s. Errors are *SyntaxError.
+func Parse(s string) (*Query, error) {
+	toks, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+	q := &Query{Source: s}
+	if toks[0].kind == tokEOF {
+		return q, nil
+	}
+	p := &parser{q: s, toks: toks}
+	if q.Root, err = p.expr(); err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		if t.kind == tokRParen {
+			return nil, p.errorf(t, "')' without a matching '('")
+		}
+		return nil, p.errorf(t, "unexpected %s", describe(t))
+	}
+	return q, nil
+}
+
+func (q *Query) String() string {
+	if q.Root == nil {
+		return ""
+	}
+	return q.Root.String()
+}
+
+// Match reports whether o satisfies the query.
+func (q *Query) Match(o *order.Order) bool {
+	return q.Root == nil || q.Root.Match(o)
+}
+
+// Filter returns the orders that match, keeping their order.
+func (q *Query) Filter(orders []*order.Order) []*order.Order {
+	var out []*order.Order
+	for _, o := range orders {
+		if q.Match(o) {
+			out = append(out, o)
+		}
+	}
+	return out
+}
+
+// Index returns a store query that finds a superset of the matching
+// orders, built from the conditions every match must satisfy (those ANDed
+// at the top level). The store can then pick an index from it; Match
+// still has to be applied to what comes back.
+func (q *Query) Index() store.Query {
+	var sq store.Query
+	var walk func(n Node)
+	walk = func(n Node) {
+		switch n := n.(type) {
+		case *And:
+			walk(n.L)
+			walk(n.R)
+		case *Cmp:
+			if n.narrow != nil {
+				n.narrow(&sq)
+			}
+		}
+	}
+	walk(q.Root)
+	return sq
+}
+
+// Find runs q against st, letting the store narrow the candidates with
+// an index first.
+func (q *Query) Find(st store.OrderStore) ([]*order.Order, error) {
+	orders, err := st.Find(q.Index())
+	if err != nil {
+		return nil, err
+	}
+	return q.Filter(orders), nil
+}
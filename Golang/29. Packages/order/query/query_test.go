@@ -0,0 +1,344 @@
+package query
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/customer"
+	"github.com/rajasur/programming-learning/GO/money"
+	"github.com/rajasur/programming-learning/GO/order"
+	"github.com/rajasur/programming-learning/GO/order/store"
+)
+
+func day(month time.Month, d int) time.Time {
+	return time.Date(2026, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestLex(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want []token
+	}{
+		{"", []token{{tokEOF, "", 1}}},
+		{"status:prepared", []token{{tokWord, "status", 1}, {tokColon, ":", 7}, {tokWord, "prepared", 8}, {tokEOF, "", 16}}},
+		{"amount>=500", []token{{tokWord, "amount", 1}, {tokOp, ">=", 7}, {tokWord, "500", 9}, {tokEOF, "", 12}}},
+		{"a<b c<=d e>f g=h", []token{
+			{tokWord, "a", 1}, {tokOp, "<", 2}, {tokWord, "b", 3},
+			{tokWord, "c", 5}, {tokOp, "<=", 6}, {tokWord, "d", 8},
+			{tokWord, "e", 10}, {tokOp, ">", 11}, {tokWord, "f", 12},
+			{tokWord, "g", 14}, {tokOp, "=", 15}, {tokWord, "h", 16},
+			{tokEOF, "", 17},
+		}},
+		{`name!="x y"`, []token{{tokWord, "name", 1}, {tokOp, "!=", 5}, {tokString, "x y", 7}, {tokEOF, "", 12}}},
+		{"!(a:b)", []token{{tokNot, "!", 1}, {tokLParen, "(", 2}, {tokWord, "a", 3}, {tokColon, ":", 4}, {tokWord, "b", 5}, {tokRParen, ")", 6}, {tokEOF, "", 7}}},
+		{"a and B Or not c", []token{{tokWord, "a", 1}, {tokAnd, "and", 3}, {tokWord, "B", 7}, {tokOr, "Or", 9}, {tokNot, "not", 12}, {tokWord, "c", 16}, {tokEOF, "", 17}}},
+		// keywords are only keywords as bare words
+		{`status:"and" android`, []token{{tokWord, "status", 1}, {tokColon, ":", 7}, {tokString, "and", 8}, {tokWord, "android", 14}, {tokEOF, "", 21}}},
+		{`"say \"hi\" \\"`, []token{{tokString, `say "hi" \`, 1}, {tokEOF, "", 16}}},
+		{`""`, []token{{tokString, "", 1}, {tokEOF, "", 3}}},
+		// columns count runes, not bytes
+		{"amount<₹5 id:x", []token{{tokWord, "amount", 1}, {tokOp, "<", 7}, {tokWord, "₹5", 8}, {tokWord, "id", 11}, {tokColon, ":", 13}, {tokWord, "x", 14}, {tokEOF, "", 15}}},
+		{" \t(\n)", []token{{tokLParen, "(", 3}, {tokRParen, ")", 5}, {tokEOF, "", 6}}},
+	} {
+		got, err := lex(tc.in)
+		if err != nil || !slices.Equal(got, tc.want) {
+			t.Errorf("lex(%q) = %v, %v\nwant %v", tc.in, got, err, tc.want)
+		}
+	}
+
+	for _, in := range []string{`name:"abc`, `name:"abc\"`} {
+		_, err := lex(in)
+		var se *SyntaxError
+		if !errors.As(err, &se) || se.Column != 6 || se.Msg != "unterminated quoted string" {
+			t.Errorf("lex(%q) = %v, want an unterminated string at column 6", in, err)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"  ", ""},
+		{"status:prepared", `status="prepared"`},
+		{"Status = Received", `Status="Received"`},
+		{"amount:>=500", `amount>="500"`},
+		{"amount>=500", `amount>="500"`},
+		{`name:"and"`, `name="and"`},
+		{"created_at:2026-01-01", `created_at="2026-01-01"`},
+		{"status:prepared amount>500", `(status="prepared" AND amount>"500")`},
+		{"id:a id:b id:c", `((id="a" AND id="b") AND id="c")`},
+		{"id:a and id:b", `(id="a" AND id="b")`},
+		// OR binds loosest, NOT tightest
+		{"status:received OR status:confirmed amount>5", `(status="received" OR (status="confirmed" AND amount>"5"))`},
+		{"NOT status:received country:in", `(NOT status="received" AND country="in")`},
+		{"!(status:received OR id:o1)", `NOT (status="received" OR id="o1")`},
+		{"NOT NOT id:x", `NOT NOT id="x"`},
+		{"id:a OR id:b OR id:c", `((id="a" OR id="b") OR id="c")`},
+		{`(status:received OR status:confirmed) AND NOT name:"test*"`, `((status="received" OR status="confirmed") AND NOT name="test*")`},
+	} {
+		q, err := Parse(tc.in)
+		if err != nil {
+			t.Errorf("Parse(%q) = %v", tc.in, err)
+			continue
+		}
+		if got := q.String(); got != tc.want {
+			t.Errorf("Parse(%q) = %s, want %s", tc.in, got, tc.want)
+		}
+		if q.Source != tc.in {
+			t.Errorf("Parse(%q).Source = %q", tc.in, q.Source)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		in  string
+		col int
+		msg string
+	}{
+		{`name:"abc`, 6, "unterminated quoted string"},
+		{"status", 7, `expected ':' or an operator after "status"`},
+		{"status prepared", 8, `expected ':' or an operator after "status"`},
+		{"status:", 8, "expected a value for status, found end of query"},
+		{"status:prepared amount>", 24, "expected a value for amount, found end of query"},
+		{"id:=", 5, "expected a value for id, found end of query"},
+		{"id:(x)", 4, "expected a value for id, found '('"},
+		{"amount>>5", 8, "expected a value for amount, found '>'"},
+		{"id:a OR", 8, "expected a condition such as status:prepared"},
+		{"NOT", 4, "expected a condition such as status:prepared"},
+		{"AND id:a", 1, "expected a field name, found AND"},
+		{"id:a OR OR id:b", 9, "expected a field name, found OR"},
+		{":x", 1, "expected a field name, found ':'"},
+		{`"id":x`, 1, `expected a field name, found "id"`},
+		{"(id:a", 1, "'(' is never closed"},
+		{"id:b (id:a OR (id:c)", 6, "'(' is never closed"},
+		{`(id:a "b")`, 7, `expected ')', found "b"`},
+		{"id:a)", 5, "')' without a matching '('"},
+		{`id:a "b"`, 6, `unexpected "b"`},
+		{"id:a =", 6, "unexpected '='"},
+		{"colour:red", 1, `unknown field "colour", use one of id, status, name, phone, country, amount, items, created, updated`},
+		{"id:1 status>received", 6, "status can only be compared with ':', '=' or '!='"},
+		{"name<=b", 1, "name can only be compared with ':', '=' or '!='"},
+		{"customer>b", 1, "name can only be compared with ':', '=' or '!='"},
+		{"status:shipped", 8, `unknown order status "shipped", valid values are: received, confirmed, prepared, delivered, cancelled, refunded, failed`},
+		{"phone:12345", 7, "wrong number of digits for IN"},
+		{"amount>abc", 8, `amount must be like 500 or 499.50, not "abc"`},
+		{"amount>5.001", 8, `amount must be like 500 or 499.50, not "5.001"`},
+		{"items:two", 7, `items must be a whole number, not "two"`},
+		{"created:yesterday", 9, `created must be a date (2026-01-31) or an RFC 3339 time, not "yesterday"`},
+		{`updated<"2026-01-01T10:00"`, 9, `updated must be a date (2026-01-31) or an RFC 3339 time, not "2026-01-01T10:00"`},
+		// columns are in runes
+		{"name:₹ status:x", 15, `unknown order status "x", valid values are: received, confirmed, prepared, delivered, cancelled, refunded, failed`},
+	} {
+		q, err := Parse(tc.in)
+		var se *SyntaxError
+		if !errors.As(err, &se) {
+			t.Errorf("Parse(%q) = %v, %v, want a *SyntaxError", tc.in, q, err)
+			continue
+		}
+		if se.Column != tc.col || se.Msg != tc.msg || se.Query != tc.in {
+			t.Errorf("Parse(%q) = column %d: %q, want column %d: %q", tc.in, se.Column, se.Msg, tc.col, tc.msg)
+		}
+	}
+
+	_, err := Parse("status:prepared amount>")
+	if want := "query: column 24: expected a value for amount, found end of query"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err, want)
+	}
+	want := "status:prepared amount>\n" + strings.Repeat(" ", 23) + "^"
+	if got := err.(*SyntaxError).Caret(); got != want {
+		t.Errorf("Caret() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+// testOrders returns:
+//
+//	o1  Raja       IN  received   ₹500.00  2 items  created 1 Jan 10:00, updated 1 Mar
+//	o2  Test user  IN  confirmed  ₹499.50  0 items  created 2 Jan
+//	o3  Jo         US  prepared  ₹1000.00  0 items  created 1 Feb
+func testOrders(t *testing.T) []*order.Order {
+	t.Helper()
+	in, err := customer.ParsePhoneNumber("+91 98765 43210", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	us, err := customer.ParsePhoneNumber("+1 415 555 0132", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var orders []*order.Order
+	for _, o := range []struct {
+		id      string
+		c       customer.Customer
+		status  order.Status
+		amount  money.Money
+		created time.Time
+	}{
+		{"o1", customer.Customer{Name: "Raja", Phone: in, Country: "IN"}, order.Received, 50000, day(time.January, 1).Add(10 * time.Hour)},
+		{"o2", customer.Customer{Name: "Test user", Country: "India"}, order.Confirmed, 49950, day(time.January, 2)},
+		{"o3", customer.Customer{Name: "Jo", Phone: us}, order.Prepared, 100000, day(time.February, 1)},
+	} {
+		created := o.created
+		ord, err := order.New(o.id, o.amount, o.status, o.c, order.WithClock(func() time.Time { return created }))
+		if err != nil {
+			t.Fatal(err)
+		}
+		orders = append(orders, ord)
+	}
+	orders[0].Items = []order.LineItem{{SKU: "pen", Quantity: 1}, {SKU: "ink", Quantity: 1}}
+	orders[0].UpdatedAt = day(time.March, 1)
+	return orders
+}
+
+func ids(orders []*order.Order) []string {
+	out := []string{}
+	for _, o := range orders {
+		out = append(out, o.ID)
+	}
+	return out
+}
+
+func TestMatch(t *testing.T) {
+	orders := testOrders(t)
+	for _, tc := range []struct {
+		in   string
+		want []string
+	}{
+		{"", []string{"o1", "o2", "o3"}},
+		{"status:received", []string{"o1"}},
+		{"status:RECEIVED", []string{"o1"}},
+		{"status!=received", []string{"o2", "o3"}},
+		{"country:India", []string{"o1", "o2"}},
+		{"country:IN", []string{"o1", "o2"}},
+		{"country:usa", []string{"o3"}}, // from the phone number
+		{"country!=in", []string{"o3"}},
+		{"name:raja", []string{"o1"}},
+		{"customer:RAJA", []string{"o1"}},
+		{`name:"test user"`, []string{"o2"}},
+		{"name:test*", []string{"o2"}},
+		{`NOT name:"test*"`, []string{"o1", "o3"}},
+		{"name!=jo", []string{"o1", "o2"}},
+		{"id:o*", []string{"o1", "o2", "o3"}},
+		{"id:o2", []string{"o2"}},
+		{"id:O2", []string{}},
+		{`phone:"+91 98765 43210"`, []string{"o1"}},
+		{"phone:09876543210", []string{"o1"}},
+		{"phone!=09876543210", []string{"o2", "o3"}},
+		{"amount>500", []string{"o3"}},
+		{"amount>=500", []string{"o1", "o3"}},
+		{"amount=₹500", []string{"o1"}},
+		{"amount<=499.50", []string{"o2"}},
+		{"amount!=499.5", []string{"o1", "o3"}},
+		{"amount<500", []string{"o2"}},
+		{"items>0", []string{"o1"}},
+		{"items:0", []string{"o2", "o3"}},
+		{"items>=2", []string{"o1"}},
+		{"created:2026-01-01", []string{"o1"}},
+		{"created:>2026-01-01", []string{"o2", "o3"}},
+		{"created>=2026-01-02", []string{"o2", "o3"}},
+		{"created<=2026-01-01", []string{"o1"}},
+		{"created<2026-01-02", []string{"o1"}},
+		{"created!=2026-01-02", []string{"o1", "o3"}},
+		{`created>="2026-01-01T10:00:00Z"`, []string{"o1", "o2", "o3"}},
+		{`created>"2026-01-01T10:00:00Z"`, []string{"o2", "o3"}},
+		{`created="2026-01-01T15:30:00+05:30"`, []string{"o1"}},
+		{"updated>2026-01-15", []string{"o1", "o3"}},
+		{"updated_at:2026-01-02", []string{"o2"}},
+		{`(status:received OR status:confirmed) AND NOT name:"test*"`, []string{"o1"}},
+		{"status:received OR amount>500 country:us", []string{"o1", "o3"}},
+		{"!(country:in) OR items>1", []string{"o1", "o3"}},
+	} {
+		q, err := Parse(tc.in)
+		if err != nil {
+			t.Errorf("Parse(%q) = %v", tc.in, err)
+			continue
+		}
+		if got := ids(q.Filter(orders)); !slices.Equal(got, tc.want) {
+			t.Errorf("%s matches %v, want %v", tc.in, got, tc.want)
+		}
+	}
+	if (&Query{}).Match(orders[0]) != true {
+		t.Error("the zero Query does not match")
+	}
+}
+
+func TestIndex(t *testing.T) {
+	phone, _ := customer.ParsePhoneNumber("09876543210", "IN")
+	for _, tc := range []struct {
+		in   string
+		want store.Query
+	}{
+		{"", store.Query{}},
+		{"status:prepared", store.Query{Status: store.StatusPtr(order.Prepared)}},
+		{"status!=prepared", store.Query{}},
+		{"name:Raja", store.Query{CustomerName: "raja"}},
+		{"name:ra*", store.Query{}},
+		{"name!=raja", store.Query{}},
+		{"phone:09876543210", store.Query{CustomerPhone: phone}},
+		{"created:2026-01-01", store.Query{CreatedFrom: day(time.January, 1), CreatedTo: day(time.January, 2)}},
+		{"created>2026-01-01 created<2026-02-01", store.Query{CreatedFrom: day(time.January, 2), CreatedTo: day(time.February, 1)}},
+		// the tighter bound wins, in either order
+		{"created>=2026-01-05 created>2026-01-01", store.Query{CreatedFrom: day(time.January, 5)}},
+		{"created>2026-01-01 created>=2026-01-05", store.Query{CreatedFrom: day(time.January, 5)}},
+		{"created<=2026-01-31 created<2026-03-01", store.Query{CreatedTo: day(time.February, 1)}},
+		{"created!=2026-01-01", store.Query{}},
+		{"updated>2026-01-01", store.Query{}},
+		{"amount>5 items:1 country:in id:o1", store.Query{}},
+		// only conditions every match must satisfy narrow the search
+		{"status:received OR status:confirmed", store.Query{}},
+		{"NOT status:received", store.Query{}},
+		{"(status:received name:raja) OR id:x", store.Query{}},
+		{"status:received (name:raja (created:2026-01-01 OR id:x))", store.Query{Status: store.StatusPtr(order.Received), CustomerName: "raja"}},
+		{"status:received name:raja phone:09876543210 created:2026-01-01", store.Query{
+			Status: store.StatusPtr(order.Received), CustomerName: "raja", CustomerPhone: phone,
+			CreatedFrom: day(time.January, 1), CreatedTo: day(time.January, 2),
+		}},
+	} {
+		q, err := Parse(tc.in)
+		if err != nil {
+			t.Errorf("Parse(%q) = %v", tc.in, err)
+			continue
+		}
+		if got := q.Index(); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: Index = %+v, want %+v", tc.in, got, tc.want)
+		}
+	}
+}
+
+// Find narrows with the index and then filters, giving what Filter gives
+// on every order.
+func TestFind(t *testing.T) {
+	orders := testOrders(t)
+	st := store.NewMemoryStore()
+	for _, o := range orders {
+		if err := st.Create(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, in := range []string{
+		"",
+		"status:received OR amount>500",
+		"name:RAJA created:2026-01-01",
+		"phone:09876543210 status:received",
+		"created>2026-01-01 NOT name:jo",
+		"status:delivered",
+	} {
+		q, err := Parse(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := q.Find(st)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := ids(q.Filter(orders)); !slices.Equal(ids(got), want) {
+			t.Errorf("Find(%s) = %v, want %v", in, ids(got), want)
+		}
+	}
+}
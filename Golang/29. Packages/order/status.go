@@ -0,0 +1,282 @@
+// Package order models customer orders and the rules for moving them
+// through their lifecycle.
+package order
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/enum"
+)
+
+// Status is where an order is in its lifecycle.
+type Status int
+
+const (
+	Received Status = iota
+	Confirmed
+	Prepared
+	Delivered
+	Cancelled
+	Refunded
+	Failed
+)
+
+// AnyStatus matches every status when registering guards and hooks.
+const AnyStatus Status = -1
+
+var statuses = enum.New("order status", map[Status]string{
+	Received:  "received",
+	Confirmed: "confirmed",
+	Prepared:  "prepared",
+	Delivered: "delivered",
+	Cancelled: "cancelled",
+	Refunded:  "refunded",
+	Failed:    "failed",
+})
+
+// ParseStatus parses a status name, ignoring case.
+func ParseStatus(s string) (Status, error) {
+	return statuses.Parse(s)
+}
+
+// Statuses lists every valid status in lifecycle order.
+func Statuses() []Status {
+	return statuses.Values()
+}
+
+func (s Status) String() string {
+	if s == AnyStatus {
+		return "any"
+	}
+	return statuses.Name(s)
+}
+
+// Valid reports whether s is one of the declared statuses.
+func (s Status) Valid() bool {
+	return statuses.Valid(s)
+}
+
+func (s Status) MarshalText() ([]byte, error) {
+	return statuses.MarshalText(s)
+}
+
+func (s *Status) UnmarshalText(b []byte) error {
+	return statuses.UnmarshalText(b, s)
+}
+
+func (s Status) MarshalJSON() ([]byte, error) {
+	return statuses.EncodeJSON(s)
+}
+
+func (s *Status) UnmarshalJSON(b []byte) error {
+	return statuses.DecodeJSON(b, s)
+}
+
+// DefaultTransitions lists the moves allowed out of each status. Delivered,
+// Refunded and Failed orders can't go backwards.
+var DefaultTransitions = map[Status][]Status{
+	Received:  {Confirmed, Cancelled, Failed},
+	Confirmed: {Prepared, Cancelled, Failed},
+	Prepared:  {Delivered, Cancelled, Failed},
+	Delivered: {Refunded},
+	Cancelled: {Refunded},
+	Refunded:  {},
+	Failed:    {},
+}
+
+var ErrIllegalTransition = errors.New("order: illegal status transition")
+
+// TransitionError is returned when a move is not in the table or a guard
+// rejects it.
+type TransitionError struct {
+	From, To Status
+	Reason   error // set when a guard refused the move
+}
+
+func (e *TransitionError) Error() string {
+	if e.Reason != nil {
+		return fmt.Sprintf("order: status %v -> %v refused: %v", e.From, e.To, e.Reason)
+	}
+	return fmt.Sprintf("order: illegal status transition %v -> %v", e.From, e.To)
+}
+
+func (e *TransitionError) Unwrap() error {
+	if e.Reason != nil {
+		return e.Reason
+	}
+	return ErrIllegalTransition
+}
+
+// StatusChange records one transition.
+type StatusChange struct {
+	OrderID string    `json:"order_id"`
+	From    Status    `json:"from"`
+	To      Status    `json:"to"`
+	At      time.Time `json:"at"`
+	Actor   string    `json:"actor"`
+}
+
+// Guard can veto a transition by returning an error.
+type Guard func(StatusChange) error
+
+// Hook runs after a transition has been saved.
+type Hook func(StatusChange)
+
+type edge struct {
+	from, to Status
+}
+
+// StatusMachine holds the transition table together with guards and hooks.
+// One machine is normally shared by all orders.
+type StatusMachine struct {
+	mu     sync.RWMutex
+	next   map[Status][]Status
+	guards map[edge][]Guard
+	hooks  map[edge][]Hook
+	now    func() time.Time
+}
+
+// DefaultStatusMachine uses DefaultTransitions and is what a Lifecycle
+// without its own machine uses.
+var DefaultStatusMachine = NewStatusMachine(DefaultTransitions)
+
+// NewStatusMachine creates a machine for the given transition table.
+func NewStatusMachine(transitions map[Status][]Status) *StatusMachine {
+	next := make(map[Status][]Status, len(transitions))
+	for from, to := range transitions {
+		next[from] = slices.Clone(to)
+	}
+	return &StatusMachine{
+		next:   next,
+		guards: make(map[edge][]Guard),
+		hooks:  make(map[edge][]Hook),
+		now:    time.Now,
+	}
+}
+
+// SetClock replaces time.Now for the timestamps of status changes.
+func (m *StatusMachine) SetClock(now func() time.Time) {
+	m.mu.Lock()
+	m.now = now
+	m.mu.Unlock()
+}
+
+// AddGuard registers g for moves from -> to. Either side can be AnyStatus.
+func (m *StatusMachine) AddGuard(from, to Status, g Guard) {
+	m.mu.Lock()
+	m.guards[edge{from, to}] = append(m.guards[edge{from, to}], g)
+	m.mu.Unlock()
+}
+
+// OnTransition registers h to run after moves from -> to have been saved,
+// see Notify. Either side can be AnyStatus.
+func (m *StatusMachine) OnTransition(from, to Status, h Hook) {
+	m.mu.Lock()
+	m.hooks[edge{from, to}] = append(m.hooks[edge{from, to}], h)
+	m.mu.Unlock()
+}
+
+// Can reports whether the table allows from -> to, without running guards.
+func (m *StatusMachine) Can(from, to Status) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return slices.Contains(m.next[from], to)
+}
+
+// Next returns the statuses reachable from s in one step.
+func (m *StatusMachine) Next(s Status) []Status {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return slices.Clone(m.next[s])
+}
+
+// Transition checks the move from -> to for order id and runs the guards.
+// It returns the change for the caller to record; the hooks don't run
+// until the caller passes the change to Notify once it has been saved.
+func (m *StatusMachine) Transition(id string, from, to Status, actor string) (StatusChange, error) {
+	m.mu.RLock()
+	allowed := slices.Contains(m.next[from], to)
+	var guards []Guard
+	for _, e := range edges(from, to) {
+		guards = append(guards, m.guards[e]...)
+	}
+	now := m.now
+	m.mu.RUnlock()
+
+	if !allowed {
+		return StatusChange{}, &TransitionError{From: from, To: to}
+	}
+
+	change := StatusChange{OrderID: id, From: from, To: to, At: now(), Actor: actor}
+	for _, g := range guards {
+		if err := g(change); err != nil {
+			return StatusChange{}, &TransitionError{From: from, To: to, Reason: err}
+		}
+	}
+	return change, nil
+}
+
+// Notify runs the hooks registered for c's move. Call it after the order
+// holding c has been saved, so hooks never act on a move that didn't stick.
+func (m *StatusMachine) Notify(c StatusChange) {
+	m.mu.RLock()
+	var hooks []Hook
+	for _, e := range edges(c.From, c.To) {
+		hooks = append(hooks, m.hooks[e]...)
+	}
+	m.mu.RUnlock()
+
+	for _, h := range hooks {
+		h(c)
+	}
+}
+
+// edges lists where guards and hooks for from -> to are registered: the
+// exact edge first, then the wildcards.
+func edges(from, to Status) []edge {
+	return []edge{{from, to}, {from, AnyStatus}, {AnyStatus, to}, {AnyStatus, AnyStatus}}
+}
+
+// Lifecycle is the current status of one order and the changes that led
+// to it.
+type Lifecycle struct {
+	Status  Status         `json:"status"`
+	History []StatusChange `json:"history,omitempty"`
+
+	machine *StatusMachine
+}
+
+// UseMachine makes l follow m's rules instead of DefaultStatusMachine.
+func (l *Lifecycle) UseMachine(m *StatusMachine) {
+	l.machine = m
+}
+
+func (l *Lifecycle) statusMachine() *StatusMachine {
+	if l.machine == nil {
+		return DefaultStatusMachine
+	}
+	return l.machine
+}
+
+// Transition moves the order to status to on behalf of actor and records
+// the change. The status is left alone when an error is returned. Hooks
+// run later, when the saved change is passed to Notify.
+func (l *Lifecycle) Transition(id string, to Status, actor string) error {
+	change, err := l.statusMachine().Transition(id, l.Status, to, actor)
+	if err != nil {
+		return err
+	}
+	l.Status = to
+	l.History = append(l.History, change)
+	return nil
+}
+
+// Notify runs the hooks of l's status machine for c, which should be a
+// change from l's history that has since been saved.
+func (l *Lifecycle) Notify(c StatusChange) {
+	l.statusMachine().Notify(c)
+}
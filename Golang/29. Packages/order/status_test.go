@@ -0,0 +1,174 @@
+package order
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/customer"
+)
+
+func TestDefaultTransitions(t *testing.T) {
+	m := NewStatusMachine(DefaultTransitions)
+	for _, from := range Statuses() {
+		for _, to := range Statuses() {
+			want := slices.Contains(DefaultTransitions[from], to)
+			if got := m.Can(from, to); got != want {
+				t.Errorf("Can(%v, %v) = %v, want %v", from, to, got, want)
+			}
+			_, err := m.Transition("o1", from, to, "test")
+			if want != (err == nil) {
+				t.Errorf("Transition(%v, %v) error = %v", from, to, err)
+			}
+		}
+	}
+	for _, s := range []Status{Refunded, Failed} {
+		if n := m.Next(s); len(n) != 0 {
+			t.Errorf("Next(%v) = %v, want none", s, n)
+		}
+	}
+}
+
+func TestTransitionErrors(t *testing.T) {
+	m := NewStatusMachine(DefaultTransitions)
+
+	_, err := m.Transition("o1", Delivered, Received, "test")
+	var te *TransitionError
+	if !errors.As(err, &te) || te.From != Delivered || te.To != Received || te.Reason != nil {
+		t.Fatalf("illegal move: %#v", err)
+	}
+	if !errors.Is(err, ErrIllegalTransition) {
+		t.Errorf("%v is not ErrIllegalTransition", err)
+	}
+	if want := "order: illegal status transition delivered -> received"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err, want)
+	}
+
+	errStock := errors.New("out of stock")
+	m.AddGuard(Received, Confirmed, func(StatusChange) error { return errStock })
+	_, err = m.Transition("o1", Received, Confirmed, "test")
+	if !errors.As(err, &te) || te.Reason != errStock {
+		t.Fatalf("guarded move: %#v", err)
+	}
+	if !errors.Is(err, errStock) || errors.Is(err, ErrIllegalTransition) {
+		t.Errorf("guard error %v should unwrap to the reason only", err)
+	}
+	if want := "order: status received -> confirmed refused: out of stock"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err, want)
+	}
+}
+
+func TestGuardsAndHooks(t *testing.T) {
+	m := NewStatusMachine(DefaultTransitions)
+	at := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	m.SetClock(func() time.Time { return at })
+
+	var calls []string
+	m.AddGuard(AnyStatus, Cancelled, func(c StatusChange) error {
+		calls = append(calls, "guard any->cancelled")
+		if c.Actor != "admin" {
+			return fmt.Errorf("%s may not cancel", c.Actor)
+		}
+		return nil
+	})
+	m.OnTransition(Received, Cancelled, func(StatusChange) { calls = append(calls, "hook exact") })
+	m.OnTransition(AnyStatus, AnyStatus, func(StatusChange) { calls = append(calls, "hook any") })
+
+	if _, err := m.Transition("o1", Received, Cancelled, "bot"); err == nil {
+		t.Fatal("guard did not refuse")
+	}
+	if !slices.Equal(calls, []string{"guard any->cancelled"}) {
+		t.Errorf("hooks ran after a refusal: %v", calls)
+	}
+
+	calls = nil
+	c, err := m.Transition("o1", Received, Cancelled, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := StatusChange{OrderID: "o1", From: Received, To: Cancelled, At: at, Actor: "admin"}
+	if c != want {
+		t.Errorf("change = %+v, want %+v", c, want)
+	}
+	if !slices.Equal(calls, []string{"guard any->cancelled"}) {
+		t.Errorf("hooks ran before the change was saved: %v", calls)
+	}
+	m.Notify(c)
+	if !slices.Equal(calls, []string{"guard any->cancelled", "hook exact", "hook any"}) {
+		t.Errorf("calls = %v", calls)
+	}
+}
+
+// Hooks of an order's machine only run when the caller notifies them, so
+// a change that is never saved never reaches them.
+func TestLifecycleNotify(t *testing.T) {
+	m := NewStatusMachine(DefaultTransitions)
+	var seen []StatusChange
+	m.OnTransition(AnyStatus, AnyStatus, func(c StatusChange) { seen = append(seen, c) })
+	o, err := New("o1", 1000, Received, customer.Customer{Name: "Raja"}, WithStatusMachine(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Confirm("shop"); err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 0 {
+		t.Fatalf("hooks ran during Confirm: %+v", seen)
+	}
+	o.Notify(o.History[0])
+	if len(seen) != 1 || seen[0].To != Confirmed {
+		t.Errorf("hooks saw %+v", seen)
+	}
+}
+
+func TestOrderLifecycle(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { now = now.Add(time.Minute); return now }
+	m := NewStatusMachine(DefaultTransitions)
+	m.SetClock(clock)
+
+	o, err := New("o1", 1000, Received, customer.Customer{Name: "Raja"}, WithClock(clock), WithStatusMachine(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, step := range []func(string) error{o.Confirm, o.Prepare, o.Deliver, o.Refund} {
+		if err := step("test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !o.IsFinal() || len(o.History) != 4 || o.UpdatedAt != now {
+		t.Errorf("after refund: final=%v history=%d updated=%v", o.IsFinal(), len(o.History), o.UpdatedAt)
+	}
+	if err := o.Cancel("test"); !errors.Is(err, ErrIllegalTransition) {
+		t.Errorf("Cancel after refund: %v", err)
+	}
+	if o.Status != Refunded || len(o.History) != 4 {
+		t.Errorf("failed transition changed the order: %v, %d changes", o.Status, len(o.History))
+	}
+}
+
+func TestStatusText(t *testing.T) {
+	for _, s := range Statuses() {
+		b, err := json.Marshal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var back Status
+		if err := json.Unmarshal(b, &back); err != nil || back != s {
+			t.Errorf("%v round-tripped through %s as %v, %v", s, b, back, err)
+		}
+	}
+	if s, err := ParseStatus("Confirmed"); err != nil || s != Confirmed {
+		t.Errorf("ParseStatus(Confirmed) = %v, %v", s, err)
+	}
+	var s Status
+	if err := json.Unmarshal([]byte(`"shipped"`), &s); err == nil {
+		t.Error("unknown status accepted")
+	}
+	if Status(42).Valid() || AnyStatus.Valid() {
+		t.Error("Valid accepts undeclared statuses")
+	}
+}
@@ -0,0 +1,247 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/internal/recordlog"
+	"github.com/rajasur/programming-learning/GO/order"
+)
+
+var ErrCorrupt = errors.New("store: log is corrupt")
+
+// FileOptions tunes a FileStore. The zero value is usable.
+type FileOptions struct {
+	// NoSync skips fsync after every write. Faster, but the last writes can
+	// be lost if the machine (not just the process) crashes.
+	NoSync bool
+	// Compaction runs once the log holds at least MinCompactRecords records
+	// and more than twice as many records as live orders. Default 1000.
+	MinCompactRecords int
+	// CompactInterval also compacts in the background on a timer when set.
+	CompactInterval time.Duration
+	// Logf reports compaction failures, which never fail the write that
+	// triggered them. Default log.Printf.
+	Logf func(format string, args ...any)
+}
+
+// FileStore keeps every order in memory and makes changes durable in an
+// append-only log of checksummed JSON records:
+//
+//	<crc32 as 8 hex digits> <json>\n
+//
+// A torn record at the end of the log (the process died mid write) is cut
+// off when the store is opened. Compaction rewrites the log with one record
+// per live order into a temporary file and renames it into place, so a
+// crash during compaction leaves the old log intact.
+type FileStore struct {
+	mu      sync.Mutex // serializes writes and compaction
+	log     *recordlog.File
+	mem     *MemoryStore
+	records int
+	opts    FileOptions
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type logRecord struct {
+	Op    string       `json:"op"` // "put" or "del"
+	ID    string       `json:"id,omitempty"`
+	Order *order.Order `json:"order,omitempty"`
+}
+
+// OpenFile opens the log at path, creating it if needed, and replays it.
+func OpenFile(path string, opts FileOptions) (*FileStore, error) {
+	if opts.MinCompactRecords <= 0 {
+		opts.MinCompactRecords = 1000
+	}
+	if opts.Logf == nil {
+		opts.Logf = log.Printf
+	}
+
+	// Replay fills the order map alone and indexes it once at the end.
+	s := &FileStore{mem: NewMemoryStore(), opts: opts}
+	orders := s.mem.orders
+	l, err := recordlog.Open(path, opts.NoSync, func(rec logRecord, _ int64, _ int) error {
+		switch {
+		case rec.Op == "put" && rec.Order != nil:
+			orders[rec.Order.ID] = rec.Order
+		case rec.Op == "del" && rec.ID != "":
+			delete(orders, rec.ID)
+		default:
+			return recordlog.ErrCorrupt
+		}
+		s.records++
+		return nil
+	})
+	if errors.Is(err, recordlog.ErrCorrupt) {
+		return nil, fmt.Errorf("%w: %w", ErrCorrupt, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.log = l
+	s.mem.ix.rebuild(orders)
+
+	if opts.CompactInterval > 0 {
+		s.stop, s.done = make(chan struct{}), make(chan struct{})
+		go s.compactLoop()
+	}
+	return s, nil
+}
+
+func (s *FileStore) apply(rec logRecord) {
+	s.mem.mu.Lock()
+	defer s.mem.mu.Unlock()
+	switch rec.Op {
+	case "put":
+		s.mem.put(rec.Order)
+	case "del":
+		s.mem.del(rec.ID)
+	}
+}
+
+// write appends rec to the log in a single write call and applies it. A
+// record that could not be written in full is cut off again by Append.
+// Compaction only tidies up after the record is durable, so its failure is
+// logged rather than returned.
+func (s *FileStore) write(rec logRecord) error {
+	if _, _, err := s.log.Append(rec); err != nil {
+		return err
+	}
+	s.apply(rec)
+	s.records++
+
+	if s.records >= s.opts.MinCompactRecords && s.records > 2*s.mem.Len() {
+		if err := s.compact(); err != nil {
+			s.opts.Logf("store: compact %s: %v", s.log.Name(), err)
+		}
+	}
+	return nil
+}
+
+func (s *FileStore) Create(o *order.Order) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.log == nil {
+		return ErrClosed
+	}
+	if _, err := s.mem.Get(o.ID); err == nil {
+		return ErrExists
+	}
+	return s.write(logRecord{Op: "put", Order: o.Clone()})
+}
+
+func (s *FileStore) Update(o *order.Order) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.log == nil {
+		return ErrClosed
+	}
+	if _, err := s.mem.Get(o.ID); err != nil {
+		return err
+	}
+	return s.write(logRecord{Op: "put", Order: o.Clone()})
+}
+
+func (s *FileStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.log == nil {
+		return ErrClosed
+	}
+	if _, err := s.mem.Get(id); err != nil {
+		return err
+	}
+	return s.write(logRecord{Op: "del", ID: id})
+}
+
+func (s *FileStore) Get(id string) (*order.Order, error) {
+	return s.mem.Get(id)
+}
+
+func (s *FileStore) Find(q Query) ([]*order.Order, error) {
+	return s.mem.Find(q)
+}
+
+// Explain reports which index Find would use for q.
+func (s *FileStore) Explain(q Query) Plan {
+	return s.mem.Explain(q)
+}
+
+func (s *FileStore) Len() int {
+	return s.mem.Len()
+}
+
+// Compact rewrites the log so it holds exactly one record per live order.
+func (s *FileStore) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.log == nil {
+		return ErrClosed
+	}
+	return s.compact()
+}
+
+func (s *FileStore) compact() error {
+	s.mem.mu.RLock()
+	defer s.mem.mu.RUnlock()
+	// oldest first, so the log reads in creation order
+	err := s.log.Rewrite(func(add func(any) error) error {
+		for _, k := range s.mem.ix.byCreated {
+			if err := add(logRecord{Op: "put", Order: s.mem.orders[k.id]}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.records = len(s.mem.orders)
+	return nil
+}
+
+func (s *FileStore) compactLoop() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.opts.CompactInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			if s.log != nil && s.records > s.mem.Len() {
+				// a failed compaction leaves the old log in use; the next
+				// tick tries again
+				if err := s.compact(); err != nil {
+					s.opts.Logf("store: compact %s: %v", s.log.Name(), err)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (s *FileStore) Close() error {
+	if s.stop != nil {
+		close(s.stop)
+		<-s.done
+		s.stop = nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.log == nil {
+		return nil
+	}
+	err := s.log.Close()
+	s.log = nil
+	s.mem.Close()
+	return err
+}
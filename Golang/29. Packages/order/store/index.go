@@ -0,0 +1,205 @@
+package store
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/customer"
+	"github.com/rajasur/programming-learning/GO/order"
+)
+
+type idSet map[string]struct{}
+
+type createdKey struct {
+	at time.Time
+	id string
+}
+
+func compareCreated(a, b createdKey) int {
+	return cmp.Or(a.at.Compare(b.at), strings.Compare(a.id, b.id))
+}
+
+// index holds the secondary indexes. It is not safe for concurrent use;
+// the stores guard it with their own locks.
+type index struct {
+	byPhone   map[customer.PhoneNumber]idSet
+	byName    map[string]idSet
+	byStatus  map[order.Status]idSet
+	byCreated []createdKey // sorted
+}
+
+func newIndex() *index {
+	return &index{
+		byPhone:  make(map[customer.PhoneNumber]idSet),
+		byName:   make(map[string]idSet),
+		byStatus: make(map[order.Status]idSet),
+	}
+}
+
+func normName(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+func addTo[K comparable](m map[K]idSet, k K, id string) {
+	set, ok := m[k]
+	if !ok {
+		set = make(idSet)
+		m[k] = set
+	}
+	set[id] = struct{}{}
+}
+
+func removeFrom[K comparable](m map[K]idSet, k K, id string) {
+	set := m[k]
+	delete(set, id)
+	if len(set) == 0 {
+		delete(m, k)
+	}
+}
+
+func (ix *index) add(o *order.Order) {
+	if !o.Customer.Phone.IsZero() {
+		addTo(ix.byPhone, o.Customer.Phone, o.ID)
+	}
+	addTo(ix.byName, normName(o.Customer.Name), o.ID)
+	addTo(ix.byStatus, o.Status, o.ID)
+	ix.addCreated(o)
+}
+
+func (ix *index) addCreated(o *order.Order) {
+	key := createdKey{o.CreatedAt, o.ID}
+	// orders mostly arrive in creation order, so this is usually an append
+	i, _ := slices.BinarySearchFunc(ix.byCreated, key, compareCreated)
+	ix.byCreated = slices.Insert(ix.byCreated, i, key)
+}
+
+// update moves o from the index entries of old to its own, touching only
+// the keys that changed. Status changes, by far the most common update,
+// leave byCreated alone.
+func (ix *index) update(old, o *order.Order) {
+	if old.Customer.Phone != o.Customer.Phone {
+		if !old.Customer.Phone.IsZero() {
+			removeFrom(ix.byPhone, old.Customer.Phone, o.ID)
+		}
+		if !o.Customer.Phone.IsZero() {
+			addTo(ix.byPhone, o.Customer.Phone, o.ID)
+		}
+	}
+	if oldName, name := normName(old.Customer.Name), normName(o.Customer.Name); oldName != name {
+		removeFrom(ix.byName, oldName, o.ID)
+		addTo(ix.byName, name, o.ID)
+	}
+	if old.Status != o.Status {
+		removeFrom(ix.byStatus, old.Status, o.ID)
+		addTo(ix.byStatus, o.Status, o.ID)
+	}
+	if !old.CreatedAt.Equal(o.CreatedAt) {
+		ix.removeCreated(old)
+		ix.addCreated(o)
+	}
+}
+
+func (ix *index) remove(o *order.Order) {
+	if !o.Customer.Phone.IsZero() {
+		removeFrom(ix.byPhone, o.Customer.Phone, o.ID)
+	}
+	removeFrom(ix.byName, normName(o.Customer.Name), o.ID)
+	removeFrom(ix.byStatus, o.Status, o.ID)
+	ix.removeCreated(o)
+}
+
+func (ix *index) removeCreated(o *order.Order) {
+	if i, ok := slices.BinarySearchFunc(ix.byCreated, createdKey{o.CreatedAt, o.ID}, compareCreated); ok {
+		ix.byCreated = slices.Delete(ix.byCreated, i, i+1)
+	}
+}
+
+// rebuild indexes orders from scratch, sorting byCreated once rather than
+// inserting into it order by order.
+func (ix *index) rebuild(orders map[string]*order.Order) {
+	*ix = *newIndex()
+	ix.byCreated = make([]createdKey, 0, len(orders))
+	for _, o := range orders {
+		if !o.Customer.Phone.IsZero() {
+			addTo(ix.byPhone, o.Customer.Phone, o.ID)
+		}
+		addTo(ix.byName, normName(o.Customer.Name), o.ID)
+		addTo(ix.byStatus, o.Status, o.ID)
+		ix.byCreated = append(ix.byCreated, createdKey{o.CreatedAt, o.ID})
+	}
+	slices.SortFunc(ix.byCreated, compareCreated)
+}
+
+// Plan names the index a query would use, "scan" when none applies.
+type Plan struct {
+	Index    string
+	Estimate int // number of candidate orders
+}
+
+// plan picks the most selective index for q and returns its candidate ids.
+// ok is false when no index applies and every order has to be scanned.
+func (ix *index) plan(q Query) (p Plan, ids func(yield func(string) bool), ok bool) {
+	best := -1
+	consider := func(name string, n int, f func(yield func(string) bool)) {
+		if best < 0 || n < best {
+			best, p, ids = n, Plan{Index: name, Estimate: n}, f
+		}
+	}
+	fromSet := func(set idSet) func(yield func(string) bool) {
+		return func(yield func(string) bool) {
+			for id := range set {
+				if !yield(id) {
+					return
+				}
+			}
+		}
+	}
+
+	if !q.CustomerPhone.IsZero() {
+		set := ix.byPhone[q.CustomerPhone]
+		consider("customer_phone", len(set), fromSet(set))
+	}
+	if q.CustomerName != "" {
+		set := ix.byName[normName(q.CustomerName)]
+		consider("customer_name", len(set), fromSet(set))
+	}
+	if q.Status != nil {
+		set := ix.byStatus[*q.Status]
+		consider("status", len(set), fromSet(set))
+	}
+	if !q.CreatedFrom.IsZero() || !q.CreatedTo.IsZero() {
+		lo, hi := ix.createdRange(q.CreatedFrom, q.CreatedTo)
+		keys := ix.byCreated[lo:hi]
+		consider("created_at", len(keys), func(yield func(string) bool) {
+			for _, k := range keys {
+				if !yield(k.id) {
+					return
+				}
+			}
+		})
+	}
+
+	if best < 0 {
+		return Plan{Index: "scan", Estimate: len(ix.byCreated)}, nil, false
+	}
+	return p, ids, true
+}
+
+// createdRange returns the slice bounds of byCreated for [from, to).
+func (ix *index) createdRange(from, to time.Time) (int, int) {
+	lo := 0
+	if !from.IsZero() {
+		lo, _ = slices.BinarySearchFunc(ix.byCreated, from, func(k createdKey, t time.Time) int {
+			return k.at.Compare(t)
+		})
+	}
+	hi := len(ix.byCreated)
+	if !to.IsZero() {
+		hi, _ = slices.BinarySearchFunc(ix.byCreated, to, func(k createdKey, t time.Time) int {
+			return k.at.Compare(t)
+		})
+	}
+	return lo, max(lo, hi)
+}
@@ -0,0 +1,142 @@
+package store
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/rajasur/programming-learning/GO/order"
+)
+
+// MemoryStore keeps orders in a map. It is safe for concurrent use.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	orders map[string]*order.Order
+	ix     *index
+	closed bool
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		orders: make(map[string]*order.Order),
+		ix:     newIndex(),
+	}
+}
+
+func (s *MemoryStore) Create(o *order.Order) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	if _, ok := s.orders[o.ID]; ok {
+		return ErrExists
+	}
+	s.put(o.Clone())
+	return nil
+}
+
+func (s *MemoryStore) Get(id string) (*order.Order, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, ErrClosed
+	}
+	o, ok := s.orders[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return o.Clone(), nil
+}
+
+func (s *MemoryStore) Update(o *order.Order) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	if _, ok := s.orders[o.ID]; !ok {
+		return ErrNotFound
+	}
+	s.put(o.Clone())
+	return nil
+}
+
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	if _, ok := s.orders[id]; !ok {
+		return ErrNotFound
+	}
+	s.del(id)
+	return nil
+}
+
+func (s *MemoryStore) Find(q Query) ([]*order.Order, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, ErrClosed
+	}
+
+	var out []*order.Order
+	collect := func(o *order.Order) {
+		if q.matches(o) {
+			out = append(out, o.Clone())
+		}
+	}
+	if _, ids, ok := s.ix.plan(q); ok {
+		for id := range ids {
+			collect(s.orders[id])
+		}
+	} else {
+		for _, o := range s.orders {
+			collect(o)
+		}
+	}
+
+	slices.SortFunc(out, func(a, b *order.Order) int {
+		return compareCreated(createdKey{a.CreatedAt, a.ID}, createdKey{b.CreatedAt, b.ID})
+	})
+	return out, nil
+}
+
+// Explain reports which index Find would use for q.
+func (s *MemoryStore) Explain(q Query) Plan {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, _, _ := s.ix.plan(q)
+	return p
+}
+
+func (s *MemoryStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.orders)
+}
+
+func (s *MemoryStore) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	return nil
+}
+
+// put and del expect s.mu to be held and o to be a private copy.
+func (s *MemoryStore) put(o *order.Order) {
+	if old, ok := s.orders[o.ID]; ok {
+		s.ix.update(old, o)
+	} else {
+		s.ix.add(o)
+	}
+	s.orders[o.ID] = o
+}
+
+func (s *MemoryStore) del(id string) {
+	if old, ok := s.orders[id]; ok {
+		s.ix.remove(old)
+		delete(s.orders, id)
+	}
+}
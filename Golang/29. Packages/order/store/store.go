@@ -0,0 +1,60 @@
+// Package store persists orders and answers lookups by customer, status and
+// creation time through secondary indexes.
+package store
+
+import (
+	"errors"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/customer"
+	"github.com/rajasur/programming-learning/GO/order"
+)
+
+var (
+	ErrNotFound = errors.New("store: order not found")
+	ErrExists   = errors.New("store: order already exists")
+	ErrClosed   = errors.New("store: closed")
+)
+
+// OrderStore is implemented by MemoryStore and FileStore. Orders passed in
+// and handed out are copies, so callers may modify them freely.
+type OrderStore interface {
+	Create(o *order.Order) error
+	Get(id string) (*order.Order, error)
+	Update(o *order.Order) error
+	Delete(id string) error
+	// Find returns the orders matching every set field of q, oldest first.
+	Find(q Query) ([]*order.Order, error)
+	Len() int
+	Close() error
+}
+
+// Query filters orders. Zero fields match everything.
+type Query struct {
+	CustomerPhone customer.PhoneNumber
+	CustomerName  string // case-insensitive, exact
+	Status        *order.Status
+	CreatedFrom   time.Time // inclusive
+	CreatedTo     time.Time // exclusive
+}
+
+// StatusPtr is a helper for filling Query.Status.
+func StatusPtr(s order.Status) *order.Status {
+	return &s
+}
+
+func (q Query) matches(o *order.Order) bool {
+	switch {
+	case !q.CustomerPhone.IsZero() && o.Customer.Phone != q.CustomerPhone:
+		return false
+	case q.CustomerName != "" && normName(o.Customer.Name) != normName(q.CustomerName):
+		return false
+	case q.Status != nil && o.Status != *q.Status:
+		return false
+	case !q.CreatedFrom.IsZero() && o.CreatedAt.Before(q.CreatedFrom):
+		return false
+	case !q.CreatedTo.IsZero() && !o.CreatedAt.Before(q.CreatedTo):
+		return false
+	}
+	return true
+}
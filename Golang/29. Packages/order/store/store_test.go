@@ -0,0 +1,401 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/customer"
+	"github.com/rajasur/programming-learning/GO/internal/recordlog"
+	"github.com/rajasur/programming-learning/GO/order"
+)
+
+var t0 = time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)
+
+func phone(t testing.TB, s string) customer.PhoneNumber {
+	t.Helper()
+	p, err := customer.ParsePhoneNumber(s, "IN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// newOrder creates order i, created i minutes after t0.
+func newOrder(t testing.TB, i int, name string, p customer.PhoneNumber) *order.Order {
+	t.Helper()
+	at := t0.Add(time.Duration(i) * time.Minute)
+	o, err := order.New(fmt.Sprintf("o%03d", i), 1000, order.Received,
+		customer.Customer{Name: name, Phone: p},
+		order.WithClock(func() time.Time { return at }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+func ids(orders []*order.Order) []string {
+	var out []string
+	for _, o := range orders {
+		out = append(out, o.ID)
+	}
+	return out
+}
+
+// stores runs fn against every OrderStore implementation.
+func stores(t *testing.T, fn func(t *testing.T, open func() OrderStore)) {
+	t.Run("memory", func(t *testing.T) {
+		fn(t, func() OrderStore { return NewMemoryStore() })
+	})
+	t.Run("file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "orders.log")
+		fn(t, func() OrderStore {
+			s, err := OpenFile(path, FileOptions{NoSync: true, MinCompactRecords: 5})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		})
+	})
+}
+
+func TestCRUD(t *testing.T) {
+	stores(t, func(t *testing.T, open func() OrderStore) {
+		s := open()
+		defer s.Close()
+
+		o := newOrder(t, 1, "Raja", customer.PhoneNumber{})
+		if err := s.Create(o); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Create(o); !errors.Is(err, ErrExists) {
+			t.Errorf("second Create: %v", err)
+		}
+
+		// the store keeps its own copy
+		o.Status = order.Cancelled
+		got, err := s.Get("o001")
+		if err != nil || got.Status != order.Received {
+			t.Fatalf("Get = %v, %v", got, err)
+		}
+		got.Items = append(got.Items, order.LineItem{})
+		if again, _ := s.Get("o001"); len(again.Items) != 0 {
+			t.Error("Get handed out shared state")
+		}
+
+		if err := got.Confirm("test"); err != nil {
+			t.Fatal(err)
+		}
+		got.Items = nil
+		if err := s.Update(got); err != nil {
+			t.Fatal(err)
+		}
+		if again, _ := s.Get("o001"); again.Status != order.Confirmed {
+			t.Errorf("status after Update = %v", again.Status)
+		}
+		if err := s.Update(newOrder(t, 2, "X", customer.PhoneNumber{})); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Update of a missing order: %v", err)
+		}
+
+		if err := s.Delete("o001"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Get("o001"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get after Delete: %v", err)
+		}
+		if err := s.Delete("o001"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("second Delete: %v", err)
+		}
+		if s.Len() != 0 {
+			t.Errorf("Len = %d", s.Len())
+		}
+
+		s.Close()
+		if _, err := s.Get("o001"); !errors.Is(err, ErrClosed) {
+			t.Errorf("Get after Close: %v", err)
+		}
+		if err := s.Create(o); !errors.Is(err, ErrClosed) {
+			t.Errorf("Create after Close: %v", err)
+		}
+	})
+}
+
+func TestFind(t *testing.T) {
+	stores(t, func(t *testing.T, open func() OrderStore) {
+		s := open()
+		defer s.Close()
+
+		a, b := phone(t, "98765 43210"), phone(t, "91234 56789")
+		// created out of order on purpose
+		for _, i := range []int{5, 1, 4, 2, 3, 6} {
+			p := a
+			if i%2 == 0 {
+				p = b
+			}
+			name := "Raja"
+			if i > 4 {
+				name = "Meera"
+			}
+			if err := s.Create(newOrder(t, i, name, p)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, id := range []string{"o002", "o003"} {
+			o, _ := s.Get(id)
+			o.Confirm("test")
+			s.Update(o)
+		}
+
+		for _, tc := range []struct {
+			q     Query
+			want  []string
+			index string
+		}{
+			{Query{}, []string{"o001", "o002", "o003", "o004", "o005", "o006"}, "scan"},
+			{Query{CustomerPhone: a}, []string{"o001", "o003", "o005"}, "customer_phone"},
+			{Query{CustomerName: " raja "}, []string{"o001", "o002", "o003", "o004"}, "customer_name"},
+			{Query{Status: StatusPtr(order.Confirmed)}, []string{"o002", "o003"}, "status"},
+			{Query{CreatedFrom: t0.Add(2 * time.Minute), CreatedTo: t0.Add(5 * time.Minute)}, []string{"o002", "o003", "o004"}, "created_at"},
+			{Query{CreatedTo: t0.Add(2 * time.Minute)}, []string{"o001"}, "created_at"},
+			{Query{CustomerPhone: b, Status: StatusPtr(order.Received)}, []string{"o004", "o006"}, "customer_phone"},
+			{Query{CustomerName: "Meera", CustomerPhone: a}, []string{"o005"}, "customer_name"},
+			{Query{CustomerName: "nobody"}, nil, "customer_name"},
+		} {
+			got, err := s.Find(tc.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(ids(got), tc.want) {
+				t.Errorf("Find(%+v) = %v, want %v", tc.q, ids(got), tc.want)
+			}
+			if ex, ok := s.(interface{ Explain(Query) Plan }); ok {
+				if p := ex.Explain(tc.q); p.Index != tc.index {
+					t.Errorf("Explain(%+v) = %+v, want %s", tc.q, p, tc.index)
+				}
+			}
+		}
+	})
+}
+
+// TestIndexFollowsUpdates changes every indexed field and checks each
+// index against a full scan.
+func TestIndexFollowsUpdates(t *testing.T) {
+	stores(t, func(t *testing.T, open func() OrderStore) {
+		s := open()
+		defer s.Close()
+
+		a, b := phone(t, "98765 43210"), phone(t, "91234 56789")
+		for i := range 20 {
+			s.Create(newOrder(t, i, "Raja", a))
+		}
+		for i := range 20 {
+			o, _ := s.Get(fmt.Sprintf("o%03d", i))
+			switch i % 4 {
+			case 0:
+				o.Customer.Phone = b
+			case 1:
+				o.Customer.Name = "Meera"
+			case 2:
+				o.Confirm("test")
+			case 3:
+				o.CreatedAt = t0.Add(-time.Duration(i) * time.Hour)
+			}
+			if err := s.Update(o); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		all, _ := s.Find(Query{})
+		for _, q := range []Query{
+			{CustomerPhone: a}, {CustomerPhone: b},
+			{CustomerName: "raja"}, {CustomerName: "meera"},
+			{Status: StatusPtr(order.Received)}, {Status: StatusPtr(order.Confirmed)},
+			{CreatedFrom: t0.Add(-10 * time.Hour), CreatedTo: t0.Add(5 * time.Minute)},
+		} {
+			var want []string
+			for _, o := range all {
+				if q.matches(o) {
+					want = append(want, o.ID)
+				}
+			}
+			got, _ := s.Find(q)
+			if !slices.Equal(ids(got), want) {
+				t.Errorf("Find(%+v) = %v, want %v", q, ids(got), want)
+			}
+		}
+		if all[0].ID != "o019" {
+			t.Errorf("oldest order is %s, want o019", all[0].ID)
+		}
+	})
+}
+
+func TestFileReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orders.log")
+	s, err := OpenFile(path, FileOptions{MinCompactRecords: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 8 {
+		s.Create(newOrder(t, i, "Raja", customer.PhoneNumber{}))
+	}
+	// enough updates to trigger a compaction along the way
+	for range 3 {
+		for i := range 8 {
+			o, _ := s.Get(fmt.Sprintf("o%03d", i))
+			o.Amount += 100
+			s.Update(o)
+		}
+	}
+	s.Delete("o007")
+	records := s.records
+	s.Close()
+	if records >= 8+24+1 {
+		t.Errorf("%d records after updates, compaction never ran", records)
+	}
+
+	s, err = OpenFile(path, FileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if s.Len() != 7 {
+		t.Fatalf("Len after reopen = %d", s.Len())
+	}
+	for i := range 7 {
+		o, err := s.Get(fmt.Sprintf("o%03d", i))
+		if err != nil || o.Amount != 1300 {
+			t.Errorf("o%03d after reopen: %v, %v", i, o, err)
+		}
+	}
+	got, _ := s.Find(Query{CreatedFrom: t0.Add(5 * time.Minute)})
+	if !slices.Equal(ids(got), []string{"o005", "o006"}) {
+		t.Errorf("created index after reopen: %v", ids(got))
+	}
+}
+
+func TestFileTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orders.log")
+	s, _ := OpenFile(path, FileOptions{NoSync: true})
+	s.Create(newOrder(t, 1, "Raja", customer.PhoneNumber{}))
+	s.Create(newOrder(t, 2, "Raja", customer.PhoneNumber{}))
+	s.Close()
+
+	data, _ := os.ReadFile(path)
+	os.WriteFile(path, data[:len(data)-20], 0o644)
+
+	s, err := OpenFile(path, FileOptions{NoSync: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Len() != 1 {
+		t.Fatalf("Len = %d after a torn write, want 1", s.Len())
+	}
+	// the next record goes where the torn one was
+	if err := s.Create(newOrder(t, 3, "Raja", customer.PhoneNumber{})); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	s, err = OpenFile(path, FileOptions{NoSync: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.Get("o003"); err != nil || s.Len() != 2 {
+		t.Errorf("after append past a torn tail: Len %d, %v", s.Len(), err)
+	}
+}
+
+func TestFileCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orders.log")
+	s, _ := OpenFile(path, FileOptions{NoSync: true})
+	s.Create(newOrder(t, 1, "Raja", customer.PhoneNumber{}))
+	s.Create(newOrder(t, 2, "Raja", customer.PhoneNumber{}))
+	s.Close()
+
+	data, _ := os.ReadFile(path)
+	data[20] ^= 1
+	os.WriteFile(path, data, 0o644)
+	if _, err := OpenFile(path, FileOptions{}); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("OpenFile = %v, want ErrCorrupt", err)
+	}
+}
+
+func TestFileCompactInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orders.log")
+	s, _ := OpenFile(path, FileOptions{NoSync: true, CompactInterval: 10 * time.Millisecond})
+	defer s.Close()
+	o := newOrder(t, 1, "Raja", customer.PhoneNumber{})
+	s.Create(o)
+	for range 5 {
+		s.Update(o)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mu.Lock()
+		n := s.records
+		s.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("still %d records", n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// makeLog writes a log of n orders in a shuffled creation order, each
+// followed later by a status update, as a long-running store leaves it.
+func makeLog(b *testing.B, n int) string {
+	path := filepath.Join(b.TempDir(), "orders.log")
+	l, err := recordlog.Open(path, true, func(logRecord, int64, int) error { return nil })
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer l.Close()
+	p := phone(b, "98765 43210")
+	orders := make([]*order.Order, n)
+	for i := range n {
+		// a fixed permutation of 0..n-1 so CreatedAt isn't monotonic
+		j := (i * 7919) % n
+		orders[i] = newOrder(b, j, fmt.Sprint("customer ", j%1000), p)
+		if _, _, err := l.Append(logRecord{Op: "put", Order: orders[i]}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	for _, o := range orders {
+		o.Confirm("bench")
+		if _, _, err := l.Append(logRecord{Op: "put", Order: o}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return path
+}
+
+func BenchmarkOpen1M(b *testing.B) {
+	path := makeLog(b, 1_000_000)
+	for b.Loop() {
+		s, err := OpenFile(path, FileOptions{NoSync: true})
+		if err != nil {
+			b.Fatal(err)
+		}
+		s.Close()
+	}
+}
+
+func BenchmarkUpdate1M(b *testing.B) {
+	s := NewMemoryStore()
+	for i := range 1_000_000 {
+		s.Create(newOrder(b, i, "Raja", customer.PhoneNumber{}))
+	}
+	o, _ := s.Get("o500000")
+	b.ResetTimer()
+	for i := 0; b.Loop(); i++ {
+		o.Status = order.Status(i % 2)
+		s.Update(o)
+	}
+}
@@ -0,0 +1,96 @@
+package order
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rajasur/programming-learning/GO/customer"
+	"github.com/rajasur/programming-learning/GO/money"
+)
+
+// Rates are in basis points: 1800 is 18%.
+
+// TaxLine is one tax charged on an amount.
+type TaxLine struct {
+	Name   string      `json:"name"`
+	Rate   int64       `json:"rate"` // basis points
+	Amount money.Money `json:"amount"`
+}
+
+// TaxRule computes the taxes due on the taxable value of one line item.
+type TaxRule interface {
+	Taxes(item LineItem, taxable money.Money) []TaxLine
+}
+
+// GST is India's goods and services tax. Within a state it is split evenly
+// into CGST and SGST, between states the whole rate is charged as IGST.
+type GST struct {
+	Rate        int64  // default rate, used when the item has none
+	SellerState string // state of the supplier
+	BuyerState  string // place of supply
+}
+
+// ForBuyer returns g with the place of supply set to c's state. A customer
+// without a state on record is taken to be in the seller's.
+func (g GST) ForBuyer(c customer.Customer) GST {
+	g.BuyerState = c.State
+	if strings.TrimSpace(g.BuyerState) == "" {
+		g.BuyerState = g.SellerState
+	}
+	return g
+}
+
+// Intrastate reports whether seller and buyer are in the same state.
+func (g GST) Intrastate() bool {
+	return strings.EqualFold(strings.TrimSpace(g.SellerState), strings.TrimSpace(g.BuyerState))
+}
+
+func (g GST) Taxes(item LineItem, taxable money.Money) []TaxLine {
+	rate := item.taxRate(g.Rate)
+	if rate == 0 {
+		return nil
+	}
+	if !g.Intrastate() {
+		return []TaxLine{{Name: "IGST", Rate: rate, Amount: taxable.MulRatio(rate, 10000)}}
+	}
+	// an odd rate can't be halved in basis points, so SGST takes the
+	// extra one; each half is rounded on its own, as it appears on the
+	// invoice
+	cgst := rate / 2
+	sgst := rate - cgst
+	return []TaxLine{
+		{Name: "CGST", Rate: cgst, Amount: taxable.MulRatio(cgst, 10000)},
+		{Name: "SGST", Rate: sgst, Amount: taxable.MulRatio(sgst, 10000)},
+	}
+}
+
+// VAT is a single rate value added tax.
+type VAT struct {
+	Name string // defaults to "VAT"
+	Rate int64
+}
+
+func (v VAT) Taxes(item LineItem, taxable money.Money) []TaxLine {
+	rate := item.taxRate(v.Rate)
+	if rate == 0 {
+		return nil
+	}
+	name := v.Name
+	if name == "" {
+		name = "VAT"
+	}
+	return []TaxLine{{Name: name, Rate: rate, Amount: taxable.MulRatio(rate, 10000)}}
+}
+
+// NoTax charges nothing.
+type NoTax struct{}
+
+func (NoTax) Taxes(LineItem, money.Money) []TaxLine { return nil }
+
+// FormatRate prints basis points as a percentage, e.g. 1800 -> "18%",
+// 250 -> "2.5%".
+func FormatRate(bp int64) string {
+	s := fmt.Sprintf("%d.%02d", bp/100, bp%100)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	return s + "%"
+}
@@ -0,0 +1,219 @@
+// Package track pushes order status changes to browsers with
+// Server-Sent Events.
+//
+// A Hub fans each Update out to subscribers over buffered channels. A
+// subscriber that falls a whole buffer behind is evicted rather than
+// allowed to block everyone else; it can reconnect with Last-Event-ID and
+// pick up from the hub's replay buffer.
+package track
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/customer"
+	"github.com/rajasur/programming-learning/GO/order"
+)
+
+// Update is one status change as sent to clients. ID increases by one
+// for every update the hub publishes.
+type Update struct {
+	ID      int64                `json:"id"`
+	OrderID string               `json:"order_id"`
+	Phone   customer.PhoneNumber `json:"-"`
+	From    order.Status         `json:"from"`
+	To      order.Status         `json:"to"`
+	At      time.Time            `json:"at"`
+	Actor   string               `json:"actor,omitempty"`
+}
+
+// Filter selects the updates a subscriber wants.
+type Filter struct {
+	OrderID string
+	Phone   customer.PhoneNumber
+}
+
+func (f Filter) match(u Update) bool {
+	if f.OrderID != "" && f.OrderID != u.OrderID {
+		return false
+	}
+	if !f.Phone.IsZero() && f.Phone != u.Phone {
+		return false
+	}
+	return true
+}
+
+// Subscriber receives updates on C until it is closed, either by
+// Unsubscribe or because the hub evicted it for not keeping up.
+type Subscriber struct {
+	C      <-chan Update
+	c      chan Update
+	filter Filter
+}
+
+// Hub is safe for concurrent use.
+type Hub struct {
+	mu     sync.Mutex
+	lastID int64
+	replay []Update // ring of the most recent updates
+	next   int      // where the next update goes in replay
+	subs   map[*Subscriber]struct{}
+	closed bool
+
+	buffer    int
+	heartbeat time.Duration
+	onEvict   func(Filter)
+}
+
+type Option func(*Hub)
+
+// WithBuffer sets how many updates a subscriber may lag behind before it
+// is evicted. The default is 16 and the minimum 1.
+func WithBuffer(n int) Option {
+	return func(h *Hub) { h.buffer = max(n, 1) }
+}
+
+// WithReplay sets how many recent updates are kept for Last-Event-ID
+// resume. The default is 256; 0 or less turns replay off.
+func WithReplay(n int) Option {
+	return func(h *Hub) { h.replay = make([]Update, 0, max(n, 0)) }
+}
+
+// WithHeartbeat sets how often an idle stream gets a comment line so
+// proxies don't close it. The default is 15 seconds; 0 or less turns
+// heartbeats off.
+func WithHeartbeat(d time.Duration) Option {
+	return func(h *Hub) { h.heartbeat = max(d, 0) }
+}
+
+// OnEvict is called, with the hub locked, when a slow subscriber is dropped.
+func OnEvict(fn func(Filter)) Option {
+	return func(h *Hub) { h.onEvict = fn }
+}
+
+func NewHub(opts ...Option) *Hub {
+	h := &Hub{
+		replay:    make([]Update, 0, 256),
+		subs:      make(map[*Subscriber]struct{}),
+		buffer:    16,
+		heartbeat: 15 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// Publish records a status change of o and sends it to every matching
+// subscriber. Its signature fits api.OnStatusChange.
+func (h *Hub) Publish(o *order.Order, c order.StatusChange) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastID++
+	u := Update{
+		ID:      h.lastID,
+		OrderID: c.OrderID,
+		Phone:   o.Customer.Phone,
+		From:    c.From,
+		To:      c.To,
+		At:      c.At,
+		Actor:   c.Actor,
+	}
+	h.remember(u)
+
+	for s := range h.subs {
+		if !s.filter.match(u) {
+			continue
+		}
+		select {
+		case s.c <- u:
+		default:
+			// buffer full: drop the subscriber instead of blocking
+			h.drop(s)
+			if h.onEvict != nil {
+				h.onEvict(s.filter)
+			}
+		}
+	}
+}
+
+func (h *Hub) remember(u Update) {
+	if cap(h.replay) == 0 {
+		return
+	}
+	if len(h.replay) < cap(h.replay) {
+		h.replay = append(h.replay, u)
+		return
+	}
+	h.replay[h.next] = u
+	h.next = (h.next + 1) % len(h.replay)
+}
+
+// Subscribe registers a subscriber for f. Updates after lastID that are
+// still in the replay buffer are queued first, so nothing published
+// between the replay and the registration can be missed. After Close the
+// subscriber's channel is already closed.
+func (h *Hub) Subscribe(f Filter, lastID int64) *Subscriber {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		c := make(chan Update)
+		close(c)
+		return &Subscriber{C: c, c: c, filter: f}
+	}
+
+	var missed []Update
+	if lastID > 0 {
+		n := len(h.replay)
+		for i := range n {
+			u := h.replay[(h.next+i)%n]
+			if u.ID > lastID && f.match(u) {
+				missed = append(missed, u)
+			}
+		}
+	}
+
+	c := make(chan Update, max(h.buffer, len(missed)))
+	for _, u := range missed {
+		c <- u
+	}
+	s := &Subscriber{C: c, c: c, filter: f}
+	h.subs[s] = struct{}{}
+	return s
+}
+
+// Unsubscribe removes s and closes its channel. It is a no-op if s was
+// already evicted.
+func (h *Hub) Unsubscribe(s *Subscriber) {
+	h.mu.Lock()
+	h.drop(s)
+	h.mu.Unlock()
+}
+
+func (h *Hub) drop(s *Subscriber) {
+	if _, ok := h.subs[s]; ok {
+		delete(h.subs, s)
+		close(s.c)
+	}
+}
+
+// Close disconnects every subscriber, ending their streams, and makes
+// later subscriptions end at once. Call it when the server shuts down,
+// since open streams would otherwise hold it up.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	h.closed = true
+	for s := range h.subs {
+		h.drop(s)
+	}
+	h.mu.Unlock()
+}
+
+// Len returns the number of connected subscribers.
+func (h *Hub) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs)
+}
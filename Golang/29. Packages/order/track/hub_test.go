@@ -0,0 +1,178 @@
+package track
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/order"
+)
+
+func publish(h *Hub, id string, to order.Status) {
+	h.Publish(&order.Order{ID: id}, order.StatusChange{OrderID: id, From: order.Received, To: to})
+}
+
+func drain(s *Subscriber) []int64 {
+	var ids []int64
+	for {
+		select {
+		case u, ok := <-s.C:
+			if !ok {
+				return ids
+			}
+			ids = append(ids, u.ID)
+		default:
+			return ids
+		}
+	}
+}
+
+func TestPublishAndReplay(t *testing.T) {
+	h := NewHub(WithReplay(3))
+	a := h.Subscribe(Filter{OrderID: "a"}, 0)
+	all := h.Subscribe(Filter{}, 0)
+	for i := range 5 {
+		publish(h, string(rune('a'+i%2)), order.Confirmed)
+	}
+	if got := drain(a); len(got) != 3 || got[0] != 1 || got[2] != 5 {
+		t.Errorf("order a got %v", got)
+	}
+	if got := drain(all); len(got) != 5 {
+		t.Errorf("unfiltered subscriber got %v", got)
+	}
+
+	// only the last three updates are kept
+	late := h.Subscribe(Filter{}, 1)
+	if got := drain(late); len(got) != 3 || got[0] != 3 {
+		t.Errorf("resume after 1 got %v, want [3 4 5]", got)
+	}
+}
+
+func TestEviction(t *testing.T) {
+	var evicted []Filter
+	h := NewHub(WithBuffer(2), OnEvict(func(f Filter) { evicted = append(evicted, f) }))
+	s := h.Subscribe(Filter{OrderID: "a"}, 0)
+	for range 3 {
+		publish(h, "a", order.Confirmed)
+	}
+	if got := drain(s); len(got) != 2 {
+		t.Errorf("got %v before eviction", got)
+	}
+	if _, ok := <-s.C; ok || h.Len() != 0 || len(evicted) != 1 {
+		t.Errorf("slow subscriber not evicted: open=%v len=%d evicted=%v", ok, h.Len(), evicted)
+	}
+	h.Unsubscribe(s) // no-op after eviction
+}
+
+func TestSubscribeAfterClose(t *testing.T) {
+	h := NewHub()
+	s := h.Subscribe(Filter{}, 0)
+	h.Close()
+	if _, ok := <-s.C; ok {
+		t.Error("subscriber still open after Close")
+	}
+	late := h.Subscribe(Filter{}, 0)
+	select {
+	case _, ok := <-late.C:
+		if ok {
+			t.Error("late subscriber received an update")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("subscriber created after Close is still open")
+	}
+	if h.Len() != 0 {
+		t.Errorf("Len = %d after Close", h.Len())
+	}
+	h.Unsubscribe(late)
+}
+
+func TestOptionBounds(t *testing.T) {
+	h := NewHub(WithBuffer(-1), WithReplay(-5), WithHeartbeat(0))
+	s := h.Subscribe(Filter{}, 0)
+	publish(h, "a", order.Confirmed)
+	if got := drain(s); len(got) != 1 {
+		t.Errorf("got %v with the minimum buffer", got)
+	}
+	if got := drain(h.Subscribe(Filter{}, -1)); len(got) != 0 {
+		t.Errorf("replay off but resumed %v", got)
+	}
+
+	// a stream without heartbeats still works
+	srv := httptest.NewServer(h.OrderEvents())
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("stream: %s", resp.Status)
+	}
+}
+
+func TestSSE(t *testing.T) {
+	h := NewHub(WithHeartbeat(10 * time.Millisecond))
+	mux := http.NewServeMux()
+	mux.Handle("GET /orders/{id}/events", h.OrderEvents())
+	mux.Handle("GET /customers/{phone}/events", h.CustomerEvents())
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	publish(h, "o1", order.Confirmed) // id 1, before the client connects
+
+	req, _ := http.NewRequest("GET", srv.URL+"/orders/o1/events", nil)
+	req.Header.Set("Last-Event-ID", "0")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	publish(h, "o2", order.Confirmed)
+	publish(h, "o1", order.Prepared)
+
+	r := bufio.NewReader(resp.Body)
+	var ids []string
+	pings := 0
+	for len(ids) < 1 || pings < 1 {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			ids = append(ids, strings.TrimSpace(line[4:]))
+		case line == ": ping\n":
+			pings++
+		case strings.HasPrefix(line, "data: ") && !strings.Contains(line, `"order_id":"o1"`):
+			t.Errorf("stream for o1 got %s", line)
+		}
+	}
+	if ids[0] != "3" {
+		t.Errorf("first event id %s, want 3", ids[0])
+	}
+
+	h.Close()
+	if _, err := r.ReadString(0); err == nil {
+		t.Error("stream still open after Close")
+	}
+
+	resp, err = http.Get(srv.URL + "/customers/12/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("bad phone number: %s", resp.Status)
+	}
+}
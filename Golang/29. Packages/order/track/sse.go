@@ -0,0 +1,94 @@
+package track
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rajasur/programming-learning/GO/customer"
+)
+
+// OrderEvents streams updates for the order named by the {id} path value.
+func (h *Hub) OrderEvents() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.serve(w, r, Filter{OrderID: r.PathValue("id")})
+	})
+}
+
+// CustomerEvents streams updates for every order of the customer whose
+// phone number is the {phone} path value.
+func (h *Hub) CustomerEvents() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		phone, err := customer.ParsePhoneNumber(r.PathValue("phone"), customer.DefaultRegion)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.serve(w, r, Filter{Phone: phone})
+	})
+}
+
+func (h *Hub) serve(w http.ResponseWriter, r *http.Request, f Filter) {
+	rc := http.NewResponseController(w)
+
+	var lastID int64
+	if s := r.Header.Get("Last-Event-ID"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			http.Error(w, "bad Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		lastID = n
+	}
+
+	sub := h.Subscribe(f, lastID)
+	defer h.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	var heartbeat <-chan time.Time
+	if h.heartbeat > 0 {
+		t := time.NewTicker(h.heartbeat)
+		defer t.Stop()
+		heartbeat = t.C
+	}
+
+	for {
+		select {
+		case u, ok := <-sub.C:
+			if !ok {
+				// evicted; the client will reconnect with Last-Event-ID
+				return
+			}
+			if err := writeEvent(w, u); err != nil {
+				return
+			}
+		case <-heartbeat:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, u Update) error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: status\ndata: %s\n\n", u.ID, data)
+	return err
+}
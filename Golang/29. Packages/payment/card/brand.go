@@ -0,0 +1,70 @@
+package card
+
+import (
+	"slices"
+	"strconv"
+)
+
+type Brand string
+
+const (
+	Unknown    Brand = "unknown"
+	Visa       Brand = "visa"
+	Mastercard Brand = "mastercard"
+	Amex       Brand = "amex"
+	Discover   Brand = "discover"
+	Diners     Brand = "diners"
+	JCB        Brand = "jcb"
+	RuPay      Brand = "rupay"
+	Maestro    Brand = "maestro"
+)
+
+// binRange matches numbers whose first `prefix` digits are between lo and hi.
+type binRange struct {
+	prefix  int
+	lo, hi  int
+	brand   Brand
+	lengths []int
+}
+
+// The table is checked top to bottom, so narrower ranges that overlap a
+// wider one (RuPay inside Discover's 65 block) must come first.
+var binRanges = []binRange{
+	{6, 508500, 508999, RuPay, []int{16}},
+	{6, 606985, 607984, RuPay, []int{16}},
+	{6, 608001, 608500, RuPay, []int{16}},
+	{6, 652150, 653149, RuPay, []int{16}},
+	{6, 622126, 622925, Discover, []int{16, 17, 18, 19}},
+	{4, 6011, 6011, Discover, []int{16, 17, 18, 19}},
+	{3, 644, 649, Discover, []int{16, 17, 18, 19}},
+	{2, 65, 65, Discover, []int{16, 17, 18, 19}},
+	{2, 34, 34, Amex, []int{15}},
+	{2, 37, 37, Amex, []int{15}},
+	{4, 3528, 3589, JCB, []int{16, 17, 18, 19}},
+	{3, 300, 305, Diners, []int{14, 15, 16, 17, 18, 19}},
+	{2, 36, 36, Diners, []int{14, 15, 16, 17, 18, 19}},
+	{2, 38, 39, Diners, []int{16, 17, 18, 19}},
+	{2, 51, 55, Mastercard, []int{16}},
+	{4, 2221, 2720, Mastercard, []int{16}},
+	{1, 4, 4, Visa, []int{13, 16, 19}},
+	{2, 50, 50, Maestro, []int{12, 13, 14, 15, 16, 17, 18, 19}},
+	{2, 56, 69, Maestro, []int{12, 13, 14, 15, 16, 17, 18, 19}},
+}
+
+// DetectBrand returns the network a card number belongs to, or Unknown when
+// the prefix or the length doesn't match any known range.
+func DetectBrand(digits string) Brand {
+	for _, r := range binRanges {
+		if len(digits) < r.prefix {
+			continue
+		}
+		bin, err := strconv.Atoi(digits[:r.prefix])
+		if err != nil {
+			return Unknown
+		}
+		if bin >= r.lo && bin <= r.hi && slices.Contains(r.lengths, len(digits)) {
+			return r.brand
+		}
+	}
+	return Unknown
+}
@@ -0,0 +1,125 @@
+// Package card validates, masks and tokenizes payment card details so that
+// code built on top of a payment gateway never has to hold raw card numbers.
+package card
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidExpiry = errors.New("card: invalid expiry date")
+	ErrExpired       = errors.New("card: card has expired")
+)
+
+// Expiry is the month and four digit year printed on the card.
+type Expiry struct {
+	Month int
+	Year  int
+}
+
+// ParseExpiry accepts "MM/YY" or "MM/YYYY". The month may be a single
+// digit; nothing else, not even a sign or a trailing space, is allowed.
+func ParseExpiry(s string) (Expiry, error) {
+	mm, yy, ok := strings.Cut(s, "/")
+	if !ok || len(mm) < 1 || len(mm) > 2 || (len(yy) != 2 && len(yy) != 4) || !allDigits(mm) || !allDigits(yy) {
+		return Expiry{}, ErrInvalidExpiry
+	}
+	month, _ := strconv.Atoi(mm)
+	year, _ := strconv.Atoi(yy)
+	if len(yy) == 2 {
+		year += 2000
+	}
+	if month < 1 || month > 12 {
+		return Expiry{}, ErrInvalidExpiry
+	}
+	return Expiry{Month: month, Year: year}, nil
+}
+
+func allDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate reports ErrExpired if the card can't be used at now.
+// A card is valid until the last moment of its expiry month.
+func (e Expiry) Validate(now time.Time) error {
+	if e.Month < 1 || e.Month > 12 || e.Year < 1 {
+		return ErrInvalidExpiry
+	}
+	// first instant of the month after expiry
+	end := time.Date(e.Year, time.Month(e.Month)+1, 1, 0, 0, 0, 0, now.Location())
+	if !now.Before(end) {
+		return ErrExpired
+	}
+	return nil
+}
+
+func (e Expiry) String() string {
+	return fmt.Sprintf("%02d/%02d", e.Month, e.Year%100)
+}
+
+// Card holds the details needed to charge a card. The CVV is deliberately
+// not part of it, it must never be stored.
+type Card struct {
+	PAN    PAN
+	Holder string
+	Expiry Expiry
+}
+
+// New parses number and expiry and checks the card hasn't expired at now.
+func New(number, holder, expiry string, now time.Time) (Card, error) {
+	pan, err := ParsePAN(number)
+	if err != nil {
+		return Card{}, err
+	}
+	exp, err := ParseExpiry(expiry)
+	if err != nil {
+		return Card{}, err
+	}
+	c := Card{PAN: pan, Holder: holder, Expiry: exp}
+	if err := c.Validate(now); err != nil {
+		return Card{}, err
+	}
+	return c, nil
+}
+
+// Validate checks the number and the expiry date.
+func (c Card) Validate(now time.Time) error {
+	if c.PAN.IsZero() {
+		return ErrInvalidNumber
+	}
+	if !Luhn(c.PAN.Reveal()) {
+		return ErrLuhn
+	}
+	return c.Expiry.Validate(now)
+}
+
+// Brand detects the card network from the number.
+func (c Card) Brand() Brand {
+	return c.PAN.Brand()
+}
+
+func (c Card) String() string {
+	return fmt.Sprintf("%s %s %s", c.Brand(), c.PAN.Masked(), c.Expiry)
+}
+
+func (c Card) GoString() string {
+	return fmt.Sprintf("card.Card{PAN:%#v, Holder:%q, Expiry:%q}", c.PAN, c.Holder, c.Expiry.String())
+}
+
+// Format keeps %+v and friends from walking the fields.
+func (c Card) Format(f fmt.State, verb rune) {
+	if verb == 'v' && f.Flag('#') {
+		fmt.Fprint(f, c.GoString())
+		return
+	}
+	fmt.Fprint(f, c.String())
+}
@@ -0,0 +1,227 @@
+package card
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+const visa = "4111111111111111"
+
+func TestLuhn(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want bool
+	}{
+		{visa, true},
+		{"4111111111111112", false},
+		{"378282246310005", true},
+		{"0", true},
+		{"", false},
+		{"4111 1111 1111 1111", false}, // Luhn wants bare digits
+		{"411111111111111a", false},
+	} {
+		if got := Luhn(tc.in); got != tc.want {
+			t.Errorf("Luhn(%q) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestParsePAN(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want error
+	}{
+		{"4111 1111-1111 1111", nil},
+		{"4111111111111112", ErrLuhn},
+		{"41111111111", ErrInvalidNumber},
+		{"41111111111111111111", ErrInvalidNumber},
+		{"4111x11111111111", ErrInvalidNumber},
+		{"", ErrInvalidNumber},
+	} {
+		p, err := ParsePAN(tc.in)
+		if !errors.Is(err, tc.want) {
+			t.Errorf("ParsePAN(%q) = %v, want %v", tc.in, err, tc.want)
+		}
+		if err == nil && p.Reveal() != visa {
+			t.Errorf("ParsePAN(%q).Reveal() = %q", tc.in, p.Reveal())
+		}
+	}
+}
+
+func TestDetectBrand(t *testing.T) {
+	for _, tc := range []struct {
+		number string
+		want   Brand
+	}{
+		{visa, Visa},
+		{"4222222222222", Visa},
+		{"5555555555554444", Mastercard},
+		{"2223003122003222", Mastercard},
+		{"378282246310005", Amex},
+		{"6011111111111117", Discover},
+		{"6221260000000000", Discover},
+		{"6500000000000002", Discover},
+		{"6521500000000006", RuPay}, // inside Discover's 65 block
+		{"5085000000000007", RuPay},
+		{"36227206271667", Diners},
+		{"3530111333300000", JCB},
+		{"6759649826438453", Maestro},
+		{"9999999999999995", Unknown},
+		{"411111111111111", Unknown}, // Visa prefix, wrong length
+		{"", Unknown},
+	} {
+		if got := DetectBrand(tc.number); got != tc.want {
+			t.Errorf("DetectBrand(%s) = %s, want %s", tc.number, got, tc.want)
+		}
+	}
+}
+
+func TestParseExpiry(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want Expiry
+		ok   bool
+	}{
+		{"12/25", Expiry{12, 2025}, true},
+		{"01/2031", Expiry{1, 2031}, true},
+		{"3/27", Expiry{3, 2027}, true},
+		{"12/25xyz", Expiry{}, false},
+		{"12/25 ", Expiry{}, false},
+		{" 12/25", Expiry{}, false},
+		{"+1/25", Expiry{}, false},
+		{"-1/25", Expiry{}, false},
+		{"12/-25", Expiry{}, false},
+		{"13/25", Expiry{}, false},
+		{"00/25", Expiry{}, false},
+		{"012/25", Expiry{}, false},
+		{"12/025", Expiry{}, false},
+		{"12/5", Expiry{}, false},
+		{"1225", Expiry{}, false},
+		{"12/25/01", Expiry{}, false},
+		{"", Expiry{}, false},
+	} {
+		got, err := ParseExpiry(tc.in)
+		if tc.ok != (err == nil) || got != tc.want {
+			t.Errorf("ParseExpiry(%q) = %v, %v", tc.in, got, err)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidExpiry) {
+			t.Errorf("ParseExpiry(%q) error %v is not ErrInvalidExpiry", tc.in, err)
+		}
+	}
+}
+
+func TestExpiryValidate(t *testing.T) {
+	e := Expiry{Month: 2, Year: 2028}
+	lastMoment := time.Date(2028, time.February, 29, 23, 59, 59, 0, time.UTC)
+	if err := e.Validate(lastMoment); err != nil {
+		t.Errorf("on the last day of the month: %v", err)
+	}
+	if err := e.Validate(lastMoment.Add(time.Second)); !errors.Is(err, ErrExpired) {
+		t.Errorf("the month after: %v, want ErrExpired", err)
+	}
+	// December rolls over into the next year
+	if err := (Expiry{12, 2027}).Validate(time.Date(2027, time.December, 31, 12, 0, 0, 0, time.UTC)); err != nil {
+		t.Errorf("in December: %v", err)
+	}
+	if err := (Expiry{0, 2027}).Validate(lastMoment); !errors.Is(err, ErrInvalidExpiry) {
+		t.Errorf("month 0: %v", err)
+	}
+	if s := (Expiry{3, 2031}).String(); s != "03/31" {
+		t.Errorf("String = %q", s)
+	}
+}
+
+func TestNew(t *testing.T) {
+	now := time.Date(2026, time.October, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := New(visa, "R Sur", "09/26", now); !errors.Is(err, ErrExpired) {
+		t.Errorf("expired card: %v", err)
+	}
+	if _, err := New(visa, "R Sur", "9/26x", now); !errors.Is(err, ErrInvalidExpiry) {
+		t.Errorf("bad expiry: %v", err)
+	}
+	c, err := New(visa, "R Sur", "10/26", now)
+	if err != nil || c.Brand() != Visa {
+		t.Fatalf("New = %v, %v", c, err)
+	}
+}
+
+// No verb, flag or nesting prints more than the last four digits.
+func TestFormatMasks(t *testing.T) {
+	c, err := New(visa, "R Sur", "12/30", time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	type wrapper struct {
+		card Card
+		pan  *PAN
+	}
+	w := wrapper{card: c, pan: &c.PAN}
+	for _, verb := range []string{"%v", "%+v", "%#v", "%s", "%q", "%x", "%X", "%d", "%10.3v"} {
+		for _, v := range []any{c, c.PAN, &c, w, []Card{c}, map[string]PAN{"p": c.PAN}} {
+			out := fmt.Sprintf(verb, v)
+			if strings.Contains(out, "411111") || strings.Contains(out, "3431") {
+				t.Errorf("Sprintf(%s, %T) leaks the number: %s", verb, v, out)
+			}
+		}
+	}
+	if got := fmt.Sprint(c); got != "visa ************1111 12/30" {
+		t.Errorf("%%v = %q", got)
+	}
+	if got := fmt.Sprintf("%#v", c.PAN); got != `card.PAN("************1111")` {
+		t.Errorf("%%#v = %q", got)
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "411111") || !strings.Contains(string(b), `"************1111"`) {
+		t.Errorf("JSON = %s", b)
+	}
+	if c.PAN.Last4() != "1111" || (PAN{}).Masked() != "" {
+		t.Errorf("Last4 = %q", c.PAN.Last4())
+	}
+}
+
+func TestVault(t *testing.T) {
+	v, err := NewVault(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewVault(make([]byte, 10)); err == nil {
+		t.Error("NewVault accepted a 10 byte key")
+	}
+	c, _ := New(visa, "R Sur", "12/99", time.Now())
+	tok, err := v.Tokenize(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(tok), "1111") {
+		t.Errorf("token %q carries card digits", tok)
+	}
+	info, err := v.Lookup(tok)
+	if err != nil || info.Brand != Visa || info.Last4 != "1111" {
+		t.Errorf("Lookup = %+v, %v", info, err)
+	}
+	back, err := v.Detokenize(tok)
+	if err != nil || back.PAN.Reveal() != visa || back.Holder != "R Sur" || back.Expiry != c.Expiry {
+		t.Errorf("Detokenize = %#v, %v", back, err)
+	}
+
+	// a ciphertext moved under another token must not open
+	other, _ := v.Tokenize(c)
+	v.mu.Lock()
+	v.entries[other] = v.entries[tok]
+	v.mu.Unlock()
+	if _, err := v.Detokenize(other); err == nil {
+		t.Error("swapped ciphertext decrypted")
+	}
+
+	v.Delete(tok)
+	if _, err := v.Detokenize(tok); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("after Delete: %v", err)
+	}
+}
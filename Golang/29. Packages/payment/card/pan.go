@@ -0,0 +1,133 @@
+package card
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrInvalidNumber = errors.New("card: number must be 12 to 19 digits")
+	ErrLuhn          = errors.New("card: number fails luhn check")
+)
+
+// PAN is a primary account number (the long number on the card).
+//
+// The digits live behind a pointer so that fmt never prints them, not even
+// when a PAN is nested inside an unexported struct field. String, GoString,
+// Format and MarshalJSON only ever reveal the last four digits; use Reveal
+// when the full number is really needed (for example by a gateway).
+type PAN struct {
+	digits *string
+}
+
+// ParsePAN strips spaces and dashes from s, then checks its length and
+// Luhn checksum.
+func ParsePAN(s string) (PAN, error) {
+	digits := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, s)
+
+	if len(digits) < 12 || len(digits) > 19 {
+		return PAN{}, ErrInvalidNumber
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return PAN{}, ErrInvalidNumber
+		}
+	}
+	if !Luhn(digits) {
+		return PAN{}, ErrLuhn
+	}
+
+	return PAN{digits: &digits}, nil
+}
+
+// Luhn reports whether digits passes the mod 10 checksum.
+// Any non digit character makes it fail.
+func Luhn(digits string) bool {
+	if digits == "" {
+		return false
+	}
+
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		c := digits[i]
+		if c < '0' || c > '9' {
+			return false
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+
+	return sum%10 == 0
+}
+
+// IsZero reports whether p holds no number.
+func (p PAN) IsZero() bool {
+	return p.digits == nil
+}
+
+// Reveal returns the full number.
+func (p PAN) Reveal() string {
+	if p.digits == nil {
+		return ""
+	}
+	return *p.digits
+}
+
+// Last4 returns the last four digits.
+func (p PAN) Last4() string {
+	n := p.Reveal()
+	if len(n) < 4 {
+		return ""
+	}
+	return n[len(n)-4:]
+}
+
+// Masked returns the number with everything but the last four digits
+// replaced by '*'.
+func (p PAN) Masked() string {
+	n := p.Reveal()
+	if len(n) < 4 {
+		return ""
+	}
+	return strings.Repeat("*", len(n)-4) + n[len(n)-4:]
+}
+
+// Brand detects the card network from the number's BIN.
+func (p PAN) Brand() Brand {
+	return DetectBrand(p.Reveal())
+}
+
+func (p PAN) String() string {
+	return p.Masked()
+}
+
+func (p PAN) GoString() string {
+	return fmt.Sprintf("card.PAN(%q)", p.Masked())
+}
+
+// Format makes every verb, including %#v and %x, print the masked number.
+func (p PAN) Format(f fmt.State, verb rune) {
+	if verb == 'v' && f.Flag('#') {
+		fmt.Fprint(f, p.GoString())
+		return
+	}
+	fmt.Fprint(f, p.Masked())
+}
+
+func (p PAN) MarshalJSON() ([]byte, error) {
+	return fmt.Appendf(nil, "%q", p.Masked()), nil
+}
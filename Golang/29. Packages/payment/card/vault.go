@@ -0,0 +1,152 @@
+package card
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrTokenNotFound = errors.New("card: token not found")
+
+// Token is an opaque reference to a card stored in a Vault. It is safe to
+// log and to keep in the order database.
+type Token string
+
+// Info is the non sensitive part of a stored card, useful for showing
+// "Visa ending 1111" without decrypting anything.
+type Info struct {
+	Brand  Brand
+	Last4  string
+	Expiry Expiry
+}
+
+type vaultEntry struct {
+	info       Info
+	nonce      []byte
+	ciphertext []byte
+}
+
+// sealed card fields, only ever seen in encrypted form
+type sealedCard struct {
+	Number string `json:"number"`
+	Holder string `json:"holder"`
+	Month  int    `json:"month"`
+	Year   int    `json:"year"`
+}
+
+// Vault keeps card details encrypted with AES-GCM and hands out tokens in
+// their place. It is safe for concurrent use.
+type Vault struct {
+	mu      sync.RWMutex
+	aead    cipher.AEAD
+	entries map[Token]vaultEntry
+}
+
+// NewVault creates a vault using key, which must be 16, 24 or 32 bytes
+// long to select AES-128, AES-192 or AES-256.
+func NewVault(key []byte) (*Vault, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("card: vault key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Vault{
+		aead:    aead,
+		entries: make(map[Token]vaultEntry),
+	}, nil
+}
+
+// Tokenize validates c, encrypts it and returns a new token for it.
+func (v *Vault) Tokenize(c Card) (Token, error) {
+	if err := c.Validate(time.Now()); err != nil {
+		return "", err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	token := Token("tok_" + hex.EncodeToString(id))
+
+	plain, err := json.Marshal(sealedCard{
+		Number: c.PAN.Reveal(),
+		Holder: c.Holder,
+		Month:  c.Expiry.Month,
+		Year:   c.Expiry.Year,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, v.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	// the token is bound as additional data so a ciphertext can't be
+	// swapped under a different token
+	ciphertext := v.aead.Seal(nil, nonce, plain, []byte(token))
+	clear(plain)
+
+	v.mu.Lock()
+	v.entries[token] = vaultEntry{
+		info:       Info{Brand: c.Brand(), Last4: c.PAN.Last4(), Expiry: c.Expiry},
+		nonce:      nonce,
+		ciphertext: ciphertext,
+	}
+	v.mu.Unlock()
+
+	return token, nil
+}
+
+// Detokenize decrypts the card stored under t.
+func (v *Vault) Detokenize(t Token) (Card, error) {
+	v.mu.RLock()
+	e, ok := v.entries[t]
+	v.mu.RUnlock()
+	if !ok {
+		return Card{}, ErrTokenNotFound
+	}
+
+	plain, err := v.aead.Open(nil, e.nonce, e.ciphertext, []byte(t))
+	if err != nil {
+		return Card{}, fmt.Errorf("card: decrypt %s: %w", t, err)
+	}
+	defer clear(plain)
+
+	var s sealedCard
+	if err := json.Unmarshal(plain, &s); err != nil {
+		return Card{}, err
+	}
+	pan, err := ParsePAN(s.Number)
+	if err != nil {
+		return Card{}, err
+	}
+	return Card{PAN: pan, Holder: s.Holder, Expiry: Expiry{Month: s.Month, Year: s.Year}}, nil
+}
+
+// Lookup returns the display details of t without decrypting the card.
+func (v *Vault) Lookup(t Token) (Info, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	e, ok := v.entries[t]
+	if !ok {
+		return Info{}, ErrTokenNotFound
+	}
+	return e.info, nil
+}
+
+// Delete removes t from the vault. Deleting an unknown token is a no-op.
+func (v *Vault) Delete(t Token) {
+	v.mu.Lock()
+	delete(v.entries, t)
+	v.mu.Unlock()
+}
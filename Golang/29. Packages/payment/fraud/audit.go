@@ -0,0 +1,49 @@
+package fraud
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// JSONAuditLog writes each decision as one JSON line.
+type JSONAuditLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func NewJSONAuditLog(w io.Writer) *JSONAuditLog {
+	return &JSONAuditLog{enc: json.NewEncoder(w)}
+}
+
+type auditEntry struct {
+	LoggedAt time.Time `json:"logged_at"`
+	Result
+}
+
+func (l *JSONAuditLog) Log(r Result) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// an audit write error must not stop payments, so it is dropped here
+	_ = l.enc.Encode(auditEntry{LoggedAt: time.Now(), Result: r})
+}
+
+// MemoryAuditLog keeps decisions in memory, mainly for tests and debugging.
+type MemoryAuditLog struct {
+	mu      sync.Mutex
+	results []Result
+}
+
+func (l *MemoryAuditLog) Log(r Result) {
+	l.mu.Lock()
+	l.results = append(l.results, r)
+	l.mu.Unlock()
+}
+
+// Results returns a copy of everything logged so far.
+func (l *MemoryAuditLog) Results() []Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Result(nil), l.results...)
+}
@@ -0,0 +1,238 @@
+// Package fraud screens payments before they reach the gateway. A
+// configurable set of rules adds up to a risk score which decides whether
+// a payment is allowed, held for review or blocked.
+package fraud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Decision string
+
+const (
+	Allow  Decision = "allow"
+	Review Decision = "review"
+	Block  Decision = "block"
+)
+
+// Transaction is what the engine knows about a payment attempt.
+type Transaction struct {
+	ID               string    `json:"id"`
+	CustomerID       string    `json:"customer_id"`
+	CardToken        string    `json:"card_token,omitempty"`
+	Amount           float32   `json:"amount"`
+	BillingCountry   string    `json:"billing_country,omitempty"`
+	IPCountry        string    `json:"ip_country,omitempty"`
+	AccountCreatedAt time.Time `json:"account_created_at,omitzero"`
+	At               time.Time `json:"at"`
+}
+
+// Result is the outcome of screening one transaction.
+type Result struct {
+	Transaction Transaction `json:"transaction"`
+	Decision    Decision    `json:"decision"`
+	Score       int         `json:"score"`
+	Reasons     []string    `json:"reasons,omitempty"`
+	Rules       []string    `json:"rules,omitempty"` // names of the rules that fired
+}
+
+// AuditLogger receives every decision the engine makes.
+type AuditLogger interface {
+	Log(Result)
+}
+
+type ruleTable struct {
+	set   RuleSet
+	rules []rule
+}
+
+// Engine evaluates transactions against the current rule set. The rule set
+// can be replaced at any time with Load while payments are being screened.
+type Engine struct {
+	table    atomic.Pointer[ruleTable]
+	velocity *velocity
+	audit    AuditLogger
+
+	mu  sync.Mutex // guards now
+	now func() time.Time
+}
+
+// NewEngine compiles rs. audit may be nil.
+func NewEngine(rs RuleSet, audit AuditLogger) (*Engine, error) {
+	e := &Engine{
+		velocity: newVelocity(),
+		audit:    audit,
+		now:      time.Now,
+	}
+	if err := e.Swap(rs); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// SetClock replaces time.Now, used for transactions that don't carry a
+// time and to tell how old remembered payments are.
+func (e *Engine) SetClock(now func() time.Time) {
+	e.mu.Lock()
+	e.now = now
+	e.mu.Unlock()
+	e.velocity.setClock(now)
+}
+
+func (e *Engine) clock() time.Time {
+	e.mu.Lock()
+	now := e.now
+	e.mu.Unlock()
+	return now()
+}
+
+// Swap installs rs. Evaluations already running finish with the old rules.
+func (e *Engine) Swap(rs RuleSet) error {
+	rules, err := rs.compile()
+	if err != nil {
+		return err
+	}
+
+	var longest time.Duration
+	for _, r := range rules {
+		longest = max(longest, time.Duration(r.config.Window))
+	}
+	e.velocity.setMaxAge(longest)
+	e.table.Store(&ruleTable{set: rs, rules: rules})
+	return nil
+}
+
+// Load reads a JSON rule set from r and swaps it in. On error the current
+// rules stay in place.
+func (e *Engine) Load(r io.Reader) error {
+	var rs RuleSet
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rs); err != nil {
+		return fmt.Errorf("fraud: decode rules: %w", err)
+	}
+	return e.Swap(rs)
+}
+
+// LoadFile is Load for a file path.
+func (e *Engine) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return e.Load(f)
+}
+
+// RuleSet returns the rules currently in use.
+func (e *Engine) RuleSet() RuleSet {
+	return e.table.Load().set
+}
+
+// Watch reloads path whenever its modification time changes, checking every
+// interval until ctx is done. Reload errors are passed to onError (if not
+// nil) and the previous rules are kept.
+func (e *Engine) Watch(ctx context.Context, path string, interval time.Duration, onError func(error)) {
+	var last time.Time
+	if fi, err := os.Stat(path); err == nil {
+		last = fi.ModTime()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fi, err := os.Stat(path)
+			if err != nil || fi.ModTime().Equal(last) {
+				continue
+			}
+			last = fi.ModTime()
+			if err := e.LoadFile(path); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// Evaluate scores tx, records it for velocity checks and logs the result.
+func (e *Engine) Evaluate(tx Transaction) Result {
+	if tx.At.IsZero() {
+		tx.At = e.clock()
+	}
+	if tx.CustomerID != "" {
+		e.velocity.record("customer:"+tx.CustomerID, tx.At)
+	}
+	if tx.CardToken != "" {
+		e.velocity.record("card:"+tx.CardToken, tx.At)
+	}
+
+	t := e.table.Load()
+	res := Result{Transaction: tx, Decision: Allow}
+	hardBlock := false
+	for _, r := range t.rules {
+		reason, ok := r.match(tx, e.velocity)
+		if !ok {
+			continue
+		}
+		res.Score += r.config.Score
+		res.Reasons = append(res.Reasons, r.config.Name+": "+reason)
+		res.Rules = append(res.Rules, r.config.Name)
+		hardBlock = hardBlock || r.config.Block
+	}
+
+	switch {
+	case hardBlock || res.Score >= t.set.BlockScore:
+		res.Decision = Block
+	case res.Score >= t.set.ReviewScore:
+		res.Decision = Review
+	}
+
+	if e.audit != nil {
+		e.audit.Log(res)
+	}
+	return res
+}
+
+// DecisionError is returned by Screen when a payment isn't allowed.
+type DecisionError struct {
+	Result Result
+}
+
+func (e *DecisionError) Error() string {
+	return fmt.Sprintf("fraud: payment %s: %s (score %d)", e.Result.Transaction.ID, e.Result.Decision, e.Result.Score)
+}
+
+var (
+	ErrBlocked = errors.New("fraud: payment blocked")
+	ErrReview  = errors.New("fraud: payment held for review")
+)
+
+// Is lets callers use errors.Is(err, ErrBlocked) or ErrReview.
+func (e *DecisionError) Is(target error) bool {
+	return (target == ErrBlocked && e.Result.Decision == Block) ||
+		(target == ErrReview && e.Result.Decision == Review)
+}
+
+// Screen evaluates tx and only calls pay when it is allowed, so it can sit
+// in front of a gateway's pay method:
+//
+//	_, err := engine.Screen(tx, func(amount float32) { gateway.pay(amount) })
+func (e *Engine) Screen(tx Transaction, pay func(amount float32)) (Result, error) {
+	res := e.Evaluate(tx)
+	if res.Decision != Allow {
+		return res, &DecisionError{Result: res}
+	}
+	pay(tx.Amount)
+	return res, nil
+}
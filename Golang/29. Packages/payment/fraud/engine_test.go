@@ -0,0 +1,220 @@
+package fraud
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func amountRules(review, block int) RuleSet {
+	return RuleSet{ReviewScore: review, BlockScore: block, Rules: []RuleConfig{
+		{Name: "large", Type: RuleAmount, Above: 1000, Score: 30},
+		{Name: "foreign-ip", Type: RuleCountryMismatch, Score: 25},
+		{Name: "new-account", Type: RuleNewAccount, MaxAge: Duration(24 * time.Hour), Score: 20},
+		{Name: "huge", Type: RuleAmount, Above: 100000, Score: 1, Block: true},
+	}}
+}
+
+func TestDecisionThresholds(t *testing.T) {
+	e, err := NewEngine(amountRules(50, 75), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	young := t0.Add(-time.Hour)
+	for _, tc := range []struct {
+		name  string
+		tx    Transaction
+		score int
+		want  Decision
+	}{
+		{"nothing fires", Transaction{Amount: 10}, 0, Allow},
+		{"below review", Transaction{Amount: 5000}, 30, Allow},
+		{"exactly review", Transaction{Amount: 5000, AccountCreatedAt: young}, 50, Review},
+		{"between", Transaction{Amount: 5000, BillingCountry: "IN", IPCountry: "SG"}, 55, Review},
+		{"exactly block", Transaction{Amount: 5000, BillingCountry: "IN", IPCountry: "SG", AccountCreatedAt: young}, 75, Block},
+		{"hard block with a low score", Transaction{Amount: 100001}, 31, Block},
+		{"old account", Transaction{Amount: 10, AccountCreatedAt: t0.Add(-48 * time.Hour)}, 0, Allow},
+		{"same country", Transaction{Amount: 10, BillingCountry: "IN", IPCountry: "IN"}, 0, Allow},
+	} {
+		tc.tx.At = t0
+		res := e.Evaluate(tc.tx)
+		if res.Score != tc.score || res.Decision != tc.want {
+			t.Errorf("%s: %s with score %d, want %s with %d (%v)", tc.name, res.Decision, res.Score, tc.want, tc.score, res.Reasons)
+		}
+		if len(res.Rules) != len(res.Reasons) {
+			t.Errorf("%s: rules %v and reasons %v differ in length", tc.name, res.Rules, res.Reasons)
+		}
+	}
+}
+
+func TestScreen(t *testing.T) {
+	e, _ := NewEngine(amountRules(50, 75), nil)
+	paid := 0
+	pay := func(float32) { paid++ }
+
+	if _, err := e.Screen(Transaction{ID: "p1", Amount: 10, At: t0}, pay); err != nil || paid != 1 {
+		t.Errorf("allowed payment: %v, paid %d times", err, paid)
+	}
+	_, err := e.Screen(Transaction{ID: "p2", Amount: 200000, At: t0}, pay)
+	var de *DecisionError
+	if !errors.As(err, &de) || !errors.Is(err, ErrBlocked) || errors.Is(err, ErrReview) {
+		t.Errorf("blocked payment: %v", err)
+	}
+	_, err = e.Screen(Transaction{ID: "p3", Amount: 5000, AccountCreatedAt: t0, At: t0}, pay)
+	if !errors.Is(err, ErrReview) || !strings.Contains(err.Error(), "payment p3: review (score 50)") {
+		t.Errorf("payment for review: %v", err)
+	}
+	if paid != 1 {
+		t.Errorf("pay called %d times, want only for the allowed payment", paid)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	f, err := os.Open("rules.example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	e, _ := NewEngine(amountRules(50, 75), nil)
+	if err := e.Load(f); err != nil {
+		t.Fatalf("Load(rules.example.json) = %v", err)
+	}
+	if rs := e.RuleSet(); len(rs.Rules) != 6 || rs.Rules[0].Window != Duration(10*time.Minute) {
+		t.Errorf("loaded %+v", rs)
+	}
+
+	for _, tc := range []struct {
+		name, json, want string
+	}{
+		{"unknown type", `{"review_score":1,"block_score":2,"rules":[{"name":"x","type":"geo"}]}`, `rule "x": unknown rule type "geo"`},
+		{"unknown field", `{"review_score":1,"block_score":2,"rules":[{"name":"x","type":"amount","abvoe":5}]}`, `unknown field "abvoe"`},
+		{"duration not a string", `{"review_score":1,"block_score":2,"rules":[{"name":"x","type":"velocity","key":"card","window":600,"max":1}]}`, `duration must be a string`},
+		{"bad duration", `{"review_score":1,"block_score":2,"rules":[{"name":"x","type":"velocity","key":"card","window":"ten","max":1}]}`, `invalid duration`},
+		{"bad velocity key", `{"review_score":1,"block_score":2,"rules":[{"name":"x","type":"velocity","key":"ip","window":"1m","max":1}]}`, `velocity key must be customer or card`},
+		{"no name", `{"review_score":1,"block_score":2,"rules":[{"type":"amount","above":5}]}`, `rule 0 has no name`},
+		{"duplicate", `{"review_score":1,"block_score":2,"rules":[{"name":"x","type":"country_mismatch"},{"name":"x","type":"country_mismatch"}]}`, `duplicate rule name "x"`},
+		{"thresholds", `{"review_score":50,"block_score":10,"rules":[]}`, `need 0 < review_score <= block_score`},
+		{"not json", `review_score: 1`, `decode rules`},
+	} {
+		err := e.Load(strings.NewReader(tc.json))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: Load = %v, want %q", tc.name, err, tc.want)
+		}
+	}
+	// failed loads keep the rules that were in use
+	if rs := e.RuleSet(); len(rs.Rules) != 6 {
+		t.Errorf("after failed loads the engine has %d rules, want 6", len(rs.Rules))
+	}
+}
+
+// Evaluations racing with Swap see one rule set or the other, never a mix.
+func TestSwapWhileEvaluating(t *testing.T) {
+	lenient := RuleSet{ReviewScore: 100, BlockScore: 200, Rules: []RuleConfig{
+		{Name: "a", Type: RuleAmount, Above: 1, Score: 10},
+	}}
+	strict := RuleSet{ReviewScore: 10, BlockScore: 20, Rules: []RuleConfig{
+		{Name: "a", Type: RuleAmount, Above: 1, Score: 10},
+		{Name: "b", Type: RuleAmount, Above: 1, Score: 10},
+	}}
+	e, _ := NewEngine(lenient, nil)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			rs := lenient
+			if i%2 == 0 {
+				rs = strict
+			}
+			if err := e.Swap(rs); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	var evals sync.WaitGroup
+	for w := range 8 {
+		evals.Add(1)
+		go func() {
+			defer evals.Done()
+			for i := range 500 {
+				res := e.Evaluate(Transaction{ID: fmt.Sprint(w, "-", i), CustomerID: fmt.Sprint("c", w), Amount: 5, At: t0})
+				ok := (res.Score == 10 && res.Decision == Allow) || (res.Score == 20 && res.Decision == Block)
+				if !ok {
+					t.Errorf("score %d decided %s: rules and thresholds from different sets", res.Score, res.Decision)
+					return
+				}
+			}
+		}()
+	}
+	evals.Wait()
+	close(stop)
+	wg.Wait()
+}
+
+func TestSetClock(t *testing.T) {
+	e, _ := NewEngine(amountRules(50, 75), nil)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range 100 {
+			e.Evaluate(Transaction{Amount: 1})
+		}
+	}()
+	e.SetClock(func() time.Time { return t0 })
+	wg.Wait()
+	if res := e.Evaluate(Transaction{Amount: 1}); !res.Transaction.At.Equal(t0) {
+		t.Errorf("At = %v, want the engine clock's %v", res.Transaction.At, t0)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	var mem MemoryAuditLog
+	e, _ := NewEngine(amountRules(50, 75), &mem)
+	e.Evaluate(Transaction{ID: "p1", Amount: 10, At: t0})
+	e.Evaluate(Transaction{ID: "p2", Amount: 5000, BillingCountry: "IN", IPCountry: "US", At: t0})
+
+	got := mem.Results()
+	if len(got) != 2 || got[0].Transaction.ID != "p1" || got[0].Decision != Allow {
+		t.Fatalf("audit = %+v", got)
+	}
+	if !slices.Equal(got[1].Rules, []string{"large", "foreign-ip"}) || got[1].Decision != Review {
+		t.Errorf("second entry = %+v", got[1])
+	}
+	got[0].Decision = Block
+	if mem.Results()[0].Decision != Allow {
+		t.Error("Results shares its slice with the log")
+	}
+
+	var buf bytes.Buffer
+	e, _ = NewEngine(amountRules(50, 75), NewJSONAuditLog(&buf))
+	e.Evaluate(Transaction{ID: "p3", Amount: 200000, At: t0})
+	var entry struct {
+		LoggedAt time.Time `json:"logged_at"`
+		Result
+	}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("audit line %q: %v", buf.String(), err)
+	}
+	if entry.LoggedAt.IsZero() || entry.Transaction.ID != "p3" || entry.Decision != Block || len(entry.Reasons) != 2 {
+		t.Errorf("audit entry = %+v", entry)
+	}
+	if strings.Count(buf.String(), "\n") != 1 {
+		t.Errorf("audit log is not one line per decision: %q", buf.String())
+	}
+}
@@ -0,0 +1,159 @@
+package fraud
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Duration is a time.Duration that reads and writes JSON as "10m", "24h".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("fraud: duration must be a string like \"10m\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("fraud: %w", err)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Rule types understood by the engine.
+const (
+	RuleVelocity        = "velocity"
+	RuleAmount          = "amount"
+	RuleCountryMismatch = "country_mismatch"
+	RuleNewAccount      = "new_account"
+)
+
+// RuleConfig describes one rule. Only the fields relevant to Type are used.
+type RuleConfig struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Score int    `json:"score"`
+	// Block makes a match block the payment whatever the total score is.
+	Block bool `json:"block,omitempty"`
+
+	// velocity: more than Max payments per Key ("customer" or "card")
+	// within Window
+	Key    string   `json:"key,omitempty"`
+	Window Duration `json:"window,omitempty"`
+	Max    int      `json:"max,omitempty"`
+
+	// amount: payments strictly above Above
+	Above float32 `json:"above,omitempty"`
+
+	// new_account: accounts younger than MaxAge
+	MaxAge Duration `json:"max_age,omitempty"`
+}
+
+// RuleSet is the full configuration. A total score at or above BlockScore
+// blocks the payment, at or above ReviewScore sends it to manual review.
+type RuleSet struct {
+	ReviewScore int          `json:"review_score"`
+	BlockScore  int          `json:"block_score"`
+	Rules       []RuleConfig `json:"rules"`
+}
+
+// rule is a compiled RuleConfig. match returns the reason when it fires.
+type rule struct {
+	config RuleConfig
+	match  func(tx Transaction, v *velocity) (string, bool)
+}
+
+func (rs RuleSet) compile() ([]rule, error) {
+	if rs.ReviewScore <= 0 || rs.BlockScore < rs.ReviewScore {
+		return nil, fmt.Errorf("fraud: need 0 < review_score <= block_score, got %d and %d", rs.ReviewScore, rs.BlockScore)
+	}
+
+	rules := make([]rule, 0, len(rs.Rules))
+	names := make(map[string]bool)
+	for i, c := range rs.Rules {
+		if c.Name == "" {
+			return nil, fmt.Errorf("fraud: rule %d has no name", i)
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("fraud: duplicate rule name %q", c.Name)
+		}
+		names[c.Name] = true
+
+		m, err := matcher(c)
+		if err != nil {
+			return nil, fmt.Errorf("fraud: rule %q: %w", c.Name, err)
+		}
+		rules = append(rules, rule{config: c, match: m})
+	}
+	return rules, nil
+}
+
+func matcher(c RuleConfig) (func(Transaction, *velocity) (string, bool), error) {
+	switch c.Type {
+	case RuleVelocity:
+		if c.Key != "customer" && c.Key != "card" {
+			return nil, fmt.Errorf("velocity key must be customer or card, got %q", c.Key)
+		}
+		if c.Window <= 0 || c.Max <= 0 {
+			return nil, fmt.Errorf("velocity needs a positive window and max")
+		}
+		window := time.Duration(c.Window)
+		return func(tx Transaction, v *velocity) (string, bool) {
+			key := tx.CustomerID
+			if c.Key == "card" {
+				key = tx.CardToken
+			}
+			if key == "" {
+				return "", false
+			}
+			n := v.count(c.Key+":"+key, tx.At, window)
+			if n <= c.Max {
+				return "", false
+			}
+			return fmt.Sprintf("%d payments by %s within %s (max %d)", n, c.Key, window, c.Max), true
+		}, nil
+
+	case RuleAmount:
+		if c.Above <= 0 {
+			return nil, fmt.Errorf("amount needs a positive above")
+		}
+		return func(tx Transaction, _ *velocity) (string, bool) {
+			if tx.Amount <= c.Above {
+				return "", false
+			}
+			return fmt.Sprintf("amount %.2f above %.2f", tx.Amount, c.Above), true
+		}, nil
+
+	case RuleCountryMismatch:
+		return func(tx Transaction, _ *velocity) (string, bool) {
+			if tx.BillingCountry == "" || tx.IPCountry == "" || tx.BillingCountry == tx.IPCountry {
+				return "", false
+			}
+			return fmt.Sprintf("billing country %s but paying from %s", tx.BillingCountry, tx.IPCountry), true
+		}, nil
+
+	case RuleNewAccount:
+		if c.MaxAge <= 0 {
+			return nil, fmt.Errorf("new_account needs a positive max_age")
+		}
+		maxAge := time.Duration(c.MaxAge)
+		return func(tx Transaction, _ *velocity) (string, bool) {
+			if tx.AccountCreatedAt.IsZero() {
+				return "", false
+			}
+			age := tx.At.Sub(tx.AccountCreatedAt)
+			if age >= maxAge {
+				return "", false
+			}
+			return fmt.Sprintf("account created %s ago", age.Round(time.Minute)), true
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown rule type %q", c.Type)
+}
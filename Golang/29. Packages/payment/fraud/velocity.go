@@ -0,0 +1,100 @@
+package fraud
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// velocity remembers when each customer or card last paid. Each key's times
+// are kept sorted, so payments reported late still land in the right place.
+type velocity struct {
+	mu     sync.Mutex
+	seen   map[string][]time.Time
+	maxAge time.Duration
+	now    func() time.Time
+	swept  time.Time // reference time of the last full sweep
+}
+
+func newVelocity() *velocity {
+	return &velocity{seen: make(map[string][]time.Time), now: time.Now}
+}
+
+// record notes a payment for key at t and drops the key's entries that are
+// older than the longest window ending at t. Keys whose payments have all
+// aged out are removed by a sweep that runs at most once per maxAge.
+//
+// The sweep measures age from t, but never from later than the clock, so a
+// payment dated in the future can't age out every other key's history.
+func (v *velocity) record(key string, t time.Time) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	times := v.seen[key]
+	i, _ := slices.BinarySearchFunc(times, t, func(a, b time.Time) int { return a.Compare(b) })
+	for i < len(times) && times[i].Equal(t) {
+		i++
+	}
+	times = slices.Insert(times, i, t)
+	if times = v.prune(times, t); len(times) == 0 {
+		delete(v.seen, key)
+	} else {
+		v.seen[key] = times
+	}
+
+	ref := t
+	if now := v.now(); now.Before(ref) {
+		ref = now
+	}
+	if ref.Sub(v.swept) > v.maxAge {
+		v.sweep(ref)
+	}
+}
+
+// prune drops the times that fall outside every window ending at ref.
+func (v *velocity) prune(times []time.Time, ref time.Time) []time.Time {
+	cutoff := ref.Add(-v.maxAge)
+	i := 0
+	for i < len(times) && times[i].Before(cutoff) {
+		i++
+	}
+	return times[i:]
+}
+
+func (v *velocity) sweep(ref time.Time) {
+	for key, times := range v.seen {
+		if times = v.prune(times, ref); len(times) == 0 {
+			delete(v.seen, key)
+		} else {
+			v.seen[key] = times
+		}
+	}
+	v.swept = ref
+}
+
+// count returns how many payments key made in (t-window, t].
+func (v *velocity) count(key string, t time.Time, window time.Duration) int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	n := 0
+	cutoff := t.Add(-window)
+	for _, at := range v.seen[key] {
+		if at.After(cutoff) && !at.After(t) {
+			n++
+		}
+	}
+	return n
+}
+
+func (v *velocity) setClock(now func() time.Time) {
+	v.mu.Lock()
+	v.now = now
+	v.mu.Unlock()
+}
+
+func (v *velocity) setMaxAge(d time.Duration) {
+	v.mu.Lock()
+	v.maxAge = d
+	v.mu.Unlock()
+}
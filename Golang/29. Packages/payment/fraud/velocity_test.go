@@ -0,0 +1,87 @@
+package fraud
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+var t0 = time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func TestVelocityOutOfOrder(t *testing.T) {
+	v := newVelocity()
+	v.setMaxAge(10 * time.Minute)
+
+	v.record("c", t0.Add(5*time.Minute))
+	v.record("c", t0) // reported late
+	v.record("c", t0.Add(2*time.Minute))
+
+	if n := v.count("c", t0.Add(5*time.Minute), 10*time.Minute); n != 3 {
+		t.Errorf("count at +5m = %d, want 3", n)
+	}
+	if n := v.count("c", t0.Add(2*time.Minute), time.Minute); n != 1 {
+		t.Errorf("count in (1m, 2m] = %d, want 1", n)
+	}
+	if n := v.count("c", t0.Add(11*time.Minute), 10*time.Minute); n != 2 {
+		t.Errorf("count at +11m = %d, want 2", n)
+	}
+}
+
+func TestVelocityPrunesIdleKeys(t *testing.T) {
+	v := newVelocity()
+	v.setMaxAge(time.Minute)
+
+	for i := range 1000 {
+		v.record(fmt.Sprint("card:", i), t0.Add(time.Duration(i)*time.Second))
+	}
+	if n := len(v.seen); n > 121 {
+		t.Errorf("%d keys kept for a one minute window, want at most 121", n)
+	}
+	v.record("late", t0) // older than every window
+	v.record("card:next", t0.Add(1000*time.Second+2*time.Minute))
+	if _, ok := v.seen["late"]; ok {
+		t.Error("payment older than the longest window survived a sweep")
+	}
+}
+
+// A payment dated in the future only affects its own key.
+func TestVelocityFutureDated(t *testing.T) {
+	v := newVelocity()
+	v.setMaxAge(10 * time.Minute)
+	v.setClock(func() time.Time { return t0.Add(5 * time.Minute) })
+
+	v.record("customer:a", t0)
+	v.record("customer:b", t0.Add(time.Minute))
+	v.record("customer:c", t0.Add(365*24*time.Hour))
+	v.record("customer:a", t0.Add(2*time.Minute))
+
+	if n := v.count("customer:a", t0.Add(5*time.Minute), 10*time.Minute); n != 2 {
+		t.Errorf("customer a has %d payments, want 2", n)
+	}
+	if n := v.count("customer:b", t0.Add(5*time.Minute), 10*time.Minute); n != 1 {
+		t.Errorf("customer b has %d payments, want 1", n)
+	}
+}
+
+func TestEvaluateVelocity(t *testing.T) {
+	e, err := NewEngine(RuleSet{ReviewScore: 40, BlockScore: 80, Rules: []RuleConfig{
+		{Name: "burst", Type: RuleVelocity, Key: "customer", Window: Duration(10 * time.Minute), Max: 2, Score: 40},
+	}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tc := range []struct {
+		at   time.Duration
+		want Decision
+	}{
+		{0, Allow},
+		{20 * time.Minute, Allow},
+		{15 * time.Minute, Allow}, // reported late
+		{21 * time.Minute, Review},
+	} {
+		res := e.Evaluate(Transaction{ID: fmt.Sprint(i), CustomerID: "c1", At: t0.Add(tc.at)})
+		if want := tc.want; res.Decision != want {
+			t.Errorf("payment %d: %s, want %s", i, res.Decision, want)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package upi
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rajasur/programming-learning/GO/qrcode"
+)
+
+var (
+	ErrInvalidAmount = errors.New("upi: amount must be positive")
+	ErrNotUPI        = errors.New("upi: not a upi://pay URI")
+)
+
+// Request is a UPI payment request as described in the NPCI linking
+// specification.
+type Request struct {
+	Payee        VPA    // pa, required
+	PayeeName    string // pn
+	Amount       int64  // am, in paise; 0 lets the payer enter it
+	Note         string // tn
+	TxnRef       string // tr
+	MerchantCode string // mc
+}
+
+// Validate checks the fields that upi apps reject.
+func (r Request) Validate() error {
+	if err := r.Payee.Validate(); err != nil {
+		return err
+	}
+	if r.Amount < 0 {
+		return ErrInvalidAmount
+	}
+	if utf8.RuneCountInString(r.Note) > 80 {
+		return errors.New("upi: note longer than 80 characters")
+	}
+	if utf8.RuneCountInString(r.TxnRef) > 35 {
+		return errors.New("upi: transaction ref longer than 35 characters")
+	}
+	return nil
+}
+
+// URI returns the upi://pay intent for r.
+func (r Request) URI() (string, error) {
+	if err := r.Validate(); err != nil {
+		return "", err
+	}
+
+	// parameters are written in a fixed order so the same request always
+	// produces the same URI (and the same QR code)
+	params := [][2]string{{"pa", string(r.Payee)}}
+	if r.PayeeName != "" {
+		params = append(params, [2]string{"pn", r.PayeeName})
+	}
+	if r.MerchantCode != "" {
+		params = append(params, [2]string{"mc", r.MerchantCode})
+	}
+	if r.TxnRef != "" {
+		params = append(params, [2]string{"tr", r.TxnRef})
+	}
+	if r.Note != "" {
+		params = append(params, [2]string{"tn", r.Note})
+	}
+	if r.Amount > 0 {
+		params = append(params, [2]string{"am", formatAmount(r.Amount)})
+	}
+	params = append(params, [2]string{"cu", "INR"})
+
+	var sb strings.Builder
+	sb.WriteString("upi://pay?")
+	for i, p := range params {
+		if i > 0 {
+			sb.WriteByte('&')
+		}
+		sb.WriteString(p[0])
+		sb.WriteByte('=')
+		sb.WriteString(escape(p[1]))
+	}
+	return sb.String(), nil
+}
+
+// Parse reads a upi://pay URI back into a Request.
+func Parse(uri string) (Request, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return Request{}, err
+	}
+	if u.Scheme != "upi" || u.Host != "pay" {
+		return Request{}, ErrNotUPI
+	}
+	q, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return Request{}, err
+	}
+	if cu := q.Get("cu"); cu != "" && cu != "INR" {
+		return Request{}, fmt.Errorf("upi: unsupported currency %q", cu)
+	}
+
+	r := Request{
+		Payee:        VPA(strings.ToLower(q.Get("pa"))),
+		PayeeName:    q.Get("pn"),
+		Note:         q.Get("tn"),
+		TxnRef:       q.Get("tr"),
+		MerchantCode: q.Get("mc"),
+	}
+	if am := q.Get("am"); am != "" {
+		if r.Amount, err = parseAmount(am); err != nil {
+			return Request{}, err
+		}
+	}
+	return r, r.Validate()
+}
+
+// QR encodes the request URI as a QR code. Medium error correction is what
+// most printed UPI stickers use.
+func (r Request) QR() (*qrcode.Code, error) {
+	uri, err := r.URI()
+	if err != nil {
+		return nil, err
+	}
+	return qrcode.EncodeString(uri, qrcode.Medium)
+}
+
+// WritePNG writes the request's QR code as a PNG with scale pixels per module.
+func (r Request) WritePNG(w io.Writer, scale int) error {
+	code, err := r.QR()
+	if err != nil {
+		return err
+	}
+	return code.WritePNG(w, scale)
+}
+
+// Terminal returns the request's QR code as block art for a terminal.
+func (r Request) Terminal(invert bool) (string, error) {
+	code, err := r.QR()
+	if err != nil {
+		return "", err
+	}
+	return code.Terminal(invert), nil
+}
+
+// escape percent-encodes v. Spaces become %20 since several upi apps show
+// a literal '+' in the note, and '@' is kept so the VPA stays readable.
+var unescaper = strings.NewReplacer("+", "%20", "%40", "@")
+
+func escape(v string) string {
+	return unescaper.Replace(url.QueryEscape(v))
+}
+
+func formatAmount(paise int64) string {
+	return fmt.Sprintf("%d.%02d", paise/100, paise%100)
+}
+
+// parseAmount reads "500", "500.5" or "500.50". Only digits are accepted
+// on either side of the point, so signs and exponents are rejected.
+func parseAmount(s string) (int64, error) {
+	rupees, frac, hasFrac := strings.Cut(s, ".")
+	if !digits(rupees) || hasFrac && !digits(frac) {
+		return 0, fmt.Errorf("upi: invalid amount %q", s)
+	}
+	if len(frac) > 2 {
+		return 0, fmt.Errorf("upi: amount %q has more than two decimals", s)
+	}
+	frac += strings.Repeat("0", 2-len(frac))
+
+	r, err := strconv.ParseInt(rupees, 10, 64)
+	if err != nil || r > math.MaxInt64/100-1 {
+		return 0, fmt.Errorf("upi: amount %q is too large", s)
+	}
+	p, _ := strconv.ParseInt(frac, 10, 64)
+	return r*100 + p, nil
+}
+
+func digits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range []byte(s) {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,181 @@
+package upi
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/rajasur/programming-learning/GO/qrcode"
+)
+
+func TestParseVPA(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want VPA
+		ok   bool
+	}{
+		{" Raja.Sur@OKAXIS ", "raja.sur@okaxis", true},
+		{"9876543210@ybl", "9876543210@ybl", true},
+		{"shop_42-in@paytm", "shop_42-in@paytm", true},
+		{"raja", "", false},
+		{"@okaxis", "", false},
+		{"r@okaxis", "", false}, // handle too short
+		{"raja@1bank", "", false},
+		{"raja@ok axis", "", false},
+		{"raja@@okaxis", "", false},
+	} {
+		got, err := ParseVPA(tc.in)
+		if tc.ok != (err == nil) || got != tc.want {
+			t.Errorf("ParseVPA(%q) = %q, %v", tc.in, got, err)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidVPA) {
+			t.Errorf("ParseVPA(%q) error %v is not ErrInvalidVPA", tc.in, err)
+		}
+	}
+	v := VPA("raja@okaxis")
+	if v.Handle() != "raja" || v.PSP() != "okaxis" {
+		t.Errorf("Handle, PSP = %q, %q", v.Handle(), v.PSP())
+	}
+}
+
+// The reference URIs are what the NPCI linking specification and the
+// common UPI apps produce for these requests.
+func TestURI(t *testing.T) {
+	for _, tc := range []struct {
+		r    Request
+		want string
+	}{
+		{
+			Request{Payee: "raja@okaxis"},
+			"upi://pay?pa=raja@okaxis&cu=INR",
+		},
+		{
+			Request{Payee: "shop@ybl", PayeeName: "Raja Sur & Sons", Amount: 49950, Note: "Order #42", TxnRef: "ord_42", MerchantCode: "5411"},
+			"upi://pay?pa=shop@ybl&pn=Raja%20Sur%20%26%20Sons&mc=5411&tr=ord_42&tn=Order%20%2342&am=499.50&cu=INR",
+		},
+		{
+			Request{Payee: "shop@ybl", Amount: 5},
+			"upi://pay?pa=shop@ybl&am=0.05&cu=INR",
+		},
+	} {
+		got, err := tc.r.URI()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("URI() =\n\t%s\nwant\n\t%s", got, tc.want)
+		}
+		back, err := Parse(got)
+		if err != nil {
+			t.Fatalf("Parse(%s): %v", got, err)
+		}
+		if back != tc.r {
+			t.Errorf("Parse(URI()) = %+v, want %+v", back, tc.r)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	r, err := Parse("upi://pay?pa=Raja@OkAxis&pn=Raja+Sur&am=100&tn=rent%20may")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Request{Payee: "raja@okaxis", PayeeName: "Raja Sur", Amount: 10000, Note: "rent may"}
+	if r != want {
+		t.Errorf("Parse = %+v, want %+v", r, want)
+	}
+
+	for _, uri := range []string{
+		"https://pay?pa=raja@okaxis",
+		"upi://collect?pa=raja@okaxis",
+		"upi://pay?pa=raja@okaxis&cu=USD",
+		"upi://pay?pa=raja",
+		"upi://pay?pa=raja@okaxis&am=abc",
+	} {
+		if _, err := Parse(uri); err == nil {
+			t.Errorf("Parse(%q) succeeded", uri)
+		}
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want int64
+		ok   bool
+	}{
+		{"0", 0, true},
+		{"1", 100, true},
+		{"1.5", 150, true},
+		{"1.50", 150, true},
+		{"1.05", 105, true},
+		{"92233720368547758.00", 0, false},
+		{"1.505", 0, false},
+		{"1.", 0, false},
+		{".5", 0, false},
+		{"1.-5", 0, false},
+		{"1.+5", 0, false},
+		{"-0.50", 0, false},
+		{"-1", 0, false},
+		{"+1", 0, false},
+		{"1e3", 0, false},
+		{" 1", 0, false},
+		{"", 0, false},
+	} {
+		got, err := parseAmount(tc.in)
+		if tc.ok != (err == nil) || got != tc.want {
+			t.Errorf("parseAmount(%q) = %d, %v", tc.in, got, err)
+		}
+	}
+}
+
+func TestValidateCountsRunes(t *testing.T) {
+	r := Request{Payee: "raja@okaxis", Note: strings.Repeat("न", 80), TxnRef: strings.Repeat("é", 35)}
+	if err := r.Validate(); err != nil {
+		t.Errorf("80-rune note and 35-rune ref: %v", err)
+	}
+	r.Note += "न"
+	if err := r.Validate(); err == nil {
+		t.Error("81-rune note accepted")
+	}
+	if err := (Request{Payee: "raja@okaxis", Amount: -1}).Validate(); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("negative amount: %v", err)
+	}
+}
+
+func TestQR(t *testing.T) {
+	r := Request{Payee: "shop@ybl", PayeeName: "Shop", Amount: 49950, TxnRef: "ord_42"}
+	uri, _ := r.URI()
+	code, err := r.QR()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := qrcode.EncodeString(uri, qrcode.Medium)
+	if code.Level != qrcode.Medium || code.Size != want.Size {
+		t.Fatalf("QR is %v size %d, want M size %d", code.Level, code.Size, want.Size)
+	}
+	for y := range code.Size {
+		for x := range code.Size {
+			if code.Dark(x, y) != want.Dark(x, y) {
+				t.Fatalf("module (%d,%d) differs from the encoded URI", x, y)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := r.WritePNG(&buf, 4); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := png.Decode(&buf); err != nil {
+		t.Errorf("WritePNG output: %v", err)
+	}
+	art, err := r.Terminal(false)
+	if err != nil || !strings.ContainsAny(art, "█▀▄") {
+		t.Errorf("Terminal() = %.20q, %v", art, err)
+	}
+	if _, err := (Request{Payee: "bad"}).QR(); err == nil {
+		t.Error("QR of an invalid request succeeded")
+	}
+}
@@ -0,0 +1,48 @@
+// Package upi builds UPI payment requests: it validates virtual payment
+// addresses, generates upi://pay intent URIs and renders them as QR codes
+// that any UPI app can scan.
+package upi
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var ErrInvalidVPA = errors.New("upi: invalid VPA, expected handle@psp")
+
+// handle: letters, digits, dot, dash and underscore; psp: starts with a letter.
+var vpaPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{1,255}@[a-zA-Z][a-zA-Z0-9]{1,63}$`)
+
+// VPA is a virtual payment address such as "raja@okaxis".
+type VPA string
+
+// ParseVPA trims s, lower cases it and checks its syntax.
+func ParseVPA(s string) (VPA, error) {
+	v := VPA(strings.ToLower(strings.TrimSpace(s)))
+	if err := v.Validate(); err != nil {
+		return "", err
+	}
+	return v, nil
+}
+
+// Validate checks the syntax only; whether the address exists can only be
+// verified with the payer's bank.
+func (v VPA) Validate() error {
+	if !vpaPattern.MatchString(string(v)) {
+		return ErrInvalidVPA
+	}
+	return nil
+}
+
+// Handle returns the part before '@'.
+func (v VPA) Handle() string {
+	h, _, _ := strings.Cut(string(v), "@")
+	return h
+}
+
+// PSP returns the payment service provider part after '@'.
+func (v VPA) PSP() string {
+	_, psp, _ := strings.Cut(string(v), "@")
+	return psp
+}
@@ -0,0 +1,110 @@
+package pipeline
+
+import (
+	"sync"
+	"time"
+)
+
+// Batch groups values into slices of up to size, sending a shorter batch
+// when maxWait has passed since its first value arrived. A maxWait of 0
+// only sends full batches, and the remainder at the end.
+func Batch[T any](p *Pipeline, in <-chan T, size int, maxWait time.Duration, opts ...StageOption) <-chan []T {
+	c := p.config("batch", opts)
+	out := make(chan []T, c.buffer)
+	ctx := p.ctx
+	size = max(size, 1)
+	p.run(c.name, func() error {
+		defer close(out)
+		var (
+			batch []T
+			timer *time.Timer
+			tick  <-chan time.Time
+		)
+		flush := func() bool {
+			if timer != nil {
+				timer.Stop()
+				timer, tick = nil, nil
+			}
+			if len(batch) == 0 {
+				return true
+			}
+			b := batch
+			batch = nil
+			return send(ctx, out, b)
+		}
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					flush()
+					return nil
+				}
+				batch = append(batch, v)
+				if len(batch) == 1 && maxWait > 0 {
+					timer = time.NewTimer(maxWait)
+					tick = timer.C
+				}
+				if len(batch) >= size && !flush() {
+					return nil
+				}
+			case <-tick:
+				timer, tick = nil, nil
+				if !flush() {
+					return nil
+				}
+			case <-ctx.Done():
+				if timer != nil {
+					timer.Stop()
+				}
+				return nil
+			}
+		}
+	})
+	return out
+}
+
+// FanOut splits in across n channels, each value going to whichever
+// consumer is ready first.
+func FanOut[T any](p *Pipeline, in <-chan T, n int, opts ...StageOption) []<-chan T {
+	c := p.config("fanout", opts)
+	outs := make([]<-chan T, max(n, 1))
+	for i := range outs {
+		out := make(chan T, c.buffer)
+		outs[i] = out
+		p.run(c.name, func() error {
+			defer close(out)
+			for {
+				v, ok := recv(p.ctx, in)
+				if !ok || !send(p.ctx, out, v) {
+					return nil
+				}
+			}
+		})
+	}
+	return outs
+}
+
+// Merge combines channels into one, in no particular order.
+func Merge[T any](p *Pipeline, ins []<-chan T, opts ...StageOption) <-chan T {
+	c := p.config("merge", opts)
+	out := make(chan T, c.buffer)
+	var wg sync.WaitGroup
+	wg.Add(len(ins))
+	for _, in := range ins {
+		p.run(c.name, func() error {
+			defer wg.Done()
+			for {
+				v, ok := recv(p.ctx, in)
+				if !ok || !send(p.ctx, out, v) {
+					return nil
+				}
+			}
+		})
+	}
+	p.run(c.name, func() error {
+		wg.Wait()
+		close(out)
+		return nil
+	})
+	return out
+}
@@ -0,0 +1,165 @@
+// Package pipeline builds concurrent pipelines out of plain functions.
+//
+// Stages are connected by channels. Each stage runs its function on one or
+// more workers, and the unbuffered (or small) channels between stages give
+// backpressure: a slow stage holds up the ones before it instead of letting
+// work pile up. The first stage to fail cancels the whole pipeline.
+//
+//	p := pipeline.New(ctx)
+//	nums := pipeline.FromSlice(p, []int{1, 2, 3, 4})
+//	squares := pipeline.Map(p, nums, square, pipeline.WithWorkers(4), pipeline.WithOrdered())
+//	batches := pipeline.Batch(p, squares, 100, time.Second)
+//	err := pipeline.ForEach(p, batches, save)
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var errStopped = errors.New("pipeline: stopped")
+
+// StageError reports the stage a pipeline failed in.
+type StageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("pipeline: stage %s: %v", e.Stage, e.Err)
+}
+
+func (e *StageError) Unwrap() error { return e.Err }
+
+// Pipeline owns the goroutines of a set of connected stages.
+type Pipeline struct {
+	parent context.Context
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	err    error
+	stages int
+}
+
+// New starts an empty pipeline. Cancelling ctx stops every stage.
+func New(ctx context.Context) *Pipeline {
+	p := &Pipeline{parent: ctx}
+	p.ctx, p.cancel = context.WithCancelCause(ctx)
+	return p
+}
+
+// Context is cancelled when the pipeline fails or is stopped.
+func (p *Pipeline) Context() context.Context { return p.ctx }
+
+// Stop cancels the pipeline without it counting as a failure, for
+// consumers that are done early.
+func (p *Pipeline) Stop() { p.cancel(errStopped) }
+
+// Wait waits for every stage to finish and returns the first stage error,
+// or the parent context's error if that ended the pipeline.
+func (p *Pipeline) Wait() error {
+	p.wg.Wait()
+	p.cancel(errStopped)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	return p.parent.Err()
+}
+
+func (p *Pipeline) fail(stage string, err error) {
+	p.mu.Lock()
+	if p.err == nil && p.ctx.Err() == nil {
+		p.err = &StageError{Stage: stage, Err: err}
+		p.cancel(p.err)
+	}
+	p.mu.Unlock()
+}
+
+// run calls fn on a goroutine owned by the pipeline, turning a panic into
+// a failure of the stage.
+func (p *Pipeline) run(stage string, fn func() error) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				p.fail(stage, fmt.Errorf("panic: %v", r))
+			}
+		}()
+		if err := fn(); err != nil {
+			p.fail(stage, err)
+		}
+	}()
+}
+
+type StageOption func(*stageConfig)
+
+type stageConfig struct {
+	name    string
+	workers int
+	ordered bool
+	buffer  int
+}
+
+// WithWorkers runs the stage function on n goroutines. The default is 1.
+func WithWorkers(n int) StageOption {
+	return func(c *stageConfig) { c.workers = max(n, 1) }
+}
+
+// WithOrdered keeps the output in input order when there is more than one
+// worker. A slow item then holds back the ones after it, up to one per
+// worker.
+func WithOrdered() StageOption {
+	return func(c *stageConfig) { c.ordered = true }
+}
+
+// WithBuffer sets the capacity of the stage's output channel. The default
+// of 0 hands each value straight to the next stage.
+func WithBuffer(n int) StageOption {
+	return func(c *stageConfig) { c.buffer = max(n, 0) }
+}
+
+// WithName names the stage in errors. Unnamed stages are numbered in the
+// order they were added, e.g. "map#2".
+func WithName(name string) StageOption {
+	return func(c *stageConfig) { c.name = name }
+}
+
+func (p *Pipeline) config(kind string, opts []StageOption) stageConfig {
+	p.mu.Lock()
+	p.stages++
+	c := stageConfig{name: fmt.Sprintf("%s#%d", kind, p.stages), workers: 1}
+	p.mu.Unlock()
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// send delivers v unless the pipeline is cancelled first.
+func send[T any](ctx context.Context, ch chan<- T, v T) bool {
+	select {
+	case ch <- v:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// recv takes the next value, reporting false once in is closed or the
+// pipeline is cancelled.
+func recv[T any](ctx context.Context, in <-chan T) (T, bool) {
+	select {
+	case v, ok := <-in:
+		return v, ok
+	case <-ctx.Done():
+		var zero T
+		return zero, false
+	}
+}
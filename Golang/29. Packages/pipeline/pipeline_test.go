@@ -0,0 +1,361 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func ints(n int) []int {
+	s := make([]int, n)
+	for i := range s {
+		s[i] = i
+	}
+	return s
+}
+
+func square(_ context.Context, v int) (int, error) { return v * v, nil }
+
+func TestMapOrdered(t *testing.T) {
+	p := New(context.Background())
+	in := FromSlice(p, ints(500))
+	out := Map(p, in, func(_ context.Context, v int) (int, error) {
+		// jitter so later items often finish first
+		time.Sleep(time.Duration(rand.N(50)) * time.Microsecond)
+		return v * v, nil
+	}, WithWorkers(8), WithOrdered())
+	got, err := Collect(p, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range got {
+		if v != i*i {
+			t.Fatalf("got[%d] = %d, want %d", i, v, i*i)
+		}
+	}
+	if len(got) != 500 {
+		t.Fatalf("got %d values, want 500", len(got))
+	}
+}
+
+func TestMapUnordered(t *testing.T) {
+	p := New(context.Background())
+	out := Map(p, FromSlice(p, ints(500)), square, WithWorkers(8), WithBuffer(16))
+	got, err := Collect(p, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(got)
+	for i, v := range got {
+		if v != i*i {
+			t.Fatalf("sorted got[%d] = %d, want %d", i, v, i*i)
+		}
+	}
+}
+
+func TestFilterFlatMapOrdered(t *testing.T) {
+	p := New(context.Background())
+	even := Filter(p, FromSlice(p, ints(10)), func(_ context.Context, v int) (bool, error) {
+		return v%2 == 0, nil
+	}, WithWorkers(3), WithOrdered())
+	twice := FlatMap(p, even, func(_ context.Context, v int, emit func(int) bool) error {
+		emit(v)
+		emit(-v)
+		return nil
+	}, WithWorkers(3), WithOrdered())
+	got, err := Collect(p, twice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{0, 0, 2, -2, 4, -4, 6, -6, 8, -8}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestBatchBySize(t *testing.T) {
+	p := New(context.Background())
+	got, err := Collect(p, Batch(p, FromSlice(p, ints(10)), 3, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]int{{0, 1, 2}, {3, 4, 5}, {6, 7, 8}, {9}}
+	if !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// A partial batch goes out once maxWait has passed, without waiting for
+// more input.
+func TestBatchByTime(t *testing.T) {
+	p := New(context.Background())
+	release := make(chan struct{})
+	src := Generate(p, func(ctx context.Context, emit func(int) bool) error {
+		for i := range 3 {
+			emit(i)
+		}
+		select {
+		case <-release: // the first batch has arrived
+		case <-time.After(5 * time.Second):
+			return errors.New("partial batch never sent")
+		}
+		emit(3)
+		return nil
+	})
+	var got [][]int
+	err := ForEach(p, Batch(p, src, 10, 10*time.Millisecond), func(_ context.Context, b []int) error {
+		if got = append(got, b); len(got) == 1 {
+			close(release)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]int{{0, 1, 2}, {3}}; !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+var errBoom = errors.New("boom")
+
+// The first error cancels every stage, including an endless source, and
+// is reported with the stage's name.
+func TestErrorCancels(t *testing.T) {
+	p := New(context.Background())
+	var sourceDone sync.WaitGroup
+	sourceDone.Add(1)
+	src := Generate(p, func(ctx context.Context, emit func(int) bool) error {
+		defer sourceDone.Done()
+		for i := 0; emit(i); i++ {
+		}
+		return nil
+	})
+	out := Map(p, src, func(_ context.Context, v int) (int, error) {
+		if v == 100 {
+			return 0, errBoom
+		}
+		return v, nil
+	}, WithName("check"), WithWorkers(4), WithOrdered())
+	got, err := Collect(p, out)
+	var se *StageError
+	if !errors.As(err, &se) || se.Stage != "check" || !errors.Is(err, errBoom) {
+		t.Fatalf("err = %v, want boom from stage check", err)
+	}
+	if slices.Contains(got, 100) || !slices.IsSorted(got) {
+		t.Errorf("collected %v, want values in order without the failed one", got)
+	}
+	sourceDone.Wait()
+	if !errors.Is(context.Cause(p.Context()), errBoom) {
+		t.Errorf("cause = %v", context.Cause(p.Context()))
+	}
+}
+
+func TestSinkError(t *testing.T) {
+	p := New(context.Background())
+	err := ForEach(p, FromSlice(p, ints(10)), func(_ context.Context, v int) error {
+		if v == 3 {
+			return errBoom
+		}
+		return nil
+	})
+	var se *StageError
+	if !errors.As(err, &se) || se.Stage != "sink" {
+		t.Fatalf("err = %v, want a sink StageError", err)
+	}
+}
+
+func TestPanic(t *testing.T) {
+	p := New(context.Background())
+	out := Map(p, FromSlice(p, ints(10)), func(_ context.Context, v int) (int, error) {
+		if v == 5 {
+			panic("bad item")
+		}
+		return v, nil
+	})
+	_, err := Collect(p, out)
+	if err == nil || !strings.Contains(err.Error(), "map#2: panic: bad item") {
+		t.Fatalf("err = %v, want the panic reported for map#2", err)
+	}
+}
+
+func TestStop(t *testing.T) {
+	p := New(context.Background())
+	src := Generate(p, func(ctx context.Context, emit func(int) bool) error {
+		for i := 0; emit(i); i++ {
+		}
+		return nil
+	})
+	n := 0
+	for range src {
+		if n++; n == 10 {
+			p.Stop()
+			break
+		}
+	}
+	if err := p.Wait(); err != nil {
+		t.Fatalf("Wait after Stop = %v, want nil", err)
+	}
+}
+
+func TestParentCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := New(ctx)
+	src := Generate(p, func(ctx context.Context, emit func(int) bool) error {
+		for i := 0; emit(i); i++ {
+		}
+		return nil
+	})
+	err := ForEach(p, Map(p, src, square), func(_ context.Context, v int) error {
+		if v > 100 {
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+}
+
+func TestFanOutMerge(t *testing.T) {
+	p := New(context.Background())
+	parts := FanOut(p, FromSlice(p, ints(1000)), 4)
+	for i, part := range parts {
+		parts[i] = Map(p, part, square)
+	}
+	got, err := Collect(p, Merge(p, parts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(got)
+	if len(got) != 1000 || got[999] != 999*999 {
+		t.Errorf("got %d values, last %d", len(got), got[len(got)-1])
+	}
+}
+
+// The benchmarks compare a stage against the hand-written goroutine and
+// channel it replaces, to show what the error handling, cancellation and
+// ordering cost per item.
+
+const benchItems = 10_000
+
+func work(v int) int {
+	for range 200 {
+		v = v*31 + 7
+	}
+	return v
+}
+
+func naiveSource(n int) <-chan int {
+	out := make(chan int)
+	go func() {
+		defer close(out)
+		for i := range n {
+			out <- i
+		}
+	}()
+	return out
+}
+
+func naiveMap(in <-chan int, workers int) <-chan int {
+	out := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for range workers {
+		go func() {
+			defer wg.Done()
+			for v := range in {
+				out <- work(v)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+// naiveOrdered keeps order by giving each item a result channel, queued
+// in input order.
+func naiveOrdered(in <-chan int, workers int) <-chan int {
+	results := make(chan chan int, workers)
+	sem := make(chan struct{}, workers)
+	go func() {
+		defer close(results)
+		for v := range in {
+			r := make(chan int, 1)
+			results <- r
+			sem <- struct{}{}
+			go func() {
+				r <- work(v)
+				<-sem
+			}()
+		}
+	}()
+	out := make(chan int)
+	go func() {
+		defer close(out)
+		for r := range results {
+			out <- <-r
+		}
+	}()
+	return out
+}
+
+func BenchmarkMap(b *testing.B) {
+	stage := func(_ context.Context, v int) (int, error) { return work(v), nil }
+	for _, workers := range []int{1, 8} {
+		b.Run(fmt.Sprintf("naive/workers=%d", workers), func(b *testing.B) {
+			for b.Loop() {
+				for range naiveMap(naiveSource(benchItems), workers) {
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("pipeline/workers=%d", workers), func(b *testing.B) {
+			for b.Loop() {
+				p := New(context.Background())
+				out := Map(p, FromSlice(p, ints(benchItems)), stage, WithWorkers(workers))
+				ForEach(p, out, func(context.Context, int) error { return nil })
+			}
+		})
+	}
+	b.Run("naive/ordered", func(b *testing.B) {
+		for b.Loop() {
+			for range naiveOrdered(naiveSource(benchItems), 8) {
+			}
+		}
+	})
+	b.Run("pipeline/ordered", func(b *testing.B) {
+		for b.Loop() {
+			p := New(context.Background())
+			out := Map(p, FromSlice(p, ints(benchItems)), stage, WithWorkers(8), WithOrdered())
+			ForEach(p, out, func(context.Context, int) error { return nil })
+		}
+	})
+}
+
+func BenchmarkBatch(b *testing.B) {
+	b.Run("naive", func(b *testing.B) {
+		for b.Loop() {
+			var batch []int
+			for v := range naiveSource(benchItems) {
+				if batch = append(batch, v); len(batch) == 100 {
+					batch = nil
+				}
+			}
+		}
+	})
+	b.Run("pipeline", func(b *testing.B) {
+		for b.Loop() {
+			p := New(context.Background())
+			out := Batch(p, FromSlice(p, ints(benchItems)), 100, time.Second)
+			ForEach(p, out, func(context.Context, []int) error { return nil })
+		}
+	})
+}
@@ -0,0 +1,55 @@
+package pipeline
+
+import "context"
+
+// FromSlice emits items in order.
+func FromSlice[T any](p *Pipeline, items []T, opts ...StageOption) <-chan T {
+	return Generate(p, func(ctx context.Context, emit func(T) bool) error {
+		for _, v := range items {
+			if !emit(v) {
+				break
+			}
+		}
+		return nil
+	}, opts...)
+}
+
+// Generate runs fn once to produce the pipeline's input. emit returns false
+// once the pipeline is cancelled, and fn should then return. Any channel
+// can also be used as input directly.
+func Generate[T any](p *Pipeline, fn func(ctx context.Context, emit func(T) bool) error, opts ...StageOption) <-chan T {
+	c := p.config("source", opts)
+	out := make(chan T, c.buffer)
+	p.run(c.name, func() error {
+		defer close(out)
+		return fn(p.ctx, func(v T) bool { return send(p.ctx, out, v) })
+	})
+	return out
+}
+
+// ForEach calls fn for every value of in, on the calling goroutine, and
+// then waits for the pipeline. An error from fn fails the pipeline.
+func ForEach[T any](p *Pipeline, in <-chan T, fn func(context.Context, T) error) error {
+	for {
+		v, ok := recv(p.ctx, in)
+		if !ok {
+			break
+		}
+		if err := fn(p.ctx, v); err != nil {
+			p.fail("sink", err)
+			break
+		}
+	}
+	return p.Wait()
+}
+
+// Collect gathers the values of in and waits for the pipeline. On error
+// the values gathered so far are returned with it.
+func Collect[T any](p *Pipeline, in <-chan T) ([]T, error) {
+	var out []T
+	err := ForEach(p, in, func(_ context.Context, v T) error {
+		out = append(out, v)
+		return nil
+	})
+	return out, err
+}
@@ -0,0 +1,126 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+)
+
+// Map applies fn to every value. An error fails the pipeline.
+func Map[In, Out any](p *Pipeline, in <-chan In, fn func(context.Context, In) (Out, error), opts ...StageOption) <-chan Out {
+	return process(p, p.config("map", opts), in, func(ctx context.Context, v In, emit func(Out) bool) error {
+		out, err := fn(ctx, v)
+		if err != nil {
+			return err
+		}
+		emit(out)
+		return nil
+	})
+}
+
+// Filter passes on the values keep returns true for.
+func Filter[T any](p *Pipeline, in <-chan T, keep func(context.Context, T) (bool, error), opts ...StageOption) <-chan T {
+	return process(p, p.config("filter", opts), in, func(ctx context.Context, v T, emit func(T) bool) error {
+		ok, err := keep(ctx, v)
+		if ok && err == nil {
+			emit(v)
+		}
+		return err
+	})
+}
+
+// FlatMap lets fn emit any number of values for each input.
+func FlatMap[In, Out any](p *Pipeline, in <-chan In, fn func(ctx context.Context, v In, emit func(Out) bool) error, opts ...StageOption) <-chan Out {
+	return process(p, p.config("flatmap", opts), in, fn)
+}
+
+// process runs fn on c.workers goroutines. Ordered output gives every input
+// a slot in a queue as long as the worker count; workers fill the slots
+// and a single emitter drains them in turn.
+func process[In, Out any](p *Pipeline, c stageConfig, in <-chan In, fn func(context.Context, In, func(Out) bool) error) <-chan Out {
+	out := make(chan Out, c.buffer)
+	ctx := p.ctx
+
+	if !c.ordered || c.workers == 1 {
+		var wg sync.WaitGroup
+		wg.Add(c.workers)
+		for range c.workers {
+			p.run(c.name, func() error {
+				defer wg.Done()
+				emit := func(v Out) bool { return send(ctx, out, v) }
+				for {
+					v, ok := recv(ctx, in)
+					if !ok {
+						return nil
+					}
+					if err := fn(ctx, v, emit); err != nil {
+						return err
+					}
+				}
+			})
+		}
+		p.run(c.name, func() error {
+			wg.Wait()
+			close(out)
+			return nil
+		})
+		return out
+	}
+
+	type slot struct {
+		done chan struct{}
+		vals []Out
+	}
+	type job struct {
+		v In
+		s *slot
+	}
+	slots := make(chan *slot, c.workers)
+	jobs := make(chan job)
+
+	p.run(c.name, func() error {
+		defer close(slots)
+		defer close(jobs)
+		for {
+			v, ok := recv(ctx, in)
+			if !ok {
+				return nil
+			}
+			s := &slot{done: make(chan struct{})}
+			if !send(ctx, slots, s) || !send(ctx, jobs, job{v, s}) {
+				return nil
+			}
+		}
+	})
+	for range c.workers {
+		p.run(c.name, func() error {
+			for j := range jobs {
+				err := fn(ctx, j.v, func(v Out) bool {
+					j.s.vals = append(j.s.vals, v)
+					return ctx.Err() == nil
+				})
+				close(j.s.done)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	p.run(c.name, func() error {
+		defer close(out)
+		for s := range slots {
+			select {
+			case <-s.done:
+			case <-ctx.Done():
+				return nil
+			}
+			for _, v := range s.vals {
+				if !send(ctx, out, v) {
+					return nil
+				}
+			}
+		}
+		return nil
+	})
+	return out
+}
@@ -0,0 +1,268 @@
+// Package pubsub is an in-process publish/subscribe broker over channels.
+//
+// Every subscription has its own buffered channel, so a slow subscriber
+// only affects others when its overflow policy is Block.
+//
+//	b := pubsub.New[order.StatusChange]()
+//	sub, _ := b.Subscribe(ctx, "orders.>", pubsub.WithPolicy(pubsub.DropOldest))
+//	go func() {
+//		for m := range sub.C() {
+//			log.Println(m.Topic, m.Value)
+//		}
+//	}()
+//	b.Publish(ctx, "orders.confirmed", change)
+package pubsub
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	ErrClosed       = errors.New("pubsub: broker is closed")
+	ErrSlowConsumer = errors.New("pubsub: subscriber disconnected, its buffer was full")
+	ErrUnsubscribed = errors.New("pubsub: unsubscribed")
+)
+
+// Message is a value together with the topic it was published on.
+type Message[T any] struct {
+	Topic string
+	Value T
+}
+
+// Broker routes published values to matching subscriptions. It is safe for
+// concurrent use.
+type Broker[T any] struct {
+	buffer int
+	policy Policy
+
+	mu       sync.RWMutex
+	exact    map[string]map[*Subscription[T]]struct{}
+	wild     map[*Subscription[T]]struct{}
+	nextID   uint64
+	closed   bool
+	inflight sync.WaitGroup // publishes in progress, for Close
+
+	published    atomic.Uint64
+	unmatched    atomic.Uint64
+	delivered    atomic.Uint64
+	dropped      atomic.Uint64
+	disconnected atomic.Uint64
+}
+
+type Option func(*config)
+
+type config struct {
+	buffer int
+	policy Policy
+}
+
+// WithBuffer sets the channel capacity of each subscription, 64 by default.
+func WithBuffer(n int) Option {
+	return func(c *config) { c.buffer = max(n, 0) }
+}
+
+// WithPolicy sets what happens when a subscription's buffer is full, Block
+// by default.
+func WithPolicy(p Policy) Option {
+	return func(c *config) { c.policy = p }
+}
+
+// New creates a broker. The options set defaults that Subscribe can
+// override per subscription.
+func New[T any](opts ...Option) *Broker[T] {
+	c := config{buffer: 64, policy: Block}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return &Broker[T]{
+		buffer: c.buffer,
+		policy: c.policy,
+		exact:  make(map[string]map[*Subscription[T]]struct{}),
+		wild:   make(map[*Subscription[T]]struct{}),
+	}
+}
+
+// Subscribe receives every value published to a topic matching pattern
+// until ctx is done or Unsubscribe is called, after which the channel is
+// closed.
+func (b *Broker[T]) Subscribe(ctx context.Context, pattern string, opts ...Option) (*Subscription[T], error) {
+	p, err := parsePattern(pattern, true)
+	if err != nil {
+		return nil, err
+	}
+	c := config{buffer: b.buffer, policy: b.policy}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, ErrClosed
+	}
+	b.nextID++
+	s := &Subscription[T]{
+		id:      b.nextID,
+		pattern: pattern,
+		p:       p,
+		policy:  c.policy,
+		broker:  b,
+		ch:      make(chan Message[T], c.buffer),
+		done:    make(chan struct{}),
+	}
+	if p.literal() {
+		set := b.exact[pattern]
+		if set == nil {
+			set = make(map[*Subscription[T]]struct{})
+			b.exact[pattern] = set
+		}
+		set[s] = struct{}{}
+	} else {
+		b.wild[s] = struct{}{}
+	}
+	s.stop = context.AfterFunc(ctx, func() { s.close(context.Cause(ctx)) })
+	return s, nil
+}
+
+func (b *Broker[T]) remove(s *Subscription[T]) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if set := b.exact[s.pattern]; set != nil {
+		delete(set, s)
+		if len(set) == 0 {
+			delete(b.exact, s.pattern)
+		}
+	}
+	delete(b.wild, s)
+}
+
+// Publish delivers v to every subscription matching topic, which must not
+// contain wildcards. It returns once each has the value queued, dropped it
+// or been disconnected by its policy. Only Block subscriptions can make it
+// wait; if ctx ends first they miss v, the others still get it, and the
+// context's error is returned.
+func (b *Broker[T]) Publish(ctx context.Context, topic string, v T) error {
+	t, err := parsePattern(topic, false)
+	if err != nil {
+		return err
+	}
+
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return ErrClosed
+	}
+	b.inflight.Add(1)
+	defer b.inflight.Done()
+	subs := make([]*Subscription[T], 0, len(b.exact[topic]))
+	for s := range b.exact[topic] {
+		subs = append(subs, s)
+	}
+	for s := range b.wild {
+		if s.p.match(t) {
+			subs = append(subs, s)
+		}
+	}
+	b.mu.RUnlock()
+
+	b.published.Add(1)
+	if len(subs) == 0 {
+		b.unmatched.Add(1)
+	}
+	m := Message[T]{Topic: topic, Value: v}
+	var first error
+	for _, s := range subs {
+		if err := s.deliver(ctx, m); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Close ends every subscription and makes Publish return ErrClosed. It
+// waits for publishes already under way.
+func (b *Broker[T]) Close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+	var subs []*Subscription[T]
+	for _, set := range b.exact {
+		for s := range set {
+			subs = append(subs, s)
+		}
+	}
+	for s := range b.wild {
+		subs = append(subs, s)
+	}
+	b.mu.Unlock()
+
+	for _, s := range subs {
+		s.close(ErrClosed)
+	}
+	b.inflight.Wait()
+}
+
+// Metrics is a snapshot of the broker's counters and subscriptions.
+type Metrics struct {
+	Published     uint64 // values published
+	Unmatched     uint64 // of those, values no subscription matched
+	Delivered     uint64 // values queued to subscriptions
+	Dropped       uint64 // values dropped by DropOldest and DropNewest
+	Disconnected  uint64 // subscriptions ended by Disconnect
+	Subscriptions []Stats
+}
+
+// Metrics returns the current counters. Delivered and Dropped include
+// subscriptions that have since ended.
+func (b *Broker[T]) Metrics() Metrics {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	m := Metrics{
+		Published:    b.published.Load(),
+		Unmatched:    b.unmatched.Load(),
+		Delivered:    b.delivered.Load(),
+		Dropped:      b.dropped.Load(),
+		Disconnected: b.disconnected.Load(),
+	}
+	add := func(s *Subscription[T]) {
+		m.Subscriptions = append(m.Subscriptions, s.Stats())
+	}
+	for _, set := range b.exact {
+		for s := range set {
+			add(s)
+		}
+	}
+	for s := range b.wild {
+		add(s)
+	}
+	slices.SortFunc(m.Subscriptions, func(a, b Stats) int { return cmp.Compare(a.ID, b.ID) })
+	return m
+}
+
+// Topics returns the patterns with at least one subscription.
+func (b *Broker[T]) Topics() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	seen := make(map[string]bool)
+	var out []string
+	for topic := range b.exact {
+		seen[topic] = true
+		out = append(out, topic)
+	}
+	for s := range b.wild {
+		if !seen[s.pattern] {
+			seen[s.pattern] = true
+			out = append(out, s.pattern)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
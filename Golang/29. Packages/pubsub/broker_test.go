@@ -0,0 +1,394 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, topic string
+		want           bool
+	}{
+		{"orders.created", "orders.created", true},
+		{"orders.created", "orders.confirmed", false},
+		{"orders.*", "orders.created", true},
+		{"orders.*", "orders.created.late", false},
+		{"orders.*", "orders", false},
+		{"orders.>", "orders.created", true},
+		{"orders.>", "orders.created.late", true},
+		{"orders.>", "orders", false},
+		{"*.created", "invoices.created", true},
+		{">", "anything.at.all", true},
+	}
+	for _, tt := range tests {
+		p, err := parsePattern(tt.pattern, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.match(strings.Split(tt.topic, ".")); got != tt.want {
+			t.Errorf("%q matches %q = %v, want %v", tt.pattern, tt.topic, got, tt.want)
+		}
+	}
+}
+
+func TestBadTopics(t *testing.T) {
+	b := New[int]()
+	for _, p := range []string{"", "orders..created", "orders.>.late", "ord*ers", "orders created"} {
+		if _, err := b.Subscribe(context.Background(), p); !errors.Is(err, ErrBadTopic) {
+			t.Errorf("Subscribe(%q): err = %v, want ErrBadTopic", p, err)
+		}
+	}
+	if err := b.Publish(context.Background(), "orders.*", 1); !errors.Is(err, ErrBadTopic) {
+		t.Errorf("Publish to a wildcard: err = %v, want ErrBadTopic", err)
+	}
+}
+
+// drain reads everything already buffered on sub without waiting.
+func drain[T any](sub *Subscription[T]) []T {
+	var out []T
+	for {
+		select {
+		case m, ok := <-sub.C():
+			if !ok {
+				return out
+			}
+			out = append(out, m.Value)
+		default:
+			return out
+		}
+	}
+}
+
+func publishN(t *testing.T, b *Broker[int], topic string, n int) {
+	t.Helper()
+	for i := range n {
+		if err := b.Publish(context.Background(), topic, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPolicies(t *testing.T) {
+	tests := []struct {
+		policy  Policy
+		want    []int
+		dropped uint64
+		err     error
+	}{
+		{DropOldest, []int{3, 4}, 3, nil},
+		{DropNewest, []int{0, 1}, 3, nil},
+		{Disconnect, []int{0, 1}, 0, ErrSlowConsumer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			b := New[int](WithBuffer(2), WithPolicy(tt.policy))
+			sub, err := b.Subscribe(context.Background(), "t")
+			if err != nil {
+				t.Fatal(err)
+			}
+			publishN(t, b, "t", 5)
+			if got := drain(sub); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if st := sub.Stats(); st.Dropped != tt.dropped {
+				t.Errorf("dropped %d, want %d", st.Dropped, tt.dropped)
+			}
+			if err := sub.Err(); err != tt.err {
+				t.Errorf("Err() = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestDisconnectClosesChannel(t *testing.T) {
+	b := New[int](WithBuffer(1), WithPolicy(Disconnect))
+	slow, _ := b.Subscribe(context.Background(), "t")
+	fast, _ := b.Subscribe(context.Background(), "t", WithBuffer(10))
+	publishN(t, b, "t", 3)
+
+	if got := drain(slow); !slices.Equal(got, []int{0}) {
+		t.Errorf("slow got %v, want [0]", got)
+	}
+	if _, ok := <-slow.C(); ok {
+		t.Error("slow subscriber's channel still open")
+	}
+	if got := drain(fast); len(got) != 3 {
+		t.Errorf("fast got %v, want all 3", got)
+	}
+	m := b.Metrics()
+	if m.Disconnected != 1 || len(m.Subscriptions) != 1 {
+		t.Errorf("metrics = %+v, want one disconnect and one subscription left", m)
+	}
+}
+
+// A Block subscriber with a full buffer holds Publish up until its
+// context ends; the other subscribers still get the value.
+func TestBlockTimeout(t *testing.T) {
+	b := New[int](WithBuffer(1))
+	stuck, _ := b.Subscribe(context.Background(), "t")
+	other, _ := b.Subscribe(context.Background(), "t", WithPolicy(DropNewest))
+	publishN(t, b, "t", 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := b.Publish(ctx, "t", 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Publish: err = %v, want DeadlineExceeded", err)
+	}
+	if got := drain(stuck); !slices.Equal(got, []int{0}) {
+		t.Errorf("stuck got %v, want [0]", got)
+	}
+	if got := drain(other); !slices.Equal(got, []int{0}) {
+		t.Errorf("other got %v, want [0] with 1 dropped", got)
+	}
+}
+
+func TestBlockWaitsForReader(t *testing.T) {
+	b := New[int](WithBuffer(0))
+	sub, _ := b.Subscribe(context.Background(), "t")
+	done := make(chan error)
+	go func() { done <- b.Publish(context.Background(), "t", 7) }()
+	select {
+	case <-done:
+		t.Fatal("Publish returned before the value was taken")
+	case <-time.After(10 * time.Millisecond):
+	}
+	if m := <-sub.C(); m.Value != 7 || m.Topic != "t" {
+		t.Errorf("got %+v", m)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	b := New[int]()
+	ctx, cancel := context.WithCancelCause(context.Background())
+	sub, _ := b.Subscribe(ctx, "orders.>")
+	if got := b.Topics(); !slices.Equal(got, []string{"orders.>"}) {
+		t.Fatalf("Topics = %v", got)
+	}
+	stop := errors.New("client went away")
+	cancel(stop)
+	<-sub.Done()
+	if _, ok := <-sub.C(); ok {
+		t.Error("channel still open")
+	}
+	if err := sub.Err(); err != stop {
+		t.Errorf("Err() = %v, want the context's cause", err)
+	}
+	if got := b.Topics(); len(got) != 0 {
+		t.Errorf("Topics after cancel = %v", got)
+	}
+	if err := b.Publish(context.Background(), "orders.created", 1); err != nil {
+		t.Fatal(err)
+	}
+	if m := b.Metrics(); m.Unmatched != 1 {
+		t.Errorf("Unmatched = %d, want 1", m.Unmatched)
+	}
+}
+
+// A Block subscriber whose context ends while Publish waits on it is
+// released at once.
+func TestContextCancelReleasesPublisher(t *testing.T) {
+	b := New[int](WithBuffer(0))
+	ctx, cancel := context.WithCancel(context.Background())
+	sub, _ := b.Subscribe(ctx, "t")
+	done := make(chan error)
+	go func() { done <- b.Publish(context.Background(), "t", 1) }()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Publish: err = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Publish still blocked after the subscriber went away")
+	}
+	if !errors.Is(sub.Err(), context.Canceled) {
+		t.Errorf("Err() = %v, want context.Canceled", sub.Err())
+	}
+}
+
+func TestClose(t *testing.T) {
+	b := New[int]()
+	sub, _ := b.Subscribe(context.Background(), "t")
+	b.Close()
+	b.Close()
+	if _, ok := <-sub.C(); ok || sub.Err() != ErrClosed {
+		t.Errorf("after Close: open = %v, Err() = %v", ok, sub.Err())
+	}
+	if _, err := b.Subscribe(context.Background(), "t"); err != ErrClosed {
+		t.Errorf("Subscribe: err = %v, want ErrClosed", err)
+	}
+	if err := b.Publish(context.Background(), "t", 1); err != ErrClosed {
+		t.Errorf("Publish: err = %v, want ErrClosed", err)
+	}
+}
+
+const (
+	subscribers = 2000
+	publishers  = 4
+	perPub      = 200
+)
+
+// TestManySubscribers checks that with thousands of Block subscribers and
+// several publishers at once every subscriber gets every value, each
+// publisher's values in order.
+func TestManySubscribers(t *testing.T) {
+	b := New[int](WithBuffer(8))
+	patterns := []string{"orders.created", "orders.*", "orders.>", "*.created", ">"}
+	var readers sync.WaitGroup
+	errs := make(chan error, subscribers)
+	for i := range subscribers {
+		sub, err := b.Subscribe(context.Background(), patterns[i%len(patterns)])
+		if err != nil {
+			t.Fatal(err)
+		}
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			last := make([]int, publishers)
+			for p := range last {
+				last[p] = -1
+			}
+			n := 0
+			for m := range sub.C() {
+				p, seq := m.Value/perPub, m.Value%perPub
+				if seq != last[p]+1 {
+					errs <- fmt.Errorf("subscription %d: publisher %d sent %d after %d", sub.id, p, seq, last[p])
+					return
+				}
+				last[p] = seq
+				n++
+			}
+			if n != publishers*perPub {
+				errs <- fmt.Errorf("subscription %d got %d values, want %d", sub.id, n, publishers*perPub)
+			}
+		}()
+	}
+
+	var pubs sync.WaitGroup
+	for p := range publishers {
+		pubs.Add(1)
+		go func() {
+			defer pubs.Done()
+			for i := range perPub {
+				if err := b.Publish(context.Background(), "orders.created", p*perPub+i); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	pubs.Wait()
+	b.Close()
+	readers.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if m := b.Metrics(); m.Delivered != subscribers*publishers*perPub {
+		t.Errorf("Delivered = %d, want %d", m.Delivered, subscribers*publishers*perPub)
+	}
+}
+
+// TestChurn mixes every policy across thousands of subscribers that read
+// slowly, unsubscribe or have their context cancelled while several
+// publishers run, then closes the broker under load. Run with -race.
+func TestChurn(t *testing.T) {
+	b := New[int](WithBuffer(4))
+	policies := []Policy{Block, DropOldest, DropNewest, Disconnect}
+	type result struct {
+		sub      *Subscription[int]
+		received uint64
+	}
+	results := make(chan result, subscribers)
+	var readers sync.WaitGroup
+	for i := range subscribers {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		sub, err := b.Subscribe(ctx, "orders.>", WithPolicy(policies[i%len(policies)]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			var n uint64
+			for range sub.C() {
+				n++
+				switch {
+				case i%7 == 0 && n == 50:
+					cancel()
+				case i%11 == 0 && n == 80:
+					sub.Unsubscribe()
+				case i%3 == 0:
+					time.Sleep(10 * time.Microsecond)
+				}
+			}
+			results <- result{sub, n}
+		}()
+	}
+
+	var pubs sync.WaitGroup
+	for p := range publishers {
+		pubs.Add(1)
+		go func() {
+			defer pubs.Done()
+			for i := range perPub {
+				err := b.Publish(context.Background(), fmt.Sprintf("orders.%d", p), i)
+				if errors.Is(err, ErrClosed) {
+					return
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	time.Sleep(5 * time.Millisecond)
+	b.Close()
+	pubs.Wait()
+	readers.Wait()
+	close(results)
+
+	var delivered, dropped uint64
+	for r := range results {
+		st := r.sub.Stats()
+		delivered += st.Delivered
+		dropped += st.Dropped
+		switch err := r.sub.Err(); {
+		case err == ErrClosed, err == ErrUnsubscribed, errors.Is(err, context.Canceled):
+		case err == ErrSlowConsumer && st.Policy == Disconnect:
+		default:
+			t.Errorf("subscription %d (%v) ended with %v", st.ID, st.Policy, err)
+		}
+		// every value queued was either read or evicted by DropOldest
+		want := st.Delivered
+		if st.Policy == DropOldest {
+			want -= st.Dropped
+		}
+		if r.received > want {
+			t.Errorf("subscription %d (%v) read %d values, only %d were queued", st.ID, st.Policy, r.received, want)
+		}
+		if st.Policy != DropOldest && st.Policy != DropNewest && st.Dropped != 0 {
+			t.Errorf("subscription %d (%v) dropped %d values", st.ID, st.Policy, st.Dropped)
+		}
+	}
+	m := b.Metrics()
+	if m.Delivered != delivered || m.Dropped != dropped {
+		t.Errorf("broker counted %d delivered and %d dropped, subscriptions %d and %d", m.Delivered, m.Dropped, delivered, dropped)
+	}
+	if len(m.Subscriptions) != 0 {
+		t.Errorf("%d subscriptions left after Close", len(m.Subscriptions))
+	}
+}
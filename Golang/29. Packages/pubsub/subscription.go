@@ -0,0 +1,172 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rajasur/programming-learning/GO/enum"
+)
+
+// Policy decides what Publish does when a subscription's buffer is full.
+type Policy int
+
+const (
+	Block      Policy = iota // wait for room, holding up the publisher
+	DropOldest               // discard the oldest queued value to make room
+	DropNewest               // discard the value being published
+	Disconnect               // end the subscription with ErrSlowConsumer
+)
+
+var policies = enum.New("Policy", map[Policy]string{
+	Block:      "block",
+	DropOldest: "drop_oldest",
+	DropNewest: "drop_newest",
+	Disconnect: "disconnect",
+})
+
+func (p Policy) String() string                { return policies.Name(p) }
+func (p Policy) MarshalText() ([]byte, error)  { return policies.MarshalText(p) }
+func (p *Policy) UnmarshalText(b []byte) error { return policies.UnmarshalText(b, p) }
+
+// Subscription is one subscriber's queue.
+type Subscription[T any] struct {
+	id      uint64
+	pattern string
+	p       pattern
+	policy  Policy
+	broker  *Broker[T]
+	ch      chan Message[T]
+	stop    func() bool // stops the context's AfterFunc
+
+	// sendMu serialises senders, and closing ch, for this subscription
+	sendMu sync.Mutex
+	done   chan struct{}
+	once   sync.Once
+	err    error // why it ended, set before done is closed
+
+	delivered atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+// C returns the channel values arrive on. It is closed when the
+// subscription ends.
+func (s *Subscription[T]) C() <-chan Message[T] { return s.ch }
+
+// Done is closed when the subscription ends, before C is.
+func (s *Subscription[T]) Done() <-chan struct{} { return s.done }
+
+// Err is nil while the subscription is active, and afterwards says why it
+// ended: ErrUnsubscribed, ErrSlowConsumer, ErrClosed or the context's
+// cause.
+func (s *Subscription[T]) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// Unsubscribe ends the subscription. Values still buffered can be read
+// from C until it is closed.
+func (s *Subscription[T]) Unsubscribe() { s.close(ErrUnsubscribed) }
+
+func (s *Subscription[T]) close(err error) {
+	s.once.Do(func() {
+		s.err = err
+		close(s.done)
+		// remove takes the broker lock, which Subscribe holds until stop
+		// is set
+		s.broker.remove(s)
+		s.stop()
+		s.sendMu.Lock()
+		close(s.ch)
+		s.sendMu.Unlock()
+		if err == ErrSlowConsumer {
+			s.broker.disconnected.Add(1)
+		}
+	})
+}
+
+func (s *Subscription[T]) deliver(ctx context.Context, m Message[T]) error {
+	s.sendMu.Lock()
+	select {
+	case <-s.done:
+		s.sendMu.Unlock()
+		return nil
+	default:
+	}
+
+	select {
+	case s.ch <- m:
+		s.sendMu.Unlock()
+		s.count(&s.delivered, &s.broker.delivered)
+		return nil
+	default:
+	}
+
+	switch s.policy {
+	case Block:
+		defer s.sendMu.Unlock()
+		select {
+		case s.ch <- m:
+			s.count(&s.delivered, &s.broker.delivered)
+		case <-s.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	case DropOldest:
+		defer s.sendMu.Unlock()
+		for cap(s.ch) > 0 {
+			select {
+			case <-s.ch:
+				s.count(&s.dropped, &s.broker.dropped)
+			default:
+			}
+			select {
+			case s.ch <- m:
+				s.count(&s.delivered, &s.broker.delivered)
+				return nil
+			default:
+			}
+		}
+		// unbuffered: there is nothing older to drop
+		s.count(&s.dropped, &s.broker.dropped)
+	case DropNewest:
+		s.sendMu.Unlock()
+		s.count(&s.dropped, &s.broker.dropped)
+	case Disconnect:
+		s.sendMu.Unlock()
+		s.close(ErrSlowConsumer)
+	}
+	return nil
+}
+
+func (s *Subscription[T]) count(sub, total *atomic.Uint64) {
+	sub.Add(1)
+	total.Add(1)
+}
+
+// Stats is a snapshot of one subscription.
+type Stats struct {
+	ID        uint64
+	Pattern   string
+	Policy    Policy
+	Depth     int // values waiting in the buffer
+	Capacity  int
+	Delivered uint64
+	Dropped   uint64
+}
+
+func (s *Subscription[T]) Stats() Stats {
+	return Stats{
+		ID:        s.id,
+		Pattern:   s.pattern,
+		Policy:    s.policy,
+		Depth:     len(s.ch),
+		Capacity:  cap(s.ch),
+		Delivered: s.delivered.Load(),
+		Dropped:   s.dropped.Load(),
+	}
+}
@@ -0,0 +1,64 @@
+package pubsub
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrBadTopic = errors.New("pubsub: invalid topic")
+
+// Topics are dot-separated names such as "orders.created". A subscription
+// pattern may use "*" for exactly one segment and ">" as the last segment
+// for one or more:
+//
+//	orders.*      matches orders.created, not orders.created.late
+//	orders.>      matches both
+//	*.created     matches orders.created and invoices.created
+type pattern []string
+
+func parsePattern(s string, wildcards bool) (pattern, error) {
+	if s == "" {
+		return nil, fmt.Errorf("%w: empty", ErrBadTopic)
+	}
+	p := pattern(strings.Split(s, "."))
+	for i, seg := range p {
+		switch {
+		case seg == "":
+			return nil, fmt.Errorf("%w: %q has an empty segment", ErrBadTopic, s)
+		case seg == "*" || seg == ">":
+			if !wildcards {
+				return nil, fmt.Errorf("%w: %q can't be published to, it has wildcards", ErrBadTopic, s)
+			}
+			if seg == ">" && i != len(p)-1 {
+				return nil, fmt.Errorf("%w: %q has > before the last segment", ErrBadTopic, s)
+			}
+		case strings.ContainsAny(seg, "*> \t\n"):
+			return nil, fmt.Errorf("%w: %q segment %q", ErrBadTopic, s, seg)
+		}
+	}
+	return p, nil
+}
+
+func (p pattern) literal() bool {
+	for _, seg := range p {
+		if seg == "*" || seg == ">" {
+			return false
+		}
+	}
+	return true
+}
+
+func (p pattern) match(topic []string) bool {
+	for i, seg := range p {
+		switch {
+		case seg == ">":
+			return len(topic) > i
+		case i >= len(topic):
+			return false
+		case seg != "*" && seg != topic[i]:
+			return false
+		}
+	}
+	return len(p) == len(topic)
+}
@@ -0,0 +1,344 @@
+package qrcode
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// decode reads a symbol back from its modules alone, the way a scanner
+// would once it has located it: version and format information, unmasking,
+// codeword order, de-interleaving, a Reed-Solomon syndrome check per block
+// and finally the byte-mode segment. It shares only the capacity tables
+// and GF(256) multiplication with the encoder.
+func decode(t *testing.T, c *Code) []byte {
+	t.Helper()
+	size := c.Size
+	version := (size - 17) / 4
+	if version < 1 || version > 40 || version*4+17 != size {
+		t.Fatalf("size %d is not a QR symbol", size)
+	}
+	dark := func(x, y int) bool { return c.Dark(x, y) }
+
+	if version >= 7 {
+		var got int
+		for i := 0; i < 18; i++ {
+			if dark(size-11+i%3, i/3) {
+				got |= 1 << i
+			}
+		}
+		if got>>12 != version || got != versionInfo(version) {
+			t.Fatalf("version info %018b, want %018b", got, versionInfo(version))
+		}
+	}
+
+	var format int
+	read := func(x, y, i int) {
+		if dark(x, y) {
+			format |= 1 << i
+		}
+	}
+	for i := 0; i <= 5; i++ {
+		read(8, i, i)
+	}
+	read(8, 7, 6)
+	read(8, 8, 7)
+	read(7, 8, 8)
+	for i := 9; i < 15; i++ {
+		read(14-i, 8, i)
+	}
+	level, mask := -1, -1
+	for l, lb := range formatBits {
+		for m := range 8 {
+			if formatInfo(lb, m) == format {
+				level, mask = l, m
+			}
+		}
+	}
+	if level < 0 {
+		t.Fatalf("format info %015b is not a valid codeword", format)
+	}
+	if Level(level) != c.Level || mask != c.Mask {
+		t.Fatalf("format info says %v/%d, code says %v/%d", Level(level), mask, c.Level, c.Mask)
+	}
+
+	function := functionModules(version)
+	raw := make([]byte, numRawDataModules(version)/8)
+	n := 0
+	for right := size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := range size {
+			for j := range 2 {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = size - 1 - vert
+				}
+				if function[y][x] || n >= len(raw)*8 {
+					continue
+				}
+				if dark(x, y) != masked(mask, x, y) {
+					raw[n>>3] |= 1 << (7 - n&7)
+				}
+				n++
+			}
+		}
+	}
+
+	l := Level(level)
+	numBlocks := numErrorCorrectionBlocks[l][version]
+	eccLen := eccCodewordsPerBlock[l][version]
+	shortData := len(raw)/numBlocks - eccLen
+	numShort := numBlocks - len(raw)%numBlocks
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := 0; i < shortData+1; i++ {
+		for b := range blocks {
+			if i == shortData && b < numShort {
+				continue
+			}
+			blocks[b] = append(blocks[b], raw[k])
+			k++
+		}
+	}
+	for range eccLen {
+		for b := range blocks {
+			blocks[b] = append(blocks[b], raw[k])
+			k++
+		}
+	}
+
+	var data []byte
+	for b, blk := range blocks {
+		var alpha byte = 1
+		for i := range eccLen {
+			var s byte
+			for _, cw := range blk {
+				s = gfMul(s, alpha) ^ cw
+			}
+			if s != 0 {
+				t.Fatalf("block %d: syndrome %d is %#x, want 0", b, i, s)
+			}
+			alpha = gfMul(alpha, 2)
+		}
+		data = append(data, blk[:len(blk)-eccLen]...)
+	}
+
+	r := bitReader{data: data}
+	if mode := r.read(4); mode != 0b0100 {
+		t.Fatalf("mode %04b, want byte mode", mode)
+	}
+	count := r.read(8)
+	if version > 9 {
+		count = count<<8 | r.read(8)
+	}
+	out := make([]byte, count)
+	for i := range out {
+		out[i] = byte(r.read(8))
+	}
+	return out
+}
+
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *bitReader) read(n int) int {
+	v := 0
+	for range n {
+		v = v<<1 | int(r.data[r.pos>>3]>>(7-r.pos&7)&1)
+		r.pos++
+	}
+	return v
+}
+
+func formatInfo(levelBits, mask int) int {
+	data := levelBits<<3 | mask
+	rem := data
+	for range 10 {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+func versionInfo(v int) int {
+	rem := v
+	for range 12 {
+		rem = rem<<1 ^ (rem>>11)*0x1f25
+	}
+	return v<<12 | rem
+}
+
+func masked(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+// functionModules marks finders with their separators and format areas,
+// timing patterns, alignment patterns and version blocks.
+func functionModules(version int) [][]bool {
+	size := version*4 + 17
+	f := make([][]bool, size)
+	for i := range f {
+		f[i] = make([]bool, size)
+	}
+	fill := func(x0, y0, w, h int) {
+		for y := y0; y < y0+h; y++ {
+			for x := x0; x < x0+w; x++ {
+				f[y][x] = true
+			}
+		}
+	}
+	fill(0, 0, 9, 9)
+	fill(size-8, 0, 8, 9)
+	fill(0, size-8, 9, 8)
+	fill(6, 0, 1, size)
+	fill(0, 6, size, 1)
+	pos := alignmentPositions(version)
+	for _, ay := range pos {
+		for _, ax := range pos {
+			if ax < 9 && (ay < 9 || ay > size-9) || ax > size-9 && ay < 9 {
+				continue // a finder is there
+			}
+			fill(ax-2, ay-2, 5, 5)
+		}
+	}
+	if version >= 7 {
+		fill(size-11, 0, 3, 6)
+		fill(0, size-11, 6, 3)
+	}
+	return f
+}
+
+// Reference values from the format and version information tables of
+// ISO/IEC 18004 annex C.
+func TestFormatAndVersionInfo(t *testing.T) {
+	for _, tc := range []struct {
+		level Level
+		mask  int
+		want  string
+	}{
+		{Low, 0, "111011111000100"},
+		{Medium, 0, "101010000010010"},
+		{Medium, 5, "100000011001110"},
+		{Quartile, 7, "010101111101101"},
+		{High, 3, "001100111010000"},
+	} {
+		if got := fmt.Sprintf("%015b", formatInfo(formatBits[tc.level], tc.mask)); got != tc.want {
+			t.Errorf("format %v/%d = %s, want %s", tc.level, tc.mask, got, tc.want)
+		}
+	}
+	for v, want := range map[int]int{7: 0x07c94, 10: 0x0a4d3, 40: 0x28c69} {
+		if got := versionInfo(v); got != want {
+			t.Errorf("version %d info = %#05x, want %#05x", v, got, want)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	payloads := []string{
+		"",
+		"A",
+		"upi://pay?pa=raja@okaxis&pn=Raja%20Sur&am=499.00&cu=INR",
+		strings.Repeat("0123456789abcdef", 12), // version >= 7 at every level
+		strings.Repeat("x", 400),               // 16-bit length field
+		string(bytes.Repeat([]byte{0, 0xff, 0x80}, 50)),
+	}
+	for _, p := range payloads {
+		for l := Low; l <= High; l++ {
+			c, err := EncodeString(p, l)
+			if err != nil {
+				t.Fatalf("%v %.20q: %v", l, p, err)
+			}
+			if got := string(decode(t, c)); got != p {
+				t.Errorf("v%d-%v: decoded %.40q, want %.40q", c.Version, l, got, p)
+			}
+		}
+	}
+}
+
+func TestSmallestVersion(t *testing.T) {
+	// byte mode capacities at level M from the standard's capacity table
+	for _, tc := range []struct{ n, version int }{{14, 1}, {15, 2}, {26, 2}, {27, 3}, {180, 9}, {181, 10}, {213, 10}, {214, 11}, {2331, 40}} {
+		c, err := Encode(make([]byte, tc.n), Medium)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Version != tc.version {
+			t.Errorf("%d bytes: version %d, want %d", tc.n, c.Version, tc.version)
+		}
+	}
+	if _, err := Encode(make([]byte, 2332), Medium); err != ErrTooLong {
+		t.Errorf("2332 bytes at M: err = %v, want ErrTooLong", err)
+	}
+}
+
+func TestRender(t *testing.T) {
+	c, err := EncodeString("hello", Medium)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := c.WritePNG(&buf, 3); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	quiet := (img.Bounds().Dx()/3 - c.Size) / 2
+	for y := range c.Size {
+		for x := range c.Size {
+			r, _, _, _ := img.At((x+quiet)*3+1, (y+quiet)*3+1).RGBA()
+			if (r == 0) != c.Dark(x, y) {
+				t.Fatalf("pixel for module (%d,%d) doesn't match", x, y)
+			}
+		}
+	}
+
+	lines := strings.Split(strings.TrimRight(c.Terminal(false), "\n"), "\n")
+	if want := (c.Size + 2*quiet + 1) / 2; len(lines) != want {
+		t.Errorf("terminal art has %d lines, want %d", len(lines), want)
+	}
+}
+
+func TestEveryVersion(t *testing.T) {
+	for v := 1; v <= 40; v++ {
+		// the longest payload that still fits v at level Q
+		n := numDataCodewords(v, Quartile) - 2
+		if v > 9 {
+			n--
+		}
+		data := bytes.Repeat([]byte{byte(v)}, n)
+		c, err := Encode(data, Quartile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Version != v {
+			t.Fatalf("%d bytes: version %d, want %d", n, c.Version, v)
+		}
+		if got := decode(t, c); !bytes.Equal(got, data) {
+			t.Errorf("version %d doesn't round-trip", v)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package qrcode
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+)
+
+// QuietZone is the light border, in modules, required around a symbol.
+const QuietZone = 4
+
+// Image draws the symbol with each module as a scale x scale square and a
+// quiet zone around it.
+func (c *Code) Image(scale int) image.Image {
+	if scale < 1 {
+		scale = 1
+	}
+	side := (c.Size + 2*QuietZone) * scale
+	img := image.NewPaletted(image.Rect(0, 0, side, side), color.Palette{color.White, color.Black})
+
+	for py := 0; py < side; py++ {
+		for px := 0; px < side; px++ {
+			if c.Dark(px/scale-QuietZone, py/scale-QuietZone) {
+				img.SetColorIndex(px, py, 1)
+			}
+		}
+	}
+	return img
+}
+
+// WritePNG writes the symbol as a PNG image.
+func (c *Code) WritePNG(w io.Writer, scale int) error {
+	return png.Encode(w, c.Image(scale))
+}
+
+// Terminal renders the symbol with Unicode half blocks, two module rows per
+// line of text. By default dark modules are drawn as blocks, which suits a
+// light background; set invert for terminals with a dark background.
+func (c *Code) Terminal(invert bool) string {
+	dark := func(x, y int) bool {
+		return c.Dark(x, y) != invert
+	}
+
+	var sb strings.Builder
+	end := c.Size + QuietZone
+	for y := -QuietZone; y < end; y += 2 {
+		for x := -QuietZone; x < end; x++ {
+			// an odd number of rows leaves the last bottom half empty
+			top, bottom := dark(x, y), y+1 < end && dark(x, y+1)
+			switch {
+			case top && bottom:
+				sb.WriteString("█")
+			case top:
+				sb.WriteString("▀")
+			case bottom:
+				sb.WriteString("▄")
+			default:
+				sb.WriteString(" ")
+			}
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
@@ -0,0 +1,59 @@
+package qrcode
+
+// Error correction codewords per block, indexed by [level][version].
+// Index 0 is unused so that versions can be used directly.
+var eccCodewordsPerBlock = [4][41]int{
+	Low:      {-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	Medium:   {-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	Quartile: {-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	High:     {-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+// Number of error correction blocks, indexed by [level][version].
+var numErrorCorrectionBlocks = [4][41]int{
+	Low:      {-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	Medium:   {-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	Quartile: {-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	High:     {-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+// numRawDataModules returns the number of modules that can hold data bits
+// (including error correction and remainder bits) in a symbol of version v.
+func numRawDataModules(v int) int {
+	n := (16*v+128)*v + 64
+	if v >= 2 {
+		align := v/7 + 2
+		n -= (25*align-10)*align - 55
+		if v >= 7 {
+			n -= 36
+		}
+	}
+	return n
+}
+
+// numDataCodewords returns how many 8-bit data codewords fit in version v at
+// level l once error correction is taken out.
+func numDataCodewords(v int, l Level) int {
+	return numRawDataModules(v)/8 - eccCodewordsPerBlock[l][v]*numErrorCorrectionBlocks[l][v]
+}
+
+// alignmentPositions returns the centre coordinates used on each axis for
+// the alignment patterns of version v.
+func alignmentPositions(v int) []int {
+	if v == 1 {
+		return nil
+	}
+	count := v/7 + 2
+	var step int
+	if v == 32 {
+		step = 26
+	} else {
+		step = (v*4 + count*2 + 1) / (count*2 - 2) * 2
+	}
+	pos := make([]int, count)
+	pos[0] = 6
+	for i, p := count-1, v*4+10; i >= 1; i, p = i-1, p-step {
+		pos[i] = p
+	}
+	return pos
+}
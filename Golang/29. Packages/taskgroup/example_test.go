@@ -0,0 +1,79 @@
+package taskgroup_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rajasur/programming-learning/GO/taskgroup"
+)
+
+// The goroutines lesson (24. Goroutines) starts a goroutine per task and
+// sleeps, hoping they are done. Wait makes that a promise.
+func Example() {
+	g := taskgroup.New(context.Background())
+	for i := 0; i <= 10; i++ {
+		g.Go(func(ctx context.Context) error {
+			fmt.Println("doing task", i)
+			return nil
+		})
+	}
+	g.Wait()
+	// Unordered output:
+	// doing task 0
+	// doing task 1
+	// doing task 2
+	// doing task 3
+	// doing task 4
+	// doing task 5
+	// doing task 6
+	// doing task 7
+	// doing task 8
+	// doing task 9
+	// doing task 10
+}
+
+// The wait group lesson (25. Wait groups), with the Add and Done
+// bookkeeping done by the group and at most four tasks running at once.
+func ExampleWithLimit() {
+	task := func(id int) {
+		fmt.Println("doing task", id)
+	}
+
+	g := taskgroup.New(context.Background(), taskgroup.WithLimit(4))
+	for i := 0; i <= 10; i++ {
+		g.Go(func(ctx context.Context) error {
+			task(i)
+			return nil
+		})
+	}
+	g.Wait()
+	// Unordered output:
+	// doing task 0
+	// doing task 1
+	// doing task 2
+	// doing task 3
+	// doing task 4
+	// doing task 5
+	// doing task 6
+	// doing task 7
+	// doing task 8
+	// doing task 9
+	// doing task 10
+}
+
+// Tasks that fail are reported together, in the order they were added.
+func ExampleGroup_Wait() {
+	g := taskgroup.New(context.Background())
+	for _, id := range []string{"a", "b", "c"} {
+		g.GoNamed(id, func(ctx context.Context) error {
+			if id == "b" {
+				return errors.New("out of stock")
+			}
+			return nil
+		})
+	}
+	fmt.Println(g.Wait())
+	// Output:
+	// task b: out of stock
+}
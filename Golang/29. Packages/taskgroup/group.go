@@ -0,0 +1,282 @@
+// Package taskgroup runs functions concurrently with a limit and collects
+// their errors, so a caller waits for work to finish instead of sleeping
+// and guessing.
+//
+// The wait group lesson, with errors:
+//
+//	g := taskgroup.New(ctx, taskgroup.WithLimit(4))
+//	for i := 0; i <= 10; i++ {
+//		g.Go(func(ctx context.Context) error {
+//			return task(ctx, i)
+//		})
+//	}
+//	if err := g.Wait(); err != nil {
+//		log.Fatal(err) // every failed task, each with its name
+//	}
+//
+// By default every task runs and Wait joins all their errors. WithFailFast
+// cancels the rest after the first failure and returns only that one.
+package taskgroup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"time"
+)
+
+var (
+	ErrSkipped = errors.New("taskgroup: not started, the group was cancelled")
+	errDone    = errors.New("taskgroup: group is done")
+)
+
+// TaskError is a failed task.
+type TaskError struct {
+	Task string
+	Err  error
+}
+
+func (e *TaskError) Error() string { return fmt.Sprintf("task %s: %v", e.Task, e.Err) }
+
+func (e *TaskError) Unwrap() error { return e.Err }
+
+// PanicError is a recovered panic.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v\n\n%s", e.Value, e.Stack)
+}
+
+// Unwrap returns the panic value if it was an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// Progress counts the tasks of a group. Queued tasks are waiting for a
+// free slot.
+type Progress struct {
+	Total     int
+	Queued    int
+	Running   int
+	Succeeded int
+	Failed    int
+	Skipped   int
+}
+
+// Finished is the number of tasks that are no longer queued or running.
+func (p Progress) Finished() int { return p.Succeeded + p.Failed + p.Skipped }
+
+type Group struct {
+	parent     context.Context
+	ctx        context.Context
+	cancel     context.CancelCauseFunc
+	limit      int
+	failFast   bool
+	timeout    time.Duration
+	onProgress func(Progress)
+
+	sem chan struct{}
+	wg  sync.WaitGroup
+
+	mu       sync.Mutex
+	progress Progress
+	errs     []indexedError
+	first    error // first failure, for WithFailFast
+
+	// reportMu keeps progress callbacks in order
+	reportMu sync.Mutex
+}
+
+type indexedError struct {
+	i   int
+	err error
+}
+
+type Option func(*Group)
+
+// WithLimit runs at most n tasks at once; Go blocks while the group is
+// full. 0, the default, means no limit.
+func WithLimit(n int) Option {
+	return func(g *Group) { g.limit = max(n, 0) }
+}
+
+// WithFailFast cancels the group's context when a task fails. Tasks not
+// yet started are skipped and Wait returns only the first error.
+func WithFailFast() Option {
+	return func(g *Group) { g.failFast = true }
+}
+
+// WithTimeout gives every task its own deadline.
+func WithTimeout(d time.Duration) Option {
+	return func(g *Group) { g.timeout = d }
+}
+
+// WithProgress calls fn after each task is added, starts or finishes. Calls
+// are made one at a time, in order, from the goroutine that made the
+// change, so fn should be quick.
+func WithProgress(fn func(Progress)) Option {
+	return func(g *Group) { g.onProgress = fn }
+}
+
+// New creates a group whose tasks run with a context derived from ctx.
+func New(ctx context.Context, opts ...Option) *Group {
+	g := &Group{parent: ctx}
+	for _, opt := range opts {
+		opt(g)
+	}
+	g.ctx, g.cancel = context.WithCancelCause(ctx)
+	if g.limit > 0 {
+		g.sem = make(chan struct{}, g.limit)
+	}
+	return g
+}
+
+// Context is cancelled when the parent is, when a task fails under
+// WithFailFast, and once Wait returns.
+func (g *Group) Context() context.Context { return g.ctx }
+
+// Go runs fn on a new goroutine, named by its position in the group.
+func (g *Group) Go(fn func(ctx context.Context) error) {
+	g.GoNamed("", fn)
+}
+
+// GoNamed runs fn on a new goroutine, naming it in errors. It blocks while
+// the group is at its limit; if the group is cancelled meanwhile, fn is not
+// run and counts as skipped.
+func (g *Group) GoNamed(name string, fn func(ctx context.Context) error) {
+	g.mu.Lock()
+	i := g.progress.Total
+	g.progress.Total++
+	g.progress.Queued++
+	g.mu.Unlock()
+	if name == "" {
+		name = fmt.Sprint(i)
+	}
+	g.report()
+
+	if g.sem != nil {
+		select {
+		case g.sem <- struct{}{}:
+		case <-g.ctx.Done():
+			g.skip(i, name)
+			return
+		}
+	}
+	if g.ctx.Err() != nil {
+		g.release()
+		g.skip(i, name)
+		return
+	}
+
+	g.update(func(p *Progress) { p.Queued--; p.Running++ })
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer g.release()
+		err := g.call(fn)
+		g.mu.Lock()
+		g.progress.Running--
+		if err != nil {
+			g.progress.Failed++
+			err = &TaskError{Task: name, Err: err}
+			g.errs = append(g.errs, indexedError{i, err})
+			if g.first == nil {
+				g.first = err
+			}
+		} else {
+			g.progress.Succeeded++
+		}
+		g.mu.Unlock()
+		if err != nil && g.failFast {
+			g.cancel(g.first)
+		}
+		g.report()
+	}()
+}
+
+func (g *Group) call(fn func(context.Context) error) (err error) {
+	ctx := g.ctx
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return fn(ctx)
+}
+
+func (g *Group) release() {
+	if g.sem != nil {
+		<-g.sem
+	}
+}
+
+func (g *Group) skip(i int, name string) {
+	g.mu.Lock()
+	g.progress.Queued--
+	g.progress.Skipped++
+	g.errs = append(g.errs, indexedError{i, &TaskError{Task: name, Err: ErrSkipped}})
+	g.mu.Unlock()
+	g.report()
+}
+
+func (g *Group) update(fn func(*Progress)) {
+	g.mu.Lock()
+	fn(&g.progress)
+	g.mu.Unlock()
+	g.report()
+}
+
+func (g *Group) report() {
+	if g.onProgress == nil {
+		return
+	}
+	g.reportMu.Lock()
+	defer g.reportMu.Unlock()
+	g.onProgress(g.Progress())
+}
+
+// Progress returns the current counts.
+func (g *Group) Progress() Progress {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.progress
+}
+
+// Wait waits for every started task. Without WithFailFast it returns the
+// errors of all failed and skipped tasks joined, in the order the tasks
+// were added. With it, the first failure, or the parent context's error if
+// that ended the group.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	defer g.cancel(errDone)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.failFast {
+		if g.first != nil {
+			return g.first
+		}
+		if g.parent.Err() != nil {
+			return context.Cause(g.parent)
+		}
+		return nil
+	}
+	slices.SortFunc(g.errs, func(a, b indexedError) int { return a.i - b.i })
+	errs := make([]error, len(g.errs))
+	for i, e := range g.errs {
+		errs[i] = e.err
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,203 @@
+package taskgroup
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errBoom = errors.New("boom")
+
+func TestWaitJoinsErrorsInOrder(t *testing.T) {
+	g := New(context.Background())
+	for i := range 5 {
+		g.Go(func(ctx context.Context) error {
+			// finish in reverse so the join has to sort
+			time.Sleep(time.Duration(5-i) * time.Millisecond)
+			if i%2 == 1 {
+				return errBoom
+			}
+			return nil
+		})
+	}
+	err := g.Wait()
+	if err == nil || err.Error() != "task 1: boom\ntask 3: boom" {
+		t.Fatalf("Wait = %q", err)
+	}
+	if !errors.Is(err, errBoom) {
+		t.Error("joined error does not wrap the task errors")
+	}
+	if p := g.Progress(); p.Total != 5 || p.Succeeded != 3 || p.Failed != 2 {
+		t.Errorf("progress = %+v", p)
+	}
+	if g.Context().Err() == nil {
+		t.Error("context still live after Wait")
+	}
+}
+
+func TestFailFast(t *testing.T) {
+	g := New(context.Background(), WithFailFast(), WithLimit(1))
+	var ran atomic.Int64
+	g.GoNamed("first", func(ctx context.Context) error {
+		ran.Add(1)
+		return errBoom
+	})
+	// with a limit of one, these wait for the first to finish and then
+	// find the group cancelled
+	for range 3 {
+		g.Go(func(ctx context.Context) error {
+			ran.Add(1)
+			return nil
+		})
+	}
+	err := g.Wait()
+	var te *TaskError
+	if !errors.As(err, &te) || te.Task != "first" || !errors.Is(err, errBoom) {
+		t.Fatalf("Wait = %v, want only the first failure", err)
+	}
+	if n := ran.Load(); n != 1 {
+		t.Errorf("%d tasks ran, want 1", n)
+	}
+	if p := g.Progress(); p.Skipped != 3 {
+		t.Errorf("progress = %+v, want 3 skipped", p)
+	}
+	if !errors.Is(context.Cause(g.Context()), errBoom) {
+		t.Errorf("cause = %v, want the failure", context.Cause(g.Context()))
+	}
+}
+
+// Under WithFailFast a failure cancels the context of tasks already
+// running.
+func TestFailFastCancelsRunning(t *testing.T) {
+	g := New(context.Background(), WithFailFast())
+	started := make(chan struct{})
+	g.GoNamed("slow", func(ctx context.Context) error {
+		close(started)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(5 * time.Second):
+			return errors.New("not cancelled")
+		}
+	})
+	<-started
+	g.GoNamed("bad", func(ctx context.Context) error { return errBoom })
+	if err := g.Wait(); !errors.Is(err, errBoom) {
+		t.Fatalf("Wait = %v, want boom", err)
+	}
+	if p := g.Progress(); p.Failed != 2 {
+		t.Errorf("progress = %+v, want the slow task failed too", p)
+	}
+}
+
+func TestFailFastParentCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	g := New(ctx, WithFailFast())
+	stop := errors.New("shutting down")
+	cancel(stop)
+	g.Go(func(ctx context.Context) error { return nil })
+	if err := g.Wait(); err != stop {
+		t.Fatalf("Wait = %v, want the parent's cause", err)
+	}
+}
+
+func TestPanic(t *testing.T) {
+	g := New(context.Background())
+	g.GoNamed("bad", func(ctx context.Context) error {
+		var m map[string]int
+		m["x"] = 1
+		return nil
+	})
+	g.GoNamed("oops", func(ctx context.Context) error { panic(errBoom) })
+	g.GoNamed("fine", func(ctx context.Context) error { return nil })
+	err := g.Wait()
+
+	var pe *PanicError
+	if !errors.As(err, &pe) {
+		t.Fatalf("Wait = %v, want a PanicError", err)
+	}
+	if !strings.Contains(pe.Error(), "assignment to entry in nil map") || !strings.Contains(string(pe.Stack), "TestPanic") {
+		t.Errorf("panic = %v, want the value and a stack naming the test", pe)
+	}
+	if !errors.Is(err, errBoom) {
+		t.Error("a panic with an error value does not unwrap to it")
+	}
+	if p := g.Progress(); p.Failed != 2 || p.Succeeded != 1 {
+		t.Errorf("progress = %+v", p)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	g := New(context.Background(), WithTimeout(20*time.Millisecond))
+	g.GoNamed("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	g.GoNamed("quick", func(ctx context.Context) error {
+		if _, ok := ctx.Deadline(); !ok {
+			return errors.New("no deadline")
+		}
+		return nil
+	})
+	err := g.Wait()
+	var te *TaskError
+	if !errors.As(err, &te) || te.Task != "slow" || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait = %v, want slow to time out", err)
+	}
+	// each task has its own deadline; the group goes on
+	if p := g.Progress(); p.Failed != 1 || p.Succeeded != 1 {
+		t.Errorf("progress = %+v", p)
+	}
+}
+
+func TestLimit(t *testing.T) {
+	g := New(context.Background(), WithLimit(3))
+	var running, peak atomic.Int64
+	for range 20 {
+		g.Go(func(ctx context.Context) error {
+			n := running.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			running.Add(-1)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if p := peak.Load(); p > 3 {
+		t.Errorf("%d tasks ran at once, limit is 3", p)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	var mu sync.Mutex
+	var seen []Progress
+	g := New(context.Background(), WithProgress(func(p Progress) {
+		mu.Lock()
+		seen = append(seen, p)
+		mu.Unlock()
+	}))
+	for range 4 {
+		g.Go(func(ctx context.Context) error { return nil })
+	}
+	g.Wait()
+	last := seen[len(seen)-1]
+	if last.Total != 4 || last.Finished() != 4 || last.Queued != 0 || last.Running != 0 {
+		t.Errorf("last progress = %+v", last)
+	}
+	for i := 1; i < len(seen); i++ {
+		if seen[i].Finished() < seen[i-1].Finished() {
+			t.Fatalf("progress went backwards: %+v then %+v", seen[i-1], seen[i])
+		}
+	}
+}